@@ -1,6 +1,10 @@
 package cfg
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"time"
+)
 
 type Cfg struct {
 	Env                       string
@@ -8,15 +12,255 @@ type Cfg struct {
 	OSRApiKey                 string
 	DatabaseConnectionPoolUrl string
 	FirebaseProjectId         string
+
+	// Distance in meters a driver can be from the planned route before a deviation is raised
+	DeviationThresholdMeters float64
+	// A vehicle is stationary if it has not moved more than StationaryRadiusMeters within StationaryDuration
+	StationaryRadiusMeters float64
+	StationaryDuration     time.Duration
+	RerouteOnDeviation     bool
+
+	PickupGeofenceRadiusMeters float64
+	FreeWaitingTime            time.Duration
+	FreeWaitingCheckInterval   time.Duration
+	// Charged per started minute of waiting after the free waiting time, in minor units of the base currency
+	WaitingFeePerMinute int
+	// Largest extra, like a cleaning fee, a driver can log on a ride, in minor units of the base currency
+	RideExtraMax    int
+	RideExtraWindow time.Duration
+
+	RideRequestTTL            time.Duration
+	RideRequestExpiryInterval time.Duration
+
+	MaxRideStops int
+
+	// How often directions stored in an older version are migrated
+	DirectionsMigrationInterval time.Duration
+
+	DriverInactivityTimeout       time.Duration
+	DriverInactivityCheckInterval time.Duration
+
+	// Directory of the local blob store
+	BlobStoreDir                 string
+	DriverDocumentReminderLead   time.Duration
+	DriverDocumentExpiryInterval time.Duration
+
+	RatingWindow                time.Duration
+	RatingRollingWindow         int
+	DriverRatingAlertThreshold  float64
+	DriverRatingAlertMinRatings int
+
+	PoolMaxDetour         time.Duration
+	PoolSeatCapacity      int
+	PoolMatchWindow       time.Duration
+	PoolMatchRadiusMeters float64
+	PoolMatchInterval     time.Duration
+	PooledDiscount        float64
+
+	TipWindow time.Duration
+	TipMin    int
+	TipMax    int
+
+	LedgerCheckInterval time.Duration
+
+	// Payment provider, "fake" or "stripe". The fake provider accepts any card, so it is only the default in development
+	PaymentProvider            string
+	StripeSecretKey            string
+	StripeWebhookSecret        string
+	FakeWebhookSecret          string
+	PaymentAuthorisationBuffer float64
+
+	// Currency of reports, fees and limits are configured in minor units of it
+	BaseCurrency string
+	// Optional JSON file of fx rates against the base currency, loaded at startup
+	FxRatesFile string
+
+	// SMTP server receipts and invoices are mailed through. Mails are logged if no host is set
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	MailFrom     string
+	// How often business riders are checked for monthly invoices of the previous month
+	MonthlyInvoiceInterval time.Duration
+
+	// Maximum amount support agents and admins can refund on a ride, in minor units
+	RefundLimitSupport int
+	RefundLimitAdmin   int
+
+	// Share of the fare taken as commission in cities and vehicle classes without a configured rate
+	CommissionRate float64
+
+	// Smallest driver balance paid out, in minor units of the base currency
+	PayoutMinAmount     int
+	PayoutBatchInterval time.Duration
+	// Account payouts are sent from, written in SEPA exports
+	PayoutDebtorName string
+	PayoutDebtorIBAN string
+	PayoutDebtorBIC  string
+
+	// Wallet credit given to the referrer and the referred user on the referred user's first ride, in minor units of the base currency
+	ReferralReferrerReward int
+	ReferralRefereeReward  int
+	// How often pending referrals are checked for a finished ride, in case the ride finished event was lost
+	ReferralSweepInterval time.Duration
+
+	ScheduledRideMaxAhead           time.Duration
+	ScheduledRideReleaseLeadTime    time.Duration
+	ScheduledRideRiderReminderLead  time.Duration
+	ScheduledRideDriverReminderLead time.Duration
+	ScheduledRidesInterval          time.Duration
+
+	RiderCancellationGracePeriod time.Duration
+	RiderLateCancellationFee     int
+	RiderNoShowFee               int
+	DriverMaxCancellations       int
+	DriverCancellationWindow     time.Duration
+	DriverCancellationCooldown   time.Duration
+	DriverCancellationPenaltyFee int
 }
 
 func NewConfig() *Cfg {
+	env := os.Getenv("ENV")
+	defaultPaymentProvider := "stripe"
+	if env == "dev" {
+		defaultPaymentProvider = "fake"
+	}
 	cfg := &Cfg{
-		Env:                       os.Getenv("ENV"),
+		Env:                       env,
 		Port:                      os.Getenv("PORT"),
 		OSRApiKey:                 os.Getenv("OSR_API_KEY"),
 		DatabaseConnectionPoolUrl: os.Getenv("DATABASE_CONNECTION_POOL_URL"),
 		FirebaseProjectId:         os.Getenv("FIREBASE_PROJECT_ID"),
+
+		DeviationThresholdMeters: getEnvFloat("DEVIATION_THRESHOLD_METERS", 150),
+		StationaryRadiusMeters:   getEnvFloat("STATIONARY_RADIUS_METERS", 25),
+		StationaryDuration:       getEnvDuration("STATIONARY_DURATION", 5*time.Minute),
+		RerouteOnDeviation:       getEnvBool("REROUTE_ON_DEVIATION", false),
+
+		PickupGeofenceRadiusMeters: getEnvFloat("PICKUP_GEOFENCE_RADIUS_METERS", 50),
+		FreeWaitingTime:            getEnvDuration("FREE_WAITING_TIME", 3*time.Minute),
+		FreeWaitingCheckInterval:   getEnvDuration("FREE_WAITING_CHECK_INTERVAL", 15*time.Second),
+		WaitingFeePerMinute:        getEnvInt("WAITING_FEE_PER_MINUTE", 50),
+		RideExtraMax:               getEnvInt("RIDE_EXTRA_MAX", 10000),
+		RideExtraWindow:            getEnvDuration("RIDE_EXTRA_WINDOW", 24*time.Hour),
+
+		RideRequestTTL:            getEnvDuration("RIDE_REQUEST_TTL", 15*time.Minute),
+		RideRequestExpiryInterval: getEnvDuration("RIDE_REQUEST_EXPIRY_INTERVAL", time.Minute),
+
+		MaxRideStops: getEnvInt("MAX_RIDE_STOPS", 3),
+
+		DirectionsMigrationInterval: getEnvDuration("DIRECTIONS_MIGRATION_INTERVAL", time.Hour),
+
+		DriverInactivityTimeout:       getEnvDuration("DRIVER_INACTIVITY_TIMEOUT", 10*time.Minute),
+		DriverInactivityCheckInterval: getEnvDuration("DRIVER_INACTIVITY_CHECK_INTERVAL", time.Minute),
+
+		BlobStoreDir:                 getEnvString("BLOB_STORE_DIR", "./data/blobs"),
+		DriverDocumentReminderLead:   getEnvDuration("DRIVER_DOCUMENT_REMINDER_LEAD", 14*24*time.Hour),
+		DriverDocumentExpiryInterval: getEnvDuration("DRIVER_DOCUMENT_EXPIRY_INTERVAL", time.Hour),
+
+		RatingWindow:                getEnvDuration("RATING_WINDOW", 72*time.Hour),
+		RatingRollingWindow:         getEnvInt("RATING_ROLLING_WINDOW", 100),
+		DriverRatingAlertThreshold:  getEnvFloat("DRIVER_RATING_ALERT_THRESHOLD", 4.5),
+		DriverRatingAlertMinRatings: getEnvInt("DRIVER_RATING_ALERT_MIN_RATINGS", 10),
+
+		PoolMaxDetour:         getEnvDuration("POOL_MAX_DETOUR", 10*time.Minute),
+		PoolSeatCapacity:      getEnvInt("POOL_SEAT_CAPACITY", 3),
+		PoolMatchWindow:       getEnvDuration("POOL_MATCH_WINDOW", 10*time.Minute),
+		PoolMatchRadiusMeters: getEnvFloat("POOL_MATCH_RADIUS_METERS", 2000),
+		PoolMatchInterval:     getEnvDuration("POOL_MATCH_INTERVAL", 30*time.Second),
+		PooledDiscount:        getEnvFloat("POOLED_DISCOUNT", 0.25),
+
+		TipWindow: getEnvDuration("TIP_WINDOW", 24*time.Hour),
+		TipMin:    getEnvInt("TIP_MIN", 100),
+		TipMax:    getEnvInt("TIP_MAX", 10000),
+
+		LedgerCheckInterval: getEnvDuration("LEDGER_CHECK_INTERVAL", time.Hour),
+
+		PaymentProvider:            getEnvString("PAYMENT_PROVIDER", defaultPaymentProvider),
+		StripeSecretKey:            os.Getenv("STRIPE_SECRET_KEY"),
+		StripeWebhookSecret:        os.Getenv("STRIPE_WEBHOOK_SECRET"),
+		FakeWebhookSecret:          os.Getenv("FAKE_PAYMENT_WEBHOOK_SECRET"),
+		PaymentAuthorisationBuffer: getEnvFloat("PAYMENT_AUTHORISATION_BUFFER", 0.25),
+
+		BaseCurrency: getEnvString("BASE_CURRENCY", "EUR"),
+		FxRatesFile:  os.Getenv("FX_RATES_FILE"),
+
+		SMTPHost:               os.Getenv("SMTP_HOST"),
+		SMTPPort:               getEnvInt("SMTP_PORT", 587),
+		SMTPUsername:           os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:           os.Getenv("SMTP_PASSWORD"),
+		MailFrom:               getEnvString("MAIL_FROM", "receipts@uber-clone.local"),
+		MonthlyInvoiceInterval: getEnvDuration("MONTHLY_INVOICE_INTERVAL", time.Hour),
+
+		RefundLimitSupport: getEnvInt("REFUND_LIMIT_SUPPORT", 2500),
+		RefundLimitAdmin:   getEnvInt("REFUND_LIMIT_ADMIN", 50000),
+
+		CommissionRate: getEnvFloat("COMMISSION_RATE", 0.25),
+
+		PayoutMinAmount:     getEnvInt("PAYOUT_MIN_AMOUNT", 1000),
+		PayoutBatchInterval: getEnvDuration("PAYOUT_BATCH_INTERVAL", 24*time.Hour),
+		PayoutDebtorName:    getEnvString("PAYOUT_DEBTOR_NAME", "Uber Clone ApS"),
+		PayoutDebtorIBAN:    os.Getenv("PAYOUT_DEBTOR_IBAN"),
+		PayoutDebtorBIC:     os.Getenv("PAYOUT_DEBTOR_BIC"),
+
+		ReferralReferrerReward: getEnvInt("REFERRAL_REFERRER_REWARD", 1000),
+		ReferralRefereeReward:  getEnvInt("REFERRAL_REFEREE_REWARD", 1000),
+		ReferralSweepInterval:  getEnvDuration("REFERRAL_SWEEP_INTERVAL", 10*time.Minute),
+
+		ScheduledRideMaxAhead:           getEnvDuration("SCHEDULED_RIDE_MAX_AHEAD", 7*24*time.Hour),
+		ScheduledRideReleaseLeadTime:    getEnvDuration("SCHEDULED_RIDE_RELEASE_LEAD_TIME", 30*time.Minute),
+		ScheduledRideRiderReminderLead:  getEnvDuration("SCHEDULED_RIDE_RIDER_REMINDER_LEAD", time.Hour),
+		ScheduledRideDriverReminderLead: getEnvDuration("SCHEDULED_RIDE_DRIVER_REMINDER_LEAD", 15*time.Minute),
+		ScheduledRidesInterval:          getEnvDuration("SCHEDULED_RIDES_INTERVAL", time.Minute),
+
+		RiderCancellationGracePeriod: getEnvDuration("RIDER_CANCELLATION_GRACE_PERIOD", 2*time.Minute),
+		RiderLateCancellationFee:     getEnvInt("RIDER_LATE_CANCELLATION_FEE", 500),
+		RiderNoShowFee:               getEnvInt("RIDER_NO_SHOW_FEE", 700),
+		DriverMaxCancellations:       getEnvInt("DRIVER_MAX_CANCELLATIONS", 3),
+		DriverCancellationWindow:     getEnvDuration("DRIVER_CANCELLATION_WINDOW", 24*time.Hour),
+		DriverCancellationCooldown:   getEnvDuration("DRIVER_CANCELLATION_COOLDOWN", 30*time.Minute),
+		DriverCancellationPenaltyFee: getEnvInt("DRIVER_CANCELLATION_PENALTY_FEE", 0),
 	}
 	return cfg
 }
+
+func getEnvString(key string, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
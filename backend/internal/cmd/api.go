@@ -2,12 +2,19 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"strconv"
+	"strings"
 
 	"github.com/bjarke-xyz/uber-clone-backend/internal/cfg"
 	"github.com/bjarke-xyz/uber-clone-backend/internal/cmdutil"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/infra/blobstore"
 	"github.com/bjarke-xyz/uber-clone-backend/internal/infra/http"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/infra/mailer"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/infra/paymentprovider"
 	"github.com/bjarke-xyz/uber-clone-backend/internal/infra/pubsub"
 	"github.com/bjarke-xyz/uber-clone-backend/internal/service"
 	"github.com/joho/godotenv"
@@ -33,11 +40,41 @@ func APICmd(ctx context.Context) error {
 
 	ps := pubsub.NewInMemoryPubsub()
 
-	api := http.NewAPI(ctx, logger, cfg, db, osrClient, ps)
+	blobStore, err := blobstore.NewLocalBlobStore(cfg.BlobStoreDir)
+	if err != nil {
+		return err
+	}
+
+	var paymentProvider payments.PaymentProvider
+	switch cfg.PaymentProvider {
+	case "stripe":
+		if cfg.StripeSecretKey == "" {
+			return fmt.Errorf("STRIPE_SECRET_KEY must be set to use the stripe payment provider")
+		}
+		if !strings.HasPrefix(cfg.StripeSecretKey, "sk_test_") {
+			// Simulated riders pay with test cards, which are only accepted in test mode
+			return fmt.Errorf("STRIPE_SECRET_KEY must be a test key, simulated riders pay with %v", payments.SimulatedPaymentMethodToken)
+		}
+		paymentProvider = paymentprovider.NewStripeProvider(cfg.StripeSecretKey, cfg.StripeWebhookSecret)
+	case "fake":
+		paymentProvider = paymentprovider.NewFakeProvider(cfg.FakeWebhookSecret)
+	default:
+		return fmt.Errorf("unknown payment provider %v", cfg.PaymentProvider)
+	}
+
+	var mail core.Mailer
+	if cfg.SMTPHost != "" {
+		mail = mailer.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	} else {
+		mail = mailer.NewLogMailer(logger)
+	}
+
+	api := http.NewAPI(ctx, logger, cfg, db, osrClient, ps, blobStore, paymentProvider, mail)
 	srv := api.Server(port)
 
 	go http.ServeMetrics(":9091")
 	go api.PubsubSubscribe(ctx)
+	go api.BackgroundJobs(ctx)
 	go func() {
 		_ = srv.ListenAndServe()
 	}()
@@ -0,0 +1,13 @@
+package core
+
+import (
+	"context"
+	"io"
+)
+
+// BlobStore stores files by key
+type BlobStore interface {
+	Put(ctx context.Context, key string, data io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
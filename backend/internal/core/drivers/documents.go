@@ -0,0 +1,376 @@
+package drivers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/users"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/samber/lo"
+)
+
+const (
+	TopicDocumentReviewed       = "driver-document-reviewed"
+	TopicDocumentExpiryReminder = "driver-document-expiry-reminder"
+	TopicDocumentExpired        = "driver-document-expired"
+)
+
+type DocumentType string
+
+const (
+	DocumentTypeLicence             DocumentType = "licence"
+	DocumentTypeInsurance           DocumentType = "insurance"
+	DocumentTypeVehicleRegistration DocumentType = "vehicle_registration"
+)
+
+// Documents a driver must have approved to drive
+var requiredDocumentTypes = []DocumentType{DocumentTypeLicence, DocumentTypeInsurance, DocumentTypeVehicleRegistration}
+
+var allowedDocumentContentTypes = []string{"application/pdf", "image/jpeg", "image/png"}
+
+type DocumentState int
+
+const (
+	DocumentStatePending DocumentState = iota
+	DocumentStateApproved
+	DocumentStateRejected
+	DocumentStateExpired
+)
+
+// documentTransitions are the allowed state changes of a document.
+// Rejected and expired documents are replaced by uploading a new document
+var documentTransitions = map[DocumentState][]DocumentState{
+	DocumentStatePending:  {DocumentStateApproved, DocumentStateRejected},
+	DocumentStateApproved: {DocumentStateExpired},
+}
+
+func canTransition(from DocumentState, to DocumentState) bool {
+	return slices.Contains(documentTransitions[from], to)
+}
+
+type DriverDocument struct {
+	ID          int64         `json:"id"`
+	DriverID    int64         `json:"driverId"`
+	Type        DocumentType  `json:"type"`
+	State       DocumentState `json:"state"`
+	FileName    string        `json:"fileName"`
+	ContentType string        `json:"contentType"`
+	BlobKey     string        `json:"-"`
+	ExpiresAt   time.Time     `json:"expiresAt"`
+
+	ReviewedBy      *int64     `json:"reviewedBy"`
+	ReviewedAt      *time.Time `json:"reviewedAt"`
+	RejectionReason *string    `json:"rejectionReason"`
+
+	ExpiryRemindedAt *time.Time `json:"expiryRemindedAt"`
+	CreatedAt        time.Time  `json:"createdAt"`
+}
+
+// DriverVerification is the state of a driver's application, derived from the documents
+type DriverVerification struct {
+	DriverID int64         `json:"driverId"`
+	State    DocumentState `json:"state"`
+	Verified bool          `json:"verified"`
+	// The newest document of each type
+	Documents []DriverDocument `json:"documents"`
+	Missing   []DocumentType   `json:"missing"`
+}
+
+type DocumentEvent struct {
+	DocumentID      int64         `json:"documentId"`
+	DriverID        int64         `json:"driverId"`
+	Type            DocumentType  `json:"type"`
+	State           DocumentState `json:"state"`
+	ExpiresAt       time.Time     `json:"expiresAt"`
+	RejectionReason *string       `json:"rejectionReason,omitempty"`
+}
+
+type DocumentRepository interface {
+	CreateDocument(ctx context.Context, document *DriverDocument) error
+	GetDocument(ctx context.Context, id int64) (DriverDocument, error)
+	// GetDocumentsByDriverID returns the documents of the driver, newest first
+	GetDocumentsByDriverID(ctx context.Context, driverID int64) ([]DriverDocument, error)
+	GetDocumentsByState(ctx context.Context, state DocumentState) ([]DriverDocument, error)
+	// ReviewDocument moves a pending document to state. Returns false if the document is no longer pending
+	ReviewDocument(ctx context.Context, id int64, state DocumentState, reviewedBy int64, reviewedAt time.Time, rejectionReason *string) (bool, error)
+	// ExpireDocuments expires approved documents that expire before expiresBefore and returns them
+	ExpireDocuments(ctx context.Context, expiresBefore time.Time) ([]DriverDocument, error)
+	// MarkDueExpiryReminders marks approved documents expiring before expiresBefore that have not been reminded of, and returns them
+	MarkDueExpiryReminders(ctx context.Context, expiresBefore time.Time) ([]DriverDocument, error)
+}
+
+// verification derives the application state from the documents, which must be newest first
+func verification(driverID int64, documents []DriverDocument, now time.Time) DriverVerification {
+	v := DriverVerification{
+		DriverID:  driverID,
+		State:     DocumentStatePending,
+		Verified:  true,
+		Documents: make([]DriverDocument, 0),
+		Missing:   make([]DocumentType, 0),
+	}
+	rejected, expired := false, false
+	for _, docType := range requiredDocumentTypes {
+		ofType := lo.Filter(documents, func(item DriverDocument, index int) bool { return item.Type == docType })
+		if len(ofType) == 0 {
+			v.Missing = append(v.Missing, docType)
+			v.Verified = false
+			continue
+		}
+		v.Documents = append(v.Documents, ofType[0])
+		// An older approved document is valid while a replacement is being reviewed
+		approved := lo.SomeBy(ofType, func(item DriverDocument) bool {
+			return item.State == DocumentStateApproved && item.ExpiresAt.After(now)
+		})
+		if !approved {
+			v.Verified = false
+			rejected = rejected || ofType[0].State == DocumentStateRejected
+			expired = expired || ofType[0].State == DocumentStateExpired
+		}
+	}
+	switch {
+	case v.Verified:
+		v.State = DocumentStateApproved
+	case rejected:
+		v.State = DocumentStateRejected
+	case expired:
+		v.State = DocumentStateExpired
+	}
+	return v
+}
+
+func (s *DriverService) getVerification(ctx context.Context, driverID int64) (DriverVerification, error) {
+	documents, err := s.documentRepo.GetDocumentsByDriverID(ctx, driverID)
+	if err != nil {
+		return DriverVerification{}, err
+	}
+	return verification(driverID, documents, time.Now().UTC()), nil
+}
+
+// isVerified returns true if the user may drive. Simulated drivers do not upload documents
+func (s *DriverService) isVerified(ctx context.Context, user users.User) (bool, error) {
+	if user.Simulated {
+		return true, nil
+	}
+	v, err := s.getVerification(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	return v.Verified, nil
+}
+
+func (s *DriverService) GetVerification(ctx context.Context, userID string) (DriverVerification, error) {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return DriverVerification{}, core.Errorw(core.EINTERNAL, err)
+	}
+	v, err := s.getVerification(ctx, user.ID)
+	if err != nil {
+		return DriverVerification{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return v, nil
+}
+
+type UploadDocumentInput struct {
+	Type        DocumentType `json:"type"`
+	ExpiresAt   time.Time    `json:"expiresAt"`
+	FileName    string       `json:"fileName"`
+	ContentType string       `json:"contentType"`
+}
+
+func (i *UploadDocumentInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.Type, validation.Required, validation.In(lo.ToAnySlice(requiredDocumentTypes)...)),
+		validation.Field(&i.ExpiresAt, validation.Required),
+		validation.Field(&i.FileName, validation.Required, validation.Length(1, 255)),
+		validation.Field(&i.ContentType, validation.Required, validation.In(lo.ToAnySlice(allowedDocumentContentTypes)...)),
+	)
+}
+
+// UploadDocument stores the document in the blob store and submits it for review
+func (s *DriverService) UploadDocument(ctx context.Context, userID string, input *UploadDocumentInput, data io.Reader) (DriverDocument, error) {
+	if err := input.Validate(); err != nil {
+		return DriverDocument{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	now := time.Now().UTC()
+	if !input.ExpiresAt.After(now) {
+		return DriverDocument{}, core.Errorf(core.EINVALID, "document has expired")
+	}
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return DriverDocument{}, core.Errorw(core.EINTERNAL, err)
+	}
+
+	document := &DriverDocument{
+		DriverID:    user.ID,
+		Type:        input.Type,
+		State:       DocumentStatePending,
+		FileName:    input.FileName,
+		ContentType: input.ContentType,
+		BlobKey:     fmt.Sprintf("driver-documents/%v/%v-%v", user.ID, now.UnixNano(), input.Type),
+		ExpiresAt:   input.ExpiresAt.UTC(),
+		CreatedAt:   now,
+	}
+	err = s.blobStore.Put(ctx, document.BlobKey, data)
+	if err != nil {
+		return DriverDocument{}, core.Errorw(core.EINTERNAL, err)
+	}
+	err = s.documentRepo.CreateDocument(ctx, document)
+	if err != nil {
+		return DriverDocument{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return *document, nil
+}
+
+func (s *DriverService) GetDocumentsByState(ctx context.Context, state DocumentState) ([]DriverDocument, error) {
+	documents, err := s.documentRepo.GetDocumentsByState(ctx, state)
+	if err != nil {
+		return []DriverDocument{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return documents, nil
+}
+
+// GetDocumentFile returns the document and its contents, which the caller must close
+func (s *DriverService) GetDocumentFile(ctx context.Context, documentID int64) (DriverDocument, io.ReadCloser, error) {
+	document, err := s.documentRepo.GetDocument(ctx, documentID)
+	if err != nil {
+		return DriverDocument{}, nil, core.WrapErr(err)
+	}
+	file, err := s.blobStore.Get(ctx, document.BlobKey)
+	if err != nil {
+		return DriverDocument{}, nil, core.WrapErr(err)
+	}
+	return document, file, nil
+}
+
+type ReviewDocumentInput struct {
+	Approve bool   `json:"approve"`
+	Reason  string `json:"reason"`
+}
+
+func (i *ReviewDocumentInput) Validate() error {
+	if i.Approve {
+		return nil
+	}
+	return validation.ValidateStruct(i,
+		validation.Field(&i.Reason, validation.Required),
+	)
+}
+
+// ReviewDocument approves or rejects a pending document
+func (s *DriverService) ReviewDocument(ctx context.Context, userID string, documentID int64, input *ReviewDocumentInput) (DriverDocument, error) {
+	if err := input.Validate(); err != nil {
+		return DriverDocument{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	reviewer, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return DriverDocument{}, core.Errorw(core.EINTERNAL, err)
+	}
+	document, err := s.documentRepo.GetDocument(ctx, documentID)
+	if err != nil {
+		return DriverDocument{}, core.WrapErr(err)
+	}
+	state := DocumentStateApproved
+	var reason *string
+	if !input.Approve {
+		state = DocumentStateRejected
+		reason = &input.Reason
+	}
+	if !canTransition(document.State, state) {
+		return DriverDocument{}, core.Errorf(core.EINVALID, "cannot review document in state %v", document.State)
+	}
+	reviewed, err := s.documentRepo.ReviewDocument(ctx, document.ID, state, reviewer.ID, time.Now().UTC(), reason)
+	if err != nil {
+		return DriverDocument{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if !reviewed {
+		return DriverDocument{}, core.Errorf(core.ECONFLICT, "document has already been reviewed")
+	}
+	document, err = s.documentRepo.GetDocument(ctx, document.ID)
+	if err != nil {
+		return DriverDocument{}, core.Errorw(core.EINTERNAL, err)
+	}
+	err = s.publishDocumentEvent(ctx, TopicDocumentReviewed, document)
+	if err != nil {
+		return DriverDocument{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return document, nil
+}
+
+func (s *DriverService) publishDocumentEvent(ctx context.Context, topic string, document DriverDocument) error {
+	event := DocumentEvent{
+		DocumentID:      document.ID,
+		DriverID:        document.DriverID,
+		Type:            document.Type,
+		State:           document.State,
+		ExpiresAt:       document.ExpiresAt,
+		RejectionReason: document.RejectionReason,
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.pubsub.Publish(ctx, topic, eventBytes)
+	return nil
+}
+
+// ProcessDocumentExpiry reminds drivers of documents about to expire, expires documents,
+// and takes drivers offline that are no longer verified
+func (s *DriverService) ProcessDocumentExpiry(ctx context.Context) error {
+	now := time.Now().UTC()
+	due, err := s.documentRepo.MarkDueExpiryReminders(ctx, now.Add(s.config.DocumentExpiryReminderLead))
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	for _, document := range due {
+		err = s.publishDocumentEvent(ctx, TopicDocumentExpiryReminder, document)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+	}
+
+	expired, err := s.documentRepo.ExpireDocuments(ctx, now)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	for _, document := range expired {
+		err = s.publishDocumentEvent(ctx, TopicDocumentExpired, document)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+	}
+	driverIds := lo.Uniq(lo.Map(expired, func(item DriverDocument, index int) int64 { return item.DriverID }))
+	for _, driverID := range driverIds {
+		err = s.offlineIfUnverified(ctx, driverID, now)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+	}
+	return nil
+}
+
+// offlineIfUnverified ends the shift of an online driver that is no longer verified.
+// A ride in progress can still be finished, but no new rides are dispatched to the driver
+func (s *DriverService) offlineIfUnverified(ctx context.Context, driverID int64, now time.Time) error {
+	availability, err := s.driverRepo.GetAvailability(ctx, driverID)
+	if err != nil || !availability.Online() {
+		return err
+	}
+	user, err := s.userRepo.GetByID(ctx, driverID)
+	if err != nil {
+		return err
+	}
+	verified, err := s.isVerified(ctx, user)
+	if err != nil || verified {
+		return err
+	}
+	err = s.driverRepo.EndShift(ctx, driverID, now, ShiftEndReasonUnverified)
+	if err != nil {
+		return err
+	}
+	return s.publishAvailability(ctx, driverID)
+}
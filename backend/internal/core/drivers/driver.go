@@ -0,0 +1,68 @@
+package drivers
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	TopicDriverAvailability = "driver-availability"
+)
+
+type AvailabilityState int
+
+const (
+	AvailabilityOffline AvailabilityState = iota
+	AvailabilityIdle
+	AvailabilityEnRoute
+	AvailabilityOnTrip
+)
+
+const (
+	ShiftEndReasonOffline  = "offline"
+	ShiftEndReasonInactive = "inactive"
+	// The driver's documents expired during the shift
+	ShiftEndReasonUnverified = "unverified"
+)
+
+// DriverAvailability is whether a driver is working, and with which vehicle
+type DriverAvailability struct {
+	DriverID int64             `json:"driverId"`
+	State    AvailabilityState `json:"state"`
+	// Set while online
+	VehicleID *int64     `json:"vehicleId"`
+	ShiftID   *int64     `json:"shiftId"`
+	OnlineAt  *time.Time `json:"onlineAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+func (d DriverAvailability) Online() bool {
+	return d.State != AvailabilityOffline
+}
+
+// Shift is a period a driver was online
+type Shift struct {
+	ID        int64      `json:"id"`
+	DriverID  int64      `json:"driverId"`
+	VehicleID int64      `json:"vehicleId"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt"`
+	EndReason *string    `json:"endReason"`
+}
+
+type DriverRepository interface {
+	// GetAvailability returns the availability of the driver, offline if the driver has never been online
+	GetAvailability(ctx context.Context, driverID int64) (DriverAvailability, error)
+	GetByState(ctx context.Context, state AvailabilityState) ([]DriverAvailability, error)
+	// StartShift creates a shift and makes the driver idle with the vehicle
+	StartShift(ctx context.Context, driverID int64, vehicleID int64, startedAt time.Time) (Shift, error)
+	// EndShift ends the open shift of the driver and makes the driver offline
+	EndShift(ctx context.Context, driverID int64, endedAt time.Time, reason string) error
+	// UpdateState updates the state of an online driver. Does nothing if the driver is offline
+	UpdateState(ctx context.Context, driverID int64, state AvailabilityState) error
+	// GetInactive returns online drivers whose vehicle has not reported a position since lastSeenBefore
+	GetInactive(ctx context.Context, lastSeenBefore time.Time) ([]DriverAvailability, error)
+	GetShifts(ctx context.Context, driverID int64, limit int) ([]Shift, error)
+	// GetShiftsBetween returns the shifts of the driver that overlap the period from from until to, oldest first
+	GetShiftsBetween(ctx context.Context, driverID int64, from time.Time, to time.Time) ([]Shift, error)
+}
@@ -0,0 +1,211 @@
+package drivers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/users"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/samber/lo"
+)
+
+type Config struct {
+	// Online drivers are taken offline when their vehicle has not reported a position for this long
+	InactivityTimeout time.Duration
+	// Drivers are reminded of documents expiring within this duration
+	DocumentExpiryReminderLead time.Duration
+}
+
+type DriverService struct {
+	config       Config
+	driverRepo   DriverRepository
+	documentRepo DocumentRepository
+	userRepo     users.UserRepository
+	vehicleRepo  vehicles.VehicleRepository
+	blobStore    core.BlobStore
+	pubsub       core.Pubsub
+}
+
+func NewService(config Config, driverRepo DriverRepository, documentRepo DocumentRepository, userRepo users.UserRepository, vehicleRepo vehicles.VehicleRepository, blobStore core.BlobStore, pubsub core.Pubsub) *DriverService {
+	return &DriverService{
+		config:       config,
+		driverRepo:   driverRepo,
+		documentRepo: documentRepo,
+		userRepo:     userRepo,
+		vehicleRepo:  vehicleRepo,
+		blobStore:    blobStore,
+		pubsub:       pubsub,
+	}
+}
+
+func (s *DriverService) publishAvailability(ctx context.Context, driverID int64) error {
+	availability, err := s.driverRepo.GetAvailability(ctx, driverID)
+	if err != nil {
+		return err
+	}
+	availabilityBytes, err := json.Marshal(availability)
+	if err != nil {
+		return err
+	}
+	s.pubsub.Publish(ctx, TopicDriverAvailability, availabilityBytes)
+	return nil
+}
+
+func (s *DriverService) GetAvailability(ctx context.Context, userID string) (DriverAvailability, error) {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return DriverAvailability{}, core.Errorw(core.EINTERNAL, err)
+	}
+	availability, err := s.driverRepo.GetAvailability(ctx, user.ID)
+	if err != nil {
+		return DriverAvailability{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return availability, nil
+}
+
+type GoOnlineInput struct {
+	VehicleID int64 `json:"vehicleId"`
+}
+
+func (i *GoOnlineInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.VehicleID, validation.Required),
+	)
+}
+
+// GoOnline starts a shift with the vehicle, making the driver available for rides.
+// Drivers must be verified to go online
+func (s *DriverService) GoOnline(ctx context.Context, userID string, input *GoOnlineInput) (DriverAvailability, error) {
+	if err := input.Validate(); err != nil {
+		return DriverAvailability{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return DriverAvailability{}, core.Errorw(core.EINTERNAL, err)
+	}
+	verified, err := s.isVerified(ctx, user)
+	if err != nil {
+		return DriverAvailability{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if !verified {
+		return DriverAvailability{}, core.Errorf(core.EUNAUTHORIZED, "driver documents have not been approved")
+	}
+	vehicle, err := s.vehicleRepo.GetByIdAndOwnerId(ctx, input.VehicleID, user.ID)
+	if err != nil {
+		return DriverAvailability{}, core.WrapErr(err)
+	}
+	availability, err := s.driverRepo.GetAvailability(ctx, user.ID)
+	if err != nil {
+		return DriverAvailability{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if availability.Online() {
+		if availability.VehicleID != nil && *availability.VehicleID == vehicle.ID {
+			return availability, nil
+		}
+		return DriverAvailability{}, core.Errorf(core.EINVALID, "already online with another vehicle, go offline to change vehicle")
+	}
+
+	_, err = s.driverRepo.StartShift(ctx, user.ID, vehicle.ID, time.Now().UTC())
+	if err != nil {
+		return DriverAvailability{}, core.Errorw(core.EINTERNAL, err)
+	}
+	err = s.publishAvailability(ctx, user.ID)
+	if err != nil {
+		return DriverAvailability{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return s.GetAvailability(ctx, userID)
+}
+
+// GoOffline ends the shift of the driver. Drivers cannot go offline during a ride
+func (s *DriverService) GoOffline(ctx context.Context, userID string) error {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	availability, err := s.driverRepo.GetAvailability(ctx, user.ID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if !availability.Online() {
+		return nil
+	}
+	if availability.State != AvailabilityIdle {
+		return core.Errorf(core.EINVALID, "cannot go offline during a ride")
+	}
+	err = s.driverRepo.EndShift(ctx, user.ID, time.Now().UTC(), ShiftEndReasonOffline)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	err = s.publishAvailability(ctx, user.ID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	return nil
+}
+
+func (s *DriverService) GetShifts(ctx context.Context, userID string) ([]Shift, error) {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return []Shift{}, core.Errorw(core.EINTERNAL, err)
+	}
+	shifts, err := s.driverRepo.GetShifts(ctx, user.ID, 50)
+	if err != nil {
+		return []Shift{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return shifts, nil
+}
+
+// OfflineInactiveDrivers ends the shifts of online drivers that have stopped sending position updates
+func (s *DriverService) OfflineInactiveDrivers(ctx context.Context) error {
+	now := time.Now().UTC()
+	inactive, err := s.driverRepo.GetInactive(ctx, now.Add(-s.config.InactivityTimeout))
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	for _, availability := range inactive {
+		err = s.driverRepo.EndShift(ctx, availability.DriverID, now, ShiftEndReasonInactive)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		err = s.publishAvailability(ctx, availability.DriverID)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+	}
+	return nil
+}
+
+// GetNearbyVehicles returns the vehicles of idle drivers within radius meters of the point
+func (s *DriverService) GetNearbyVehicles(ctx context.Context, point geo.Point, radius float64) ([]vehicles.Vehicle, error) {
+	idle, err := s.driverRepo.GetByState(ctx, AvailabilityIdle)
+	if err != nil {
+		return []vehicles.Vehicle{}, core.Errorw(core.EINTERNAL, err)
+	}
+	vehicleIds := lo.FilterMap(idle, func(item DriverAvailability, index int) (int64, bool) {
+		if item.VehicleID == nil {
+			return 0, false
+		}
+		return *item.VehicleID, true
+	})
+	positions, err := s.vehicleRepo.GetVehiclePositions(ctx, vehicleIds)
+	if err != nil {
+		return []vehicles.Vehicle{}, core.Errorw(core.EINTERNAL, err)
+	}
+	nearby := make([]vehicles.Vehicle, 0)
+	for _, position := range positions {
+		if geo.Distance(point, geo.Point{Lat: position.Lat, Lng: position.Lng}) > radius {
+			continue
+		}
+		vehicle, err := s.vehicleRepo.GetByID(ctx, position.VehicleID)
+		if err != nil {
+			return []vehicles.Vehicle{}, core.Errorw(core.EINTERNAL, err)
+		}
+		vehicle.LastRecordedPosition = &position
+		nearby = append(nearby, vehicle)
+	}
+	return nearby, nil
+}
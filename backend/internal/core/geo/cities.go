@@ -0,0 +1,36 @@
+package geo
+
+import "github.com/samber/lo"
+
+// City is an area the service operates in, approximated by a circle around its center
+type City struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Country string `json:"country"`
+	Center  Point  `json:"center"`
+	// Radius of the area around the center in meters
+	RadiusMeters float64 `json:"radiusMeters"`
+	// Currency rides in the city are priced in
+	Currency string `json:"currency"`
+}
+
+var cities = []City{
+	{ID: "copenhagen", Name: "Copenhagen", Country: "DK", Center: Point{Lat: 55.6761, Lng: 12.5683}, RadiusMeters: 25000, Currency: "DKK"},
+	{ID: "aarhus", Name: "Aarhus", Country: "DK", Center: Point{Lat: 56.1629, Lng: 10.2039}, RadiusMeters: 15000, Currency: "DKK"},
+	{ID: "odense", Name: "Odense", Country: "DK", Center: Point{Lat: 55.4038, Lng: 10.4024}, RadiusMeters: 12000, Currency: "DKK"},
+	{ID: "berlin", Name: "Berlin", Country: "DE", Center: Point{Lat: 52.5200, Lng: 13.4050}, RadiusMeters: 30000, Currency: "EUR"},
+	{ID: "amsterdam", Name: "Amsterdam", Country: "NL", Center: Point{Lat: 52.3676, Lng: 4.9041}, RadiusMeters: 20000, Currency: "EUR"},
+}
+
+func GetCities() []City {
+	return cities
+}
+
+func GetCity(id string) (City, bool) {
+	return lo.Find(cities, func(item City) bool { return item.ID == id })
+}
+
+// CityAt returns the city the point is in, if any
+func CityAt(point Point) (City, bool) {
+	return lo.Find(cities, func(item City) bool { return Distance(item.Center, point) <= item.RadiusMeters })
+}
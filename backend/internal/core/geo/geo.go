@@ -0,0 +1,201 @@
+package geo
+
+import "math"
+
+const earthRadiusMeters = 6371008.8
+
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// PointsFromCoordinates converts [lat, lng] coordinates to points
+func PointsFromCoordinates(coordinates [][]float64) []Point {
+	points := make([]Point, 0, len(coordinates))
+	for _, coordinate := range coordinates {
+		if len(coordinate) < 2 {
+			continue
+		}
+		points = append(points, Point{Lat: coordinate[0], Lng: coordinate[1]})
+	}
+	return points
+}
+
+func toRadians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func toDegrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// Distance returns the haversine distance between two points in meters
+func Distance(a Point, b Point) float64 {
+	dLat := toRadians(b.Lat - a.Lat)
+	dLng := toRadians(b.Lng - a.Lng)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(a.Lat))*math.Cos(toRadians(b.Lat))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Bearing returns the initial bearing from a to b in degrees, clockwise from north in the range [0, 360)
+func Bearing(a Point, b Point) float64 {
+	lat1 := toRadians(a.Lat)
+	lat2 := toRadians(b.Lat)
+	dLng := toRadians(b.Lng - a.Lng)
+	y := math.Sin(dLng) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLng)
+	return math.Mod(toDegrees(math.Atan2(y, x))+360, 360)
+}
+
+// Interpolate returns the point at fraction t (0..1) between a and b
+func Interpolate(a Point, b Point, t float64) Point {
+	return Point{
+		Lat: a.Lat + (b.Lat-a.Lat)*t,
+		Lng: a.Lng + (b.Lng-a.Lng)*t,
+	}
+}
+
+// LineLength returns the length of the line in meters
+func LineLength(line []Point) float64 {
+	length := 0.0
+	for i := 1; i < len(line); i++ {
+		length += Distance(line[i-1], line[i])
+	}
+	return length
+}
+
+// PointAlong returns the point located distance meters along the line.
+// Distances beyond the ends of the line are clamped to the first and last point
+func PointAlong(line []Point, distance float64) Point {
+	if len(line) == 0 {
+		return Point{}
+	}
+	if distance <= 0 {
+		return line[0]
+	}
+	travelled := 0.0
+	for i := 1; i < len(line); i++ {
+		segmentLength := Distance(line[i-1], line[i])
+		if travelled+segmentLength >= distance {
+			if segmentLength == 0 {
+				return line[i]
+			}
+			return Interpolate(line[i-1], line[i], (distance-travelled)/segmentLength)
+		}
+		travelled += segmentLength
+	}
+	return line[len(line)-1]
+}
+
+// LinePosition describes where a point is located relative to a line
+type LinePosition struct {
+	// Closest point on the line
+	Point Point `json:"point"`
+	// Index of the segment start the closest point is on
+	Index int `json:"index"`
+	// Distance from the point to the line in meters
+	Distance float64 `json:"distance"`
+	// Distance from the start of the line to the closest point in meters
+	DistanceAlong float64 `json:"distanceAlong"`
+}
+
+// NearestPointOnLine finds the point on the line closest to p.
+// Segments are projected using an equirectangular approximation, which is precise enough for road-length segments
+func NearestPointOnLine(line []Point, p Point) LinePosition {
+	best := LinePosition{Distance: math.Inf(1)}
+	if len(line) == 0 {
+		return best
+	}
+	if len(line) == 1 {
+		return LinePosition{Point: line[0], Distance: Distance(line[0], p)}
+	}
+	travelled := 0.0
+	for i := 1; i < len(line); i++ {
+		a := line[i-1]
+		b := line[i]
+		t := projectOnSegment(a, b, p)
+		candidate := Interpolate(a, b, t)
+		distance := Distance(candidate, p)
+		if distance < best.Distance {
+			best = LinePosition{
+				Point:         candidate,
+				Index:         i - 1,
+				Distance:      distance,
+				DistanceAlong: travelled + Distance(a, candidate),
+			}
+		}
+		travelled += Distance(a, b)
+	}
+	return best
+}
+
+// projectOnSegment returns the fraction along a-b of the projection of p, clamped to [0, 1]
+func projectOnSegment(a Point, b Point, p Point) float64 {
+	cosLat := math.Cos(toRadians((a.Lat + b.Lat) / 2))
+	dx := (b.Lng - a.Lng) * cosLat
+	dy := b.Lat - a.Lat
+	lengthSquared := dx*dx + dy*dy
+	if lengthSquared == 0 {
+		return 0
+	}
+	px := (p.Lng - a.Lng) * cosLat
+	py := p.Lat - a.Lat
+	t := (px*dx + py*dy) / lengthSquared
+	return math.Max(0, math.Min(1, t))
+}
+
+type BoundingBox struct {
+	MinLat float64 `json:"minLat"`
+	MinLng float64 `json:"minLng"`
+	MaxLat float64 `json:"maxLat"`
+	MaxLng float64 `json:"maxLng"`
+}
+
+// NewBoundingBox returns the smallest box containing all points
+func NewBoundingBox(points []Point) BoundingBox {
+	if len(points) == 0 {
+		return BoundingBox{}
+	}
+	box := BoundingBox{
+		MinLat: points[0].Lat,
+		MinLng: points[0].Lng,
+		MaxLat: points[0].Lat,
+		MaxLng: points[0].Lng,
+	}
+	for _, p := range points[1:] {
+		box.MinLat = math.Min(box.MinLat, p.Lat)
+		box.MinLng = math.Min(box.MinLng, p.Lng)
+		box.MaxLat = math.Max(box.MaxLat, p.Lat)
+		box.MaxLng = math.Max(box.MaxLng, p.Lng)
+	}
+	return box
+}
+
+func (b BoundingBox) Contains(p Point) bool {
+	return p.Lat >= b.MinLat && p.Lat <= b.MaxLat && p.Lng >= b.MinLng && p.Lng <= b.MaxLng
+}
+
+// Expand grows the box by the given number of meters in every direction
+func (b BoundingBox) Expand(meters float64) BoundingBox {
+	dLat := toDegrees(meters / earthRadiusMeters)
+	maxAbsLat := math.Max(math.Abs(b.MinLat), math.Abs(b.MaxLat))
+	dLng := toDegrees(meters / (earthRadiusMeters * math.Cos(toRadians(maxAbsLat))))
+	return BoundingBox{
+		MinLat: b.MinLat - dLat,
+		MinLng: b.MinLng - dLng,
+		MaxLat: b.MaxLat + dLat,
+		MaxLng: b.MaxLng + dLng,
+	}
+}
+
+// Geofence is a circular area around a center point
+type Geofence struct {
+	Center Point `json:"center"`
+	// Radius in meters
+	Radius float64 `json:"radius"`
+}
+
+func (g Geofence) Contains(p Point) bool {
+	return Distance(g.Center, p) <= g.Radius
+}
@@ -0,0 +1,54 @@
+package geo
+
+// Polygon is an area bounded by its vertices, in order. The last vertex connects back to the first
+type Polygon []Point
+
+// Contains reports whether the point is inside the polygon, using the even-odd rule.
+// Coordinates are treated as planar, which is precise enough for areas the size of a city
+func (poly Polygon) Contains(p Point) bool {
+	inside := false
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		a, b := poly[i], poly[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lng < (b.Lng-a.Lng)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lng {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// orientation returns the sign of the cross product of a-o and b-o: positive if o, a, b turn counterclockwise
+func orientation(o Point, a Point, b Point) float64 {
+	return (a.Lng-o.Lng)*(b.Lat-o.Lat) - (a.Lat-o.Lat)*(b.Lng-o.Lng)
+}
+
+// segmentsCross reports whether the segments a1-a2 and b1-b2 properly intersect
+func segmentsCross(a1 Point, a2 Point, b1 Point, b2 Point) bool {
+	d1 := orientation(b1, b2, a1)
+	d2 := orientation(b1, b2, a2)
+	d3 := orientation(a1, a2, b1)
+	d4 := orientation(a1, a2, b2)
+	return ((d1 > 0) != (d2 > 0)) && ((d3 > 0) != (d4 > 0)) && d1 != 0 && d2 != 0 && d3 != 0 && d4 != 0
+}
+
+// Intersects reports whether the line enters the polygon, either with a point inside it or a segment crossing it
+func (poly Polygon) Intersects(line []Point) bool {
+	if len(poly) < 3 {
+		return false
+	}
+	box := NewBoundingBox(poly)
+	for i, p := range line {
+		if box.Contains(p) && poly.Contains(p) {
+			return true
+		}
+		if i == 0 {
+			continue
+		}
+		for j, k := 0, len(poly)-1; j < len(poly); k, j = j, j+1 {
+			if segmentsCross(line[i-1], p, poly[k], poly[j]) {
+				return true
+			}
+		}
+	}
+	return false
+}
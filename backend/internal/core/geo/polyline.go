@@ -0,0 +1,88 @@
+package geo
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+var ErrInvalidPolyline = errors.New("invalid encoded polyline")
+
+// DecodePolyline decodes an encoded polyline (precision 5, as returned by
+// OpenRouteService) into a list of [lat, lng] coordinates.
+func DecodePolyline(encoded string) ([][]float64, error) {
+	coordinates := make([][]float64, 0)
+	index := 0
+	lat := 0
+	lng := 0
+	for index < len(encoded) {
+		dLat, next, err := decodePolylineValue(encoded, index)
+		if err != nil {
+			return nil, err
+		}
+		dLng, next, err := decodePolylineValue(encoded, next)
+		if err != nil {
+			return nil, err
+		}
+		index = next
+		lat += dLat
+		lng += dLng
+		coordinates = append(coordinates, []float64{float64(lat) / 1e5, float64(lng) / 1e5})
+	}
+	return coordinates, nil
+}
+
+func decodePolylineValue(encoded string, index int) (int, int, error) {
+	result := 0
+	shift := 0
+	for {
+		if index >= len(encoded) {
+			return 0, index, ErrInvalidPolyline
+		}
+		b := int(encoded[index]) - 63
+		index++
+		if b < 0 {
+			return 0, index, ErrInvalidPolyline
+		}
+		result |= (b & 0x1f) << shift
+		shift += 5
+		if b < 0x20 {
+			break
+		}
+	}
+	if result&1 != 0 {
+		return ^(result >> 1), index, nil
+	}
+	return result >> 1, index, nil
+}
+
+// EncodePolyline encodes a list of [lat, lng] coordinates as a polyline with precision 5
+func EncodePolyline(coordinates [][]float64) string {
+	sb := strings.Builder{}
+	prevLat := 0
+	prevLng := 0
+	for _, coordinate := range coordinates {
+		if len(coordinate) < 2 {
+			continue
+		}
+		lat := int(math.Round(coordinate[0] * 1e5))
+		lng := int(math.Round(coordinate[1] * 1e5))
+		encodePolylineValue(&sb, lat-prevLat)
+		encodePolylineValue(&sb, lng-prevLng)
+		prevLat = lat
+		prevLng = lng
+	}
+	return sb.String()
+}
+
+func encodePolylineValue(sb *strings.Builder, value int) {
+	shifted := value << 1
+	if value < 0 {
+		shifted = ^shifted
+	}
+	for shifted >= 0x20 {
+		sb.WriteByte(byte((0x20 | (shifted & 0x1f)) + 63))
+		shifted >>= 5
+	}
+	sb.WriteByte(byte(shifted + 63))
+}
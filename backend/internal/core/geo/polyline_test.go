@@ -0,0 +1,58 @@
+package geo
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestEncodePolyline(t *testing.T) {
+	tests := []struct {
+		name        string
+		coordinates [][]float64
+		want        string
+	}{
+		{"empty", [][]float64{}, ""},
+		{"reference", [][]float64{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}, "_p~iF~ps|U_ulLnnqC_mqNvxq`@"},
+		{"skips short coordinates", [][]float64{{38.5, -120.2}, {1}}, "_p~iF~ps|U"},
+		{"rounds to precision 5", [][]float64{{38.500004, -120.199996}}, "_p~iF~ps|U"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EncodePolyline(tt.coordinates); got != tt.want {
+				t.Errorf("EncodePolyline() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodePolyline(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+		want    [][]float64
+		wantErr error
+	}{
+		{"empty", "", [][]float64{}, nil},
+		{"reference", "_p~iF~ps|U_ulLnnqC_mqNvxq`@", [][]float64{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}, nil},
+		{"truncated value", "_p~iF~ps|", nil, ErrInvalidPolyline},
+		{"missing longitude", "_p~iF", nil, ErrInvalidPolyline},
+		{"invalid character", " ", nil, ErrInvalidPolyline},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodePolyline(tt.encoded)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DecodePolyline() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("DecodePolyline() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if math.Abs(got[i][0]-tt.want[i][0]) > 1e-9 || math.Abs(got[i][1]-tt.want[i][1]) > 1e-9 {
+					t.Errorf("DecodePolyline()[%v] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
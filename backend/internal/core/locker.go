@@ -0,0 +1,10 @@
+package core
+
+import "context"
+
+// Locker provides locks shared between all running instances of the application
+type Locker interface {
+	// TryWithLock runs fn while holding the named lock.
+	// Returns false without running fn if the lock is held by someone else
+	TryWithLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error)
+}
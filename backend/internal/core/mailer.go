@@ -0,0 +1,23 @@
+package core
+
+import "context"
+
+type MailAttachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+// Mail is an email to a single recipient, with a plain text and an optional HTML body
+type Mail struct {
+	To          string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []MailAttachment
+}
+
+// Mailer sends emails to users
+type Mailer interface {
+	Send(ctx context.Context, mail Mail) error
+}
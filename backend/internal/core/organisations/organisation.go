@@ -0,0 +1,255 @@
+package organisations
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/samber/lo"
+)
+
+const (
+	TopicOrganisationInviteCreated = "organisation-invite-created"
+)
+
+// Roles of organisation members. Admins manage the organisation and see the rides of all members
+const (
+	MemberRoleAdmin  = "admin"
+	MemberRoleMember = "member"
+)
+
+var memberRoles = []string{MemberRoleAdmin, MemberRoleMember}
+
+type InviteState int
+
+const (
+	InviteStatePending InviteState = iota
+	InviteStateAccepted
+	InviteStateRevoked
+)
+
+// Organisation is a company its members can bill rides to, instead of their own payment method.
+// The organisation is billed centrally for the rides
+type Organisation struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	BillingEmail string    `json:"billingEmail"`
+	VATNumber    string    `json:"vatNumber"`
+	Address      string    `json:"address"`
+	CreatedBy    int64     `json:"createdBy"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+type Member struct {
+	OrganisationID int64     `json:"organisationId"`
+	UserID         int64     `json:"userId"`
+	Name           string    `json:"name"`
+	Email          string    `json:"email"`
+	Role           string    `json:"role"`
+	JoinedAt       time.Time `json:"joinedAt"`
+}
+
+// Invite is an invitation for the user with the email address to join an organisation
+type Invite struct {
+	ID             int64       `json:"id"`
+	OrganisationID int64       `json:"organisationId"`
+	Email          string      `json:"email"`
+	Role           string      `json:"role"`
+	State          InviteState `json:"state"`
+	InvitedBy      int64       `json:"invitedBy"`
+	AcceptedBy     *int64      `json:"acceptedBy"`
+	// Hash of the single use token mailed with the invite. The invite is accepted with the token, which proves the address belongs to the user
+	TokenHash string    `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type InviteCreatedEvent struct {
+	Invite           Invite `json:"invite"`
+	OrganisationName string `json:"organisationName"`
+	InvitedByName    string `json:"invitedByName"`
+	// The token the invite is accepted with. Only sent to the invited address
+	Token string `json:"token"`
+}
+
+// RidePolicy is the rules rides billed to an organisation must follow. Empty values do not restrict rides
+type RidePolicy struct {
+	OrganisationID int64 `json:"organisationId"`
+	// Pickup times of day rides are allowed at, as HH:MM in the time zone. A window ending before it starts spans midnight
+	AllowedFrom  string `json:"allowedFrom"`
+	AllowedUntil string `json:"allowedUntil"`
+	// Days of the week rides are allowed on, 0 is Sunday
+	Weekdays       []int                   `json:"weekdays"`
+	TimeZone       string                  `json:"timeZone"`
+	VehicleClasses []vehicles.VehicleClass `json:"vehicleClasses"`
+	// Highest fare of a ride, in minor units of the base currency
+	MaxFare            *int `json:"maxFare"`
+	RequireExpenseCode bool `json:"requireExpenseCode"`
+	// Expense codes rides can be billed with. Any code is accepted if empty
+	ExpenseCodes []string  `json:"expenseCodes"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+type OrganisationRepository interface {
+	// CreateOrganisation creates the organisation with the member as its first admin
+	CreateOrganisation(ctx context.Context, organisation *Organisation, admin Member) error
+	GetOrganisation(ctx context.Context, organisationID int64) (Organisation, error)
+	GetOrganisationsByUserID(ctx context.Context, userID int64) ([]Organisation, error)
+	UpdateOrganisation(ctx context.Context, organisation Organisation) error
+	// GetMember returns nil if the user is not a member of the organisation
+	GetMember(ctx context.Context, organisationID int64, userID int64) (*Member, error)
+	GetMembers(ctx context.Context, organisationID int64) ([]Member, error)
+	RemoveMember(ctx context.Context, organisationID int64, userID int64) error
+	// CreateInvite creates the invite. Returns false if the address already has a pending invite to the organisation
+	CreateInvite(ctx context.Context, invite *Invite) (bool, error)
+	GetInvite(ctx context.Context, inviteID int64) (Invite, error)
+	GetInvitesByOrganisationID(ctx context.Context, organisationID int64) ([]Invite, error)
+	// AcceptInvite marks a pending invite accepted and adds the member. Returns false if the invite is not pending
+	AcceptInvite(ctx context.Context, invite *Invite, member Member) (bool, error)
+	// RevokeInvite marks a pending invite revoked. Returns false if the invite is not pending
+	RevokeInvite(ctx context.Context, inviteID int64, updatedAt time.Time) (bool, error)
+	// GetPolicy returns a policy without restrictions if the organisation has not set one
+	GetPolicy(ctx context.Context, organisationID int64) (RidePolicy, error)
+	SavePolicy(ctx context.Context, policy RidePolicy) error
+}
+
+type OrganisationInput struct {
+	Name         string `json:"name"`
+	BillingEmail string `json:"billingEmail"`
+	VATNumber    string `json:"vatNumber"`
+	Address      string `json:"address"`
+}
+
+func (i *OrganisationInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.Name, validation.Required, validation.Length(2, 200)),
+		validation.Field(&i.BillingEmail, validation.Required, is.Email),
+		validation.Field(&i.VATNumber, validation.Length(0, 50)),
+		validation.Field(&i.Address, validation.Length(0, 500)),
+	)
+}
+
+type InviteInput struct {
+	Email string `json:"email"`
+	// Defaults to member
+	Role string `json:"role"`
+}
+
+func (i *InviteInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.Email, validation.Required, is.Email),
+		validation.Field(&i.Role, validation.In(lo.ToAnySlice(memberRoles)...)),
+	)
+}
+
+type AcceptInviteInput struct {
+	// The token mailed with the invite
+	Token string `json:"token"`
+}
+
+func (i *AcceptInviteInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.Token, validation.Required),
+	)
+}
+
+type RidePolicyInput struct {
+	AllowedFrom        string                  `json:"allowedFrom"`
+	AllowedUntil       string                  `json:"allowedUntil"`
+	Weekdays           []int                   `json:"weekdays"`
+	TimeZone           string                  `json:"timeZone"`
+	VehicleClasses     []vehicles.VehicleClass `json:"vehicleClasses"`
+	MaxFare            *int                    `json:"maxFare"`
+	RequireExpenseCode bool                    `json:"requireExpenseCode"`
+	ExpenseCodes       []string                `json:"expenseCodes"`
+}
+
+var timeOfDayRegexp = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+var validTimeZone = validation.NewStringRule(func(value string) bool {
+	_, err := time.LoadLocation(value)
+	return err == nil
+}, "must be a valid time zone")
+
+func (i *RidePolicyInput) Validate() error {
+	err := validation.ValidateStruct(i,
+		validation.Field(&i.AllowedFrom, validation.Match(timeOfDayRegexp)),
+		validation.Field(&i.AllowedUntil, validation.Match(timeOfDayRegexp)),
+		validation.Field(&i.Weekdays, validation.Each(validation.Min(0), validation.Max(6))),
+		validation.Field(&i.TimeZone, validTimeZone),
+		validation.Field(&i.VehicleClasses, validation.Each(validation.By(func(value interface{}) error {
+			if _, ok := vehicles.GetVehicleClass(value.(vehicles.VehicleClass)); !ok {
+				return errors.New("unknown vehicle class")
+			}
+			return nil
+		}))),
+		validation.Field(&i.MaxFare, validation.Min(1)),
+		validation.Field(&i.ExpenseCodes, validation.Each(validation.Required, validation.Length(0, 100))),
+	)
+	if err != nil {
+		return err
+	}
+	if i.AllowedFrom != "" || i.AllowedUntil != "" {
+		return validation.ValidateStruct(i,
+			validation.Field(&i.AllowedFrom, validation.Required),
+			validation.Field(&i.AllowedUntil, validation.Required),
+		)
+	}
+	return nil
+}
+
+// minutesOfDay parses a HH:MM time of day
+func minutesOfDay(value string) int {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0
+	}
+	return t.Hour()*60 + t.Minute()
+}
+
+// allowsTime returns whether a ride with pickup at t is within the allowed days and hours
+func (p RidePolicy) allowsTime(t time.Time) bool {
+	location, err := time.LoadLocation(p.TimeZone)
+	if err != nil {
+		location = time.UTC
+	}
+	t = t.In(location)
+	if len(p.Weekdays) > 0 && !slices.Contains(p.Weekdays, int(t.Weekday())) {
+		return false
+	}
+	if p.AllowedFrom == "" || p.AllowedUntil == "" {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	from, until := minutesOfDay(p.AllowedFrom), minutesOfDay(p.AllowedUntil)
+	if from <= until {
+		return minute >= from && minute < until
+	}
+	return minute >= from || minute < until
+}
+
+// Check returns an error if a ride with pickup at pickupAt in the vehicle class, billed with the expense code, breaks the policy.
+// The fare is checked by the caller, as the maximum fare is in the base currency
+func (p RidePolicy) Check(pickupAt time.Time, vehicleClass vehicles.VehicleClass, expenseCode string) error {
+	if !p.allowsTime(pickupAt) {
+		return core.Errorf(core.EINVALID, "rides are not allowed at this time by the policy of the organisation")
+	}
+	if len(p.VehicleClasses) > 0 && !slices.Contains(p.VehicleClasses, vehicleClass) {
+		return core.Errorf(core.EINVALID, "%v rides are not allowed by the policy of the organisation", vehicleClass)
+	}
+	if p.RequireExpenseCode && strings.TrimSpace(expenseCode) == "" {
+		return core.Errorf(core.EINVALID, "an expense code is required by the policy of the organisation")
+	}
+	if expenseCode != "" && len(p.ExpenseCodes) > 0 && !slices.Contains(p.ExpenseCodes, expenseCode) {
+		return core.Errorf(core.EINVALID, "unknown expense code %v", expenseCode)
+	}
+	return nil
+}
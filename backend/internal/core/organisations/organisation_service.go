@@ -0,0 +1,417 @@
+package organisations
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/users"
+	"github.com/samber/lo"
+)
+
+type OrganisationService struct {
+	organisationRepo OrganisationRepository
+	userRepo         users.UserRepository
+	pubsub           core.Pubsub
+}
+
+func NewService(organisationRepo OrganisationRepository, userRepo users.UserRepository, pubsub core.Pubsub) *OrganisationService {
+	return &OrganisationService{
+		organisationRepo: organisationRepo,
+		userRepo:         userRepo,
+		pubsub:           pubsub,
+	}
+}
+
+// requireAdmin returns an error if the user is neither an admin of the organisation nor a platform admin
+func (s *OrganisationService) requireAdmin(ctx context.Context, organisationID int64, user users.User) error {
+	if user.Role == users.RoleAdmin {
+		return nil
+	}
+	member, err := s.organisationRepo.GetMember(ctx, organisationID, user.ID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if member == nil || member.Role != MemberRoleAdmin {
+		return core.Errorf(core.EUNAUTHORIZED, "only admins of the organisation can do this")
+	}
+	return nil
+}
+
+// RequireAdmin returns the user if they are an admin of the organisation or a platform admin
+func (s *OrganisationService) RequireAdmin(ctx context.Context, userID string, organisationID int64) (users.User, error) {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return users.User{}, core.Errorw(core.EINTERNAL, err)
+	}
+	_, err = s.organisationRepo.GetOrganisation(ctx, organisationID)
+	if err != nil {
+		return users.User{}, core.WrapErr(err)
+	}
+	return user, s.requireAdmin(ctx, organisationID, user)
+}
+
+func (s *OrganisationService) CreateOrganisation(ctx context.Context, userID string, input *OrganisationInput) (Organisation, error) {
+	if err := input.Validate(); err != nil {
+		return Organisation{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return Organisation{}, core.Errorw(core.EINTERNAL, err)
+	}
+	now := time.Now().UTC()
+	organisation := Organisation{
+		Name:         input.Name,
+		BillingEmail: input.BillingEmail,
+		VATNumber:    input.VATNumber,
+		Address:      input.Address,
+		CreatedBy:    user.ID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	admin := Member{UserID: user.ID, Name: user.Name, Email: user.Email, Role: MemberRoleAdmin, JoinedAt: now}
+	err = s.organisationRepo.CreateOrganisation(ctx, &organisation, admin)
+	if err != nil {
+		return Organisation{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return organisation, nil
+}
+
+// GetMyOrganisations returns the organisations the user is a member of
+func (s *OrganisationService) GetMyOrganisations(ctx context.Context, userID string) ([]Organisation, error) {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return []Organisation{}, core.Errorw(core.EINTERNAL, err)
+	}
+	organisationList, err := s.organisationRepo.GetOrganisationsByUserID(ctx, user.ID)
+	if err != nil {
+		return []Organisation{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return organisationList, nil
+}
+
+// GetOrganisation returns the organisation to its members and platform admins
+func (s *OrganisationService) GetOrganisation(ctx context.Context, userID string, organisationID int64) (Organisation, error) {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return Organisation{}, core.Errorw(core.EINTERNAL, err)
+	}
+	organisation, err := s.organisationRepo.GetOrganisation(ctx, organisationID)
+	if err != nil {
+		return Organisation{}, core.WrapErr(err)
+	}
+	if user.Role != users.RoleAdmin {
+		member, err := s.organisationRepo.GetMember(ctx, organisationID, user.ID)
+		if err != nil {
+			return Organisation{}, core.Errorw(core.EINTERNAL, err)
+		}
+		if member == nil {
+			return Organisation{}, core.Errorf(core.EUNAUTHORIZED, "not a member of the organisation")
+		}
+	}
+	return organisation, nil
+}
+
+func (s *OrganisationService) UpdateOrganisation(ctx context.Context, userID string, organisationID int64, input *OrganisationInput) (Organisation, error) {
+	if err := input.Validate(); err != nil {
+		return Organisation{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	_, err := s.RequireAdmin(ctx, userID, organisationID)
+	if err != nil {
+		return Organisation{}, err
+	}
+	organisation, err := s.organisationRepo.GetOrganisation(ctx, organisationID)
+	if err != nil {
+		return Organisation{}, core.WrapErr(err)
+	}
+	organisation.Name = input.Name
+	organisation.BillingEmail = input.BillingEmail
+	organisation.VATNumber = input.VATNumber
+	organisation.Address = input.Address
+	organisation.UpdatedAt = time.Now().UTC()
+	err = s.organisationRepo.UpdateOrganisation(ctx, organisation)
+	if err != nil {
+		return Organisation{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return organisation, nil
+}
+
+func (s *OrganisationService) GetMembers(ctx context.Context, userID string, organisationID int64) ([]Member, error) {
+	_, err := s.RequireAdmin(ctx, userID, organisationID)
+	if err != nil {
+		return []Member{}, err
+	}
+	members, err := s.organisationRepo.GetMembers(ctx, organisationID)
+	if err != nil {
+		return []Member{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return members, nil
+}
+
+// RemoveMember removes the member from the organisation. Members can leave the organisation, admins can remove anyone but the last admin
+func (s *OrganisationService) RemoveMember(ctx context.Context, userID string, organisationID int64, memberUserID int64) error {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if user.ID != memberUserID {
+		if err := s.requireAdmin(ctx, organisationID, user); err != nil {
+			return err
+		}
+	}
+	members, err := s.organisationRepo.GetMembers(ctx, organisationID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	member, ok := lo.Find(members, func(item Member) bool { return item.UserID == memberUserID })
+	if !ok {
+		return core.Errorf(core.ENOTFOUND, "member with id %v not found", memberUserID)
+	}
+	admins := lo.CountBy(members, func(item Member) bool { return item.Role == MemberRoleAdmin })
+	if member.Role == MemberRoleAdmin && admins == 1 {
+		return core.Errorf(core.EINVALID, "cannot remove the last admin of the organisation")
+	}
+	err = s.organisationRepo.RemoveMember(ctx, organisationID, memberUserID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	return nil
+}
+
+// generateInviteToken returns a random token and the hash it is stored as
+func generateInviteToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashInviteToken(token), nil
+}
+
+func hashInviteToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// checkInviteToken returns an error if the token is not the token of the invite. Invites created before tokens have none and cannot be accepted
+func checkInviteToken(invite Invite, token string) error {
+	if invite.TokenHash == "" || subtle.ConstantTimeCompare([]byte(invite.TokenHash), []byte(hashInviteToken(token))) != 1 {
+		return core.Errorf(core.EUNAUTHORIZED, "invalid invite token")
+	}
+	return nil
+}
+
+// InviteMember invites the email address to join the organisation. The invite is emailed with a single use token it is accepted with
+func (s *OrganisationService) InviteMember(ctx context.Context, userID string, organisationID int64, input *InviteInput) (Invite, error) {
+	if err := input.Validate(); err != nil {
+		return Invite{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	user, err := s.RequireAdmin(ctx, userID, organisationID)
+	if err != nil {
+		return Invite{}, err
+	}
+	organisation, err := s.organisationRepo.GetOrganisation(ctx, organisationID)
+	if err != nil {
+		return Invite{}, core.WrapErr(err)
+	}
+	email := strings.ToLower(strings.TrimSpace(input.Email))
+	members, err := s.organisationRepo.GetMembers(ctx, organisationID)
+	if err != nil {
+		return Invite{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if lo.ContainsBy(members, func(item Member) bool { return strings.EqualFold(item.Email, email) }) {
+		return Invite{}, core.Errorf(core.ECONFLICT, "%v is already a member of the organisation", email)
+	}
+	token, tokenHash, err := generateInviteToken()
+	if err != nil {
+		return Invite{}, core.Errorw(core.EINTERNAL, err)
+	}
+	now := time.Now().UTC()
+	invite := Invite{
+		OrganisationID: organisationID,
+		Email:          email,
+		Role:           lo.Ternary(input.Role == "", MemberRoleMember, input.Role),
+		State:          InviteStatePending,
+		InvitedBy:      user.ID,
+		TokenHash:      tokenHash,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	created, err := s.organisationRepo.CreateInvite(ctx, &invite)
+	if err != nil {
+		return Invite{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if !created {
+		return Invite{}, core.Errorf(core.ECONFLICT, "%v has already been invited", email)
+	}
+
+	event := InviteCreatedEvent{
+		Invite:           invite,
+		OrganisationName: organisation.Name,
+		InvitedByName:    user.Name,
+		Token:            token,
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return Invite{}, core.Errorw(core.EINTERNAL, err)
+	}
+	s.pubsub.Publish(ctx, TopicOrganisationInviteCreated, eventBytes)
+	return invite, nil
+}
+
+func (s *OrganisationService) GetInvites(ctx context.Context, userID string, organisationID int64) ([]Invite, error) {
+	_, err := s.RequireAdmin(ctx, userID, organisationID)
+	if err != nil {
+		return []Invite{}, err
+	}
+	invites, err := s.organisationRepo.GetInvitesByOrganisationID(ctx, organisationID)
+	if err != nil {
+		return []Invite{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return invites, nil
+}
+
+func (s *OrganisationService) RevokeInvite(ctx context.Context, userID string, organisationID int64, inviteID int64) error {
+	_, err := s.RequireAdmin(ctx, userID, organisationID)
+	if err != nil {
+		return err
+	}
+	invite, err := s.organisationRepo.GetInvite(ctx, inviteID)
+	if err != nil {
+		return core.WrapErr(err)
+	}
+	if invite.OrganisationID != organisationID {
+		return core.Errorf(core.ENOTFOUND, "invite with id %v not found", inviteID)
+	}
+	revoked, err := s.organisationRepo.RevokeInvite(ctx, inviteID, time.Now().UTC())
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if !revoked {
+		return core.Errorf(core.EINVALID, "invite is no longer pending")
+	}
+	return nil
+}
+
+// GetInvite returns the invite the token was mailed with, so the user can see it before accepting it
+func (s *OrganisationService) GetInvite(ctx context.Context, inviteID int64, token string) (Invite, error) {
+	invite, err := s.organisationRepo.GetInvite(ctx, inviteID)
+	if err != nil {
+		return Invite{}, core.WrapErr(err)
+	}
+	if err := checkInviteToken(invite, token); err != nil {
+		return Invite{}, err
+	}
+	return invite, nil
+}
+
+// AcceptInvite makes the user a member of the organisation of the invite. The token mailed with the invite proves the user has the invited address,
+// as the email address of the user is not verified
+func (s *OrganisationService) AcceptInvite(ctx context.Context, userID string, inviteID int64, input *AcceptInviteInput) (Member, error) {
+	if err := input.Validate(); err != nil {
+		return Member{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return Member{}, core.Errorw(core.EINTERNAL, err)
+	}
+	invite, err := s.organisationRepo.GetInvite(ctx, inviteID)
+	if err != nil {
+		return Member{}, core.WrapErr(err)
+	}
+	if err := checkInviteToken(invite, input.Token); err != nil {
+		return Member{}, err
+	}
+	if invite.State != InviteStatePending {
+		return Member{}, core.Errorf(core.EINVALID, "invite is no longer pending")
+	}
+	existing, err := s.organisationRepo.GetMember(ctx, invite.OrganisationID, user.ID)
+	if err != nil {
+		return Member{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if existing != nil {
+		return Member{}, core.Errorf(core.ECONFLICT, "already a member of the organisation")
+	}
+	now := time.Now().UTC()
+	member := Member{
+		OrganisationID: invite.OrganisationID,
+		UserID:         user.ID,
+		Name:           user.Name,
+		Email:          user.Email,
+		Role:           invite.Role,
+		JoinedAt:       now,
+	}
+	invite.State = InviteStateAccepted
+	invite.AcceptedBy = &user.ID
+	invite.UpdatedAt = now
+	accepted, err := s.organisationRepo.AcceptInvite(ctx, &invite, member)
+	if err != nil {
+		return Member{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if !accepted {
+		return Member{}, core.Errorf(core.ECONFLICT, "invite is no longer pending")
+	}
+	return member, nil
+}
+
+func (s *OrganisationService) GetPolicy(ctx context.Context, userID string, organisationID int64) (RidePolicy, error) {
+	_, err := s.GetOrganisation(ctx, userID, organisationID)
+	if err != nil {
+		return RidePolicy{}, err
+	}
+	policy, err := s.organisationRepo.GetPolicy(ctx, organisationID)
+	if err != nil {
+		return RidePolicy{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return policy, nil
+}
+
+func (s *OrganisationService) SetPolicy(ctx context.Context, userID string, organisationID int64, input *RidePolicyInput) (RidePolicy, error) {
+	if err := input.Validate(); err != nil {
+		return RidePolicy{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	_, err := s.RequireAdmin(ctx, userID, organisationID)
+	if err != nil {
+		return RidePolicy{}, err
+	}
+	policy := RidePolicy{
+		OrganisationID:     organisationID,
+		AllowedFrom:        input.AllowedFrom,
+		AllowedUntil:       input.AllowedUntil,
+		Weekdays:           lo.Ternary(input.Weekdays == nil, []int{}, input.Weekdays),
+		TimeZone:           lo.Ternary(input.TimeZone == "", "UTC", input.TimeZone),
+		VehicleClasses:     lo.Uniq(input.VehicleClasses),
+		MaxFare:            input.MaxFare,
+		RequireExpenseCode: input.RequireExpenseCode,
+		ExpenseCodes:       lo.Ternary(input.ExpenseCodes == nil, []string{}, input.ExpenseCodes),
+		UpdatedAt:          time.Now().UTC(),
+	}
+	err = s.organisationRepo.SavePolicy(ctx, policy)
+	if err != nil {
+		return RidePolicy{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return policy, nil
+}
+
+// BillingPolicy returns the policy rides the user bills to the organisation must follow. Returns an error if the user is not a member
+func (s *OrganisationService) BillingPolicy(ctx context.Context, organisationID int64, memberUserID int64) (RidePolicy, error) {
+	member, err := s.organisationRepo.GetMember(ctx, organisationID, memberUserID)
+	if err != nil {
+		return RidePolicy{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if member == nil {
+		return RidePolicy{}, core.Errorf(core.EUNAUTHORIZED, "cannot bill rides to organisation you are not a member of")
+	}
+	policy, err := s.organisationRepo.GetPolicy(ctx, organisationID)
+	if err != nil {
+		return RidePolicy{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return policy, nil
+}
@@ -0,0 +1,45 @@
+package organisations
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+)
+
+func TestRidePolicyCheck(t *testing.T) {
+	// A Wednesday, 09:30 in Copenhagen
+	wednesdayMorning := time.Date(2024, 3, 13, 8, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		policy       RidePolicy
+		pickupAt     time.Time
+		vehicleClass vehicles.VehicleClass
+		expenseCode  string
+		wantErr      bool
+	}{
+		{"empty policy", RidePolicy{}, wednesdayMorning, vehicles.VehicleClassPremium, "", false},
+		{"within hours", RidePolicy{AllowedFrom: "08:00", AllowedUntil: "18:00", TimeZone: "Europe/Copenhagen"}, wednesdayMorning, vehicles.VehicleClassEconomy, "", false},
+		{"outside hours in time zone", RidePolicy{AllowedFrom: "09:00", AllowedUntil: "18:00", TimeZone: "America/New_York"}, wednesdayMorning, vehicles.VehicleClassEconomy, "", true},
+		{"window spanning midnight", RidePolicy{AllowedFrom: "22:00", AllowedUntil: "10:00", TimeZone: "Europe/Copenhagen"}, wednesdayMorning, vehicles.VehicleClassEconomy, "", false},
+		{"outside window spanning midnight", RidePolicy{AllowedFrom: "22:00", AllowedUntil: "06:00", TimeZone: "Europe/Copenhagen"}, wednesdayMorning, vehicles.VehicleClassEconomy, "", true},
+		{"until is exclusive", RidePolicy{AllowedFrom: "08:00", AllowedUntil: "09:30", TimeZone: "Europe/Copenhagen"}, wednesdayMorning, vehicles.VehicleClassEconomy, "", true},
+		{"allowed weekday", RidePolicy{Weekdays: []int{1, 2, 3, 4, 5}, TimeZone: "UTC"}, wednesdayMorning, vehicles.VehicleClassEconomy, "", false},
+		{"weekend only", RidePolicy{Weekdays: []int{0, 6}, TimeZone: "UTC"}, wednesdayMorning, vehicles.VehicleClassEconomy, "", true},
+		{"allowed class", RidePolicy{VehicleClasses: []vehicles.VehicleClass{vehicles.VehicleClassEconomy}}, wednesdayMorning, vehicles.VehicleClassEconomy, "", false},
+		{"disallowed class", RidePolicy{VehicleClasses: []vehicles.VehicleClass{vehicles.VehicleClassEconomy}}, wednesdayMorning, vehicles.VehicleClassPremium, "", true},
+		{"missing required expense code", RidePolicy{RequireExpenseCode: true}, wednesdayMorning, vehicles.VehicleClassEconomy, " ", true},
+		{"required expense code", RidePolicy{RequireExpenseCode: true}, wednesdayMorning, vehicles.VehicleClassEconomy, "SALES", false},
+		{"known expense code", RidePolicy{ExpenseCodes: []string{"SALES", "TRAVEL"}}, wednesdayMorning, vehicles.VehicleClassEconomy, "TRAVEL", false},
+		{"unknown expense code", RidePolicy{ExpenseCodes: []string{"SALES", "TRAVEL"}}, wednesdayMorning, vehicles.VehicleClassEconomy, "OTHER", true},
+		{"optional expense code omitted", RidePolicy{ExpenseCodes: []string{"SALES"}}, wednesdayMorning, vehicles.VehicleClassEconomy, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.pickupAt, tt.vehicleClass, tt.expenseCode)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package payments
+
+import "time"
+
+// CancellationPolicy decides cancellation fees. Fees are in minor units of the base currency
+type CancellationPolicy struct {
+	// Riders can cancel free of charge within this period after the ride is accepted
+	RiderGracePeriod time.Duration
+	RiderLateFee     int
+	RiderNoShowFee   int
+
+	// Drivers cancelling more than DriverMaxCancellations times within DriverCancellationWindow
+	// are not allowed to claim rides for DriverCooldown
+	DriverMaxCancellations   int
+	DriverCancellationWindow time.Duration
+	DriverCooldown           time.Duration
+	DriverPenaltyFee         int
+}
+
+// RiderCancellationFee returns the fee for a rider cancelling a ride. acceptedAt is nil if no driver has accepted the ride
+func (s *PaymentsService) RiderCancellationFee(acceptedAt *time.Time, now time.Time) int {
+	if acceptedAt == nil || now.Sub(*acceptedAt) <= s.cancellationPolicy.RiderGracePeriod {
+		return 0
+	}
+	return s.cancellationPolicy.RiderLateFee
+}
+
+// NoShowFee returns the fee charged to a rider that did not show up at the pickup location
+func (s *PaymentsService) NoShowFee() int {
+	return s.cancellationPolicy.RiderNoShowFee
+}
+
+// DriverCancellationFee returns the penalty for a driver releasing a ride
+func (s *PaymentsService) DriverCancellationFee() int {
+	return s.cancellationPolicy.DriverPenaltyFee
+}
+
+// DriverCancellationLookback returns how far back driver cancellations can affect the cooldown
+func (s *PaymentsService) DriverCancellationLookback() time.Duration {
+	return s.cancellationPolicy.DriverCancellationWindow + s.cancellationPolicy.DriverCooldown
+}
+
+// DriverCooldownUntil returns the time until which a driver with the given cancellation times is not allowed to claim rides.
+// Returns false if the driver is not in cooldown
+func (s *PaymentsService) DriverCooldownUntil(cancellationTimes []time.Time, now time.Time) (time.Time, bool) {
+	policy := s.cancellationPolicy
+	if policy.DriverMaxCancellations <= 0 || len(cancellationTimes) == 0 {
+		return time.Time{}, false
+	}
+	latest := cancellationTimes[0]
+	for _, t := range cancellationTimes[1:] {
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	count := 0
+	for _, t := range cancellationTimes {
+		if latest.Sub(t) <= policy.DriverCancellationWindow {
+			count++
+		}
+	}
+	if count <= policy.DriverMaxCancellations {
+		return time.Time{}, false
+	}
+	cooldownUntil := latest.Add(policy.DriverCooldown)
+	if !cooldownUntil.After(now) {
+		return time.Time{}, false
+	}
+	return cooldownUntil, true
+}
@@ -0,0 +1,132 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// CommissionPolicy configures the commission taken from the fares of rides
+type CommissionPolicy struct {
+	// Rate of cities and classes without a configured rate, between 0 and 1
+	DefaultRate float64
+}
+
+// CommissionRate is the share of the fare the platform takes from rides in a city and vehicle class.
+// An empty CityID or VehicleClass applies to all cities or classes
+type CommissionRate struct {
+	CityID       string                `json:"cityId"`
+	VehicleClass vehicles.VehicleClass `json:"vehicleClass"`
+	Rate         float64               `json:"rate"`
+	UpdatedAt    time.Time             `json:"updatedAt"`
+}
+
+type CommissionRateRepository interface {
+	GetRates(ctx context.Context) ([]CommissionRate, error)
+	// SaveRate creates or updates the rate of the city and vehicle class
+	SaveRate(ctx context.Context, rate CommissionRate) error
+	DeleteRate(ctx context.Context, cityID string, vehicleClass vehicles.VehicleClass) error
+}
+
+type SetCommissionRateInput struct {
+	CityID       string                `json:"cityId"`
+	VehicleClass vehicles.VehicleClass `json:"vehicleClass"`
+	Rate         float64               `json:"rate"`
+}
+
+func (i *SetCommissionRateInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.Rate, validation.Min(0.0), validation.Max(1.0)),
+	)
+}
+
+// commissionRate returns the rate of the city and vehicle class. A rate for the city and the class
+// takes precedence over a rate for the city, which takes precedence over a rate for the class
+func commissionRate(rates []CommissionRate, defaultRate float64, cityID string, vehicleClass vehicles.VehicleClass) float64 {
+	candidates := []CommissionRate{
+		{CityID: cityID, VehicleClass: vehicleClass},
+		{CityID: cityID},
+		{VehicleClass: vehicleClass},
+	}
+	for _, candidate := range candidates {
+		for _, rate := range rates {
+			if rate.CityID == candidate.CityID && rate.VehicleClass == candidate.VehicleClass {
+				return rate.Rate
+			}
+		}
+	}
+	return defaultRate
+}
+
+// Commission returns the commission of amount at the rate, rounded to the minor unit
+func Commission(amount int, rate float64) int {
+	return int(math.Round(float64(amount) * rate))
+}
+
+// CommissionRateAt returns the commission rate of a ride in the vehicle class starting at the point
+func (s *PaymentsService) CommissionRateAt(ctx context.Context, point geo.Point, vehicleClass vehicles.VehicleClass) (float64, error) {
+	rates, err := s.commissionRateRepo.GetRates(ctx)
+	if err != nil {
+		return 0, core.Errorw(core.EINTERNAL, err)
+	}
+	city, _ := geo.CityAt(point)
+	return commissionRate(rates, s.commissionPolicy.DefaultRate, city.ID, vehicles.ClassOrDefault(vehicleClass)), nil
+}
+
+func (s *PaymentsService) GetCommissionRates(ctx context.Context) ([]CommissionRate, error) {
+	rates, err := s.commissionRateRepo.GetRates(ctx)
+	if err != nil {
+		return []CommissionRate{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return rates, nil
+}
+
+// SetCommissionRate sets the rate of a city and vehicle class. Rides finished afterwards are charged the new rate
+func (s *PaymentsService) SetCommissionRate(ctx context.Context, input *SetCommissionRateInput) ([]CommissionRate, error) {
+	if err := input.Validate(); err != nil {
+		return []CommissionRate{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	if _, ok := geo.GetCity(input.CityID); input.CityID != "" && !ok {
+		return []CommissionRate{}, core.Errorf(core.EINVALID, "unknown city %v", input.CityID)
+	}
+	if _, ok := vehicles.GetVehicleClass(input.VehicleClass); input.VehicleClass != "" && !ok {
+		return []CommissionRate{}, core.Errorf(core.EINVALID, "unknown vehicle class %v", input.VehicleClass)
+	}
+	err := s.commissionRateRepo.SaveRate(ctx, CommissionRate{
+		CityID:       input.CityID,
+		VehicleClass: input.VehicleClass,
+		Rate:         input.Rate,
+		UpdatedAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		return []CommissionRate{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return s.GetCommissionRates(ctx)
+}
+
+// DeleteCommissionRate removes the rate of a city and vehicle class, so the next most specific rate applies
+func (s *PaymentsService) DeleteCommissionRate(ctx context.Context, cityID string, vehicleClass vehicles.VehicleClass) ([]CommissionRate, error) {
+	err := s.commissionRateRepo.DeleteRate(ctx, cityID, vehicleClass)
+	if err != nil {
+		return []CommissionRate{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return s.GetCommissionRates(ctx)
+}
+
+// RecordCommission records the commission of a finished ride, paid by the driver to the platform
+func (s *PaymentsService) RecordCommission(ctx context.Context, rideID int64, driverID int64, amount int, currency string) error {
+	return s.RecordTransfer(ctx, EntryCommission, fmt.Sprintf("ride:%v:commission", rideID), fmt.Sprintf("Commission for ride %v", rideID),
+		DriverAccount(driverID), PlatformRevenueAccount, amount, currency)
+}
+
+// RecordCommissionRefund records the commission returned to the driver on a fare adjustment, as the driver only pays back their share
+func (s *PaymentsService) RecordCommissionRefund(ctx context.Context, refundID int64, rideID int64, driverID int64, amount int, currency string) error {
+	return s.RecordTransfer(ctx, EntryCommission, fmt.Sprintf("refund:%v:commission", refundID), fmt.Sprintf("Commission refund for ride %v", rideID),
+		PlatformRevenueAccount, DriverAccount(driverID), amount, currency)
+}
@@ -0,0 +1,58 @@
+package payments
+
+import (
+	"testing"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+)
+
+func TestCommissionRate(t *testing.T) {
+	rates := []CommissionRate{
+		{CityID: "copenhagen", VehicleClass: vehicles.VehicleClassPremium, Rate: 0.15},
+		{CityID: "copenhagen", Rate: 0.2},
+		{VehicleClass: vehicles.VehicleClassPremium, Rate: 0.3},
+		{VehicleClass: vehicles.VehicleClassXL, Rate: 0.22},
+	}
+	tests := []struct {
+		name         string
+		cityID       string
+		vehicleClass vehicles.VehicleClass
+		want         float64
+	}{
+		{"city and class", "copenhagen", vehicles.VehicleClassPremium, 0.15},
+		{"city before class", "copenhagen", vehicles.VehicleClassXL, 0.2},
+		{"city", "copenhagen", vehicles.VehicleClassEconomy, 0.2},
+		{"class", "aarhus", vehicles.VehicleClassPremium, 0.3},
+		{"default", "aarhus", vehicles.VehicleClassEconomy, 0.25},
+		{"outside cities", "", vehicles.VehicleClassEconomy, 0.25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := commissionRate(rates, 0.25, tt.cityID, tt.vehicleClass); got != tt.want {
+				t.Errorf("commissionRate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommission(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount int
+		rate   float64
+		want   int
+	}{
+		{"whole", 10000, 0.25, 2500},
+		{"rounds down", 1001, 0.2, 200},
+		{"rounds half up", 1005, 0.1, 101},
+		{"zero rate", 10000, 0, 0},
+		{"negative amount", -1000, 0.25, -250},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Commission(tt.amount, tt.rate); got != tt.want {
+				t.Errorf("Commission() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
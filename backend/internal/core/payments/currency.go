@@ -0,0 +1,170 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/samber/lo"
+)
+
+// Where the icon of a currency is written relative to the amount
+const (
+	IconBefore = "before"
+	IconAfter  = "after"
+)
+
+type Currency struct {
+	// ISO 4217 code of the currency
+	Symbol string `json:"symbol"`
+	Icon   string `json:"icon"`
+	Name   string `json:"name"`
+	// Number of digits after the decimal separator. Amounts are stored in minor units, 10^-Decimals of the currency
+	Decimals     int    `json:"decimals"`
+	IconPosition string `json:"iconPosition"`
+}
+
+var currencies = []Currency{
+	{Symbol: "EUR", Icon: "€", Name: "Euro", Decimals: 2, IconPosition: IconBefore},
+	{Symbol: "DKK", Icon: "kr.", Name: "Danish krone", Decimals: 2, IconPosition: IconAfter},
+}
+
+func GetCurrency(code string) (Currency, bool) {
+	return lo.Find(currencies, func(item Currency) bool { return item.Symbol == code })
+}
+
+func (s *PaymentsService) GetCurrencies() []Currency {
+	return currencies
+}
+
+// FxRate is the number of units of the currency one unit of the base currency buys
+type FxRate struct {
+	Currency  string    `json:"currency"`
+	Rate      float64   `json:"rate"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type FxRateRepository interface {
+	GetRates(ctx context.Context) ([]FxRate, error)
+	// SaveRates creates or updates the rates
+	SaveRates(ctx context.Context, rates []FxRate) error
+}
+
+type SetFxRatesInput struct {
+	// Rate of each currency against the base currency
+	Rates map[string]float64 `json:"rates"`
+}
+
+func (i *SetFxRatesInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.Rates, validation.Required),
+	)
+}
+
+// convert converts an amount in minor units between currencies, given their rates against the base currency.
+// The result is rounded half away from zero to the minor unit of the target currency
+func convert(amount int, from Currency, fromRate float64, to Currency, toRate float64) int {
+	major := float64(amount) / math.Pow10(from.Decimals)
+	return int(math.Round(major / fromRate * toRate * math.Pow10(to.Decimals)))
+}
+
+// BaseCurrency returns the currency reports are made in and configured amounts are given in
+func (s *PaymentsService) BaseCurrency() string {
+	return s.baseCurrency
+}
+
+func (s *PaymentsService) GetFxRates(ctx context.Context) ([]FxRate, error) {
+	rates, err := s.fxRateRepo.GetRates(ctx)
+	if err != nil {
+		return []FxRate{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return rates, nil
+}
+
+// SetFxRates updates the rates of the currencies against the base currency
+func (s *PaymentsService) SetFxRates(ctx context.Context, input *SetFxRatesInput) ([]FxRate, error) {
+	if err := input.Validate(); err != nil {
+		return []FxRate{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	now := time.Now().UTC()
+	rates := make([]FxRate, 0, len(input.Rates))
+	for code, rate := range input.Rates {
+		if _, ok := GetCurrency(code); !ok {
+			return []FxRate{}, core.Errorf(core.EINVALID, "unknown currency %v", code)
+		}
+		if code == s.baseCurrency && rate != 1 {
+			return []FxRate{}, core.Errorf(core.EINVALID, "rate of the base currency %v must be 1", code)
+		}
+		if rate <= 0 {
+			return []FxRate{}, core.Errorf(core.EINVALID, "rate of %v must be positive", code)
+		}
+		rates = append(rates, FxRate{Currency: code, Rate: rate, UpdatedAt: now})
+	}
+	err := s.fxRateRepo.SaveRates(ctx, rates)
+	if err != nil {
+		return []FxRate{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return s.GetFxRates(ctx)
+}
+
+// LoadFxRatesFile sets the rates from a JSON file mapping currency codes to their rate against the base currency
+func (s *PaymentsService) LoadFxRatesFile(ctx context.Context, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	input := &SetFxRatesInput{}
+	err = json.Unmarshal(content, &input.Rates)
+	if err != nil {
+		return core.Errorf(core.EINVALID, "invalid fx rates file %v: %v", path, err)
+	}
+	_, err = s.SetFxRates(ctx, input)
+	return err
+}
+
+// Convert converts an amount in minor units from one currency to another
+func (s *PaymentsService) Convert(ctx context.Context, amount int, from string, to string) (int, error) {
+	if from == to || amount == 0 {
+		return amount, nil
+	}
+	fromCurrency, ok := GetCurrency(from)
+	if !ok {
+		return 0, core.Errorf(core.EINVALID, "unknown currency %v", from)
+	}
+	toCurrency, ok := GetCurrency(to)
+	if !ok {
+		return 0, core.Errorf(core.EINVALID, "unknown currency %v", to)
+	}
+	rates, err := s.fxRateRepo.GetRates(ctx)
+	if err != nil {
+		return 0, core.Errorw(core.EINTERNAL, err)
+	}
+	rateOf := func(code string) (float64, error) {
+		if code == s.baseCurrency {
+			return 1, nil
+		}
+		rate, ok := lo.Find(rates, func(item FxRate) bool { return item.Currency == code })
+		if !ok {
+			return 0, core.Errorf(core.EINTERNAL, "no fx rate for %v", code)
+		}
+		return rate.Rate, nil
+	}
+	fromRate, err := rateOf(from)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := rateOf(to)
+	if err != nil {
+		return 0, err
+	}
+	return convert(amount, fromCurrency, fromRate, toCurrency, toRate), nil
+}
+
+// LocalAmount converts an amount configured in the base currency, such as a fee, to the currency
+func (s *PaymentsService) LocalAmount(ctx context.Context, amount int, currency string) (int, error) {
+	return s.Convert(ctx, amount, s.baseCurrency, currency)
+}
@@ -0,0 +1,187 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// Series of invoice numbers. Numbers are sequential without gaps within a series
+const (
+	// Receipt of a single ride
+	InvoiceSeriesReceipt = "R"
+	// Consolidated invoice of the rides of a business rider in a month
+	InvoiceSeriesMonthly = "M"
+)
+
+// Invoice is a numbered receipt or consolidated invoice issued to a user
+type Invoice struct {
+	ID     int64  `json:"id"`
+	Series string `json:"series"`
+	Number int64  `json:"number"`
+	UserID int64  `json:"userId"`
+	// Set for receipts
+	RideID *int64 `json:"rideId"`
+	// First day of the month of a monthly invoice
+	PeriodStart *time.Time `json:"periodStart"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+// InvoiceNumber is the number printed on the invoice
+func (i Invoice) InvoiceNumber() string {
+	return fmt.Sprintf("%v-%06d", i.Series, i.Number)
+}
+
+// BillingProfile is the company details of a business rider, printed on their invoices
+type BillingProfile struct {
+	UserID      int64  `json:"userId"`
+	CompanyName string `json:"companyName"`
+	VATNumber   string `json:"vatNumber"`
+	Address     string `json:"address"`
+	// Set if the rider gets a consolidated invoice of their rides every month
+	MonthlyInvoice bool      `json:"monthlyInvoice"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+type SetBillingProfileInput struct {
+	CompanyName    string `json:"companyName"`
+	VATNumber      string `json:"vatNumber"`
+	Address        string `json:"address"`
+	MonthlyInvoice bool   `json:"monthlyInvoice"`
+}
+
+func (i *SetBillingProfileInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.CompanyName, validation.Required, validation.Length(2, 200)),
+		validation.Field(&i.VATNumber, validation.Length(0, 50)),
+		validation.Field(&i.Address, validation.Required, validation.Length(2, 500)),
+	)
+}
+
+type InvoiceRepository interface {
+	// IssueRideInvoice gives the ride the next number of the receipt series. Returns the existing invoice if the ride has one
+	IssueRideInvoice(ctx context.Context, rideID int64, userID int64, issuedAt time.Time) (Invoice, error)
+	// IssuePeriodInvoice gives the month of the user the next number of the monthly series.
+	// Returns the existing invoice and false if the month has one
+	IssuePeriodInvoice(ctx context.Context, userID int64, periodStart time.Time, issuedAt time.Time) (Invoice, bool, error)
+	// GetPeriodInvoice returns nil if the month of the user has no invoice
+	GetPeriodInvoice(ctx context.Context, userID int64, periodStart time.Time) (*Invoice, error)
+	// GetPeriodInvoices returns the monthly invoices of the user, newest first
+	GetPeriodInvoices(ctx context.Context, userID int64) ([]Invoice, error)
+	GetRideInvoices(ctx context.Context, rideIDs []int64) ([]Invoice, error)
+	// GetBillingProfile returns nil if the user has no billing profile
+	GetBillingProfile(ctx context.Context, userID int64) (*BillingProfile, error)
+	SaveBillingProfile(ctx context.Context, profile *BillingProfile) error
+	// GetMonthlyBillingProfiles returns the billing profiles of riders getting monthly invoices
+	GetMonthlyBillingProfiles(ctx context.Context) ([]BillingProfile, error)
+}
+
+// MonthStart returns the first instant of the month of t, in UTC
+func MonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// IssueRideInvoice returns the receipt invoice of a finished ride, numbering it the first time
+func (s *PaymentsService) IssueRideInvoice(ctx context.Context, rideID int64, riderID int64) (Invoice, error) {
+	invoice, err := s.invoiceRepo.IssueRideInvoice(ctx, rideID, riderID, time.Now().UTC())
+	if err != nil {
+		return Invoice{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return invoice, nil
+}
+
+// IssueMonthlyInvoice returns the invoice of the month starting at periodStart, numbering it the first time.
+// Returns false if the month was already invoiced
+func (s *PaymentsService) IssueMonthlyInvoice(ctx context.Context, userID int64, periodStart time.Time) (Invoice, bool, error) {
+	invoice, created, err := s.invoiceRepo.IssuePeriodInvoice(ctx, userID, periodStart, time.Now().UTC())
+	if err != nil {
+		return Invoice{}, false, core.Errorw(core.EINTERNAL, err)
+	}
+	return invoice, created, nil
+}
+
+// GetMonthlyInvoice returns nil if the month has not been invoiced
+func (s *PaymentsService) GetMonthlyInvoice(ctx context.Context, userID int64, periodStart time.Time) (*Invoice, error) {
+	invoice, err := s.invoiceRepo.GetPeriodInvoice(ctx, userID, periodStart)
+	if err != nil {
+		return nil, core.Errorw(core.EINTERNAL, err)
+	}
+	return invoice, nil
+}
+
+func (s *PaymentsService) GetMonthlyInvoices(ctx context.Context, userID string) ([]Invoice, error) {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return []Invoice{}, core.Errorw(core.EINTERNAL, err)
+	}
+	invoices, err := s.invoiceRepo.GetPeriodInvoices(ctx, user.ID)
+	if err != nil {
+		return []Invoice{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return invoices, nil
+}
+
+// GetRideInvoices returns the receipt invoices of the rides that have been numbered
+func (s *PaymentsService) GetRideInvoices(ctx context.Context, rideIDs []int64) ([]Invoice, error) {
+	if len(rideIDs) == 0 {
+		return []Invoice{}, nil
+	}
+	invoices, err := s.invoiceRepo.GetRideInvoices(ctx, rideIDs)
+	if err != nil {
+		return []Invoice{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return invoices, nil
+}
+
+// GetBillingProfile returns nil if the user is not a business rider
+func (s *PaymentsService) GetBillingProfile(ctx context.Context, userID int64) (*BillingProfile, error) {
+	profile, err := s.invoiceRepo.GetBillingProfile(ctx, userID)
+	if err != nil {
+		return nil, core.Errorw(core.EINTERNAL, err)
+	}
+	return profile, nil
+}
+
+func (s *PaymentsService) GetMyBillingProfile(ctx context.Context, userID string) (*BillingProfile, error) {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, core.Errorw(core.EINTERNAL, err)
+	}
+	return s.GetBillingProfile(ctx, user.ID)
+}
+
+// SetBillingProfile makes the user a business rider, or updates their company details
+func (s *PaymentsService) SetBillingProfile(ctx context.Context, userID string, input *SetBillingProfileInput) (BillingProfile, error) {
+	if err := input.Validate(); err != nil {
+		return BillingProfile{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return BillingProfile{}, core.Errorw(core.EINTERNAL, err)
+	}
+	profile := BillingProfile{
+		UserID:         user.ID,
+		CompanyName:    input.CompanyName,
+		VATNumber:      input.VATNumber,
+		Address:        input.Address,
+		MonthlyInvoice: input.MonthlyInvoice,
+		UpdatedAt:      time.Now().UTC(),
+	}
+	err = s.invoiceRepo.SaveBillingProfile(ctx, &profile)
+	if err != nil {
+		return BillingProfile{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return profile, nil
+}
+
+func (s *PaymentsService) GetMonthlyBillingProfiles(ctx context.Context) ([]BillingProfile, error) {
+	profiles, err := s.invoiceRepo.GetMonthlyBillingProfiles(ctx)
+	if err != nil {
+		return []BillingProfile{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return profiles, nil
+}
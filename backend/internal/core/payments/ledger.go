@@ -0,0 +1,199 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/samber/lo"
+)
+
+type AccountType string
+
+const (
+	// Wallet of a rider. A negative balance is owed by the rider
+	AccountRider AccountType = "rider"
+	// Earnings of a driver not yet paid out
+	AccountDriver AccountType = "driver"
+	// Commission and fees earned by the platform
+	AccountPlatformRevenue AccountType = "platform_revenue"
+	// Money outside the ledger, such as card payments and bank transfers
+	AccountExternal AccountType = "external"
+	// Funds discounts given to riders through promotions
+	AccountMarketing AccountType = "marketing"
+	// Rides billed centrally to an organisation. A negative balance is owed by the organisation
+	AccountOrganisation AccountType = "organisation"
+)
+
+// Account is a ledger account. OwnerID is the user owning a rider or driver account, the organisation owning an organisation account,
+// and 0 for platform accounts
+type Account struct {
+	Type    AccountType `json:"type"`
+	OwnerID int64       `json:"ownerId"`
+}
+
+func RiderAccount(riderID int64) Account {
+	return Account{Type: AccountRider, OwnerID: riderID}
+}
+
+func DriverAccount(driverID int64) Account {
+	return Account{Type: AccountDriver, OwnerID: driverID}
+}
+
+func OrganisationAccount(organisationID int64) Account {
+	return Account{Type: AccountOrganisation, OwnerID: organisationID}
+}
+
+var (
+	PlatformRevenueAccount = Account{Type: AccountPlatformRevenue}
+	ExternalAccount        = Account{Type: AccountExternal}
+	MarketingAccount       = Account{Type: AccountMarketing}
+)
+
+type EntryType string
+
+const (
+	EntryFare       EntryType = "fare"
+	EntryCommission EntryType = "commission"
+	EntryTip        EntryType = "tip"
+	EntryRefund     EntryType = "refund"
+	// Correction of a fare after the ride, paid back by the driver
+	EntryAdjustment EntryType = "adjustment"
+	EntryFee        EntryType = "fee"
+	EntryPayout     EntryType = "payout"
+	// Promotion discount, funded by marketing
+	EntryDiscount EntryType = "discount"
+	// Money received from a rider's payment method
+	EntryCharge EntryType = "charge"
+	// Referral reward, funded by marketing
+	EntryReferral EntryType = "referral"
+	// Waiting time, zone fees and extras added to the fare
+	EntrySurcharge EntryType = "surcharge"
+)
+
+// Posting is a change to the balance of an account, in minor units
+type Posting struct {
+	Account Account `json:"account"`
+	Amount  int     `json:"amount"`
+}
+
+// JournalEntry is an immutable ledger transaction. The amounts of its postings sum to zero
+type JournalEntry struct {
+	ID   int64     `json:"id"`
+	Type EntryType `json:"type"`
+	// Identifies what the entry records, an entry is only recorded once per reference
+	Reference   string    `json:"reference"`
+	Description string    `json:"description"`
+	Currency    string    `json:"currency"`
+	Postings    []Posting `json:"postings"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+func (e *JournalEntry) Validate() error {
+	if e.Reference == "" || e.Currency == "" {
+		return fmt.Errorf("entry must have a reference and a currency")
+	}
+	if len(e.Postings) < 2 {
+		return fmt.Errorf("entry %v must have at least two postings", e.Reference)
+	}
+	if lo.SomeBy(e.Postings, func(item Posting) bool { return item.Amount == 0 }) {
+		return fmt.Errorf("entry %v has a posting without amount", e.Reference)
+	}
+	if sum := lo.SumBy(e.Postings, func(item Posting) int { return item.Amount }); sum != 0 {
+		return fmt.Errorf("entry %v does not balance, postings sum to %v", e.Reference, sum)
+	}
+	return nil
+}
+
+type Balance struct {
+	AccountType AccountType `json:"accountType"`
+	Currency    string      `json:"currency"`
+	Amount      int         `json:"amount"`
+}
+
+// OwnerBalance is the balance of the account of an owner in a currency
+type OwnerBalance struct {
+	OwnerID  int64  `json:"ownerId"`
+	Currency string `json:"currency"`
+	Amount   int    `json:"amount"`
+}
+
+// AccountPosting is a posting to an account of a user, with its entry
+type AccountPosting struct {
+	EntryID     int64       `json:"entryId"`
+	Type        EntryType   `json:"type"`
+	Reference   string      `json:"reference"`
+	Description string      `json:"description"`
+	AccountType AccountType `json:"accountType"`
+	Amount      int         `json:"amount"`
+	Currency    string      `json:"currency"`
+	CreatedAt   time.Time   `json:"createdAt"`
+}
+
+type LedgerRepository interface {
+	// CreateEntry creates the entry and its postings atomically. Returns false if an entry with the reference exists
+	CreateEntry(ctx context.Context, entry *JournalEntry) (bool, error)
+	// GetBalances returns the balances of the accounts of the owner, derived from the postings
+	GetBalances(ctx context.Context, ownerID int64, accountTypes []AccountType) ([]Balance, error)
+	// GetOwnerBalances returns the balance of every account of the type, per owner and currency
+	GetOwnerBalances(ctx context.Context, accountType AccountType) ([]OwnerBalance, error)
+	// GetPostings returns the postings to the accounts of the owner in entries before beforeEntryID, newest first
+	GetPostings(ctx context.Context, ownerID int64, accountTypes []AccountType, beforeEntryID int64, limit int) ([]AccountPosting, error)
+	// GetUnbalancedEntries returns the IDs of entries whose postings do not sum to zero
+	GetUnbalancedEntries(ctx context.Context) ([]int64, error)
+}
+
+// RecordTransfer records an entry moving amount from one account to another.
+// Recording an entry with the same reference again does nothing
+func (s *PaymentsService) RecordTransfer(ctx context.Context, entryType EntryType, reference string, description string, from Account, to Account, amount int, currency string) error {
+	if amount == 0 {
+		return nil
+	}
+	entry := &JournalEntry{
+		Type:        entryType,
+		Reference:   reference,
+		Description: description,
+		Currency:    currency,
+		Postings: []Posting{
+			{Account: from, Amount: -amount},
+			{Account: to, Amount: amount},
+		},
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := entry.Validate(); err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	_, err := s.ledgerRepo.CreateEntry(ctx, entry)
+	return err
+}
+
+// RecordFare records the fare of a finished ride, owed by the payer to the driver. The payer is the rider, or the organisation the ride is billed to
+func (s *PaymentsService) RecordFare(ctx context.Context, rideID int64, payer Account, driverID int64, amount int, currency string) error {
+	return s.RecordTransfer(ctx, EntryFare, fmt.Sprintf("ride:%v:fare", rideID), fmt.Sprintf("Fare for ride %v", rideID),
+		payer, DriverAccount(driverID), amount, currency)
+}
+
+// RecordTip records a tip, credited to the driver in full
+func (s *PaymentsService) RecordTip(ctx context.Context, rideID int64, riderID int64, driverID int64, amount int, currency string) error {
+	return s.RecordTransfer(ctx, EntryTip, fmt.Sprintf("ride:%v:tip", rideID), fmt.Sprintf("Tip for ride %v", rideID),
+		RiderAccount(riderID), DriverAccount(driverID), amount, currency)
+}
+
+// RecordDiscount records a promotion discount on a ride, credited to the rider by marketing
+func (s *PaymentsService) RecordDiscount(ctx context.Context, redemptionID int64, rideID int64, riderID int64, amount int, currency string) error {
+	return s.RecordTransfer(ctx, EntryDiscount, fmt.Sprintf("redemption:%v:discount", redemptionID), fmt.Sprintf("Discount for ride %v", rideID),
+		MarketingAccount, RiderAccount(riderID), amount, currency)
+}
+
+// RecordReferralReward records the reward of the referrer or the referred user of a referral, credited to their wallet by marketing
+func (s *PaymentsService) RecordReferralReward(ctx context.Context, referralID int64, party string, userID int64, amount int, currency string) error {
+	return s.RecordTransfer(ctx, EntryReferral, fmt.Sprintf("referral:%v:%v", referralID, party), fmt.Sprintf("Referral reward for referral %v", referralID),
+		MarketingAccount, RiderAccount(userID), amount, currency)
+}
+
+// RecordCancellationFee records a cancellation fee paid by payer to payee
+func (s *PaymentsService) RecordCancellationFee(ctx context.Context, cancellationID int64, rideID int64, payer Account, payee Account, amount int, currency string) error {
+	return s.RecordTransfer(ctx, EntryFee, fmt.Sprintf("cancellation:%v:fee", cancellationID), fmt.Sprintf("Cancellation fee for ride %v", rideID),
+		payer, payee, amount, currency)
+}
@@ -0,0 +1,73 @@
+package payments
+
+import "testing"
+
+func TestJournalEntryValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   JournalEntry
+		wantErr bool
+	}{
+		{
+			name: "balanced",
+			entry: JournalEntry{Reference: "ride:1:fare", Currency: "DKK", Postings: []Posting{
+				{Account: RiderAccount(1), Amount: -10000},
+				{Account: DriverAccount(2), Amount: 10000},
+			}},
+		},
+		{
+			name: "balanced over three postings",
+			entry: JournalEntry{Reference: "ride:1:fare", Currency: "DKK", Postings: []Posting{
+				{Account: RiderAccount(1), Amount: -10000},
+				{Account: DriverAccount(2), Amount: 8000},
+				{Account: PlatformRevenueAccount, Amount: 2000},
+			}},
+		},
+		{
+			name: "unbalanced",
+			entry: JournalEntry{Reference: "ride:1:fare", Currency: "DKK", Postings: []Posting{
+				{Account: RiderAccount(1), Amount: -10000},
+				{Account: DriverAccount(2), Amount: 9999},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "posting without amount",
+			entry: JournalEntry{Reference: "ride:1:fare", Currency: "DKK", Postings: []Posting{
+				{Account: RiderAccount(1), Amount: 0},
+				{Account: DriverAccount(2), Amount: 0},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "single posting",
+			entry: JournalEntry{Reference: "ride:1:fare", Currency: "DKK", Postings: []Posting{
+				{Account: RiderAccount(1), Amount: 0},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "missing reference",
+			entry: JournalEntry{Currency: "DKK", Postings: []Posting{
+				{Account: RiderAccount(1), Amount: -100},
+				{Account: DriverAccount(2), Amount: 100},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "missing currency",
+			entry: JournalEntry{Reference: "ride:1:fare", Postings: []Posting{
+				{Account: RiderAccount(1), Amount: -100},
+				{Account: DriverAccount(2), Amount: 100},
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.entry.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,21 +1,73 @@
 package payments
 
-type PaymentsService struct {
-}
+import (
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/users"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+)
 
-func NewService() *PaymentsService {
-	return &PaymentsService{}
+type Config struct {
+	Cancellation CancellationPolicy
+	// Discount applied to the fare of pooled rides, between 0 and 1
+	PooledDiscount float64
+	Tips           TipPolicy
+	Refunds        RefundPolicy
+	Commission     CommissionPolicy
+	Payouts        PayoutPolicy
+	Surcharges     SurchargePolicy
+	// Share of the fare authorised on top of the fare, to cover changes during the ride
+	AuthorisationBuffer float64
+	// Currency of reports and of the configured fees and limits
+	BaseCurrency string
 }
 
-func (s *PaymentsService) CalculatePrice(distanceInMeters int) int {
-	return calculatePrice(distanceInMeters)
+type PaymentsService struct {
+	cancellationPolicy  CancellationPolicy
+	pooledDiscount      float64
+	tipPolicy           TipPolicy
+	refundPolicy        RefundPolicy
+	commissionPolicy    CommissionPolicy
+	payoutPolicy        PayoutPolicy
+	surchargePolicy     SurchargePolicy
+	authorisationBuffer float64
+	baseCurrency        string
+	ledgerRepo          LedgerRepository
+	fxRateRepo          FxRateRepository
+	commissionRateRepo  CommissionRateRepository
+	invoiceRepo         InvoiceRepository
+	paymentRepo         PaymentRepository
+	payoutRepo          PayoutRepository
+	surchargeZoneRepo   SurchargeZoneRepository
+	userRepo            users.UserRepository
+	provider            PaymentProvider
+	pubsub              core.Pubsub
 }
 
-func (s *PaymentsService) GetCurrencies() []Currency {
-	return []Currency{
-		{
-			Symbol: "EUR",
-			Icon:   "€",
-		},
+func NewService(config Config, ledgerRepo LedgerRepository, fxRateRepo FxRateRepository, commissionRateRepo CommissionRateRepository, invoiceRepo InvoiceRepository, paymentRepo PaymentRepository, payoutRepo PayoutRepository, surchargeZoneRepo SurchargeZoneRepository, userRepo users.UserRepository, provider PaymentProvider, pubsub core.Pubsub) *PaymentsService {
+	return &PaymentsService{
+		cancellationPolicy:  config.Cancellation,
+		pooledDiscount:      config.PooledDiscount,
+		tipPolicy:           config.Tips,
+		refundPolicy:        config.Refunds,
+		commissionPolicy:    config.Commission,
+		payoutPolicy:        config.Payouts,
+		surchargePolicy:     config.Surcharges,
+		authorisationBuffer: config.AuthorisationBuffer,
+		baseCurrency:        config.BaseCurrency,
+		ledgerRepo:          ledgerRepo,
+		fxRateRepo:          fxRateRepo,
+		commissionRateRepo:  commissionRateRepo,
+		invoiceRepo:         invoiceRepo,
+		paymentRepo:         paymentRepo,
+		payoutRepo:          payoutRepo,
+		surchargeZoneRepo:   surchargeZoneRepo,
+		userRepo:            userRepo,
+		provider:            provider,
+		pubsub:              pubsub,
 	}
 }
+
+// CalculatePrice returns the fare of a ride in the currency, in minor units
+func (s *PaymentsService) CalculatePrice(vehicleClass vehicles.VehicleClass, currency string, distanceInMeters int) int {
+	return calculatePrice(rateCard(vehicleClass, currency), distanceInMeters)
+}
@@ -0,0 +1,396 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/samber/lo"
+)
+
+const (
+	TopicPayoutUpdated = "payout-updated"
+)
+
+// Number of payouts returned in the payout history of a driver
+const payoutHistoryLimit = 100
+
+type PayoutPolicy struct {
+	// Smallest driver balance that is paid out, in minor units of the base currency
+	MinAmount int
+}
+
+type PayoutState string
+
+const (
+	// Sent to the bank, not yet confirmed
+	PayoutStatePending PayoutState = "pending"
+	PayoutStatePaid    PayoutState = "paid"
+	// Rejected by the bank, the amount is credited back to the driver's balance
+	PayoutStateFailed PayoutState = "failed"
+)
+
+// PayoutAccount is the bank account a driver's earnings are paid out to
+type PayoutAccount struct {
+	DriverID   int64     `json:"driverId"`
+	HolderName string    `json:"holderName"`
+	IBAN       string    `json:"iban"`
+	BIC        string    `json:"bic"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+var (
+	ibanFormat = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z0-9]{11,30}$`)
+	bicFormat  = regexp.MustCompile(`^[A-Z]{6}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+)
+
+// normalizeAccountNumber removes spaces from an IBAN or BIC and upper cases it
+func normalizeAccountNumber(s string) string {
+	return strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+}
+
+// validIBAN reports whether the IBAN has a valid format and check digits
+func validIBAN(iban string) bool {
+	iban = normalizeAccountNumber(iban)
+	if !ibanFormat.MatchString(iban) {
+		return false
+	}
+	// The check digits make the number, with the country and check digits moved to the end and letters as 10 to 35, 1 modulo 97
+	var digits strings.Builder
+	for _, r := range iban[4:] + iban[:4] {
+		if r >= 'A' && r <= 'Z' {
+			fmt.Fprintf(&digits, "%d", r-'A'+10)
+		} else {
+			digits.WriteRune(r)
+		}
+	}
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+type SetPayoutAccountInput struct {
+	HolderName string `json:"holderName"`
+	IBAN       string `json:"iban"`
+	// Optional within SEPA
+	BIC string `json:"bic"`
+}
+
+func (i *SetPayoutAccountInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.HolderName, validation.Required, validation.Length(2, 70)),
+		validation.Field(&i.IBAN, validation.Required, validation.NewStringRule(validIBAN, "must be a valid IBAN")),
+		validation.Field(&i.BIC, validation.NewStringRule(func(s string) bool { return bicFormat.MatchString(normalizeAccountNumber(s)) }, "must be a valid BIC")),
+	)
+}
+
+// Payout is a transfer of a driver's earnings to their bank account
+type Payout struct {
+	ID       int64       `json:"id"`
+	BatchID  int64       `json:"batchId"`
+	DriverID int64       `json:"driverId"`
+	Amount   int         `json:"amount"`
+	Currency string      `json:"currency"`
+	State    PayoutState `json:"state"`
+	// The payout account when the payout was created
+	HolderName    string    `json:"holderName"`
+	IBAN          string    `json:"iban"`
+	BIC           string    `json:"bic"`
+	FailureReason *string   `json:"failureReason"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// Reference is the reference of the payout on the driver's bank statement
+func (p Payout) Reference() string {
+	return fmt.Sprintf("PAYOUT-%v", p.ID)
+}
+
+// PayoutBatch is the payouts in a currency sent to the bank together
+type PayoutBatch struct {
+	ID       int64  `json:"id"`
+	Currency string `json:"currency"`
+	// Number of payouts and their sum
+	Count     int       `json:"count"`
+	Total     int       `json:"total"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Only set when getting a single batch
+	Payouts []Payout `json:"payouts,omitempty"`
+}
+
+// PayoutUpdatedEvent is published when a payout is created, paid or fails
+type PayoutUpdatedEvent struct {
+	DriverID int64  `json:"driverId"`
+	Payout   Payout `json:"payout"`
+}
+
+type PayoutResult struct {
+	PayoutID int64       `json:"payoutId"`
+	State    PayoutState `json:"state"`
+	// Required for failed payouts
+	Reason string `json:"reason"`
+}
+
+// SettlePayoutsInput is the outcome of payouts reported by the bank
+type SettlePayoutsInput struct {
+	Results []PayoutResult `json:"results"`
+}
+
+func (i *SettlePayoutsInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.Results, validation.Required, validation.Each(validation.By(func(value interface{}) error {
+			result, _ := value.(PayoutResult)
+			if result.State != PayoutStatePaid && result.State != PayoutStateFailed {
+				return fmt.Errorf("state of payout %v must be paid or failed", result.PayoutID)
+			}
+			if result.State == PayoutStateFailed && result.Reason == "" {
+				return fmt.Errorf("failed payout %v must have a reason", result.PayoutID)
+			}
+			return nil
+		}))),
+	)
+}
+
+type PayoutRepository interface {
+	// GetPayoutAccount returns the payout account of the driver, nil if the driver has none
+	GetPayoutAccount(ctx context.Context, driverID int64) (*PayoutAccount, error)
+	GetPayoutAccounts(ctx context.Context, driverIDs []int64) ([]PayoutAccount, error)
+	// SavePayoutAccount creates or updates the payout account of the driver
+	SavePayoutAccount(ctx context.Context, account PayoutAccount) error
+	// CreateBatch creates the batch and its payouts atomically
+	CreateBatch(ctx context.Context, batch *PayoutBatch, payouts []Payout) error
+	// GetBatches returns the newest batches
+	GetBatches(ctx context.Context, limit int) ([]PayoutBatch, error)
+	GetBatch(ctx context.Context, batchID int64) (PayoutBatch, error)
+	GetPayoutsByBatchID(ctx context.Context, batchID int64) ([]Payout, error)
+	// GetPayoutsByDriverID returns the newest payouts of the driver
+	GetPayoutsByDriverID(ctx context.Context, driverID int64, limit int) ([]Payout, error)
+	GetPayoutsByState(ctx context.Context, state PayoutState) ([]Payout, error)
+	// SettlePayout changes a pending payout to paid or failed. Returns false if the payout is not pending
+	SettlePayout(ctx context.Context, payoutID int64, state PayoutState, failureReason *string, updatedAt time.Time) (bool, error)
+}
+
+// recordPayout records the payout leaving the driver's balance
+func (s *PaymentsService) recordPayout(ctx context.Context, payout Payout) error {
+	return s.RecordTransfer(ctx, EntryPayout, fmt.Sprintf("payout:%v", payout.ID), fmt.Sprintf("Payout %v", payout.Reference()),
+		DriverAccount(payout.DriverID), ExternalAccount, payout.Amount, payout.Currency)
+}
+
+// recordFailedPayout records the amount of a failed payout returning to the driver's balance
+func (s *PaymentsService) recordFailedPayout(ctx context.Context, payout Payout) error {
+	return s.RecordTransfer(ctx, EntryPayout, fmt.Sprintf("payout:%v:failed", payout.ID), fmt.Sprintf("Failed payout %v", payout.Reference()),
+		ExternalAccount, DriverAccount(payout.DriverID), payout.Amount, payout.Currency)
+}
+
+func (s *PaymentsService) publishPayoutUpdated(ctx context.Context, payout Payout) error {
+	eventBytes, err := json.Marshal(PayoutUpdatedEvent{DriverID: payout.DriverID, Payout: payout})
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	s.pubsub.Publish(ctx, TopicPayoutUpdated, eventBytes)
+	return nil
+}
+
+func (s *PaymentsService) GetMyPayoutAccount(ctx context.Context, userID string) (*PayoutAccount, error) {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, core.Errorw(core.EINTERNAL, err)
+	}
+	account, err := s.payoutRepo.GetPayoutAccount(ctx, user.ID)
+	if err != nil {
+		return nil, core.Errorw(core.EINTERNAL, err)
+	}
+	return account, nil
+}
+
+// SetPayoutAccount sets the bank account the driver's earnings are paid out to. Pending payouts keep the account they were created with
+func (s *PaymentsService) SetPayoutAccount(ctx context.Context, userID string, input *SetPayoutAccountInput) (PayoutAccount, error) {
+	if err := input.Validate(); err != nil {
+		return PayoutAccount{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return PayoutAccount{}, core.Errorw(core.EINTERNAL, err)
+	}
+	account := PayoutAccount{
+		DriverID:   user.ID,
+		HolderName: input.HolderName,
+		IBAN:       normalizeAccountNumber(input.IBAN),
+		BIC:        normalizeAccountNumber(input.BIC),
+		UpdatedAt:  time.Now().UTC(),
+	}
+	err = s.payoutRepo.SavePayoutAccount(ctx, account)
+	if err != nil {
+		return PayoutAccount{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return account, nil
+}
+
+// GetMyPayouts returns the newest payouts of the driver
+func (s *PaymentsService) GetMyPayouts(ctx context.Context, userID string) ([]Payout, error) {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return []Payout{}, core.Errorw(core.EINTERNAL, err)
+	}
+	payouts, err := s.payoutRepo.GetPayoutsByDriverID(ctx, user.ID, payoutHistoryLimit)
+	if err != nil {
+		return []Payout{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return payouts, nil
+}
+
+// CreatePayoutBatches pays out the balance of drivers with a payout account and at least the minimum amount,
+// in a batch per currency
+func (s *PaymentsService) CreatePayoutBatches(ctx context.Context) error {
+	// Payouts are created before their ledger entries. Recording the entries of pending payouts first
+	// makes sure an interrupted run is not paid out again
+	pending, err := s.payoutRepo.GetPayoutsByState(ctx, PayoutStatePending)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	for _, payout := range pending {
+		if err := s.recordPayout(ctx, payout); err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+	}
+
+	balances, err := s.ledgerRepo.GetOwnerBalances(ctx, AccountDriver)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	balances = lo.Filter(balances, func(item OwnerBalance, index int) bool { return item.Amount > 0 })
+	accounts, err := s.payoutRepo.GetPayoutAccounts(ctx, lo.Uniq(lo.Map(balances, func(item OwnerBalance, index int) int64 { return item.OwnerID })))
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	accountsByDriver := lo.KeyBy(accounts, func(item PayoutAccount) int64 { return item.DriverID })
+
+	now := time.Now().UTC()
+	for currency, currencyBalances := range lo.GroupBy(balances, func(item OwnerBalance) string { return item.Currency }) {
+		minAmount, err := s.LocalAmount(ctx, s.payoutPolicy.MinAmount, currency)
+		if err != nil {
+			return err
+		}
+		payouts := make([]Payout, 0)
+		for _, balance := range currencyBalances {
+			account, ok := accountsByDriver[balance.OwnerID]
+			if !ok || balance.Amount < minAmount {
+				continue
+			}
+			payouts = append(payouts, Payout{
+				DriverID:   balance.OwnerID,
+				Amount:     balance.Amount,
+				Currency:   currency,
+				State:      PayoutStatePending,
+				HolderName: account.HolderName,
+				IBAN:       account.IBAN,
+				BIC:        account.BIC,
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			})
+		}
+		if len(payouts) == 0 {
+			continue
+		}
+		batch := &PayoutBatch{Currency: currency, CreatedAt: now}
+		err = s.payoutRepo.CreateBatch(ctx, batch, payouts)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		for _, payout := range payouts {
+			if err := s.recordPayout(ctx, payout); err != nil {
+				return core.Errorw(core.EINTERNAL, err)
+			}
+			if err := s.publishPayoutUpdated(ctx, payout); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *PaymentsService) GetPayoutBatches(ctx context.Context) ([]PayoutBatch, error) {
+	batches, err := s.payoutRepo.GetBatches(ctx, payoutHistoryLimit)
+	if err != nil {
+		return []PayoutBatch{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return batches, nil
+}
+
+// GetPayoutBatch returns the batch with its payouts
+func (s *PaymentsService) GetPayoutBatch(ctx context.Context, batchID int64) (PayoutBatch, error) {
+	batch, err := s.payoutRepo.GetBatch(ctx, batchID)
+	if err != nil {
+		return PayoutBatch{}, core.WrapErr(err)
+	}
+	batch.Payouts, err = s.payoutRepo.GetPayoutsByBatchID(ctx, batchID)
+	if err != nil {
+		return PayoutBatch{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return batch, nil
+}
+
+// SettlePayouts marks pending payouts of the batch paid or failed. The amount of failed payouts is
+// credited back to the driver and paid out in a later batch
+func (s *PaymentsService) SettlePayouts(ctx context.Context, batchID int64, input *SettlePayoutsInput) (PayoutBatch, error) {
+	if err := input.Validate(); err != nil {
+		return PayoutBatch{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	batch, err := s.GetPayoutBatch(ctx, batchID)
+	if err != nil {
+		return PayoutBatch{}, err
+	}
+	payoutsByID := lo.KeyBy(batch.Payouts, func(item Payout) int64 { return item.ID })
+	for _, result := range input.Results {
+		if _, ok := payoutsByID[result.PayoutID]; !ok {
+			return PayoutBatch{}, core.Errorf(core.EINVALID, "payout %v is not in batch %v", result.PayoutID, batchID)
+		}
+	}
+
+	now := time.Now().UTC()
+	for _, result := range input.Results {
+		payout := payoutsByID[result.PayoutID]
+		if payout.State == result.State {
+			// A run that failed after marking the payout failed may not have credited the driver back
+			if payout.State == PayoutStateFailed {
+				if err := s.recordFailedPayout(ctx, payout); err != nil {
+					return PayoutBatch{}, core.Errorw(core.EINTERNAL, err)
+				}
+			}
+			continue
+		}
+		if payout.State != PayoutStatePending {
+			return PayoutBatch{}, core.Errorf(core.ECONFLICT, "payout %v is already %v", payout.ID, payout.State)
+		}
+		// The payout may have been created by a run that did not get to record it
+		if err := s.recordPayout(ctx, payout); err != nil {
+			return PayoutBatch{}, core.Errorw(core.EINTERNAL, err)
+		}
+		var failureReason *string
+		if result.State == PayoutStateFailed {
+			failureReason = &result.Reason
+		}
+		updated, err := s.payoutRepo.SettlePayout(ctx, payout.ID, result.State, failureReason, now)
+		if err != nil {
+			return PayoutBatch{}, core.Errorw(core.EINTERNAL, err)
+		}
+		if !updated {
+			return PayoutBatch{}, core.Errorf(core.ECONFLICT, "payout %v was settled concurrently", payout.ID)
+		}
+		if result.State == PayoutStateFailed {
+			if err := s.recordFailedPayout(ctx, payout); err != nil {
+				return PayoutBatch{}, core.Errorw(core.EINTERNAL, err)
+			}
+		}
+		payout.State, payout.FailureReason, payout.UpdatedAt = result.State, failureReason, now
+		if err := s.publishPayoutUpdated(ctx, payout); err != nil {
+			return PayoutBatch{}, err
+		}
+	}
+	return s.GetPayoutBatch(ctx, batchID)
+}
@@ -0,0 +1,28 @@
+package payments
+
+import "testing"
+
+func TestValidIBAN(t *testing.T) {
+	tests := []struct {
+		name string
+		iban string
+		want bool
+	}{
+		{"valid", "DK5000400440116243", true},
+		{"valid with spaces", "GB82 WEST 1234 5698 7654 32", true},
+		{"valid lower case", "de89370400440532013000", true},
+		{"wrong check digits", "GB83WEST12345698765432", false},
+		{"swapped digits", "GB82WEST12345698765423", false},
+		{"too short", "DK50004004", false},
+		{"no country", "5000400440116243", false},
+		{"invalid character", "DK50004004401162-3", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validIBAN(tt.iban); got != tt.want {
+				t.Errorf("validIBAN(%q) = %v, want %v", tt.iban, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package payments
+
+import "math"
+
+// MaxPooledPrice returns the most a rider pays for a pooled ride that costs soloPrice when riding alone
+func (s *PaymentsService) MaxPooledPrice(soloPrice int) int {
+	return int(math.Round(float64(soloPrice) * (1 - s.pooledDiscount)))
+}
+
+// SplitPooledFare splits the fare of a pooled route between the riders in proportion to their prices of riding alone,
+// and applies the pooled discount. No rider pays more than MaxPooledPrice
+func (s *PaymentsService) SplitPooledFare(total int, soloPrices []int) []int {
+	soloTotal := 0
+	for _, price := range soloPrices {
+		soloTotal += price
+	}
+	shares := make([]int, len(soloPrices))
+	for i, price := range soloPrices {
+		if soloTotal == 0 {
+			continue
+		}
+		share := float64(total) * float64(price) / float64(soloTotal)
+		shares[i] = min(int(math.Round(share*(1-s.pooledDiscount))), s.MaxPooledPrice(price))
+	}
+	return shares
+}
@@ -0,0 +1,30 @@
+package payments
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitPooledFare(t *testing.T) {
+	s := &PaymentsService{pooledDiscount: 0.25}
+	tests := []struct {
+		name       string
+		total      int
+		soloPrices []int
+		want       []int
+	}{
+		{"equal riders", 20000, []int{10000, 10000}, []int{7500, 7500}},
+		{"in proportion to solo prices", 12000, []int{4000, 8000}, []int{3000, 6000}},
+		{"capped at the max pooled price", 30000, []int{10000, 10000}, []int{7500, 7500}},
+		{"single rider", 9000, []int{10000}, []int{6750}},
+		{"no solo prices", 10000, []int{0, 0}, []int{0, 0}},
+		{"no riders", 10000, []int{}, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.SplitPooledFare(tt.total, tt.soloPrices); !slices.Equal(got, tt.want) {
+				t.Errorf("SplitPooledFare() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,11 +1,62 @@
 package payments
 
-type Currency struct {
-	Symbol string `json:"symbol"`
-	Icon   string `json:"icon"`
+import (
+	"fmt"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+)
+
+// RateCard is the fare of a vehicle class, in minor units
+type RateCard struct {
+	BaseFare     int `json:"baseFare"`
+	PerKilometer int `json:"perKilometer"`
+}
+
+// Rate cards of each currency rides are priced in
+var rateCards = map[string]map[vehicles.VehicleClass]RateCard{
+	"EUR": {
+		vehicles.VehicleClassEconomy:    {BaseFare: 700, PerKilometer: 140},
+		vehicles.VehicleClassXL:         {BaseFare: 1000, PerKilometer: 190},
+		vehicles.VehicleClassPremium:    {BaseFare: 1500, PerKilometer: 260},
+		vehicles.VehicleClassAccessible: {BaseFare: 700, PerKilometer: 140},
+	},
+	"DKK": {
+		vehicles.VehicleClassEconomy:    {BaseFare: 5000, PerKilometer: 1000},
+		vehicles.VehicleClassXL:         {BaseFare: 7500, PerKilometer: 1400},
+		vehicles.VehicleClassPremium:    {BaseFare: 11000, PerKilometer: 1900},
+		vehicles.VehicleClassAccessible: {BaseFare: 5000, PerKilometer: 1000},
+	},
+}
+
+// rateCard returns the rate card of the class in the currency, falling back to the default class
+func rateCard(vehicleClass vehicles.VehicleClass, currency string) RateCard {
+	cards, ok := rateCards[currency]
+	if !ok {
+		cards = rateCards["EUR"]
+	}
+	card, ok := cards[vehicleClass]
+	if !ok {
+		return cards[vehicles.DefaultVehicleClass]
+	}
+	return card
 }
 
-func calculatePrice(distanceInMeters int) int {
+func calculatePrice(card RateCard, distanceInMeters int) int {
 	kilometers := distanceInMeters / 1000
-	return (700 + (140 * kilometers))
+	return (card.BaseFare + (card.PerKilometer * kilometers))
+}
+
+// FareComponent is a part of the fare of a ride, in minor units
+type FareComponent struct {
+	Name   string `json:"name"`
+	Amount int    `json:"amount"`
+}
+
+// FareComponents returns the components the fare of a ride in the currency is calculated from
+func (s *PaymentsService) FareComponents(vehicleClass vehicles.VehicleClass, currency string, distanceInMeters int) []FareComponent {
+	card := rateCard(vehicleClass, currency)
+	return []FareComponent{
+		{Name: "Base fare", Amount: card.BaseFare},
+		{Name: fmt.Sprintf("Distance, %v km", distanceInMeters/1000), Amount: card.PerKilometer * (distanceInMeters / 1000)},
+	}
 }
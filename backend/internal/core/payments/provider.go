@@ -0,0 +1,89 @@
+package payments
+
+import (
+	"context"
+	"time"
+)
+
+// IntentStatus is the status of a payment at the provider
+type IntentStatus string
+
+const (
+	// The payment needs confirmation, which the provider sends as an event
+	IntentStatusPending    IntentStatus = "pending"
+	IntentStatusAuthorised IntentStatus = "authorised"
+	IntentStatusCaptured   IntentStatus = "captured"
+	IntentStatusVoided     IntentStatus = "voided"
+	IntentStatusFailed     IntentStatus = "failed"
+)
+
+type ProviderEventType string
+
+const (
+	ProviderEventAuthorised ProviderEventType = "authorised"
+	ProviderEventCaptured   ProviderEventType = "captured"
+	ProviderEventVoided     ProviderEventType = "voided"
+	ProviderEventFailed     ProviderEventType = "failed"
+	ProviderEventRefunded   ProviderEventType = "refunded"
+	// Events the service does not handle
+	ProviderEventUnknown ProviderEventType = "unknown"
+)
+
+// PaymentIntent is a payment at the provider
+type PaymentIntent struct {
+	ID     string       `json:"id"`
+	Status IntentStatus `json:"status"`
+	// Amount authorised, in minor units
+	Amount         int    `json:"amount"`
+	AmountCaptured int    `json:"amountCaptured"`
+	Currency       string `json:"currency"`
+}
+
+type ProviderRefund struct {
+	ID       string `json:"id"`
+	IntentID string `json:"intentId"`
+	Amount   int    `json:"amount"`
+}
+
+type PaymentMethod struct {
+	ID    string `json:"id"`
+	Brand string `json:"brand"`
+	Last4 string `json:"last4"`
+	// Identifies the card, the same card added by different customers has the same fingerprint
+	Fingerprint string `json:"fingerprint"`
+}
+
+// ProviderEvent is an asynchronous notification from the provider. Providers may send an event more than once
+type ProviderEvent struct {
+	ID       string            `json:"id"`
+	Type     ProviderEventType `json:"type"`
+	IntentID string            `json:"intentId"`
+	// Amount captured or refunded, in minor units
+	Amount    int       `json:"amount"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type AuthoriseInput struct {
+	CustomerID      string
+	PaymentMethodID string
+	Amount          int
+	Currency        string
+	Description     string
+	// Retrying a call with the same key does not create another payment
+	IdempotencyKey string
+}
+
+// PaymentProvider charges riders through an external payment service
+type PaymentProvider interface {
+	CreateCustomer(ctx context.Context, userID int64, name string) (string, error)
+	// AttachPaymentMethod attaches the payment method the client tokenized to the customer
+	AttachPaymentMethod(ctx context.Context, customerID string, token string) (PaymentMethod, error)
+	// Authorise places a hold on the payment method, to be captured or voided later
+	Authorise(ctx context.Context, input AuthoriseInput) (PaymentIntent, error)
+	// Capture captures amount of an authorised payment and releases the rest of the hold
+	Capture(ctx context.Context, intentID string, amount int, idempotencyKey string) (PaymentIntent, error)
+	Void(ctx context.Context, intentID string, idempotencyKey string) (PaymentIntent, error)
+	Refund(ctx context.Context, intentID string, amount int, idempotencyKey string) (ProviderRefund, error)
+	// ParseWebhook verifies the signature of a webhook request and parses its event
+	ParseWebhook(payload []byte, signature string) (ProviderEvent, error)
+}
@@ -0,0 +1,63 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+)
+
+type RefundPolicy struct {
+	// Maximum amount a user of each role can refund on a ride in total, in minor units of the base currency. Roles not listed cannot refund
+	Limits map[string]int
+}
+
+// RefundLimit returns the amount a user with the role can refund on a ride
+func (s *PaymentsService) RefundLimit(role string) (int, bool) {
+	limit, ok := s.refundPolicy.Limits[role]
+	return limit, ok
+}
+
+// RecordRefund records money returned to the payee, the rider or the organisation the ride was billed to. Refunds are paid by the platform,
+// fare adjustments by the driver that was paid the fare
+func (s *PaymentsService) RecordRefund(ctx context.Context, entryType EntryType, refundID int64, rideID int64, payer Account, payee Account, amount int, currency string) error {
+	return s.RecordTransfer(ctx, entryType, fmt.Sprintf("refund:%v", refundID), fmt.Sprintf("Refund for ride %v", rideID),
+		payer, payee, amount, currency)
+}
+
+// RefundRide returns up to amount to the payment method charged for the ride, and returns the amount refunded.
+// Rides not paid by card are refunded to the rider's wallet only
+func (s *PaymentsService) RefundRide(ctx context.Context, rideID int64, refundID int64, amount int) (int, error) {
+	payment, err := s.paymentRepo.GetCapturedPayment(ctx, rideID)
+	if err != nil {
+		return 0, core.Errorw(core.EINTERNAL, err)
+	}
+	if payment == nil || payment.IntentID == nil {
+		return 0, nil
+	}
+	amount = min(amount, payment.CapturedAmount-payment.RefundedAmount)
+	if amount <= 0 {
+		return 0, nil
+	}
+	updated, err := s.paymentRepo.AddRefundedAmount(ctx, payment.ID, amount)
+	if err != nil {
+		return 0, core.Errorw(core.EINTERNAL, err)
+	}
+	if !updated {
+		return 0, core.Errorf(core.ECONFLICT, "payment of ride %v was refunded concurrently", rideID)
+	}
+	// The amount is reserved before calling the provider, so concurrent refunds cannot refund more than was captured
+	_, err = s.provider.Refund(ctx, *payment.IntentID, amount, fmt.Sprintf("refund:%v", refundID))
+	if err != nil {
+		if _, undoErr := s.paymentRepo.AddRefundedAmount(ctx, payment.ID, -amount); undoErr != nil {
+			return 0, core.Errorw(core.EINTERNAL, undoErr)
+		}
+		return 0, core.Errorw(core.EINTERNAL, err)
+	}
+	err = s.RecordTransfer(ctx, EntryRefund, fmt.Sprintf("refund:%v:card", refundID), fmt.Sprintf("Card refund for ride %v", rideID),
+		RiderAccount(payment.RiderID), ExternalAccount, amount, payment.Currency)
+	if err != nil {
+		return 0, core.Errorw(core.EINTERNAL, err)
+	}
+	return amount, nil
+}
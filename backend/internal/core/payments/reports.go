@@ -0,0 +1,45 @@
+package payments
+
+import (
+	"context"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+)
+
+// Accounts of the platform included in reports
+var reportAccountTypes = []AccountType{AccountPlatformRevenue, AccountMarketing, AccountExternal}
+
+// ReportBalance is a balance with its amount converted to the base currency
+type ReportBalance struct {
+	Balance
+	BaseAmount int `json:"baseAmount"`
+}
+
+// PlatformReport is the balances of the platform accounts, in their currencies and in the base currency
+type PlatformReport struct {
+	BaseCurrency string          `json:"baseCurrency"`
+	Balances     []ReportBalance `json:"balances"`
+	// Balance of each account type over all currencies, in the base currency
+	BaseTotals map[AccountType]int `json:"baseTotals"`
+}
+
+func (s *PaymentsService) GetPlatformReport(ctx context.Context) (PlatformReport, error) {
+	balances, err := s.ledgerRepo.GetBalances(ctx, 0, reportAccountTypes)
+	if err != nil {
+		return PlatformReport{}, core.Errorw(core.EINTERNAL, err)
+	}
+	report := PlatformReport{
+		BaseCurrency: s.baseCurrency,
+		Balances:     make([]ReportBalance, 0, len(balances)),
+		BaseTotals:   map[AccountType]int{},
+	}
+	for _, balance := range balances {
+		baseAmount, err := s.Convert(ctx, balance.Amount, balance.Currency, s.baseCurrency)
+		if err != nil {
+			return PlatformReport{}, err
+		}
+		report.Balances = append(report.Balances, ReportBalance{Balance: balance, BaseAmount: baseAmount})
+		report.BaseTotals[balance.AccountType] += baseAmount
+	}
+	return report, nil
+}
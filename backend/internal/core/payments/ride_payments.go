@@ -0,0 +1,500 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/users"
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+// Payment method attached for simulated riders. Accepted by the fake provider and by Stripe in test mode
+const SimulatedPaymentMethodToken = "tok_visa"
+
+type PaymentState int
+
+const (
+	PaymentStatePending PaymentState = iota
+	PaymentStateAuthorised
+	PaymentStateCaptured
+	PaymentStateVoided
+	PaymentStateFailed
+)
+
+// paymentTransitions are the states a payment can move to from each state.
+// Provider events can arrive late or more than once, so moving to a state not listed is ignored
+var paymentTransitions = map[PaymentState][]PaymentState{
+	PaymentStatePending:    {PaymentStateAuthorised, PaymentStateCaptured, PaymentStateVoided, PaymentStateFailed},
+	PaymentStateAuthorised: {PaymentStateCaptured, PaymentStateVoided, PaymentStateFailed},
+}
+
+// statesBefore returns the states a payment can move to state from
+func statesBefore(state PaymentState) []PaymentState {
+	from := make([]PaymentState, 0)
+	for s, to := range paymentTransitions {
+		if slices.Contains(to, state) {
+			from = append(from, s)
+		}
+	}
+	return from
+}
+
+var intentStates = map[IntentStatus]PaymentState{
+	IntentStatusPending:    PaymentStatePending,
+	IntentStatusAuthorised: PaymentStateAuthorised,
+	IntentStatusCaptured:   PaymentStateCaptured,
+	IntentStatusVoided:     PaymentStateVoided,
+	IntentStatusFailed:     PaymentStateFailed,
+}
+
+// PaymentCustomer is a user registered with the payment provider
+type PaymentCustomer struct {
+	UserID          int64     `json:"userId"`
+	CustomerID      string    `json:"-"`
+	PaymentMethodID string    `json:"-"`
+	CardBrand       string    `json:"cardBrand"`
+	CardLast4       string    `json:"cardLast4"`
+	CardFingerprint string    `json:"-"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+// RidePayment is a hold on the rider's payment method for the fare of a ride, or a charge for an amount added to the ride after it finished
+type RidePayment struct {
+	ID       int64        `json:"id"`
+	RideID   int64        `json:"rideId"`
+	RiderID  int64        `json:"riderId"`
+	IntentID *string      `json:"-"`
+	State    PaymentState `json:"state"`
+	// Identifies a charge, like the tip it pays for. Nil for the hold on the fare
+	Reference *string `json:"-"`
+	// Amount authorised, in minor units
+	Amount         int       `json:"amount"`
+	CapturedAmount int       `json:"capturedAmount"`
+	RefundedAmount int       `json:"refundedAmount"`
+	Currency       string    `json:"currency"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+type PaymentRepository interface {
+	// GetCustomer returns nil if the user is not registered with the provider
+	GetCustomer(ctx context.Context, userID int64) (*PaymentCustomer, error)
+	SaveCustomer(ctx context.Context, customer *PaymentCustomer) error
+	// CreatePayment creates the payment. Returns false if a payment with the reference already exists
+	CreatePayment(ctx context.Context, payment *RidePayment) (bool, error)
+	SetPaymentIntent(ctx context.Context, paymentID int64, intentID string) error
+	// GetActivePayment returns the newest pending or authorised hold on the fare of the ride, or nil
+	GetActivePayment(ctx context.Context, rideID int64) (*RidePayment, error)
+	// GetCapturedPayment returns the captured payment of the fare of the ride, or nil
+	GetCapturedPayment(ctx context.Context, rideID int64) (*RidePayment, error)
+	// GetPaymentByReference returns nil if no payment has the reference
+	GetPaymentByReference(ctx context.Context, reference string) (*RidePayment, error)
+	// ReleaseReference frees the reference of a failed or voided payment, so the reference can be charged again
+	ReleaseReference(ctx context.Context, paymentID int64) error
+	// AddRefundedAmount adds amount to the refunded amount, unless more than the captured amount would be refunded. Returns false if it would
+	AddRefundedAmount(ctx context.Context, paymentID int64, amount int) (bool, error)
+	// GetPaymentByIntentID returns nil if no payment has the intent
+	GetPaymentByIntentID(ctx context.Context, intentID string) (*RidePayment, error)
+	// UpdatePaymentState moves the payment to state if it is in one of the from states. Returns false if it was not
+	UpdatePaymentState(ctx context.Context, paymentID int64, from []PaymentState, state PaymentState, capturedAmount int) (bool, error)
+	// SaveProviderEvent stores the event. Returns false if the event has already been stored
+	SaveProviderEvent(ctx context.Context, event ProviderEvent) (bool, error)
+	IsProviderEventProcessed(ctx context.Context, eventID string) (bool, error)
+}
+
+type SetPaymentMethodInput struct {
+	// Payment method tokenized by the client with the provider
+	Token string `json:"token"`
+}
+
+func (i *SetPaymentMethodInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.Token, validation.Required),
+	)
+}
+
+// attachPaymentMethod registers the user with the provider if needed and makes the payment method the user's default
+func (s *PaymentsService) attachPaymentMethod(ctx context.Context, user users.User, token string) (PaymentCustomer, error) {
+	customer, err := s.paymentRepo.GetCustomer(ctx, user.ID)
+	if err != nil {
+		return PaymentCustomer{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if customer == nil {
+		customerID, err := s.provider.CreateCustomer(ctx, user.ID, user.Name)
+		if err != nil {
+			return PaymentCustomer{}, core.Errorw(core.EINTERNAL, err)
+		}
+		customer = &PaymentCustomer{UserID: user.ID, CustomerID: customerID}
+	}
+	method, err := s.provider.AttachPaymentMethod(ctx, customer.CustomerID, token)
+	if err != nil {
+		return PaymentCustomer{}, core.Errorf(core.EINVALID, "payment method could not be added: %v", err)
+	}
+	customer.PaymentMethodID = method.ID
+	customer.CardBrand = method.Brand
+	customer.CardLast4 = method.Last4
+	customer.CardFingerprint = method.Fingerprint
+	customer.UpdatedAt = time.Now().UTC()
+	err = s.paymentRepo.SaveCustomer(ctx, customer)
+	if err != nil {
+		return PaymentCustomer{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return *customer, nil
+}
+
+func (s *PaymentsService) SetPaymentMethod(ctx context.Context, userID string, input *SetPaymentMethodInput) (PaymentCustomer, error) {
+	if err := input.Validate(); err != nil {
+		return PaymentCustomer{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return PaymentCustomer{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return s.attachPaymentMethod(ctx, user, input.Token)
+}
+
+func (s *PaymentsService) GetPaymentMethod(ctx context.Context, userID string) (PaymentCustomer, error) {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return PaymentCustomer{}, core.Errorw(core.EINTERNAL, err)
+	}
+	customer, err := s.paymentRepo.GetCustomer(ctx, user.ID)
+	if err != nil {
+		return PaymentCustomer{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if customer == nil || customer.PaymentMethodID == "" {
+		return PaymentCustomer{}, core.Errorf(core.ENOTFOUND, "no payment method")
+	}
+	return *customer, nil
+}
+
+// SharePaymentMethod returns whether the users have added the same card
+func (s *PaymentsService) SharePaymentMethod(ctx context.Context, userID int64, otherUserID int64) (bool, error) {
+	customer, err := s.paymentRepo.GetCustomer(ctx, userID)
+	if err != nil || customer == nil || customer.CardFingerprint == "" {
+		return false, err
+	}
+	other, err := s.paymentRepo.GetCustomer(ctx, otherUserID)
+	if err != nil || other == nil {
+		return false, err
+	}
+	return customer.CardFingerprint == other.CardFingerprint, nil
+}
+
+// EnsurePaymentMethod returns an error if the rider cannot pay for rides.
+// Simulated riders get a test payment method
+func (s *PaymentsService) EnsurePaymentMethod(ctx context.Context, user users.User) error {
+	customer, err := s.paymentRepo.GetCustomer(ctx, user.ID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if customer != nil && customer.PaymentMethodID != "" {
+		return nil
+	}
+	if !user.Simulated {
+		return core.Errorf(core.EINVALID, "add a payment method before requesting rides")
+	}
+	_, err = s.attachPaymentMethod(ctx, user, SimulatedPaymentMethodToken)
+	return err
+}
+
+// applyIntent updates the payment from the status of its intent at the provider
+func (s *PaymentsService) applyIntent(ctx context.Context, payment *RidePayment, status IntentStatus, capturedAmount int) error {
+	state, ok := intentStates[status]
+	if !ok || state == payment.State {
+		return nil
+	}
+	if state == PaymentStateCaptured && slices.Contains(statesBefore(state), payment.State) {
+		// The charge is recorded before the state is moved, so a failed ledger write is retried with the payment.
+		// Recording is idempotent by reference
+		err := s.RecordTransfer(ctx, EntryCharge, fmt.Sprintf("payment:%v:capture", payment.ID), fmt.Sprintf("Card payment for ride %v", payment.RideID),
+			ExternalAccount, RiderAccount(payment.RiderID), capturedAmount, payment.Currency)
+		if err != nil {
+			return err
+		}
+	}
+	updated, err := s.paymentRepo.UpdatePaymentState(ctx, payment.ID, statesBefore(state), state, capturedAmount)
+	if err != nil || !updated {
+		return err
+	}
+	payment.State = state
+	payment.CapturedAmount = capturedAmount
+	return nil
+}
+
+// holdAmount is the amount held for a fare, including the buffer for changes to the fare
+func (s *PaymentsService) holdAmount(fare int) int {
+	return fare + int(math.Ceil(float64(fare)*s.authorisationBuffer))
+}
+
+// AuthoriseRide places a hold on the rider's payment method for the fare of the ride, plus a buffer for changes to the fare
+func (s *PaymentsService) AuthoriseRide(ctx context.Context, rideID int64, riderID int64, fare int, currency string) (RidePayment, error) {
+	if fare <= 0 {
+		return RidePayment{}, core.Errorf(core.EINVALID, "ride %v has no fare to authorise", rideID)
+	}
+	customer, err := s.paymentRepo.GetCustomer(ctx, riderID)
+	if err != nil {
+		return RidePayment{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if customer == nil || customer.PaymentMethodID == "" {
+		return RidePayment{}, core.Errorf(core.EINVALID, "rider has no payment method")
+	}
+	payment := &RidePayment{
+		RideID:    rideID,
+		RiderID:   riderID,
+		State:     PaymentStatePending,
+		Amount:    s.holdAmount(fare),
+		Currency:  currency,
+		CreatedAt: time.Now().UTC(),
+	}
+	payment.UpdatedAt = payment.CreatedAt
+	_, err = s.paymentRepo.CreatePayment(ctx, payment)
+	if err != nil {
+		return RidePayment{}, core.Errorw(core.EINTERNAL, err)
+	}
+	intent, err := s.provider.Authorise(ctx, AuthoriseInput{
+		CustomerID:      customer.CustomerID,
+		PaymentMethodID: customer.PaymentMethodID,
+		Amount:          payment.Amount,
+		Currency:        currency,
+		Description:     fmt.Sprintf("Ride %v", rideID),
+		IdempotencyKey:  fmt.Sprintf("ride-payment:%v:authorise", payment.ID),
+	})
+	if err != nil {
+		_, updateErr := s.paymentRepo.UpdatePaymentState(ctx, payment.ID, []PaymentState{PaymentStatePending}, PaymentStateFailed, 0)
+		if updateErr != nil {
+			return RidePayment{}, core.Errorw(core.EINTERNAL, updateErr)
+		}
+		return RidePayment{}, core.Errorf(core.EINVALID, "payment could not be authorised: %v", err)
+	}
+	payment.IntentID = &intent.ID
+	err = s.paymentRepo.SetPaymentIntent(ctx, payment.ID, intent.ID)
+	if err != nil {
+		return RidePayment{}, core.Errorw(core.EINTERNAL, err)
+	}
+	err = s.applyIntent(ctx, payment, intent.Status, intent.AmountCaptured)
+	if err != nil {
+		return RidePayment{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if payment.State == PaymentStateFailed {
+		return RidePayment{}, core.Errorf(core.EINVALID, "payment could not be authorised")
+	}
+	return *payment, nil
+}
+
+// CaptureRide captures amount of the hold on the ride, at most the authorised amount, and releases the rest.
+// An amount beyond the hold is charged separately once the hold is captured. Does nothing if the ride has no hold
+func (s *PaymentsService) CaptureRide(ctx context.Context, rideID int64, amount int) error {
+	payment, err := s.paymentRepo.GetActivePayment(ctx, rideID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if payment != nil && payment.IntentID != nil {
+		if amount <= 0 {
+			return s.VoidRide(ctx, rideID)
+		}
+		intent, err := s.provider.Capture(ctx, *payment.IntentID, min(amount, payment.Amount), fmt.Sprintf("ride-payment:%v:capture", payment.ID))
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		err = s.applyIntent(ctx, payment, intent.Status, intent.AmountCaptured)
+		if err != nil {
+			return err
+		}
+	}
+	// Looked up again so a capture that succeeded before a failed charge of the excess is completed when the ride is captured again
+	captured, err := s.paymentRepo.GetCapturedPayment(ctx, rideID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if captured == nil || amount <= captured.CapturedAmount {
+		return nil
+	}
+	return s.ChargeRide(ctx, rideID, captured.RiderID, amount-captured.CapturedAmount, captured.Currency, fmt.Sprintf("ride:%v:excess", rideID))
+}
+
+// ChargeRide charges amount to the rider's payment method for the ride, separately from the fare, for example for a tip.
+// The charge is identified by reference, so charging the same reference again resumes the charge instead of charging twice.
+// A declined charge is tried again as a new payment
+func (s *PaymentsService) ChargeRide(ctx context.Context, rideID int64, riderID int64, amount int, currency string, reference string) error {
+	if amount <= 0 {
+		return nil
+	}
+	payment, err := s.paymentRepo.GetPaymentByReference(ctx, reference)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if payment != nil && (payment.State == PaymentStateFailed || payment.State == PaymentStateVoided) {
+		err = s.paymentRepo.ReleaseReference(ctx, payment.ID)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		payment = nil
+	}
+	if payment != nil && (payment.Amount != amount || payment.Currency != currency) {
+		return core.Errorf(core.ECONFLICT, "%v has already been charged with another amount", reference)
+	}
+	if payment == nil {
+		payment = &RidePayment{
+			RideID:    rideID,
+			RiderID:   riderID,
+			State:     PaymentStatePending,
+			Reference: &reference,
+			Amount:    amount,
+			Currency:  currency,
+			CreatedAt: time.Now().UTC(),
+		}
+		payment.UpdatedAt = payment.CreatedAt
+		created, err := s.paymentRepo.CreatePayment(ctx, payment)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		if !created {
+			// Charged concurrently
+			payment, err = s.paymentRepo.GetPaymentByReference(ctx, reference)
+			if err != nil || payment == nil {
+				return core.Errorw(core.EINTERNAL, fmt.Errorf("payment %v not found: %w", reference, err))
+			}
+		}
+	}
+	if payment.IntentID == nil && payment.State == PaymentStatePending {
+		customer, err := s.paymentRepo.GetCustomer(ctx, riderID)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		if customer == nil || customer.PaymentMethodID == "" {
+			return core.Errorf(core.EINVALID, "rider has no payment method")
+		}
+		intent, err := s.provider.Authorise(ctx, AuthoriseInput{
+			CustomerID:      customer.CustomerID,
+			PaymentMethodID: customer.PaymentMethodID,
+			Amount:          payment.Amount,
+			Currency:        payment.Currency,
+			Description:     fmt.Sprintf("Ride %v", rideID),
+			IdempotencyKey:  fmt.Sprintf("ride-payment:%v:authorise", payment.ID),
+		})
+		if err != nil {
+			_, updateErr := s.paymentRepo.UpdatePaymentState(ctx, payment.ID, []PaymentState{PaymentStatePending}, PaymentStateFailed, 0)
+			if updateErr != nil {
+				return core.Errorw(core.EINTERNAL, updateErr)
+			}
+			return core.Errorf(core.EINVALID, "payment could not be charged: %v", err)
+		}
+		payment.IntentID = &intent.ID
+		err = s.paymentRepo.SetPaymentIntent(ctx, payment.ID, intent.ID)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		err = s.applyIntent(ctx, payment, intent.Status, intent.AmountCaptured)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+	}
+	switch payment.State {
+	case PaymentStateAuthorised:
+		intent, err := s.provider.Capture(ctx, *payment.IntentID, payment.Amount, fmt.Sprintf("ride-payment:%v:capture", payment.ID))
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		return s.applyIntent(ctx, payment, intent.Status, intent.AmountCaptured)
+	case PaymentStateVoided, PaymentStateFailed:
+		return core.Errorf(core.EINVALID, "payment could not be charged")
+	}
+	// Pending payments are captured when the charge is retried after the provider confirms them
+	return nil
+}
+
+// AdjustRideHold places a larger hold on the ride when its fare has grown beyond what the hold covers, and then releases the old hold.
+// A smaller fare is captured from the existing hold. Does nothing if the ride has no hold
+func (s *PaymentsService) AdjustRideHold(ctx context.Context, rideID int64, riderID int64, fare int, currency string) error {
+	payment, err := s.paymentRepo.GetActivePayment(ctx, rideID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if payment == nil || payment.IntentID == nil || s.holdAmount(fare) <= payment.Amount {
+		return nil
+	}
+	_, err = s.AuthoriseRide(ctx, rideID, riderID, fare, currency)
+	if err != nil {
+		return err
+	}
+	return s.voidPayment(ctx, payment)
+}
+
+// VoidRide releases the hold on the ride. Does nothing if the ride has no hold
+func (s *PaymentsService) VoidRide(ctx context.Context, rideID int64) error {
+	payment, err := s.paymentRepo.GetActivePayment(ctx, rideID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if payment == nil || payment.IntentID == nil {
+		return nil
+	}
+	return s.voidPayment(ctx, payment)
+}
+
+func (s *PaymentsService) voidPayment(ctx context.Context, payment *RidePayment) error {
+	intent, err := s.provider.Void(ctx, *payment.IntentID, fmt.Sprintf("ride-payment:%v:void", payment.ID))
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	return s.applyIntent(ctx, payment, intent.Status, intent.AmountCaptured)
+}
+
+// HandleWebhook processes an event sent by the provider. Events are processed once, repeated events are ignored
+func (s *PaymentsService) HandleWebhook(ctx context.Context, payload []byte, signature string) error {
+	event, err := s.provider.ParseWebhook(payload, signature)
+	if err != nil {
+		return core.Errorf(core.EINVALID, "invalid webhook: %v", err)
+	}
+	processed, err := s.paymentRepo.IsProviderEventProcessed(ctx, event.ID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if processed {
+		return nil
+	}
+	err = s.handleProviderEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+	// Saved after handling, so a failed event is handled again when the provider retries it.
+	// Handling is idempotent, so concurrent deliveries do not apply an event twice
+	_, err = s.paymentRepo.SaveProviderEvent(ctx, event)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	return nil
+}
+
+func (s *PaymentsService) handleProviderEvent(ctx context.Context, event ProviderEvent) error {
+	payment, err := s.paymentRepo.GetPaymentByIntentID(ctx, event.IntentID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if payment == nil {
+		return nil
+	}
+	var status IntentStatus
+	switch event.Type {
+	case ProviderEventAuthorised:
+		status = IntentStatusAuthorised
+	case ProviderEventCaptured:
+		status = IntentStatusCaptured
+	case ProviderEventVoided:
+		status = IntentStatusVoided
+	case ProviderEventFailed:
+		status = IntentStatusFailed
+	default:
+		return nil
+	}
+	err = s.applyIntent(ctx, payment, status, event.Amount)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	return nil
+}
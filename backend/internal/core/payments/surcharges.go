@@ -0,0 +1,189 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/samber/lo"
+)
+
+// SurchargePolicy configures the amounts added to the fare of rides. Amounts are in minor units of the base currency
+type SurchargePolicy struct {
+	// Charged per started minute the rider is picked up after the free waiting time
+	WaitingFeePerMinute int
+	// Largest extra a driver can log on a ride
+	ExtraMax int
+	// Drivers can log extras within this period after the ride has finished
+	ExtraWindow time.Duration
+}
+
+type SurchargeZoneType string
+
+const (
+	SurchargeZoneToll    SurchargeZoneType = "toll"
+	SurchargeZoneAirport SurchargeZoneType = "airport"
+	// Other zones with an entry fee, like congestion charge zones
+	SurchargeZoneEntry SurchargeZoneType = "zone"
+)
+
+var surchargeZoneTypes = []SurchargeZoneType{SurchargeZoneToll, SurchargeZoneAirport, SurchargeZoneEntry}
+
+// SurchargeZone is an area that adds a fee to the fare of rides entering it
+type SurchargeZone struct {
+	ID      int64             `json:"id"`
+	Name    string            `json:"name"`
+	Type    SurchargeZoneType `json:"type"`
+	Polygon geo.Polygon       `json:"polygon"`
+	// Fee in minor units of the base currency
+	Fee       int       `json:"fee"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ZoneFee is the fee of a zone a ride entered, in the currency of the ride
+type ZoneFee struct {
+	Zone   SurchargeZone `json:"zone"`
+	Amount int           `json:"amount"`
+}
+
+type SurchargeZoneRepository interface {
+	GetZones(ctx context.Context) ([]SurchargeZone, error)
+	GetZone(ctx context.Context, zoneID int64) (SurchargeZone, error)
+	CreateZone(ctx context.Context, zone *SurchargeZone) error
+	UpdateZone(ctx context.Context, zone SurchargeZone) error
+	DeleteZone(ctx context.Context, zoneID int64) error
+}
+
+type SurchargeZoneInput struct {
+	Name    string            `json:"name"`
+	Type    SurchargeZoneType `json:"type"`
+	Polygon geo.Polygon       `json:"polygon"`
+	Fee     int               `json:"fee"`
+}
+
+func (i *SurchargeZoneInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.Name, validation.Required, validation.Length(0, 200)),
+		validation.Field(&i.Type, validation.Required, validation.In(lo.ToAnySlice(surchargeZoneTypes)...)),
+		validation.Field(&i.Polygon, validation.Required, validation.Length(3, 1000)),
+		validation.Field(&i.Fee, validation.Min(0)),
+	)
+}
+
+func (s *PaymentsService) GetSurchargeZones(ctx context.Context) ([]SurchargeZone, error) {
+	zones, err := s.surchargeZoneRepo.GetZones(ctx)
+	if err != nil {
+		return []SurchargeZone{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return zones, nil
+}
+
+// CreateSurchargeZone adds a zone. Rides finished afterwards are charged its fee when they enter it
+func (s *PaymentsService) CreateSurchargeZone(ctx context.Context, input *SurchargeZoneInput) (SurchargeZone, error) {
+	if err := input.Validate(); err != nil {
+		return SurchargeZone{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	zone := SurchargeZone{
+		Name:      input.Name,
+		Type:      input.Type,
+		Polygon:   input.Polygon,
+		Fee:       input.Fee,
+		CreatedAt: time.Now().UTC(),
+	}
+	zone.UpdatedAt = zone.CreatedAt
+	err := s.surchargeZoneRepo.CreateZone(ctx, &zone)
+	if err != nil {
+		return SurchargeZone{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return zone, nil
+}
+
+func (s *PaymentsService) UpdateSurchargeZone(ctx context.Context, zoneID int64, input *SurchargeZoneInput) (SurchargeZone, error) {
+	if err := input.Validate(); err != nil {
+		return SurchargeZone{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	zone, err := s.surchargeZoneRepo.GetZone(ctx, zoneID)
+	if err != nil {
+		return SurchargeZone{}, core.WrapErr(err)
+	}
+	zone.Name = input.Name
+	zone.Type = input.Type
+	zone.Polygon = input.Polygon
+	zone.Fee = input.Fee
+	zone.UpdatedAt = time.Now().UTC()
+	err = s.surchargeZoneRepo.UpdateZone(ctx, zone)
+	if err != nil {
+		return SurchargeZone{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return zone, nil
+}
+
+func (s *PaymentsService) DeleteSurchargeZone(ctx context.Context, zoneID int64) error {
+	err := s.surchargeZoneRepo.DeleteZone(ctx, zoneID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	return nil
+}
+
+// WaitingFee returns the fee in the currency for the rider being picked up waited after the free waiting time.
+// Every started minute is charged
+func (s *PaymentsService) WaitingFee(ctx context.Context, waited time.Duration, currency string) (int, error) {
+	if waited <= 0 {
+		return 0, nil
+	}
+	perMinute, err := s.LocalAmount(ctx, s.surchargePolicy.WaitingFeePerMinute, currency)
+	if err != nil {
+		return 0, err
+	}
+	return int(math.Ceil(waited.Minutes())) * perMinute, nil
+}
+
+// ZoneFees returns the fees in the currency of the zones the path enters
+func (s *PaymentsService) ZoneFees(ctx context.Context, path []geo.Point, currency string) ([]ZoneFee, error) {
+	zones, err := s.surchargeZoneRepo.GetZones(ctx)
+	if err != nil {
+		return nil, core.Errorw(core.EINTERNAL, err)
+	}
+	fees := make([]ZoneFee, 0)
+	for _, zone := range zones {
+		if zone.Fee == 0 || !zone.Polygon.Intersects(path) {
+			continue
+		}
+		amount, err := s.LocalAmount(ctx, zone.Fee, currency)
+		if err != nil {
+			return nil, err
+		}
+		fees = append(fees, ZoneFee{Zone: zone, Amount: amount})
+	}
+	return fees, nil
+}
+
+// ExtraWindow returns how long after a ride has finished the driver can log extras
+func (s *PaymentsService) ExtraWindow() time.Duration {
+	return s.surchargePolicy.ExtraWindow
+}
+
+// ValidateExtra returns an error if the extra amount in the currency is above the configured limit
+func (s *PaymentsService) ValidateExtra(ctx context.Context, amount int, currency string) error {
+	maxExtra, err := s.LocalAmount(ctx, s.surchargePolicy.ExtraMax, currency)
+	if err != nil {
+		return err
+	}
+	if amount <= 0 || amount > maxExtra {
+		return core.Errorf(core.EINVALID, "extra must be between 1 and %v", maxExtra)
+	}
+	return nil
+}
+
+// RecordSurcharge records a surcharge line item of a ride, owed by the payer of the fare to the driver.
+// Surcharges cover the driver's costs, so no commission is taken from them
+func (s *PaymentsService) RecordSurcharge(ctx context.Context, lineItemID int64, rideID int64, payer Account, driverID int64, amount int, currency string) error {
+	return s.RecordTransfer(ctx, EntrySurcharge, fmt.Sprintf("line-item:%v", lineItemID), fmt.Sprintf("Surcharge for ride %v", rideID),
+		payer, DriverAccount(driverID), amount, currency)
+}
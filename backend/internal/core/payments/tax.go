@@ -0,0 +1,33 @@
+package payments
+
+import "math"
+
+// VATRate is the VAT rate rides are taxed with in a jurisdiction
+type VATRate struct {
+	// ISO 3166 code of the country
+	Jurisdiction string  `json:"jurisdiction"`
+	Rate         float64 `json:"rate"`
+}
+
+// VAT rates of passenger transport in the countries the service operates in
+var vatRates = []VATRate{
+	{Jurisdiction: "DK", Rate: 0.25},
+	// Reduced rate of local passenger transport
+	{Jurisdiction: "DE", Rate: 0.07},
+	{Jurisdiction: "NL", Rate: 0.09},
+}
+
+// GetVATRate returns the VAT rate of the jurisdiction. Rides outside the known jurisdictions are not taxed
+func GetVATRate(jurisdiction string) VATRate {
+	for _, rate := range vatRates {
+		if rate.Jurisdiction == jurisdiction {
+			return rate
+		}
+	}
+	return VATRate{Jurisdiction: jurisdiction}
+}
+
+// VATIncluded returns the VAT included in a gross amount in minor units, rounded half away from zero
+func VATIncluded(gross int, rate float64) int {
+	return int(math.Round(float64(gross) * rate / (1 + rate)))
+}
@@ -0,0 +1,37 @@
+package payments
+
+import (
+	"context"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+)
+
+type TipPolicy struct {
+	// Riders can tip within this period after the ride has finished
+	Window time.Duration
+	// Limits of a tip, in minor units of the base currency
+	Min int
+	Max int
+}
+
+// TipWindow returns how long after a ride has finished the rider can tip
+func (s *PaymentsService) TipWindow() time.Duration {
+	return s.tipPolicy.Window
+}
+
+// ValidateTip returns an error if the tip amount in the currency is outside the configured limits
+func (s *PaymentsService) ValidateTip(ctx context.Context, amount int, currency string) error {
+	minTip, err := s.LocalAmount(ctx, s.tipPolicy.Min, currency)
+	if err != nil {
+		return err
+	}
+	maxTip, err := s.LocalAmount(ctx, s.tipPolicy.Max, currency)
+	if err != nil {
+		return err
+	}
+	if amount < minTip || amount > maxTip {
+		return core.Errorf(core.EINVALID, "tip must be between %v and %v", minTip, maxTip)
+	}
+	return nil
+}
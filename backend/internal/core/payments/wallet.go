@@ -0,0 +1,66 @@
+package payments
+
+import (
+	"context"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+)
+
+// Number of transactions returned per page of the wallet history
+const walletTransactionsPageSize = 50
+
+// Accounts of a user shown in the wallet
+var walletAccountTypes = []AccountType{AccountRider, AccountDriver}
+
+type Wallet struct {
+	UserID int64 `json:"userId"`
+	// Balance of each account and currency the user has transactions in
+	Balances []Balance `json:"balances"`
+}
+
+func (s *PaymentsService) GetWallet(ctx context.Context, userID string) (Wallet, error) {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return Wallet{}, core.Errorw(core.EINTERNAL, err)
+	}
+	balances, err := s.ledgerRepo.GetBalances(ctx, user.ID, walletAccountTypes)
+	if err != nil {
+		return Wallet{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return Wallet{UserID: user.ID, Balances: balances}, nil
+}
+
+// GetOrganisationBalances returns the balances of the account of the organisation, what it owes for the rides billed to it
+func (s *PaymentsService) GetOrganisationBalances(ctx context.Context, organisationID int64) ([]Balance, error) {
+	balances, err := s.ledgerRepo.GetBalances(ctx, organisationID, []AccountType{AccountOrganisation})
+	if err != nil {
+		return []Balance{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return balances, nil
+}
+
+// GetWalletTransactions returns the transactions of the user's wallet, newest first.
+// beforeEntryID pages through older transactions, 0 returns the newest
+func (s *PaymentsService) GetWalletTransactions(ctx context.Context, userID string, beforeEntryID int64) ([]AccountPosting, error) {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return []AccountPosting{}, core.Errorw(core.EINTERNAL, err)
+	}
+	postings, err := s.ledgerRepo.GetPostings(ctx, user.ID, walletAccountTypes, beforeEntryID, walletTransactionsPageSize)
+	if err != nil {
+		return []AccountPosting{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return postings, nil
+}
+
+// CheckLedger returns an error if any journal entry does not balance
+func (s *PaymentsService) CheckLedger(ctx context.Context) error {
+	unbalanced, err := s.ledgerRepo.GetUnbalancedEntries(ctx)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if len(unbalanced) > 0 {
+		return core.Errorf(core.EINTERNAL, "ledger entries do not balance: %v", unbalanced)
+	}
+	return nil
+}
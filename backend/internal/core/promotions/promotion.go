@@ -0,0 +1,182 @@
+package promotions
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+type DiscountType string
+
+const (
+	DiscountPercentage DiscountType = "percentage"
+	DiscountFixed      DiscountType = "fixed"
+)
+
+// Promotion is a promo code riders can apply to rides
+type Promotion struct {
+	ID           int64        `json:"id"`
+	Code         string       `json:"code"`
+	DiscountType DiscountType `json:"discountType"`
+	// Percentage of the fare taken off, for percentage discounts
+	PercentOff int `json:"percentOff"`
+	// Amount taken off, for fixed discounts, in minor units of Currency
+	AmountOff int    `json:"amountOff"`
+	Currency  string `json:"currency"`
+	// Most a percentage discount takes off, 0 if unlimited
+	MaxDiscount int        `json:"maxDiscount"`
+	ValidFrom   *time.Time `json:"validFrom"`
+	ValidUntil  *time.Time `json:"validUntil"`
+	// IDs of the cities the code can be used in, all cities if empty
+	Cities        []string `json:"cities"`
+	FirstRideOnly bool     `json:"firstRideOnly"`
+	// Number of times each user can use the code, 0 if unlimited
+	PerUserLimit int `json:"perUserLimit"`
+	// Number of times the code can be used in total, 0 if unlimited
+	GlobalLimit int `json:"globalLimit"`
+	// Stackable codes can be combined with other stackable codes on a ride
+	Stackable   bool      `json:"stackable"`
+	Active      bool      `json:"active"`
+	Redemptions int       `json:"redemptions"`
+	CreatedBy   int64     `json:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// discount returns the amount taken off the fare
+func (p *Promotion) discount(fare int) int {
+	d := p.AmountOff
+	if p.DiscountType == DiscountPercentage {
+		d = fare * p.PercentOff / 100
+		if p.MaxDiscount > 0 {
+			d = min(d, p.MaxDiscount)
+		}
+	}
+	return max(0, min(d, fare))
+}
+
+type RedemptionState int
+
+const (
+	// The code is applied to a ride that has not finished
+	RedemptionStateReserved RedemptionState = iota
+	RedemptionStateRedeemed
+	// The ride was cancelled, the use of the code does not count
+	RedemptionStateReleased
+)
+
+// Redemption is the use of a promo code on a ride
+type Redemption struct {
+	ID          int64           `json:"id"`
+	PromotionID int64           `json:"promotionId"`
+	Code        string          `json:"code"`
+	UserID      int64           `json:"userId"`
+	RideID      *int64          `json:"rideId"`
+	State       RedemptionState `json:"state"`
+	// Set when the ride has finished
+	Discount  int       `json:"discount"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// AppliedPromotion is the discount of a promo code on a fare
+type AppliedPromotion struct {
+	PromotionID int64  `json:"promotionId"`
+	Code        string `json:"code"`
+	Discount    int    `json:"discount"`
+}
+
+// applyDiscounts applies the promotions to the fare. Percentages are taken off the fare before fixed amounts,
+// and the fare never goes below zero
+func applyDiscounts(promotionList []Promotion, fare int) []AppliedPromotion {
+	sorted := make([]Promotion, len(promotionList))
+	copy(sorted, promotionList)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].DiscountType == DiscountPercentage && sorted[j].DiscountType != DiscountPercentage
+	})
+	applied := make([]AppliedPromotion, 0, len(sorted))
+	remaining := fare
+	for _, promotion := range sorted {
+		discount := promotion.discount(remaining)
+		remaining -= discount
+		applied = append(applied, AppliedPromotion{PromotionID: promotion.ID, Code: promotion.Code, Discount: discount})
+	}
+	return applied
+}
+
+// NormalizeCode returns the code in the form it is stored in. Codes are case insensitive
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+type PromotionRepository interface {
+	CreatePromotion(ctx context.Context, promotion *Promotion) error
+	GetPromotions(ctx context.Context) ([]Promotion, error)
+	// GetByCodes returns the promotions with the codes, ignoring codes that do not exist
+	GetByCodes(ctx context.Context, codes []string) ([]Promotion, error)
+	SetActive(ctx context.Context, promotionID int64, active bool) error
+	// GetUserRedemptionCount returns how many times the user has used the promotion, not counting released uses
+	GetUserRedemptionCount(ctx context.Context, promotionID int64, userID int64) (int, error)
+	// ReserveRedemption atomically counts the use of the promotion and creates the redemption.
+	// Returns false if the use would exceed the global or per-user limit of the promotion
+	ReserveRedemption(ctx context.Context, redemption *Redemption) (bool, error)
+	AssignRide(ctx context.Context, redemptionIDs []int64, rideID int64) error
+	GetRedemptionsByRideID(ctx context.Context, rideID int64) ([]Redemption, error)
+	// RedeemRedemption marks a reserved redemption as redeemed with the discount. Returns false if it was not reserved
+	RedeemRedemption(ctx context.Context, redemptionID int64, discount int) (bool, error)
+	// ReleaseRedemptions marks the reserved redemptions as released and uncounts their use
+	ReleaseRedemptions(ctx context.Context, redemptionIDs []int64) error
+}
+
+type CreatePromotionInput struct {
+	Code          string       `json:"code"`
+	DiscountType  DiscountType `json:"discountType"`
+	PercentOff    int          `json:"percentOff"`
+	AmountOff     int          `json:"amountOff"`
+	Currency      string       `json:"currency"`
+	MaxDiscount   int          `json:"maxDiscount"`
+	ValidFrom     *time.Time   `json:"validFrom"`
+	ValidUntil    *time.Time   `json:"validUntil"`
+	Cities        []string     `json:"cities"`
+	FirstRideOnly bool         `json:"firstRideOnly"`
+	PerUserLimit  int          `json:"perUserLimit"`
+	GlobalLimit   int          `json:"globalLimit"`
+	Stackable     bool         `json:"stackable"`
+}
+
+func (i *CreatePromotionInput) Validate() error {
+	err := validation.ValidateStruct(i,
+		validation.Field(&i.Code, validation.Required, validation.Length(3, 32)),
+		validation.Field(&i.DiscountType, validation.Required, validation.In(DiscountPercentage, DiscountFixed)),
+		validation.Field(&i.MaxDiscount, validation.Min(0)),
+		validation.Field(&i.PerUserLimit, validation.Min(0)),
+		validation.Field(&i.GlobalLimit, validation.Min(0)),
+		validation.Field(&i.Cities, validation.Each(validation.By(func(value interface{}) error {
+			if _, ok := geo.GetCity(value.(string)); !ok {
+				return errors.New("unknown city")
+			}
+			return nil
+		}))),
+	)
+	if err != nil {
+		return err
+	}
+	if i.DiscountType == DiscountPercentage {
+		return validation.ValidateStruct(i,
+			validation.Field(&i.PercentOff, validation.Required, validation.Min(1), validation.Max(100)),
+		)
+	}
+	return validation.ValidateStruct(i,
+		validation.Field(&i.AmountOff, validation.Required, validation.Min(1)),
+		validation.Field(&i.Currency, validation.Required, validation.By(func(value interface{}) error {
+			if _, ok := payments.GetCurrency(value.(string)); !ok {
+				return errors.New("unknown currency")
+			}
+			return nil
+		})),
+	)
+}
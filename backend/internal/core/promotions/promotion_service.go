@@ -0,0 +1,263 @@
+package promotions
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/users"
+	"github.com/samber/lo"
+)
+
+// Most promo codes a rider can apply to a ride
+const MaxCodesPerRide = 3
+
+type PromotionService struct {
+	promotionRepo PromotionRepository
+	userRepo      users.UserRepository
+}
+
+func NewService(promotionRepo PromotionRepository, userRepo users.UserRepository) *PromotionService {
+	return &PromotionService{
+		promotionRepo: promotionRepo,
+		userRepo:      userRepo,
+	}
+}
+
+// RideContext is what promo codes are checked against
+type RideContext struct {
+	UserID int64
+	// ID of the city of the pickup, empty if the pickup is outside the cities
+	CityID   string
+	Currency string
+	// Whether the user has not finished a ride before
+	FirstRide bool
+	Now       time.Time
+}
+
+func (s *PromotionService) CreatePromotion(ctx context.Context, userID string, input *CreatePromotionInput) (Promotion, error) {
+	if err := input.Validate(); err != nil {
+		return Promotion{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return Promotion{}, core.Errorw(core.EINTERNAL, err)
+	}
+	code := NormalizeCode(input.Code)
+	existing, err := s.promotionRepo.GetByCodes(ctx, []string{code})
+	if err != nil {
+		return Promotion{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if len(existing) > 0 {
+		return Promotion{}, core.Errorf(core.ECONFLICT, "promo code %v already exists", code)
+	}
+	promotion := Promotion{
+		Code:          code,
+		DiscountType:  input.DiscountType,
+		PercentOff:    input.PercentOff,
+		AmountOff:     input.AmountOff,
+		Currency:      input.Currency,
+		MaxDiscount:   input.MaxDiscount,
+		ValidFrom:     input.ValidFrom,
+		ValidUntil:    input.ValidUntil,
+		Cities:        lo.Ternary(input.Cities == nil, []string{}, input.Cities),
+		FirstRideOnly: input.FirstRideOnly,
+		PerUserLimit:  input.PerUserLimit,
+		GlobalLimit:   input.GlobalLimit,
+		Stackable:     input.Stackable,
+		Active:        true,
+		CreatedBy:     user.ID,
+		CreatedAt:     time.Now().UTC(),
+	}
+	err = s.promotionRepo.CreatePromotion(ctx, &promotion)
+	if err != nil {
+		return Promotion{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return promotion, nil
+}
+
+func (s *PromotionService) GetPromotions(ctx context.Context) ([]Promotion, error) {
+	promotionList, err := s.promotionRepo.GetPromotions(ctx)
+	if err != nil {
+		return []Promotion{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return promotionList, nil
+}
+
+// DeactivatePromotion stops the code from being applied to new rides. Rides it has been applied to keep the discount
+func (s *PromotionService) DeactivatePromotion(ctx context.Context, promotionID int64) error {
+	err := s.promotionRepo.SetActive(ctx, promotionID, false)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	return nil
+}
+
+// checkPromotion returns an error if the promotion cannot be applied to the ride
+func (s *PromotionService) checkPromotion(ctx context.Context, promotion Promotion, ride RideContext) error {
+	if !promotion.Active {
+		return core.Errorf(core.EINVALID, "promo code %v is not valid", promotion.Code)
+	}
+	if (promotion.ValidFrom != nil && ride.Now.Before(*promotion.ValidFrom)) || (promotion.ValidUntil != nil && !ride.Now.Before(*promotion.ValidUntil)) {
+		return core.Errorf(core.EINVALID, "promo code %v is not valid at this time", promotion.Code)
+	}
+	if len(promotion.Cities) > 0 && !slices.Contains(promotion.Cities, ride.CityID) {
+		return core.Errorf(core.EINVALID, "promo code %v is not valid in this city", promotion.Code)
+	}
+	if promotion.Currency != "" && promotion.Currency != ride.Currency {
+		return core.Errorf(core.EINVALID, "promo code %v is not valid for rides in %v", promotion.Code, ride.Currency)
+	}
+	if promotion.FirstRideOnly && !ride.FirstRide {
+		return core.Errorf(core.EINVALID, "promo code %v is only valid on the first ride", promotion.Code)
+	}
+	if promotion.GlobalLimit > 0 && promotion.Redemptions >= promotion.GlobalLimit {
+		return core.Errorf(core.EINVALID, "promo code %v has been used up", promotion.Code)
+	}
+	if promotion.PerUserLimit > 0 {
+		used, err := s.promotionRepo.GetUserRedemptionCount(ctx, promotion.ID, ride.UserID)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		if used >= promotion.PerUserLimit {
+			return core.Errorf(core.EINVALID, "you have already used promo code %v", promotion.Code)
+		}
+	}
+	return nil
+}
+
+// GetApplicable returns the promotions of the codes, and an error if any of them cannot be applied to the ride.
+// Codes can only be combined if all of them are stackable
+func (s *PromotionService) GetApplicable(ctx context.Context, codes []string, ride RideContext) ([]Promotion, error) {
+	codes = lo.Uniq(lo.Map(codes, func(item string, index int) string { return NormalizeCode(item) }))
+	if len(codes) == 0 {
+		return []Promotion{}, nil
+	}
+	if len(codes) > MaxCodesPerRide {
+		return nil, core.Errorf(core.EINVALID, "at most %v promo codes can be applied to a ride", MaxCodesPerRide)
+	}
+	promotionList, err := s.promotionRepo.GetByCodes(ctx, codes)
+	if err != nil {
+		return nil, core.Errorw(core.EINTERNAL, err)
+	}
+	for _, code := range codes {
+		if !lo.ContainsBy(promotionList, func(item Promotion) bool { return item.Code == code }) {
+			return nil, core.Errorf(core.EINVALID, "promo code %v is not valid", code)
+		}
+	}
+	if len(promotionList) > 1 {
+		if notStackable, ok := lo.Find(promotionList, func(item Promotion) bool { return !item.Stackable }); ok {
+			return nil, core.Errorf(core.EINVALID, "promo code %v cannot be combined with other codes", notStackable.Code)
+		}
+	}
+	for _, promotion := range promotionList {
+		if err := s.checkPromotion(ctx, promotion, ride); err != nil {
+			return nil, err
+		}
+	}
+	return promotionList, nil
+}
+
+// Discounts returns the discounts of the promotions on the fare
+func (s *PromotionService) Discounts(promotionList []Promotion, fare int) []AppliedPromotion {
+	return applyDiscounts(promotionList, fare)
+}
+
+// Reserve counts a use of each promotion by the user. The limits of the promotions are enforced here,
+// so concurrent rides cannot use a code more often than allowed
+func (s *PromotionService) Reserve(ctx context.Context, userID int64, promotionList []Promotion) ([]Redemption, error) {
+	redemptions := make([]Redemption, 0, len(promotionList))
+	for _, promotion := range promotionList {
+		redemption := Redemption{
+			PromotionID: promotion.ID,
+			Code:        promotion.Code,
+			UserID:      userID,
+			State:       RedemptionStateReserved,
+			CreatedAt:   time.Now().UTC(),
+		}
+		reserved, err := s.promotionRepo.ReserveRedemption(ctx, &redemption)
+		if err == nil && !reserved {
+			err = core.Errorf(core.EINVALID, "promo code %v has been used up", promotion.Code)
+		}
+		if err != nil {
+			releaseErr := s.Release(ctx, redemptions)
+			if releaseErr != nil {
+				return nil, releaseErr
+			}
+			return nil, core.WrapErr(err)
+		}
+		redemptions = append(redemptions, redemption)
+	}
+	return redemptions, nil
+}
+
+// AssignRide links reserved redemptions to the ride they were reserved for
+func (s *PromotionService) AssignRide(ctx context.Context, redemptions []Redemption, rideID int64) error {
+	if len(redemptions) == 0 {
+		return nil
+	}
+	err := s.promotionRepo.AssignRide(ctx, lo.Map(redemptions, func(item Redemption, index int) int64 { return item.ID }), rideID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	return nil
+}
+
+// Release uncounts the reserved redemptions, so the codes can be used again
+func (s *PromotionService) Release(ctx context.Context, redemptions []Redemption) error {
+	if len(redemptions) == 0 {
+		return nil
+	}
+	err := s.promotionRepo.ReleaseRedemptions(ctx, lo.Map(redemptions, func(item Redemption, index int) int64 { return item.ID }))
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	return nil
+}
+
+// ReleaseRide releases the codes reserved for a ride that will not be finished
+func (s *PromotionService) ReleaseRide(ctx context.Context, rideID int64) error {
+	redemptions, err := s.promotionRepo.GetRedemptionsByRideID(ctx, rideID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	reserved := lo.Filter(redemptions, func(item Redemption, index int) bool { return item.State == RedemptionStateReserved })
+	return s.Release(ctx, reserved)
+}
+
+// RideDiscounts returns the redemptions of the ride that are reserved or redeemed. Reserved redemptions have their
+// discount calculated on the final fare, redeemed ones keep the discount they were redeemed with
+func (s *PromotionService) RideDiscounts(ctx context.Context, rideID int64, fare int) ([]Redemption, error) {
+	redemptions, err := s.promotionRepo.GetRedemptionsByRideID(ctx, rideID)
+	if err != nil {
+		return nil, core.Errorw(core.EINTERNAL, err)
+	}
+	redemptions = lo.Filter(redemptions, func(item Redemption, index int) bool { return item.State != RedemptionStateReleased })
+	if !lo.SomeBy(redemptions, func(item Redemption) bool { return item.State == RedemptionStateReserved }) {
+		return redemptions, nil
+	}
+	// The discounts are calculated for all the codes of the ride, so a code redeemed earlier does not change the discounts of the rest
+	codes := lo.Map(redemptions, func(item Redemption, index int) string { return item.Code })
+	promotionList, err := s.promotionRepo.GetByCodes(ctx, codes)
+	if err != nil {
+		return nil, core.Errorw(core.EINTERNAL, err)
+	}
+	discounts := lo.SliceToMap(applyDiscounts(promotionList, fare), func(item AppliedPromotion) (int64, int) {
+		return item.PromotionID, item.Discount
+	})
+	for i, redemption := range redemptions {
+		if redemption.State == RedemptionStateReserved {
+			redemptions[i].Discount = discounts[redemption.PromotionID]
+		}
+	}
+	return redemptions, nil
+}
+
+// Redeem marks the reserved redemption as redeemed with its discount. Redeeming twice does nothing
+func (s *PromotionService) Redeem(ctx context.Context, redemption Redemption) error {
+	_, err := s.promotionRepo.RedeemRedemption(ctx, redemption.ID, redemption.Discount)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	return nil
+}
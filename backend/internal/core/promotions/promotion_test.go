@@ -0,0 +1,44 @@
+package promotions
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestApplyDiscounts(t *testing.T) {
+	percentage := Promotion{ID: 1, Code: "TENOFF", DiscountType: DiscountPercentage, PercentOff: 10}
+	capped := Promotion{ID: 2, Code: "HALF", DiscountType: DiscountPercentage, PercentOff: 50, MaxDiscount: 2000}
+	fixed := Promotion{ID: 3, Code: "FIVE", DiscountType: DiscountFixed, AmountOff: 500}
+	large := Promotion{ID: 4, Code: "FREE", DiscountType: DiscountFixed, AmountOff: 50000}
+	tests := []struct {
+		name       string
+		promotions []Promotion
+		fare       int
+		want       []int
+	}{
+		{"percentage", []Promotion{percentage}, 10000, []int{1000}},
+		{"percentage capped", []Promotion{capped}, 10000, []int{2000}},
+		{"fixed", []Promotion{fixed}, 10000, []int{500}},
+		{"percentage before fixed", []Promotion{fixed, percentage}, 10000, []int{500, 1000}},
+		{"fixed taken off the discounted fare", []Promotion{percentage, fixed}, 1000, []int{100, 500}},
+		{"never below zero", []Promotion{large, fixed}, 10000, []int{10000, 0}},
+		{"no fare", []Promotion{percentage, fixed}, 0, []int{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied := applyDiscounts(tt.promotions, tt.fare)
+			// Discounts are compared in the order of the promotions
+			got := make([]int, 0, len(tt.promotions))
+			for _, promotion := range tt.promotions {
+				for _, a := range applied {
+					if a.PromotionID == promotion.ID {
+						got = append(got, a.Discount)
+					}
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("applyDiscounts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
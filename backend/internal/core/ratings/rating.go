@@ -0,0 +1,103 @@
+package ratings
+
+import (
+	"context"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/rides"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/samber/lo"
+)
+
+const (
+	TopicRideRated       = "ride-rated"
+	TopicDriverRatingLow = "driver-rating-low"
+)
+
+// Tags a rider can give a driver
+var driverTags = []string{
+	"safe_driving", "clean_vehicle", "friendly", "good_navigation", "great_conversation",
+	"unsafe_driving", "dirty_vehicle", "rude", "wrong_route", "late_pickup",
+}
+
+// Tags a driver can give a rider
+var riderTags = []string{
+	"polite", "on_time", "respectful", "late", "rude", "messy",
+}
+
+// Rating is the rating one party of a finished ride gives the other
+type Rating struct {
+	ID      int64 `json:"id"`
+	RideID  int64 `json:"rideId"`
+	RaterID int64 `json:"raterId"`
+	RateeID int64 `json:"rateeId"`
+	// The party of the ride that gave the rating, rides.PartyRider or rides.PartyDriver
+	RaterParty string    `json:"raterParty"`
+	Stars      int       `json:"stars"`
+	Tags       []string  `json:"tags"`
+	Comment    *string   `json:"comment"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type RatingAverage struct {
+	// Average of the most recent ratings, 0 if there are none
+	Average float64 `json:"average"`
+	// Total number of ratings
+	Count int `json:"count"`
+}
+
+// UserRatings are the ratings a user has received, as a rider and as a driver
+type UserRatings struct {
+	UserID   int64         `json:"userId"`
+	AsRider  RatingAverage `json:"asRider"`
+	AsDriver RatingAverage `json:"asDriver"`
+}
+
+type UserProfile struct {
+	ID      int64       `json:"id"`
+	Name    string      `json:"name"`
+	Ratings UserRatings `json:"ratings"`
+}
+
+type MyRatings struct {
+	UserRatings
+	// Most recent ratings received
+	Received []Rating `json:"received"`
+}
+
+// DriverRatingAlert is raised when the rolling average of a driver falls below the alert threshold
+type DriverRatingAlert struct {
+	DriverID  int64     `json:"driverId"`
+	Average   float64   `json:"average"`
+	Ratings   int       `json:"ratings"`
+	Threshold float64   `json:"threshold"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type RateRideInput struct {
+	Stars   int      `json:"stars"`
+	Tags    []string `json:"tags"`
+	Comment *string  `json:"comment"`
+}
+
+func (i *RateRideInput) validate(raterParty string) error {
+	tags := driverTags
+	if raterParty == rides.PartyDriver {
+		tags = riderTags
+	}
+	return validation.ValidateStruct(i,
+		validation.Field(&i.Stars, validation.Required, validation.Min(1), validation.Max(5)),
+		validation.Field(&i.Tags, validation.Each(validation.In(lo.ToAnySlice(tags)...))),
+		validation.Field(&i.Comment, validation.Length(0, 1000)),
+	)
+}
+
+type RatingRepository interface {
+	// CreateRating returns a core.ECONFLICT error if the rater has already rated the ride
+	CreateRating(ctx context.Context, rating *Rating) error
+	GetByRideID(ctx context.Context, rideID int64) ([]Rating, error)
+	// GetReceived returns the most recent ratings the user has received from the party, newest first
+	GetReceived(ctx context.Context, rateeID int64, raterParty string, limit int) ([]Rating, error)
+	// GetAverage returns the average of the window most recent ratings the user has received from the party
+	GetAverage(ctx context.Context, rateeID int64, raterParty string, window int) (RatingAverage, error)
+}
@@ -0,0 +1,247 @@
+package ratings
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/rides"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/users"
+	"github.com/samber/lo"
+)
+
+// Number of received ratings returned to a user
+const maxReceivedRatings = 50
+
+type Config struct {
+	// Time after a ride has finished in which its parties can rate each other
+	RatingWindow time.Duration
+	// Averages are calculated over this many of the most recent ratings
+	RollingWindow int
+	// Admins are alerted when the rolling average of a driver falls below this
+	DriverAlertThreshold float64
+	// Drivers with fewer ratings than this are not alerted on
+	DriverAlertMinRatings int
+}
+
+type RatingService struct {
+	config     Config
+	ratingRepo RatingRepository
+	rideRepo   rides.RideRepository
+	userRepo   users.UserRepository
+	pubsub     core.Pubsub
+}
+
+func NewService(config Config, ratingRepo RatingRepository, rideRepo rides.RideRepository, userRepo users.UserRepository, pubsub core.Pubsub) *RatingService {
+	return &RatingService{
+		config:     config,
+		ratingRepo: ratingRepo,
+		rideRepo:   rideRepo,
+		userRepo:   userRepo,
+		pubsub:     pubsub,
+	}
+}
+
+// rideParty returns the party of the ride the user is, or false if the user is not part of the ride
+func rideParty(ride rides.RideRequest, userID int64) (string, bool) {
+	if ride.RiderID == userID {
+		return rides.PartyRider, true
+	}
+	if ride.DriverID != nil && *ride.DriverID == userID {
+		return rides.PartyDriver, true
+	}
+	return "", false
+}
+
+// VisibleTo returns the rating as the user may see it.
+// Riders do not see the comments drivers write about them
+func (r Rating) VisibleTo(userID int64) Rating {
+	if r.RateeID == userID && r.RaterParty == rides.PartyDriver {
+		r.Comment = nil
+	}
+	return r
+}
+
+func visibleTo(ratings []Rating, userID int64) []Rating {
+	return lo.Map(ratings, func(item Rating, index int) Rating { return item.VisibleTo(userID) })
+}
+
+func averageStars(ratings []Rating) float64 {
+	if len(ratings) == 0 {
+		return 0
+	}
+	return float64(lo.SumBy(ratings, func(item Rating) int { return item.Stars })) / float64(len(ratings))
+}
+
+// RateRide rates the other party of a finished ride
+func (s *RatingService) RateRide(ctx context.Context, userID string, rideRequestId int64, input *RateRideInput) (Rating, error) {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return Rating{}, core.Errorw(core.EINTERNAL, err)
+	}
+	ride, err := s.rideRepo.GetByID(ctx, rideRequestId)
+	if err != nil {
+		return Rating{}, core.WrapErr(err)
+	}
+	party, ok := rideParty(ride, user.ID)
+	if !ok {
+		return Rating{}, core.Errorf(core.EUNAUTHORIZED, "cannot rate ride you are not part of")
+	}
+	if ride.State != rides.RiderRequestStateFinished || ride.FinishedAt == nil {
+		return Rating{}, core.Errorf(core.EINVALID, "only finished rides can be rated")
+	}
+	now := time.Now().UTC()
+	if now.After(ride.FinishedAt.Add(s.config.RatingWindow)) {
+		return Rating{}, core.Errorf(core.EINVALID, "ride can no longer be rated")
+	}
+	if err := input.validate(party); err != nil {
+		return Rating{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+
+	rateeID := ride.RiderID
+	if party == rides.PartyRider {
+		rateeID = *ride.DriverID
+	}
+	rating := &Rating{
+		RideID:     ride.ID,
+		RaterID:    user.ID,
+		RateeID:    rateeID,
+		RaterParty: party,
+		Stars:      input.Stars,
+		Tags:       lo.Uniq(input.Tags),
+		Comment:    input.Comment,
+		CreatedAt:  now,
+	}
+	if rating.Tags == nil {
+		rating.Tags = make([]string, 0)
+	}
+	err = s.ratingRepo.CreateRating(ctx, rating)
+	if err != nil {
+		return Rating{}, core.WrapErr(err)
+	}
+	ratingBytes, err := json.Marshal(rating.VisibleTo(rateeID))
+	if err != nil {
+		return Rating{}, core.Errorw(core.EINTERNAL, err)
+	}
+	s.pubsub.Publish(ctx, TopicRideRated, ratingBytes)
+
+	if party == rides.PartyRider {
+		err = s.checkDriverRating(ctx, rateeID, now)
+		if err != nil {
+			return Rating{}, core.Errorw(core.EINTERNAL, err)
+		}
+	}
+	return *rating, nil
+}
+
+// checkDriverRating alerts admins when the rolling average of the driver falls below the threshold.
+// Only the rating that takes the average below the threshold raises an alert
+func (s *RatingService) checkDriverRating(ctx context.Context, driverID int64, now time.Time) error {
+	recent, err := s.ratingRepo.GetReceived(ctx, driverID, rides.PartyRider, s.config.RollingWindow+1)
+	if err != nil {
+		return err
+	}
+	current := recent[:min(len(recent), s.config.RollingWindow)]
+	if len(current) == 0 || len(current) < s.config.DriverAlertMinRatings {
+		return nil
+	}
+	average := averageStars(current)
+	if average >= s.config.DriverAlertThreshold {
+		return nil
+	}
+	previous := recent[1:]
+	if len(previous) >= s.config.DriverAlertMinRatings && averageStars(previous) < s.config.DriverAlertThreshold {
+		return nil
+	}
+	alert := DriverRatingAlert{
+		DriverID:  driverID,
+		Average:   average,
+		Ratings:   len(current),
+		Threshold: s.config.DriverAlertThreshold,
+		Timestamp: now,
+	}
+	alertBytes, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	s.pubsub.Publish(ctx, TopicDriverRatingLow, alertBytes)
+	return nil
+}
+
+// GetRideRatings returns the ratings of the ride visible to the user
+func (s *RatingService) GetRideRatings(ctx context.Context, userID string, rideRequestId int64) ([]Rating, error) {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return []Rating{}, core.Errorw(core.EINTERNAL, err)
+	}
+	ride, err := s.rideRepo.GetByID(ctx, rideRequestId)
+	if err != nil {
+		return []Rating{}, core.WrapErr(err)
+	}
+	if _, ok := rideParty(ride, user.ID); !ok {
+		return []Rating{}, core.Errorf(core.EUNAUTHORIZED, "cannot view ratings of ride you are not part of")
+	}
+	ratingList, err := s.ratingRepo.GetByRideID(ctx, ride.ID)
+	if err != nil {
+		return []Rating{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return visibleTo(ratingList, user.ID), nil
+}
+
+func (s *RatingService) getUserRatings(ctx context.Context, userID int64) (UserRatings, error) {
+	asRider, err := s.ratingRepo.GetAverage(ctx, userID, rides.PartyDriver, s.config.RollingWindow)
+	if err != nil {
+		return UserRatings{}, err
+	}
+	asDriver, err := s.ratingRepo.GetAverage(ctx, userID, rides.PartyRider, s.config.RollingWindow)
+	if err != nil {
+		return UserRatings{}, err
+	}
+	return UserRatings{UserID: userID, AsRider: asRider, AsDriver: asDriver}, nil
+}
+
+// GetMyRatings returns the rating averages of the user and the most recent ratings the user has received
+func (s *RatingService) GetMyRatings(ctx context.Context, userID string) (MyRatings, error) {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return MyRatings{}, core.Errorw(core.EINTERNAL, err)
+	}
+	userRatings, err := s.getUserRatings(ctx, user.ID)
+	if err != nil {
+		return MyRatings{}, core.Errorw(core.EINTERNAL, err)
+	}
+	fromRiders, err := s.ratingRepo.GetReceived(ctx, user.ID, rides.PartyRider, maxReceivedRatings)
+	if err != nil {
+		return MyRatings{}, core.Errorw(core.EINTERNAL, err)
+	}
+	fromDrivers, err := s.ratingRepo.GetReceived(ctx, user.ID, rides.PartyDriver, maxReceivedRatings)
+	if err != nil {
+		return MyRatings{}, core.Errorw(core.EINTERNAL, err)
+	}
+	received := append(fromRiders, fromDrivers...)
+	sort.Slice(received, func(i, j int) bool { return received[i].CreatedAt.After(received[j].CreatedAt) })
+	received = received[:min(len(received), maxReceivedRatings)]
+	return MyRatings{
+		UserRatings: userRatings,
+		Received:    visibleTo(received, user.ID),
+	}, nil
+}
+
+// GetUserProfile returns the public profile of a user
+func (s *RatingService) GetUserProfile(ctx context.Context, id int64) (UserProfile, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return UserProfile{}, core.WrapErr(err)
+	}
+	userRatings, err := s.getUserRatings(ctx, user.ID)
+	if err != nil {
+		return UserProfile{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return UserProfile{
+		ID:      user.ID,
+		Name:    user.Name,
+		Ratings: userRatings,
+	}, nil
+}
@@ -0,0 +1,112 @@
+package referrals
+
+import (
+	"context"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/rides"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+)
+
+const (
+	TopicReferralRewarded = "referral-rewarded"
+)
+
+type ReferralState int
+
+const (
+	// The referred user has not finished a ride yet
+	ReferralStatePending ReferralState = iota
+	ReferralStateRewarded
+	// The referral was found to be fraudulent, nobody is rewarded
+	ReferralStateRejected
+)
+
+// Reasons a referral is taken to be a user referring themselves
+const (
+	RejectionSameDevice        = "same_device"
+	RejectionSamePaymentMethod = "same_payment_method"
+)
+
+// Parties of a referral
+const (
+	PartyReferrer = "referrer"
+	PartyReferee  = "referee"
+)
+
+// Referral is a user signing up with the referral code of another user
+type Referral struct {
+	ID         int64 `json:"id"`
+	ReferrerID int64 `json:"referrerId"`
+	// The user that signed up with the code
+	RefereeID       int64         `json:"refereeId"`
+	Code            string        `json:"code"`
+	State           ReferralState `json:"state"`
+	RejectionReason *string       `json:"rejectionReason"`
+	// The first ride of the referee, which the rewards were given for
+	RideID         *int64    `json:"rideId"`
+	ReferrerReward int       `json:"referrerReward"`
+	RefereeReward  int       `json:"refereeReward"`
+	Currency       *string   `json:"currency"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+type ReferralRewardedEvent struct {
+	Referral Referral `json:"referral"`
+	// The user being notified, the referrer or the referee
+	UserID int64  `json:"userId"`
+	Party  string `json:"party"`
+	Amount int    `json:"amount"`
+}
+
+// ReferralStats is how a user's referral code has been used
+type ReferralStats struct {
+	Code     string `json:"code"`
+	Referred int    `json:"referred"`
+	Pending  int    `json:"pending"`
+	Rewarded int    `json:"rewarded"`
+	Rejected int    `json:"rejected"`
+	// Rewards earned as referrer, by currency
+	Earned map[string]int `json:"earned"`
+}
+
+type ReferralRepository interface {
+	// CreateCode gives the user the code. Returns false if the user already has a code or the code is taken
+	CreateCode(ctx context.Context, userID int64, code string) (bool, error)
+	// GetCode returns the code of the user, empty if the user has none
+	GetCode(ctx context.Context, userID int64) (string, error)
+	// GetUserIDByCode returns the user with the code, false if no user has it
+	GetUserIDByCode(ctx context.Context, code string) (int64, bool, error)
+	AddDevice(ctx context.Context, userID int64, deviceID string) error
+	// HasDevice returns whether the user has signed up on the device
+	HasDevice(ctx context.Context, userID int64, deviceID string) (bool, error)
+	CreateReferral(ctx context.Context, referral *Referral) error
+	// GetByRefereeID returns the referral the user signed up with, nil if none
+	GetByRefereeID(ctx context.Context, refereeID int64) (*Referral, error)
+	GetByReferrerID(ctx context.Context, referrerID int64) ([]Referral, error)
+	// UpdateReferral updates the state, rejection reason, ride and rewards of a pending referral. Returns false if it was not pending
+	UpdateReferral(ctx context.Context, referral *Referral) (bool, error)
+	// GetPendingFinishedRides returns the first finished ride of each referee whose referral is still pending
+	GetPendingFinishedRides(ctx context.Context) ([]rides.RideFinishedEvent, error)
+}
+
+type SignupInput struct {
+	Name string `json:"name"`
+	// Address receipts are emailed to. Optional
+	Email string `json:"email"`
+	// Referral code of the user that referred the new user. Optional
+	ReferralCode string `json:"referralCode"`
+	// Identifies the device the user signs up on. Optional
+	DeviceID string `json:"deviceId"`
+}
+
+func (i *SignupInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.Name, validation.Required, validation.Length(2, 200)),
+		validation.Field(&i.Email, is.Email),
+		validation.Field(&i.ReferralCode, validation.Length(0, 32)),
+		validation.Field(&i.DeviceID, validation.Length(0, 200)),
+	)
+}
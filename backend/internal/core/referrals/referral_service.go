@@ -0,0 +1,290 @@
+package referrals
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/rides"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/users"
+)
+
+// Characters of referral codes, without characters that are easily confused
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+const (
+	codeLength = 8
+	// Times a new code is generated if the generated code is taken
+	codeAttempts = 5
+)
+
+type Config struct {
+	// Wallet credit given to the referrer and the referred user when the referred user finishes their first ride,
+	// in minor units of the base currency. Rewards are given in the currency of the ride
+	ReferrerReward int
+	RefereeReward  int
+}
+
+type ReferralService struct {
+	config          Config
+	referralRepo    ReferralRepository
+	userRepo        users.UserRepository
+	paymentsService *payments.PaymentsService
+	pubsub          core.Pubsub
+}
+
+func NewService(config Config, referralRepo ReferralRepository, userRepo users.UserRepository, paymentsService *payments.PaymentsService, pubsub core.Pubsub) *ReferralService {
+	return &ReferralService{
+		config:          config,
+		referralRepo:    referralRepo,
+		userRepo:        userRepo,
+		paymentsService: paymentsService,
+		pubsub:          pubsub,
+	}
+}
+
+func generateCode() (string, error) {
+	var sb strings.Builder
+	for i := 0; i < codeLength; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(codeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(codeAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// getOrCreateCode returns the referral code of the user, giving the user one if they have none
+func (s *ReferralService) getOrCreateCode(ctx context.Context, userID int64) (string, error) {
+	for i := 0; i < codeAttempts; i++ {
+		code, err := s.referralRepo.GetCode(ctx, userID)
+		if err != nil || code != "" {
+			return code, err
+		}
+		code, err = generateCode()
+		if err != nil {
+			return "", err
+		}
+		created, err := s.referralRepo.CreateCode(ctx, userID, code)
+		if err != nil {
+			return "", err
+		}
+		if created {
+			return code, nil
+		}
+	}
+	return "", core.Errorf(core.EINTERNAL, "could not generate referral code")
+}
+
+// Signup creates the user of the token. A user signing up with a referral code is rewarded with the referrer when they finish their first ride.
+// Referrals from a device the referrer has signed up on are recorded as rejected
+func (s *ReferralService) Signup(ctx context.Context, userID string, input *SignupInput) (users.User, error) {
+	if err := input.Validate(); err != nil {
+		return users.User{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	_, err := s.userRepo.GetByUserID(ctx, userID)
+	if err == nil {
+		return users.User{}, core.Errorf(core.ECONFLICT, "already signed up")
+	}
+	if core.ErrorCode(err) != core.ENOTFOUND {
+		return users.User{}, core.Errorw(core.EINTERNAL, err)
+	}
+	code := strings.ToUpper(strings.TrimSpace(input.ReferralCode))
+	var referrerID int64
+	if code != "" {
+		var ok bool
+		referrerID, ok, err = s.referralRepo.GetUserIDByCode(ctx, code)
+		if err != nil {
+			return users.User{}, core.Errorw(core.EINTERNAL, err)
+		}
+		if !ok {
+			return users.User{}, core.Errorf(core.EINVALID, "referral code %v is not valid", code)
+		}
+	}
+
+	user := users.User{UserID: userID, Name: input.Name, Role: users.RoleUser, Email: input.Email}
+	err = s.userRepo.CreateOrUpdate(ctx, &user)
+	if err != nil {
+		return users.User{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if input.DeviceID != "" {
+		err = s.referralRepo.AddDevice(ctx, user.ID, input.DeviceID)
+		if err != nil {
+			return users.User{}, core.Errorw(core.EINTERNAL, err)
+		}
+	}
+	_, err = s.getOrCreateCode(ctx, user.ID)
+	if err != nil {
+		return users.User{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if code == "" {
+		return user, nil
+	}
+
+	now := time.Now().UTC()
+	referral := Referral{
+		ReferrerID: referrerID,
+		RefereeID:  user.ID,
+		Code:       code,
+		State:      ReferralStatePending,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if input.DeviceID != "" {
+		sameDevice, err := s.referralRepo.HasDevice(ctx, referrerID, input.DeviceID)
+		if err != nil {
+			return users.User{}, core.Errorw(core.EINTERNAL, err)
+		}
+		if sameDevice {
+			rejection := RejectionSameDevice
+			referral.State = ReferralStateRejected
+			referral.RejectionReason = &rejection
+		}
+	}
+	err = s.referralRepo.CreateReferral(ctx, &referral)
+	if err != nil {
+		return users.User{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return user, nil
+}
+
+// HandleRideFinished rewards the referral of the rider when the rider finishes their first ride.
+// The referral is rejected if the rider pays with the same card as the referrer.
+// The rewards are recorded before the referral is marked rewarded, so handling the ride again completes a referral that failed halfway
+func (s *ReferralService) HandleRideFinished(ctx context.Context, event rides.RideFinishedEvent) error {
+	referral, err := s.referralRepo.GetByRefereeID(ctx, event.RiderID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if referral == nil || referral.State != ReferralStatePending {
+		return nil
+	}
+	sameCard, err := s.paymentsService.SharePaymentMethod(ctx, referral.RefereeID, referral.ReferrerID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	referral.RideID = &event.RideID
+	referral.UpdatedAt = time.Now().UTC()
+	if sameCard {
+		rejection := RejectionSamePaymentMethod
+		referral.State = ReferralStateRejected
+		referral.RejectionReason = &rejection
+		_, err = s.referralRepo.UpdateReferral(ctx, referral)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		return nil
+	}
+
+	referral.State = ReferralStateRewarded
+	referral.ReferrerReward, err = s.paymentsService.LocalAmount(ctx, s.config.ReferrerReward, event.Currency)
+	if err != nil {
+		return err
+	}
+	referral.RefereeReward, err = s.paymentsService.LocalAmount(ctx, s.config.RefereeReward, event.Currency)
+	if err != nil {
+		return err
+	}
+	referral.Currency = &event.Currency
+	err = s.reward(ctx, *referral, PartyReferrer, referral.ReferrerID, referral.ReferrerReward)
+	if err != nil {
+		return err
+	}
+	err = s.reward(ctx, *referral, PartyReferee, referral.RefereeID, referral.RefereeReward)
+	if err != nil {
+		return err
+	}
+	updated, err := s.referralRepo.UpdateReferral(ctx, referral)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if !updated {
+		return nil
+	}
+	// Only the handler that marked the referral rewarded notifies, so the users are notified once
+	err = s.publishRewarded(ctx, *referral, PartyReferrer, referral.ReferrerID, referral.ReferrerReward)
+	if err != nil {
+		return err
+	}
+	return s.publishRewarded(ctx, *referral, PartyReferee, referral.RefereeID, referral.RefereeReward)
+}
+
+// RewardFinishedReferrals handles the first finished ride of referees whose referral is still pending,
+// in case the ride finished event was lost
+func (s *ReferralService) RewardFinishedReferrals(ctx context.Context) error {
+	events, err := s.referralRepo.GetPendingFinishedRides(ctx)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	for _, event := range events {
+		err = s.HandleRideFinished(ctx, event)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reward records the reward of the party in the ledger. Recording it again does nothing
+func (s *ReferralService) reward(ctx context.Context, referral Referral, party string, userID int64, amount int) error {
+	if amount == 0 {
+		return nil
+	}
+	err := s.paymentsService.RecordReferralReward(ctx, referral.ID, party, userID, amount, *referral.Currency)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	return nil
+}
+
+func (s *ReferralService) publishRewarded(ctx context.Context, referral Referral, party string, userID int64, amount int) error {
+	if amount == 0 {
+		return nil
+	}
+	event := ReferralRewardedEvent{Referral: referral, UserID: userID, Party: party, Amount: amount}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	s.pubsub.Publish(ctx, TopicReferralRewarded, eventBytes)
+	return nil
+}
+
+// GetStats returns the referral code of the user and how it has been used
+func (s *ReferralService) GetStats(ctx context.Context, userID string) (ReferralStats, error) {
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return ReferralStats{}, core.Errorw(core.EINTERNAL, err)
+	}
+	code, err := s.getOrCreateCode(ctx, user.ID)
+	if err != nil {
+		return ReferralStats{}, core.Errorw(core.EINTERNAL, err)
+	}
+	referralList, err := s.referralRepo.GetByReferrerID(ctx, user.ID)
+	if err != nil {
+		return ReferralStats{}, core.Errorw(core.EINTERNAL, err)
+	}
+	stats := ReferralStats{
+		Code:     code,
+		Referred: len(referralList),
+		Earned:   map[string]int{},
+	}
+	for _, referral := range referralList {
+		switch referral.State {
+		case ReferralStatePending:
+			stats.Pending++
+		case ReferralStateRewarded:
+			stats.Rewarded++
+			stats.Earned[*referral.Currency] += referral.ReferrerReward
+		case ReferralStateRejected:
+			stats.Rejected++
+		}
+	}
+	return stats, nil
+}
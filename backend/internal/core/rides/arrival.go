@@ -0,0 +1,80 @@
+package rides
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+	"github.com/samber/lo"
+)
+
+const (
+	TopicRideDriverArrived    = "ride-driver-arrived"
+	TopicRideFreeWaitingEnded = "ride-free-waiting-ended"
+)
+
+type RideArrivalEvent struct {
+	RideID           int64     `json:"rideId"`
+	RiderID          int64     `json:"riderId"`
+	DriverID         int64     `json:"driverId"`
+	VehicleID        int64     `json:"vehicleId"`
+	ArrivedAt        time.Time `json:"arrivedAt"`
+	FreeWaitingUntil time.Time `json:"freeWaitingUntil"`
+}
+
+// detectDriverArrival moves an accepted ride to driver arrived when the vehicle enters the pickup geofence
+func (r *RideService) detectDriverArrival(ctx context.Context, ride RideRequest, vehicleID int64, point geo.Point) error {
+	if ride.State != RiderRequestStateAccepted || ride.PickupGeofence == nil || !ride.PickupGeofence.Contains(point) {
+		return nil
+	}
+	arrivedAt := time.Now().UTC()
+	freeWaitingUntil := arrivedAt.Add(r.config.FreeWaitingTime)
+	arrived, err := r.rideRepo.MarkDriverArrived(ctx, ride.ID, arrivedAt, freeWaitingUntil)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if !arrived {
+		// Another location update already moved the ride on
+		return nil
+	}
+	event := RideArrivalEvent{
+		RideID:           ride.ID,
+		RiderID:          ride.RiderID,
+		DriverID:         *ride.DriverID,
+		VehicleID:        vehicleID,
+		ArrivedAt:        arrivedAt,
+		FreeWaitingUntil: freeWaitingUntil,
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	r.pubsub.Publish(ctx, TopicRideDriverArrived, eventBytes)
+	return nil
+}
+
+// EndFreeWaiting notifies that the free waiting time is over on the rides where the rider still has not been picked up
+func (r *RideService) EndFreeWaiting(ctx context.Context) error {
+	ended, err := r.rideRepo.MarkFreeWaitingEnded(ctx, time.Now().UTC())
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	for _, ride := range ended {
+		event := RideArrivalEvent{
+			RideID:           ride.ID,
+			RiderID:          ride.RiderID,
+			DriverID:         lo.FromPtr(ride.DriverID),
+			VehicleID:        lo.FromPtr(ride.VehicleID),
+			ArrivedAt:        lo.FromPtr(ride.DriverArrivedAt),
+			FreeWaitingUntil: lo.FromPtr(ride.FreeWaitingUntil),
+		}
+		eventBytes, err := json.Marshal(event)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		r.pubsub.Publish(ctx, TopicRideFreeWaitingEnded, eventBytes)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package rides
+
+import (
+	"context"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/drivers"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+	"github.com/samber/lo"
+)
+
+// dispatchableVehicle returns the vehicle the driver is online with, or nil if the driver is not online and idle
+func (r *RideService) dispatchableVehicle(ctx context.Context, driverID int64) (*vehicles.Vehicle, error) {
+	availability, err := r.driverRepo.GetAvailability(ctx, driverID)
+	if err != nil {
+		return nil, err
+	}
+	if availability.State != drivers.AvailabilityIdle || availability.VehicleID == nil {
+		return nil, nil
+	}
+	vehicle, err := r.vehicleRepo.GetByID(ctx, *availability.VehicleID)
+	if err != nil {
+		return nil, err
+	}
+	vehicle.Class = vehicles.ClassOrDefault(vehicle.Class)
+	return &vehicle, nil
+}
+
+// refreshDriverAvailability sets the availability of an online driver from the driver's active rides
+func (r *RideService) refreshDriverAvailability(ctx context.Context, driverID int64) error {
+	ridesList, err := r.rideRepo.GetByUserIDs(ctx, []int64{driverID}, activeRideStates)
+	if err != nil {
+		return err
+	}
+	ridesList = lo.Filter(ridesList, func(item RideRequest, index int) bool { return item.DriverID != nil && *item.DriverID == driverID })
+	state := drivers.AvailabilityIdle
+	if lo.SomeBy(ridesList, func(item RideRequest) bool { return item.State == RiderRequestStateInProgress }) {
+		state = drivers.AvailabilityOnTrip
+	} else if len(ridesList) > 0 {
+		state = drivers.AvailabilityEnRoute
+	}
+	return r.driverRepo.UpdateState(ctx, driverID, state)
+}
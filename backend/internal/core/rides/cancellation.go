@@ -0,0 +1,255 @@
+package rides
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/samber/lo"
+)
+
+const (
+	TopicRideCancelled = "ride-cancelled"
+)
+
+// Parties of a ride
+const (
+	PartyRider  = "rider"
+	PartyDriver = "driver"
+	PartySystem = "system"
+)
+
+// Cancellation reason codes
+const (
+	CancellationReasonChangedPlans  = "changed_plans"
+	CancellationReasonDriverTooFar  = "driver_too_far"
+	CancellationReasonWrongAddress  = "wrong_address"
+	CancellationReasonRiderNoShow   = "rider_no_show"
+	CancellationReasonVehicleIssue  = "vehicle_issue"
+	CancellationReasonUnsafePickup  = "unsafe_pickup"
+	CancellationReasonNoDriverFound = "no_driver_found"
+	CancellationReasonOther         = "other"
+)
+
+var riderCancellationReasons = []string{
+	CancellationReasonChangedPlans,
+	CancellationReasonDriverTooFar,
+	CancellationReasonWrongAddress,
+	CancellationReasonOther,
+}
+
+// States a rider can cancel a ride in
+var riderCancellableStates = []RideRequestState{
+	RiderRequestStateScheduled,
+	RiderRequestStateAvailable,
+	RiderRequestStateAccepted,
+	RiderRequestStateDriverArrived,
+}
+
+var driverCancellationReasons = []string{
+	CancellationReasonRiderNoShow,
+	CancellationReasonVehicleIssue,
+	CancellationReasonUnsafePickup,
+	CancellationReasonOther,
+}
+
+type RideCancellation struct {
+	ID     int64 `json:"id"`
+	RideID int64 `json:"rideId"`
+	// ID of the user that cancelled, nil if cancelled by the system
+	CancelledBy *int64 `json:"cancelledBy"`
+	Party       string `json:"party"`
+	Reason      string `json:"reason"`
+	Fee         int    `json:"fee"`
+	Currency    string `json:"currency"`
+	// The party the fee is charged to
+	FeeParty  string    `json:"feeParty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type RideCancelledEvent struct {
+	Cancellation RideCancellation `json:"cancellation"`
+	RiderID      int64            `json:"riderId"`
+	DriverID     *int64           `json:"driverId"`
+	// True if the ride was released by the driver and is available again
+	Released bool `json:"released"`
+}
+
+type CancelRideInput struct {
+	Reason string `json:"reason"`
+}
+
+func (c *CancelRideInput) Validate() error {
+	return validation.ValidateStruct(c,
+		validation.Field(&c.Reason, validation.Required),
+	)
+}
+
+// CancelRide cancels a ride as the rider, or releases it as the driver.
+// A ride released by the driver is available to other drivers again, unless the rider did not show up
+func (r *RideService) CancelRide(ctx context.Context, userID string, rideRequestId int64, input *CancelRideInput) (RideCancellation, error) {
+	if err := input.Validate(); err != nil {
+		return RideCancellation{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	user, err := r.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return RideCancellation{}, core.Errorw(core.EINTERNAL, err)
+	}
+	rideReq, err := r.rideRepo.GetByID(ctx, rideRequestId)
+	if err != nil {
+		return RideCancellation{}, core.WrapErr(err)
+	}
+
+	now := time.Now().UTC()
+	cancellation := RideCancellation{
+		RideID:      rideReq.ID,
+		CancelledBy: &user.ID,
+		Reason:      input.Reason,
+		Currency:    rideReq.Currency,
+		CreatedAt:   now,
+	}
+	released := false
+	// The state is only changed if the ride is still in the state it was checked in, as it may have been started or cancelled meanwhile
+	updated := false
+	switch {
+	case rideReq.RiderID == user.ID:
+		if !slices.Contains(riderCancellationReasons, input.Reason) {
+			return RideCancellation{}, core.Errorf(core.EINVALID, "invalid rider cancellation reason %v", input.Reason)
+		}
+		if !slices.Contains(riderCancellableStates, rideReq.State) {
+			return RideCancellation{}, core.Errorf(core.EINVALID, "cannot cancel ride in state %v", rideReq.State)
+		}
+		cancellation.Party = PartyRider
+		cancellation.FeeParty = PartyRider
+		// Scheduled rides have not been released to drivers yet, so cancelling them before the pickup window is free
+		if rideReq.State != RiderRequestStateScheduled {
+			cancellation.Fee = r.paymentsService.RiderCancellationFee(rideReq.AcceptedAt, now)
+		}
+		updated, err = r.rideRepo.UpdateRequestState(ctx, rideReq.ID, rideReq.State, RiderRequestStateCancelled)
+	case rideReq.DriverID != nil && *rideReq.DriverID == user.ID:
+		if !slices.Contains(driverCancellationReasons, input.Reason) {
+			return RideCancellation{}, core.Errorf(core.EINVALID, "invalid driver cancellation reason %v", input.Reason)
+		}
+		if rideReq.State != RiderRequestStateAccepted && rideReq.State != RiderRequestStateDriverArrived {
+			return RideCancellation{}, core.Errorf(core.EINVALID, "cannot release ride in state %v", rideReq.State)
+		}
+		cancellation.Party = PartyDriver
+		if input.Reason == CancellationReasonRiderNoShow {
+			if rideReq.State != RiderRequestStateDriverArrived || rideReq.FreeWaitingUntil == nil || now.Before(*rideReq.FreeWaitingUntil) {
+				return RideCancellation{}, core.Errorf(core.EINVALID, "rider no-show can only be reported after the free waiting time")
+			}
+			cancellation.FeeParty = PartyRider
+			cancellation.Fee = r.paymentsService.NoShowFee()
+			updated, err = r.rideRepo.UpdateRequestState(ctx, rideReq.ID, rideReq.State, RiderRequestStateCancelled)
+		} else {
+			cancellation.FeeParty = PartyDriver
+			cancellation.Fee = r.paymentsService.DriverCancellationFee()
+			released = true
+			updated, err = r.rideRepo.ReleaseRequest(ctx, rideReq.ID)
+		}
+	default:
+		return RideCancellation{}, core.Errorf(core.EUNAUTHORIZED, "cannot cancel ride you are not part of")
+	}
+	if err != nil {
+		return RideCancellation{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if !updated {
+		return RideCancellation{}, core.Errorf(core.ECONFLICT, "ride changed while it was being cancelled")
+	}
+	// The other riders of the pool no longer detour via the stops of the ride
+	if rideReq.PoolID != nil {
+		err = r.reroutePool(ctx, *rideReq.PoolID)
+		if err != nil {
+			return RideCancellation{}, core.Errorw(core.EINTERNAL, err)
+		}
+	}
+	cancellation.Fee, err = r.paymentsService.LocalAmount(ctx, cancellation.Fee, cancellation.Currency)
+	if err != nil {
+		return RideCancellation{}, err
+	}
+
+	err = r.rideRepo.CreateCancellation(ctx, &cancellation)
+	if err != nil {
+		return RideCancellation{}, core.Errorw(core.EINTERNAL, err)
+	}
+	err = r.recordCancellationFee(ctx, rideReq, cancellation)
+	if err != nil {
+		return RideCancellation{}, core.Errorw(core.EINTERNAL, err)
+	}
+	err = r.settleCancellation(ctx, cancellation)
+	if err != nil {
+		return RideCancellation{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if !released {
+		err = r.promotionService.ReleaseRide(ctx, rideReq.ID)
+		if err != nil {
+			return RideCancellation{}, err
+		}
+	}
+	if rideReq.DriverID != nil {
+		err = r.refreshDriverAvailability(ctx, *rideReq.DriverID)
+		if err != nil {
+			return RideCancellation{}, core.Errorw(core.EINTERNAL, err)
+		}
+	}
+	err = r.publishCancellation(ctx, rideReq, cancellation, released)
+	if err != nil {
+		return RideCancellation{}, err
+	}
+	return cancellation, nil
+}
+
+// recordCancellationFee records the fee in the ledger. Rider fees are paid by whoever the ride is billed to and compensate the driver,
+// driver penalties go to the platform
+func (r *RideService) recordCancellationFee(ctx context.Context, ride RideRequest, cancellation RideCancellation) error {
+	if cancellation.Fee == 0 {
+		return nil
+	}
+	var payer, payee payments.Account
+	switch {
+	case cancellation.FeeParty == PartyRider && ride.DriverID != nil:
+		payer, payee = billedAccount(ride), payments.DriverAccount(*ride.DriverID)
+	case cancellation.FeeParty == PartyRider:
+		payer, payee = billedAccount(ride), payments.PlatformRevenueAccount
+	case cancellation.FeeParty == PartyDriver && ride.DriverID != nil:
+		payer, payee = payments.DriverAccount(*ride.DriverID), payments.PlatformRevenueAccount
+	default:
+		return nil
+	}
+	return r.paymentsService.RecordCancellationFee(ctx, cancellation.ID, ride.ID, payer, payee, cancellation.Fee, cancellation.Currency)
+}
+
+func (r *RideService) publishCancellation(ctx context.Context, ride RideRequest, cancellation RideCancellation, released bool) error {
+	event := RideCancelledEvent{
+		Cancellation: cancellation,
+		RiderID:      ride.RiderID,
+		DriverID:     ride.DriverID,
+		Released:     released,
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	r.pubsub.Publish(ctx, TopicRideCancelled, eventBytes)
+	return nil
+}
+
+// driverCooldownUntil returns the time until which the driver cannot claim rides because of frequent cancellations
+func (r *RideService) driverCooldownUntil(ctx context.Context, driverID int64, now time.Time) (time.Time, bool, error) {
+	since := now.Add(-r.paymentsService.DriverCancellationLookback())
+	cancellations, err := r.rideRepo.GetCancellationsByUserID(ctx, driverID, PartyDriver, since)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	// No-shows are not the drivers fault
+	cancellations = lo.Filter(cancellations, func(item RideCancellation, index int) bool {
+		return item.Reason != CancellationReasonRiderNoShow
+	})
+	times := lo.Map(cancellations, func(item RideCancellation, index int) time.Time { return item.CreatedAt })
+	cooldownUntil, inCooldown := r.paymentsService.DriverCooldownUntil(times, now)
+	return cooldownUntil, inCooldown, nil
+}
@@ -0,0 +1,260 @@
+package rides
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+)
+
+// DirectionsVersionCurrent is the version new directions are stored in
+const DirectionsVersionCurrent = 2
+
+const DirectionsProviderORS = "openrouteservice"
+
+// Directions is the provider-neutral route format (directions v2).
+// Coordinates are [lat, lng] pairs, distances are in meters and durations in seconds.
+type Directions struct {
+	Provider    string          `json:"provider"`
+	Distance    float64         `json:"distance"`
+	Duration    float64         `json:"duration"`
+	Coordinates [][]float64     `json:"coordinates"`
+	Legs        []DirectionsLeg `json:"legs"`
+}
+
+type DirectionsLeg struct {
+	Distance float64          `json:"distance"`
+	Duration float64          `json:"duration"`
+	Steps    []DirectionsStep `json:"steps"`
+}
+
+type DirectionsStep struct {
+	Distance    float64 `json:"distance"`
+	Duration    float64 `json:"duration"`
+	Type        int     `json:"type"`
+	Instruction string  `json:"instruction"`
+	Name        string  `json:"name"`
+	// Index of the first and last coordinate of the step in Directions.Coordinates
+	WayPoints     []int     `json:"wayPoints"`
+	Location      []float64 `json:"location"`
+	BearingBefore int       `json:"bearingBefore"`
+	BearingAfter  int       `json:"bearingAfter"`
+}
+
+// Points returns the route geometry as points
+func (d *Directions) Points() []geo.Point {
+	return geo.PointsFromCoordinates(d.Coordinates)
+}
+
+// Steps returns the steps of all legs in route order
+func (d *Directions) Steps() []DirectionsStep {
+	steps := make([]DirectionsStep, 0)
+	for _, leg := range d.Legs {
+		steps = append(steps, leg.Steps...)
+	}
+	return steps
+}
+
+// legEndIndex returns the index in Coordinates of the last coordinate of the leg
+func (d *Directions) legEndIndex(leg DirectionsLeg) (int, bool) {
+	steps := leg.Steps
+	if len(steps) == 0 || len(steps[len(steps)-1].WayPoints) != 2 {
+		return 0, false
+	}
+	return steps[len(steps)-1].WayPoints[1], true
+}
+
+// WayPointIndices returns the indices in Coordinates of the locations the route was requested through,
+// i.e. the start and the end of each leg
+func (d *Directions) WayPointIndices() []int {
+	indices := []int{0}
+	for _, leg := range d.Legs {
+		if end, ok := d.legEndIndex(leg); ok {
+			indices = append(indices, end)
+		}
+	}
+	return indices
+}
+
+// NearestWayPointIndex returns the index in Coordinates of the way point closest to p.
+// Directions fetched from the drivers position has the pickup at the end of the first leg
+func (d *Directions) NearestWayPointIndex(p geo.Point) int {
+	points := d.Points()
+	nearest, nearestDistance := 0, math.MaxFloat64
+	for _, index := range d.WayPointIndices() {
+		if index >= len(points) {
+			continue
+		}
+		if distance := geo.Distance(points[index], p); distance < nearestDistance {
+			nearest, nearestDistance = index, distance
+		}
+	}
+	return nearest
+}
+
+// DistanceFrom returns the distance in meters of the legs starting at or after the coordinate at index
+func (d *Directions) DistanceFrom(index int) float64 {
+	distance := 0.0
+	start := 0
+	for _, leg := range d.Legs {
+		if start >= index {
+			distance += leg.Distance
+		}
+		if end, ok := d.legEndIndex(leg); ok {
+			start = end
+		}
+	}
+	return distance
+}
+
+// ORSDirections is the raw OpenRouteService response, stored as directions v1
+type ORSDirections struct {
+	Bbox   []float64 `json:"bbox"`
+	Routes []struct {
+		Summary struct {
+			Distance float64 `json:"distance"`
+			Duration float64 `json:"duration"`
+		} `json:"summary"`
+		Segments []struct {
+			Distance float64 `json:"distance"`
+			Duration float64 `json:"duration"`
+			Steps    []struct {
+				Distance    float64 `json:"distance"`
+				Duration    float64 `json:"duration"`
+				Type        int     `json:"type"`
+				Instruction string  `json:"instruction"`
+				Name        string  `json:"name"`
+				WayPoints   []int   `json:"way_points"`
+				Maneuver    struct {
+					Location      []float64 `json:"location"`
+					BearingBefore int       `json:"bearing_before"`
+					BearingAfter  int       `json:"bearing_after"`
+				} `json:"maneuver"`
+			} `json:"steps"`
+		} `json:"segments"`
+		Bbox      []float64 `json:"bbox"`
+		Geometry  string    `json:"geometry"`
+		WayPoints []int     `json:"way_points"`
+		Legs      []any     `json:"legs"`
+	} `json:"routes"`
+	Metadata struct {
+		Attribution string `json:"attribution"`
+		Service     string `json:"service"`
+		Timestamp   int64  `json:"timestamp"`
+		Query       struct {
+			Coordinates [][]float64 `json:"coordinates"`
+			Profile     string      `json:"profile"`
+			Format      string      `json:"format"`
+		} `json:"query"`
+		Engine struct {
+			Version   string    `json:"version"`
+			BuildDate time.Time `json:"build_date"`
+			GraphDate time.Time `json:"graph_date"`
+		} `json:"engine"`
+	} `json:"metadata"`
+}
+
+// ToDirections converts the first route of the ORS response to the provider-neutral format
+func (o *ORSDirections) ToDirections() (*Directions, error) {
+	directions := &Directions{
+		Provider:    DirectionsProviderORS,
+		Coordinates: make([][]float64, 0),
+		Legs:        make([]DirectionsLeg, 0),
+	}
+	if len(o.Routes) == 0 {
+		return directions, nil
+	}
+	route := o.Routes[0]
+	coordinates, err := geo.DecodePolyline(route.Geometry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ors geometry: %w", err)
+	}
+	directions.Distance = route.Summary.Distance
+	directions.Duration = route.Summary.Duration
+	directions.Coordinates = coordinates
+	for _, segment := range route.Segments {
+		leg := DirectionsLeg{
+			Distance: segment.Distance,
+			Duration: segment.Duration,
+			Steps:    make([]DirectionsStep, 0, len(segment.Steps)),
+		}
+		for _, step := range segment.Steps {
+			var location []float64
+			if len(step.Maneuver.Location) == 2 {
+				// ORS locations are [lng, lat]
+				location = []float64{step.Maneuver.Location[1], step.Maneuver.Location[0]}
+			}
+			leg.Steps = append(leg.Steps, DirectionsStep{
+				Distance:      step.Distance,
+				Duration:      step.Duration,
+				Type:          step.Type,
+				Instruction:   step.Instruction,
+				Name:          step.Name,
+				WayPoints:     step.WayPoints,
+				Location:      location,
+				BearingBefore: step.Maneuver.BearingBefore,
+				BearingAfter:  step.Maneuver.BearingAfter,
+			})
+		}
+		directions.Legs = append(directions.Legs, leg)
+	}
+	return directions, nil
+}
+
+// DirectionsDecoder decodes stored directions json of a specific version
+type DirectionsDecoder func(data []byte) (*Directions, error)
+
+var directionsDecoders = map[int]DirectionsDecoder{
+	1: decodeDirectionsV1,
+	2: decodeDirectionsV2,
+}
+
+func decodeDirectionsV1(data []byte) (*Directions, error) {
+	orsDirections := &ORSDirections{}
+	err := json.Unmarshal(data, orsDirections)
+	if err != nil {
+		return nil, err
+	}
+	return orsDirections.ToDirections()
+}
+
+func decodeDirectionsV2(data []byte) (*Directions, error) {
+	directions := &Directions{}
+	err := json.Unmarshal(data, directions)
+	if err != nil {
+		return nil, err
+	}
+	return directions, nil
+}
+
+// DecodeDirections decodes stored directions json using the decoder registered for the version
+func DecodeDirections(version int, data []byte) (*Directions, error) {
+	decoder, ok := directionsDecoders[version]
+	if !ok {
+		return nil, fmt.Errorf("no decoder for directions version %v", version)
+	}
+	directions, err := decoder(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode v%v directions json: %w", version, err)
+	}
+	return directions, nil
+}
+
+// StoredDirections are the directions json of a ride as stored, before decoding
+type StoredDirections struct {
+	RideID  int64
+	Version int
+	Json    string
+	Price   int
+}
+
+// EncodeDirections encodes directions in the current version
+func EncodeDirections(directions *Directions) (int, []byte, error) {
+	data, err := json.Marshal(directions)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to marshal directions: %w", err)
+	}
+	return DirectionsVersionCurrent, data, nil
+}
@@ -0,0 +1,233 @@
+package rides
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/samber/lo"
+)
+
+const (
+	TopicDisputeOpened   = "dispute-opened"
+	TopicDisputeResolved = "dispute-resolved"
+)
+
+type DisputeState int
+
+const (
+	DisputeStateOpen DisputeState = iota
+	// Resolved in favour of the rider
+	DisputeStateAccepted
+	DisputeStateRejected
+)
+
+const (
+	DisputeReasonFareTooHigh = "fare_too_high"
+	DisputeReasonWrongRoute  = "wrong_route"
+	DisputeReasonNotTaken    = "ride_not_taken"
+	DisputeReasonOther       = "other"
+)
+
+var disputeReasons = []string{
+	DisputeReasonFareTooHigh,
+	DisputeReasonWrongRoute,
+	DisputeReasonNotTaken,
+	DisputeReasonOther,
+}
+
+// FareDispute is a rider's complaint about the fare of a finished ride, handled by support
+type FareDispute struct {
+	ID             int64        `json:"id"`
+	RideID         int64        `json:"rideId"`
+	RiderID        int64        `json:"riderId"`
+	Reason         string       `json:"reason"`
+	Description    string       `json:"description"`
+	State          DisputeState `json:"state"`
+	ResolvedBy     *int64       `json:"resolvedBy"`
+	ResolvedAt     *time.Time   `json:"resolvedAt"`
+	ResolutionNote *string      `json:"resolutionNote"`
+	// Refund issued when the dispute was accepted
+	RefundID  *int64    `json:"refundId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// RideBreadcrumb is a position of the driver recorded during a ride
+type RideBreadcrumb struct {
+	Lat        float64   `json:"lat"`
+	Lng        float64   `json:"lng"`
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+// DisputeDetails is a dispute with what support needs to handle it
+type DisputeDetails struct {
+	Dispute FareDispute `json:"dispute"`
+	// The ride including its planned route
+	Ride        RideRequest      `json:"ride"`
+	LineItems   []RideLineItem   `json:"lineItems"`
+	Breadcrumbs []RideBreadcrumb `json:"breadcrumbs"`
+	Refunds     []RideRefund     `json:"refunds"`
+}
+
+type OpenDisputeInput struct {
+	Reason      string `json:"reason"`
+	Description string `json:"description"`
+}
+
+func (i *OpenDisputeInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.Reason, validation.Required, validation.In(lo.ToAnySlice(disputeReasons)...)),
+		validation.Field(&i.Description, validation.Required, validation.Length(0, 2000)),
+	)
+}
+
+type ResolveDisputeInput struct {
+	Accept bool   `json:"accept"`
+	Note   string `json:"note"`
+	// Refund issued to the rider when the dispute is accepted. Optional
+	Refund *IssueRefundInput `json:"refund"`
+}
+
+func (i *ResolveDisputeInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.Note, validation.Required),
+	)
+}
+
+// OpenDispute opens a dispute about the fare of a finished ride. A ride can have one open dispute at a time
+func (r *RideService) OpenDispute(ctx context.Context, userID string, rideRequestId int64, input *OpenDisputeInput) (FareDispute, error) {
+	if err := input.Validate(); err != nil {
+		return FareDispute{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	user, err := r.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return FareDispute{}, core.Errorw(core.EINTERNAL, err)
+	}
+	rideReq, err := r.rideRepo.GetByID(ctx, rideRequestId)
+	if err != nil {
+		return FareDispute{}, core.WrapErr(err)
+	}
+	if rideReq.RiderID != user.ID {
+		return FareDispute{}, core.Errorf(core.EUNAUTHORIZED, "cannot dispute ride you are not the rider of")
+	}
+	if rideReq.State != RiderRequestStateFinished {
+		return FareDispute{}, core.Errorf(core.EINVALID, "only finished rides can be disputed")
+	}
+	dispute := FareDispute{
+		RideID:      rideReq.ID,
+		RiderID:     user.ID,
+		Reason:      input.Reason,
+		Description: input.Description,
+		State:       DisputeStateOpen,
+		CreatedAt:   time.Now().UTC(),
+	}
+	created, err := r.rideRepo.CreateDispute(ctx, &dispute)
+	if err != nil {
+		return FareDispute{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if !created {
+		return FareDispute{}, core.Errorf(core.ECONFLICT, "ride already has an open dispute")
+	}
+	err = r.publishDispute(ctx, TopicDisputeOpened, dispute)
+	if err != nil {
+		return FareDispute{}, err
+	}
+	return dispute, nil
+}
+
+func (r *RideService) publishDispute(ctx context.Context, topic string, dispute FareDispute) error {
+	eventBytes, err := json.Marshal(dispute)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	r.pubsub.Publish(ctx, topic, eventBytes)
+	return nil
+}
+
+// GetDisputes returns the disputes in the state, oldest first
+func (r *RideService) GetDisputes(ctx context.Context, state DisputeState) ([]FareDispute, error) {
+	disputes, err := r.rideRepo.GetDisputesByState(ctx, state)
+	if err != nil {
+		return []FareDispute{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return disputes, nil
+}
+
+// GetDisputeDetails returns the dispute with the ride, its route and the breadcrumbs recorded during the ride
+func (r *RideService) GetDisputeDetails(ctx context.Context, disputeID int64) (DisputeDetails, error) {
+	dispute, err := r.rideRepo.GetDispute(ctx, disputeID)
+	if err != nil {
+		return DisputeDetails{}, core.WrapErr(err)
+	}
+	rideReq, err := r.rideRepo.GetByID(ctx, dispute.RideID)
+	if err != nil {
+		return DisputeDetails{}, core.WrapErr(err)
+	}
+	lineItems, err := r.rideRepo.GetLineItems(ctx, []int64{rideReq.ID})
+	if err != nil {
+		return DisputeDetails{}, core.Errorw(core.EINTERNAL, err)
+	}
+	breadcrumbs, err := r.rideRepo.GetBreadcrumbs(ctx, rideReq.ID)
+	if err != nil {
+		return DisputeDetails{}, core.Errorw(core.EINTERNAL, err)
+	}
+	refunds, err := r.rideRepo.GetRefunds(ctx, rideReq.ID)
+	if err != nil {
+		return DisputeDetails{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return DisputeDetails{
+		Dispute:     dispute,
+		Ride:        rideReq,
+		LineItems:   lineItems,
+		Breadcrumbs: breadcrumbs,
+		Refunds:     refunds,
+	}, nil
+}
+
+// ResolveDispute accepts or rejects an open dispute. Accepting can issue a refund, within the approval limit of the user's role
+func (r *RideService) ResolveDispute(ctx context.Context, userID string, disputeID int64, input *ResolveDisputeInput) (FareDispute, error) {
+	if err := input.Validate(); err != nil {
+		return FareDispute{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	user, err := r.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return FareDispute{}, core.Errorw(core.EINTERNAL, err)
+	}
+	dispute, err := r.rideRepo.GetDispute(ctx, disputeID)
+	if err != nil {
+		return FareDispute{}, core.WrapErr(err)
+	}
+	if dispute.State != DisputeStateOpen {
+		return FareDispute{}, core.Errorf(core.EINVALID, "dispute has already been resolved")
+	}
+	if input.Refund != nil && !input.Accept {
+		return FareDispute{}, core.Errorf(core.EINVALID, "only accepted disputes can be refunded")
+	}
+
+	if input.Refund != nil {
+		refund, err := r.issueRefund(ctx, userID, dispute.RideID, &dispute.ID, input.Refund)
+		if err != nil {
+			return FareDispute{}, err
+		}
+		dispute.RefundID = &refund.ID
+	}
+	now := time.Now().UTC()
+	dispute.State = lo.Ternary(input.Accept, DisputeStateAccepted, DisputeStateRejected)
+	dispute.ResolvedBy = &user.ID
+	dispute.ResolvedAt = &now
+	dispute.ResolutionNote = &input.Note
+	resolved, err := r.rideRepo.ResolveDispute(ctx, &dispute)
+	if err != nil {
+		return FareDispute{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if !resolved {
+		return FareDispute{}, core.Errorf(core.ECONFLICT, "dispute was resolved concurrently")
+	}
+	err = r.publishDispute(ctx, TopicDisputeResolved, dispute)
+	if err != nil {
+		return FareDispute{}, err
+	}
+	return dispute, nil
+}
@@ -0,0 +1,207 @@
+package rides
+
+import (
+	"context"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/drivers"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/samber/lo"
+)
+
+// Longest period an earnings report can cover
+const maxEarningsPeriod = 366 * 24 * time.Hour
+
+// Periods earnings reports are summarised by
+const (
+	EarningsPeriodDay  = "day"
+	EarningsPeriodWeek = "week"
+)
+
+// RideEarnings is what a driver earned on a finished ride
+type RideEarnings struct {
+	RideID     int64     `json:"rideId"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Currency   string    `json:"currency"`
+	Fare       int       `json:"fare"`
+	// Commission taken by the platform, less the commission returned on fare adjustments
+	Commission int `json:"commission"`
+	// Fare adjustments paid back to the rider
+	Adjustments int `json:"adjustments"`
+	// Waiting time, zone fees and approved extras, credited to the driver in full
+	Surcharges int `json:"surcharges"`
+	// Tips are credited to the driver in full
+	Tips  int `json:"tips"`
+	Total int `json:"total"`
+}
+
+type EarningsTotal struct {
+	Currency    string `json:"currency"`
+	Rides       int    `json:"rides"`
+	Fares       int    `json:"fares"`
+	Commission  int    `json:"commission"`
+	Adjustments int    `json:"adjustments"`
+	Surcharges  int    `json:"surcharges"`
+	Tips        int    `json:"tips"`
+	Total       int    `json:"total"`
+}
+
+// PeriodEarnings is the earnings of the rides finished in a day or week
+type PeriodEarnings struct {
+	Start  time.Time       `json:"start"`
+	End    time.Time       `json:"end"`
+	Totals []EarningsTotal `json:"totals"`
+}
+
+// ShiftEarnings is the earnings of the rides finished during a shift
+type ShiftEarnings struct {
+	ShiftID   int64           `json:"shiftId"`
+	StartedAt time.Time       `json:"startedAt"`
+	EndedAt   *time.Time      `json:"endedAt"`
+	Totals    []EarningsTotal `json:"totals"`
+}
+
+// DriverEarnings is the earnings report of a driver for rides finished in a period
+type DriverEarnings struct {
+	DriverID int64          `json:"driverId"`
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Rides    []RideEarnings `json:"rides"`
+	// Day or week the rides are summarised by in Periods
+	Period string `json:"period"`
+	// Periods with finished rides, oldest first
+	Periods []PeriodEarnings `json:"periods"`
+	// Shifts overlapping the report, oldest first
+	Shifts []ShiftEarnings `json:"shifts"`
+	// Totals per currency
+	Totals []EarningsTotal `json:"totals"`
+}
+
+// addEarnings adds the ride to the total of its currency
+func addEarnings(totals []EarningsTotal, ride RideEarnings) []EarningsTotal {
+	_, i, ok := lo.FindIndexOf(totals, func(item EarningsTotal) bool { return item.Currency == ride.Currency })
+	if !ok {
+		i = len(totals)
+		totals = append(totals, EarningsTotal{Currency: ride.Currency})
+	}
+	total := &totals[i]
+	total.Rides++
+	total.Fares += ride.Fare
+	total.Commission += ride.Commission
+	total.Adjustments += ride.Adjustments
+	total.Surcharges += ride.Surcharges
+	total.Tips += ride.Tips
+	total.Total += ride.Total
+	return totals
+}
+
+// periodStart returns the start of the day or week t is in, in UTC. Weeks start on Monday
+func periodStart(t time.Time, period string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if period == EarningsPeriodWeek {
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day
+}
+
+func rideEarnings(ride RideRequest, lineItems []RideLineItem, refunds []RideRefund) RideEarnings {
+	tips := lo.SumBy(lineItems, func(item RideLineItem) int {
+		return lo.Ternary(item.Type == LineItemTip, item.Amount, 0)
+	})
+	surcharges := lo.SumBy(lineItems, func(item RideLineItem) int {
+		return lo.Ternary(isSurcharge(item), item.Amount, 0)
+	})
+	adjustments := lo.Filter(refunds, func(item RideRefund, index int) bool { return item.Type == RefundTypeAdjustment })
+	adjusted := lo.SumBy(adjustments, func(item RideRefund) int { return item.Amount })
+	commission := payments.Commission(ride.Price, ride.CommissionRate) - lo.SumBy(adjustments, func(item RideRefund) int {
+		return payments.Commission(item.Amount, ride.CommissionRate)
+	})
+	return RideEarnings{
+		RideID:      ride.ID,
+		FinishedAt:  lo.FromPtr(ride.FinishedAt),
+		Currency:    ride.Currency,
+		Fare:        ride.Price,
+		Commission:  commission,
+		Adjustments: adjusted,
+		Surcharges:  surcharges,
+		Tips:        tips,
+		Total:       ride.Price - commission - adjusted + surcharges + tips,
+	}
+}
+
+func newDriverEarnings(driverID int64, from time.Time, to time.Time, period string, ridesList []RideRequest, lineItems []RideLineItem, refunds []RideRefund, shifts []drivers.Shift) DriverEarnings {
+	lineItemsByRide := lo.GroupBy(lineItems, func(item RideLineItem) int64 { return item.RideID })
+	refundsByRide := lo.GroupBy(refunds, func(item RideRefund) int64 { return item.RideID })
+	earnings := DriverEarnings{
+		DriverID: driverID,
+		From:     from,
+		To:       to,
+		Rides:    make([]RideEarnings, 0, len(ridesList)),
+		Period:   period,
+		Periods:  make([]PeriodEarnings, 0),
+		Shifts: lo.Map(shifts, func(item drivers.Shift, index int) ShiftEarnings {
+			return ShiftEarnings{ShiftID: item.ID, StartedAt: item.StartedAt, EndedAt: item.EndedAt, Totals: make([]EarningsTotal, 0)}
+		}),
+		Totals: make([]EarningsTotal, 0),
+	}
+	for _, ride := range ridesList {
+		rideEarnings := rideEarnings(ride, lineItemsByRide[ride.ID], refundsByRide[ride.ID])
+		earnings.Rides = append(earnings.Rides, rideEarnings)
+		earnings.Totals = addEarnings(earnings.Totals, rideEarnings)
+
+		// Rides are ordered by when they finished, so a ride is in the last period or a new one
+		start := periodStart(rideEarnings.FinishedAt, period)
+		if len(earnings.Periods) == 0 || !earnings.Periods[len(earnings.Periods)-1].Start.Equal(start) {
+			end := lo.Ternary(period == EarningsPeriodWeek, start.AddDate(0, 0, 7), start.AddDate(0, 0, 1))
+			earnings.Periods = append(earnings.Periods, PeriodEarnings{Start: start, End: end, Totals: make([]EarningsTotal, 0)})
+		}
+		last := &earnings.Periods[len(earnings.Periods)-1]
+		last.Totals = addEarnings(last.Totals, rideEarnings)
+
+		for i, shift := range earnings.Shifts {
+			if !rideEarnings.FinishedAt.Before(shift.StartedAt) && (shift.EndedAt == nil || !rideEarnings.FinishedAt.After(*shift.EndedAt)) {
+				earnings.Shifts[i].Totals = addEarnings(shift.Totals, rideEarnings)
+				break
+			}
+		}
+	}
+	return earnings
+}
+
+// GetDriverEarnings returns the earnings of the driver for rides finished from from until to,
+// per ride, per shift and per day or week
+func (r *RideService) GetDriverEarnings(ctx context.Context, userID string, from time.Time, to time.Time, period string) (DriverEarnings, error) {
+	if !to.After(from) || to.Sub(from) > maxEarningsPeriod {
+		return DriverEarnings{}, core.Errorf(core.EINVALID, "invalid period")
+	}
+	if period == "" {
+		period = EarningsPeriodDay
+	}
+	if period != EarningsPeriodDay && period != EarningsPeriodWeek {
+		return DriverEarnings{}, core.Errorf(core.EINVALID, "period must be %v or %v", EarningsPeriodDay, EarningsPeriodWeek)
+	}
+	user, err := r.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return DriverEarnings{}, core.Errorw(core.EINTERNAL, err)
+	}
+	ridesList, err := r.rideRepo.GetFinishedByDriverID(ctx, user.ID, from, to)
+	if err != nil {
+		return DriverEarnings{}, core.Errorw(core.EINTERNAL, err)
+	}
+	rideIDs := lo.Map(ridesList, func(item RideRequest, index int) int64 { return item.ID })
+	lineItems, err := r.rideRepo.GetLineItems(ctx, rideIDs)
+	if err != nil {
+		return DriverEarnings{}, core.Errorw(core.EINTERNAL, err)
+	}
+	refunds, err := r.rideRepo.GetRefundsByRideIDs(ctx, rideIDs)
+	if err != nil {
+		return DriverEarnings{}, core.Errorw(core.EINTERNAL, err)
+	}
+	shifts, err := r.driverRepo.GetShiftsBetween(ctx, user.ID, from, to)
+	if err != nil {
+		return DriverEarnings{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return newDriverEarnings(user.ID, from, to, period, ridesList, lineItems, refunds, shifts), nil
+}
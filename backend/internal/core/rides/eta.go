@@ -0,0 +1,105 @@
+package rides
+
+import (
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+)
+
+const (
+	TopicRideETA = "ride-eta"
+)
+
+const (
+	ETATargetPickup  = "pickup"
+	ETATargetStop    = "stop"
+	ETATargetDropoff = "dropoff"
+)
+
+// Speed used for the parts of the trip not covered by the planned route, ~30 km/h
+const offRouteSpeedMetersPerSecond = 8.0
+
+type RideETA struct {
+	RideID    int64  `json:"rideId"`
+	RiderID   int64  `json:"riderId"`
+	VehicleID int64  `json:"vehicleId"`
+	Target    string `json:"target"`
+	// Set when the target is a stop
+	StopID *int64 `json:"stopId,omitempty"`
+	// Remaining distance in meters
+	Distance float64 `json:"distance"`
+	// Remaining duration in seconds
+	Duration     float64   `json:"duration"`
+	ArrivalAt    time.Time `json:"arrivalAt"`
+	CalculatedAt time.Time `json:"calculatedAt"`
+}
+
+// etaTarget returns the target of the ETA, its index in the route geometry and the stop if the target is a stop
+func etaTarget(ride RideRequest) (string, int, *int64) {
+	if ride.State == RiderRequestStateInProgress {
+		if pending := ride.PendingStops(); len(pending) > 0 {
+			return ETATargetStop, ride.Directions.NearestWayPointIndex(pending[0].Point()), &pending[0].ID
+		}
+		// The drop-off of a pooled ride is not necessarily the end of the route
+		if ride.PoolID != nil {
+			return ETATargetDropoff, ride.Directions.NearestWayPointIndex(geo.Point{Lat: ride.ToLat, Lng: ride.ToLng}), nil
+		}
+		return ETATargetDropoff, len(ride.Directions.Coordinates) - 1, nil
+	}
+	return ETATargetPickup, ride.Directions.NearestWayPointIndex(geo.Point{Lat: ride.FromLat, Lng: ride.FromLng}), nil
+}
+
+// estimateArrival estimates the remaining distance and duration from position to the coordinate at targetIndex,
+// using the durations of the remaining route steps
+func estimateArrival(directions *Directions, targetIndex int, position geo.Point) (float64, float64) {
+	points := directions.Points()
+	if len(points) == 0 {
+		return 0, 0
+	}
+	if targetIndex < 1 || targetIndex >= len(points) {
+		distance := geo.Distance(position, points[max(0, min(targetIndex, len(points)-1))])
+		return distance, distance / offRouteSpeedMetersPerSecond
+	}
+
+	line := points[:targetIndex+1]
+	linePos := geo.NearestPointOnLine(line, position)
+	distance := geo.LineLength(line) - linePos.DistanceAlong + linePos.Distance
+	duration := linePos.Distance / offRouteSpeedMetersPerSecond
+	for _, step := range directions.Steps() {
+		if len(step.WayPoints) != 2 {
+			continue
+		}
+		start, end := step.WayPoints[0], min(step.WayPoints[1], targetIndex)
+		if start >= targetIndex || end <= linePos.Index {
+			continue
+		}
+		if start > linePos.Index {
+			duration += step.Duration
+			continue
+		}
+		// The vehicle is somewhere on this step
+		stepLength := geo.LineLength(points[start : end+1])
+		if stepLength == 0 {
+			continue
+		}
+		remaining := geo.Distance(linePos.Point, points[linePos.Index+1]) + geo.LineLength(points[linePos.Index+1:end+1])
+		duration += step.Duration * remaining / stepLength
+	}
+	return distance, duration
+}
+
+func calculateRideETA(ride RideRequest, position geo.Point, vehicleID int64, now time.Time) RideETA {
+	target, targetIndex, stopID := etaTarget(ride)
+	distance, duration := estimateArrival(ride.Directions, targetIndex, position)
+	return RideETA{
+		RideID:       ride.ID,
+		RiderID:      ride.RiderID,
+		VehicleID:    vehicleID,
+		Target:       target,
+		StopID:       stopID,
+		Distance:     distance,
+		Duration:     duration,
+		ArrivalAt:    now.Add(time.Duration(duration) * time.Second),
+		CalculatedAt: now,
+	}
+}
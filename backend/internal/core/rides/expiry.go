@@ -0,0 +1,56 @@
+package rides
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/samber/lo"
+)
+
+const (
+	TopicRideExpired = "ride-expired"
+)
+
+type RideExpiredEvent struct {
+	RideID    int64     `json:"rideId"`
+	RiderID   int64     `json:"riderId"`
+	ExpiredAt time.Time `json:"expiredAt"`
+}
+
+// isExpired returns true if the ride has been available for longer than the TTL, even if it has not been expired yet.
+// Scheduled rides do not expire, they are cancelled if not claimed before the pickup time
+func (r *RideService) isExpired(ride RideRequest, now time.Time) bool {
+	if ride.State == RiderRequestStateExpired {
+		return true
+	}
+	availableSince := lo.FromPtrOr(ride.AvailableSince, ride.CreatedAt)
+	return ride.State == RiderRequestStateAvailable && ride.ScheduledPickupAt == nil && availableSince.Before(now.Add(-r.config.RequestTTL))
+}
+
+// ExpireRideRequests expires ride requests that have not been claimed within the TTL and notifies the riders
+func (r *RideService) ExpireRideRequests(ctx context.Context) error {
+	now := time.Now().UTC()
+	expired, err := r.rideRepo.ExpireRequests(ctx, now.Add(-r.config.RequestTTL))
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	for _, ride := range expired {
+		err = r.promotionService.ReleaseRide(ctx, ride.ID)
+		if err != nil {
+			return err
+		}
+		event := RideExpiredEvent{
+			RideID:    ride.ID,
+			RiderID:   ride.RiderID,
+			ExpiredAt: now,
+		}
+		eventBytes, err := json.Marshal(event)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		r.pubsub.Publish(ctx, TopicRideExpired, eventBytes)
+	}
+	return nil
+}
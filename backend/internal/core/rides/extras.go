@@ -0,0 +1,269 @@
+package rides
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/samber/lo"
+)
+
+const (
+	TopicRideExtraLogged   = "ride-extra-logged"
+	TopicRideExtraReviewed = "ride-extra-reviewed"
+)
+
+const (
+	// Extra logged by the driver and approved by support
+	LineItemExtra = "extra"
+)
+
+type ExtraState int
+
+const (
+	ExtraStatePending ExtraState = iota
+	ExtraStateApproved
+	ExtraStateRejected
+)
+
+const (
+	ExtraTypeCleaning = "cleaning"
+	ExtraTypeOther    = "other"
+)
+
+var extraTypes = []string{
+	ExtraTypeCleaning,
+	ExtraTypeOther,
+}
+
+// RideExtra is a fee the driver logs on a ride, like a cleaning fee. It is charged to the rider once support has approved it
+type RideExtra struct {
+	ID          int64      `json:"id"`
+	RideID      int64      `json:"rideId"`
+	DriverID    int64      `json:"driverId"`
+	Type        string     `json:"type"`
+	Amount      int        `json:"amount"`
+	Currency    string     `json:"currency"`
+	Description string     `json:"description"`
+	State       ExtraState `json:"state"`
+	ReviewedBy  *int64     `json:"reviewedBy"`
+	ReviewedAt  *time.Time `json:"reviewedAt"`
+	ReviewNote  *string    `json:"reviewNote"`
+	// Line item charged to the rider when the extra was approved
+	LineItemID *int64    `json:"lineItemId"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type RideExtraEvent struct {
+	RiderID int64     `json:"riderId"`
+	Extra   RideExtra `json:"extra"`
+}
+
+type LogExtraInput struct {
+	Type        string `json:"type"`
+	Amount      int    `json:"amount"`
+	Description string `json:"description"`
+}
+
+func (i *LogExtraInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.Type, validation.Required, validation.In(lo.ToAnySlice(extraTypes)...)),
+		validation.Field(&i.Amount, validation.Required),
+		validation.Field(&i.Description, validation.Required, validation.Length(0, 500)),
+	)
+}
+
+type ReviewExtraInput struct {
+	Approve bool   `json:"approve"`
+	Note    string `json:"note"`
+}
+
+func (i *ReviewExtraInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.Note, validation.Required),
+	)
+}
+
+func (r *RideService) publishExtra(ctx context.Context, topic string, riderID int64, extra RideExtra) error {
+	eventBytes, err := json.Marshal(RideExtraEvent{RiderID: riderID, Extra: extra})
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	r.pubsub.Publish(ctx, topic, eventBytes)
+	return nil
+}
+
+// LogExtra logs an extra on a ride in progress, or on a finished ride within the extra window. The extra is reviewed by support
+func (r *RideService) LogExtra(ctx context.Context, userID string, rideRequestId int64, input *LogExtraInput) (RideExtra, error) {
+	if err := input.Validate(); err != nil {
+		return RideExtra{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	user, err := r.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return RideExtra{}, core.Errorw(core.EINTERNAL, err)
+	}
+	rideReq, err := r.rideRepo.GetByID(ctx, rideRequestId)
+	if err != nil {
+		return RideExtra{}, core.WrapErr(err)
+	}
+	if rideReq.DriverID == nil || *rideReq.DriverID != user.ID {
+		return RideExtra{}, core.Errorf(core.EUNAUTHORIZED, "cannot log extras on ride you are not the driver of")
+	}
+	now := time.Now().UTC()
+	switch rideReq.State {
+	case RiderRequestStateInProgress:
+	case RiderRequestStateFinished:
+		if rideReq.FinishedAt == nil || now.After(rideReq.FinishedAt.Add(r.paymentsService.ExtraWindow())) {
+			return RideExtra{}, core.Errorf(core.EINVALID, "extras can no longer be logged on ride")
+		}
+	default:
+		return RideExtra{}, core.Errorf(core.EINVALID, "extras can only be logged on rides in progress or finished")
+	}
+	if err := r.paymentsService.ValidateExtra(ctx, input.Amount, rideReq.Currency); err != nil {
+		return RideExtra{}, err
+	}
+
+	extra := RideExtra{
+		RideID:      rideReq.ID,
+		DriverID:    user.ID,
+		Type:        input.Type,
+		Amount:      input.Amount,
+		Currency:    rideReq.Currency,
+		Description: input.Description,
+		State:       ExtraStatePending,
+		CreatedAt:   now,
+	}
+	err = r.rideRepo.CreateExtra(ctx, &extra)
+	if err != nil {
+		return RideExtra{}, core.Errorw(core.EINTERNAL, err)
+	}
+	err = r.publishExtra(ctx, TopicRideExtraLogged, rideReq.RiderID, extra)
+	if err != nil {
+		return RideExtra{}, err
+	}
+	return extra, nil
+}
+
+// GetRideExtras returns the extras logged on the ride, for its rider and driver
+func (r *RideService) GetRideExtras(ctx context.Context, userID string, rideRequestId int64) ([]RideExtra, error) {
+	user, err := r.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return []RideExtra{}, core.Errorw(core.EINTERNAL, err)
+	}
+	rideReq, err := r.rideRepo.GetByID(ctx, rideRequestId)
+	if err != nil {
+		return []RideExtra{}, core.WrapErr(err)
+	}
+	if rideReq.RiderID != user.ID && (rideReq.DriverID == nil || *rideReq.DriverID != user.ID) {
+		return []RideExtra{}, core.Errorf(core.EUNAUTHORIZED, "cannot view extras of ride you are not part of")
+	}
+	extras, err := r.rideRepo.GetExtrasByRideID(ctx, rideReq.ID)
+	if err != nil {
+		return []RideExtra{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return extras, nil
+}
+
+// GetExtras returns the extras in the state, oldest first
+func (r *RideService) GetExtras(ctx context.Context, state ExtraState) ([]RideExtra, error) {
+	extras, err := r.rideRepo.GetExtrasByState(ctx, state)
+	if err != nil {
+		return []RideExtra{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return extras, nil
+}
+
+// ReviewExtra approves or rejects a pending extra. An approved extra is added to the fare as a line item, paid to the driver
+func (r *RideService) ReviewExtra(ctx context.Context, userID string, extraID int64, input *ReviewExtraInput) (RideExtra, error) {
+	if err := input.Validate(); err != nil {
+		return RideExtra{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	user, err := r.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return RideExtra{}, core.Errorw(core.EINTERNAL, err)
+	}
+	extra, err := r.rideRepo.GetExtra(ctx, extraID)
+	if err != nil {
+		return RideExtra{}, core.WrapErr(err)
+	}
+	rideReq, err := r.rideRepo.GetByID(ctx, extra.RideID)
+	if err != nil {
+		return RideExtra{}, core.WrapErr(err)
+	}
+	if extra.State == ExtraStateApproved && input.Approve && extra.LineItemID != nil {
+		// Approving again completes the charge of an extra approved after the ride finished
+		err = r.chargeExtra(ctx, rideReq, *extra.LineItemID)
+		if err != nil {
+			return RideExtra{}, core.WrapErr(err)
+		}
+		return extra, nil
+	}
+	if extra.State != ExtraStatePending {
+		return RideExtra{}, core.Errorf(core.EINVALID, "extra has already been reviewed")
+	}
+
+	now := time.Now().UTC()
+	extra.State = lo.Ternary(input.Approve, ExtraStateApproved, ExtraStateRejected)
+	extra.ReviewedBy = &user.ID
+	extra.ReviewedAt = &now
+	extra.ReviewNote = &input.Note
+	var lineItem *RideLineItem
+	if input.Approve {
+		lineItem = &RideLineItem{
+			RideID:      extra.RideID,
+			Type:        LineItemExtra,
+			Amount:      extra.Amount,
+			Currency:    extra.Currency,
+			Description: extra.Description,
+			CreatedBy:   extra.DriverID,
+			CreatedAt:   now,
+		}
+	}
+	reviewed, err := r.rideRepo.ReviewExtra(ctx, &extra, lineItem)
+	if err != nil {
+		return RideExtra{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if !reviewed {
+		return RideExtra{}, core.Errorf(core.ECONFLICT, "extra was reviewed concurrently")
+	}
+	if lineItem != nil {
+		err = r.paymentsService.RecordSurcharge(ctx, lineItem.ID, rideReq.ID, billedAccount(rideReq), extra.DriverID, lineItem.Amount, lineItem.Currency)
+		if err != nil {
+			return RideExtra{}, core.Errorw(core.EINTERNAL, err)
+		}
+		err = r.chargeExtra(ctx, rideReq, lineItem.ID)
+		if err != nil {
+			return RideExtra{}, core.WrapErr(err)
+		}
+	}
+	err = r.publishExtra(ctx, TopicRideExtraReviewed, rideReq.RiderID, extra)
+	if err != nil {
+		return RideExtra{}, err
+	}
+	return extra, nil
+}
+
+// chargedSeparately returns whether the line item is an extra approved after the ride finished, which is not captured with the fare
+func chargedSeparately(ride RideRequest, lineItem RideLineItem) bool {
+	return lineItem.Type == LineItemExtra && ride.FinishedAt != nil && lineItem.CreatedAt.After(*ride.FinishedAt)
+}
+
+// chargeExtra charges an extra approved after the ride finished to the rider's payment method, as the fare has been captured already.
+// The charge is identified by the line item, so charging again does not charge twice. Rides billed to an organisation are invoiced
+func (r *RideService) chargeExtra(ctx context.Context, ride RideRequest, lineItemID int64) error {
+	if ride.OrganisationID != nil {
+		return nil
+	}
+	lineItems, err := r.rideRepo.GetLineItems(ctx, []int64{ride.ID})
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	lineItem, ok := lo.Find(lineItems, func(item RideLineItem) bool { return item.ID == lineItemID })
+	if !ok || !chargedSeparately(ride, lineItem) {
+		return nil
+	}
+	return r.paymentsService.ChargeRide(ctx, ride.ID, ride.RiderID, lineItem.Amount, lineItem.Currency, fmt.Sprintf("line-item:%v", lineItem.ID))
+}
@@ -0,0 +1,223 @@
+package rides
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+	"github.com/samber/lo"
+)
+
+const (
+	TopicRideDeviation     = "ride-deviation"
+	TopicVehicleStationary = "vehicle-stationary"
+)
+
+type MonitorConfig struct {
+	DeviationThresholdMeters float64
+	StationaryRadiusMeters   float64
+	StationaryDuration       time.Duration
+	RerouteOnDeviation       bool
+}
+
+type RideAlert struct {
+	Type      string    `json:"type"`
+	RideID    int64     `json:"rideId"`
+	DriverID  int64     `json:"driverId"`
+	VehicleID int64     `json:"vehicleId"`
+	Lat       float64   `json:"lat"`
+	Lng       float64   `json:"lng"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// vehicleTrack is the monitoring state of a vehicle on an active ride
+type vehicleTrack struct {
+	vehicleID int64
+	// Position the vehicle was last seen moving away from
+	anchor             geo.Point
+	anchorAt           time.Time
+	stationaryReported bool
+	deviating          bool
+}
+
+// RideMonitor watches position updates of vehicles on active rides and raises alerts
+// when a driver leaves the planned route or stops for too long
+type RideMonitor struct {
+	rideRepo           RideRepository
+	vehicleRepo        vehicles.VehicleRepository
+	routeServiceClient RouteServiceClient
+	pubsub             core.Pubsub
+	config             MonitorConfig
+
+	mu sync.Mutex
+	// Tracks by ride id. A vehicle with pooled riders has a track for each ride
+	tracks map[int64]*vehicleTrack
+}
+
+var maxRecentAlerts = 100
+
+func NewMonitor(rideRepo RideRepository, vehicleRepo vehicles.VehicleRepository, routeServiceClient RouteServiceClient, pubsub core.Pubsub, config MonitorConfig) *RideMonitor {
+	return &RideMonitor{
+		rideRepo:           rideRepo,
+		vehicleRepo:        vehicleRepo,
+		routeServiceClient: routeServiceClient,
+		pubsub:             pubsub,
+		config:             config,
+		tracks:             make(map[int64]*vehicleTrack),
+	}
+}
+
+// HandlePositionUpdate checks the position against each of the vehicle's active rides and publishes any alerts
+func (m *RideMonitor) HandlePositionUpdate(ctx context.Context, position vehicles.VehiclePosition) error {
+	vehicle, err := m.vehicleRepo.GetByID(ctx, position.VehicleID)
+	if err != nil {
+		return core.WrapErr(err)
+	}
+	ridesList, err := activeRidesForVehicle(ctx, m.rideRepo, vehicle)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	m.dropFinishedTracks(vehicle.ID, ridesList)
+
+	point := geo.Point{Lat: position.Lat, Lng: position.Lng}
+	now := time.Now().UTC()
+	for _, ride := range ridesList {
+		alerts := m.check(ride, vehicle.ID, point, now)
+		for _, alert := range alerts {
+			err = m.publishAlert(ctx, alert)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dropFinishedTracks stops tracking the rides of the vehicle that are no longer active
+func (m *RideMonitor) dropFinishedTracks(vehicleID int64, activeRides []RideRequest) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for rideID, track := range m.tracks {
+		if track.vehicleID != vehicleID {
+			continue
+		}
+		if !lo.ContainsBy(activeRides, func(ride RideRequest) bool { return ride.ID == rideID }) {
+			delete(m.tracks, rideID)
+		}
+	}
+}
+
+func (m *RideMonitor) check(ride RideRequest, vehicleID int64, point geo.Point, now time.Time) []RideAlert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	track, ok := m.tracks[ride.ID]
+	if !ok || track.vehicleID != vehicleID {
+		track = &vehicleTrack{vehicleID: vehicleID, anchor: point, anchorAt: now}
+		m.tracks[ride.ID] = track
+	}
+	newAlert := func(alertType string, message string) RideAlert {
+		return RideAlert{
+			Type:      alertType,
+			RideID:    ride.ID,
+			DriverID:  *ride.DriverID,
+			VehicleID: vehicleID,
+			Lat:       point.Lat,
+			Lng:       point.Lng,
+			Message:   message,
+			Timestamp: now,
+		}
+	}
+
+	alerts := make([]RideAlert, 0)
+	// Waiting at the pickup location is expected
+	if ride.State == RiderRequestStateDriverArrived || geo.Distance(track.anchor, point) > m.config.StationaryRadiusMeters {
+		track.anchor = point
+		track.anchorAt = now
+		track.stationaryReported = false
+	} else if !track.stationaryReported && now.Sub(track.anchorAt) >= m.config.StationaryDuration {
+		track.stationaryReported = true
+		message := fmt.Sprintf("vehicle has not moved for %v", now.Sub(track.anchorAt).Round(time.Second))
+		alerts = append(alerts, newAlert(TopicVehicleStationary, message))
+	}
+
+	if ride.Directions != nil && len(ride.Directions.Coordinates) > 1 {
+		linePos := geo.NearestPointOnLine(ride.Directions.Points(), point)
+		if linePos.Distance > m.config.DeviationThresholdMeters {
+			if !track.deviating {
+				track.deviating = true
+				message := fmt.Sprintf("vehicle is %.0fm from the planned route", linePos.Distance)
+				alerts = append(alerts, newAlert(TopicRideDeviation, message))
+			}
+		} else {
+			track.deviating = false
+		}
+	}
+	return alerts
+}
+
+func (m *RideMonitor) publishAlert(ctx context.Context, alert RideAlert) error {
+	err := m.rideRepo.CreateAlert(ctx, alert)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	alertBytes, err := json.Marshal(alert)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	m.pubsub.Publish(ctx, alert.Type, alertBytes)
+	return nil
+}
+
+// GetRecentAlerts returns the latest alerts raised by any replica, newest first
+func (m *RideMonitor) GetRecentAlerts(ctx context.Context) ([]RideAlert, error) {
+	alerts, err := m.rideRepo.GetRecentAlerts(ctx, maxRecentAlerts)
+	if err != nil {
+		return nil, core.Errorw(core.EINTERNAL, err)
+	}
+	return alerts, nil
+}
+
+// Reroute fetches new directions from the vehicle's position for a ride that has deviated from its route.
+// Does nothing if rerouting is disabled
+func (m *RideMonitor) Reroute(ctx context.Context, alert RideAlert) error {
+	if !m.config.RerouteOnDeviation {
+		return nil
+	}
+	ride, err := m.rideRepo.GetByID(ctx, alert.RideID)
+	if err != nil {
+		return core.WrapErr(err)
+	}
+	position := geo.Point{Lat: alert.Lat, Lng: alert.Lng}
+	dropoff := geo.Point{Lat: ride.ToLat, Lng: ride.ToLng}
+	var points []geo.Point
+	switch ride.State {
+	case RiderRequestStateAccepted, RiderRequestStateDriverArrived:
+		points = ridePoints(&position, geo.Point{Lat: ride.FromLat, Lng: ride.FromLng}, ride.Stops, dropoff)
+	case RiderRequestStateInProgress:
+		points = ridePoints(nil, position, ride.PendingStops(), dropoff)
+	default:
+		return nil
+	}
+	directions, err := m.routeServiceClient.GetDirections(routeLocations(points...))
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	err = m.rideRepo.UpdateRideDirections(ctx, ride.ID, directions, ride.Price)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if track, ok := m.tracks[ride.ID]; ok && track.vehicleID == alert.VehicleID {
+		track.deviating = false
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package rides
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/users"
+	"github.com/samber/lo"
+)
+
+const (
+	TopicMonthlyInvoiceIssued = "monthly-invoice-issued"
+)
+
+// MonthlyInvoiceTotal is the total of the rides of a monthly invoice paid in a currency
+type MonthlyInvoiceTotal struct {
+	Currency string       `json:"currency"`
+	Total    int          `json:"total"`
+	Refunded int          `json:"refunded"`
+	VAT      []ReceiptVAT `json:"vat"`
+}
+
+// MonthlyInvoice is the consolidated invoice of the rides a business rider finished in a month
+type MonthlyInvoice struct {
+	InvoiceNumber string                  `json:"invoiceNumber"`
+	IssuedAt      time.Time               `json:"issuedAt"`
+	UserID        int64                   `json:"userId"`
+	RiderName     string                  `json:"riderName"`
+	Billing       payments.BillingProfile `json:"billing"`
+	PeriodStart   time.Time               `json:"periodStart"`
+	PeriodEnd     time.Time               `json:"periodEnd"`
+	Receipts      []RideReceipt           `json:"receipts"`
+	Totals        []MonthlyInvoiceTotal   `json:"totals"`
+}
+
+type MonthlyInvoiceIssuedEvent struct {
+	UserID      int64     `json:"userId"`
+	PeriodStart time.Time `json:"periodStart"`
+}
+
+// monthlyInvoiceTotals sums the receipts by currency, and their VAT by jurisdiction
+func monthlyInvoiceTotals(receipts []RideReceipt) []MonthlyInvoiceTotal {
+	totals := make([]MonthlyInvoiceTotal, 0)
+	for currency, currencyReceipts := range lo.GroupBy(receipts, func(item RideReceipt) string { return item.Currency }) {
+		total := MonthlyInvoiceTotal{
+			Currency: currency,
+			Total:    lo.SumBy(currencyReceipts, func(item RideReceipt) int { return item.Total }),
+			Refunded: lo.SumBy(currencyReceipts, func(item RideReceipt) int { return item.Refunded }),
+			VAT:      make([]ReceiptVAT, 0),
+		}
+		vatLines := lo.FlatMap(currencyReceipts, func(item RideReceipt, index int) []ReceiptVAT { return item.VAT })
+		for jurisdiction, jurisdictionLines := range lo.GroupBy(vatLines, func(item ReceiptVAT) string { return item.Jurisdiction }) {
+			total.VAT = append(total.VAT, ReceiptVAT{
+				Jurisdiction: jurisdiction,
+				Rate:         jurisdictionLines[0].Rate,
+				Net:          lo.SumBy(jurisdictionLines, func(item ReceiptVAT) int { return item.Net }),
+				VAT:          lo.SumBy(jurisdictionLines, func(item ReceiptVAT) int { return item.VAT }),
+			})
+		}
+		sort.Slice(total.VAT, func(i, j int) bool { return total.VAT[i].Jurisdiction < total.VAT[j].Jurisdiction })
+		totals = append(totals, total)
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i].Currency < totals[j].Currency })
+	return totals
+}
+
+// selfBilledRides returns the rides billed to the rider. Rides billed to an organisation are not on the rider's invoices
+func selfBilledRides(ridesList []RideRequest) []RideRequest {
+	return lo.Filter(ridesList, func(item RideRequest, index int) bool { return item.OrganisationID == nil })
+}
+
+// buildMonthlyInvoice returns the invoice of the rides the user finished in the month of the invoice
+func (r *RideService) buildMonthlyInvoice(ctx context.Context, user users.User, billing payments.BillingProfile, invoice payments.Invoice) (MonthlyInvoice, error) {
+	periodStart := *invoice.PeriodStart
+	periodEnd := periodStart.AddDate(0, 1, 0)
+	ridesList, err := r.rideRepo.GetFinishedByRiderID(ctx, user.ID, periodStart, periodEnd)
+	if err != nil {
+		return MonthlyInvoice{}, err
+	}
+	ridesList = selfBilledRides(ridesList)
+	receipts := make([]RideReceipt, 0, len(ridesList))
+	for _, ride := range ridesList {
+		receipt, err := r.buildRideReceipt(ctx, ride)
+		if err != nil {
+			return MonthlyInvoice{}, err
+		}
+		receipts = append(receipts, receipt)
+	}
+	return MonthlyInvoice{
+		InvoiceNumber: invoice.InvoiceNumber(),
+		IssuedAt:      invoice.CreatedAt,
+		UserID:        user.ID,
+		RiderName:     user.Name,
+		Billing:       billing,
+		PeriodStart:   periodStart,
+		PeriodEnd:     periodEnd,
+		Receipts:      receipts,
+		Totals:        monthlyInvoiceTotals(receipts),
+	}, nil
+}
+
+// IssueMonthlyInvoices invoices business riders getting monthly invoices for the rides they finished last month.
+// Months without rides are not invoiced
+func (r *RideService) IssueMonthlyInvoices(ctx context.Context) error {
+	periodStart := payments.MonthStart(time.Now()).AddDate(0, -1, 0)
+	profiles, err := r.paymentsService.GetMonthlyBillingProfiles(ctx)
+	if err != nil {
+		return err
+	}
+	for _, profile := range profiles {
+		existing, err := r.paymentsService.GetMonthlyInvoice(ctx, profile.UserID, periodStart)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			continue
+		}
+		ridesList, err := r.rideRepo.GetFinishedByRiderID(ctx, profile.UserID, periodStart, periodStart.AddDate(0, 1, 0))
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		if len(selfBilledRides(ridesList)) == 0 {
+			continue
+		}
+		_, created, err := r.paymentsService.IssueMonthlyInvoice(ctx, profile.UserID, periodStart)
+		if err != nil {
+			return err
+		}
+		if !created {
+			continue
+		}
+		event := MonthlyInvoiceIssuedEvent{UserID: profile.UserID, PeriodStart: periodStart}
+		eventBytes, err := json.Marshal(event)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		r.pubsub.Publish(ctx, TopicMonthlyInvoiceIssued, eventBytes)
+	}
+	return nil
+}
+
+// GetMonthlyInvoiceByID returns the invoice of the month starting at periodStart of the user
+func (r *RideService) GetMonthlyInvoiceByID(ctx context.Context, userID int64, periodStart time.Time) (MonthlyInvoice, error) {
+	user, err := r.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return MonthlyInvoice{}, core.WrapErr(err)
+	}
+	invoice, err := r.paymentsService.GetMonthlyInvoice(ctx, user.ID, periodStart)
+	if err != nil {
+		return MonthlyInvoice{}, err
+	}
+	if invoice == nil {
+		return MonthlyInvoice{}, core.Errorf(core.ENOTFOUND, "no invoice for %v", periodStart.Format("2006-01"))
+	}
+	billing, err := r.paymentsService.GetBillingProfile(ctx, user.ID)
+	if err != nil {
+		return MonthlyInvoice{}, err
+	}
+	if billing == nil {
+		return MonthlyInvoice{}, core.Errorf(core.ENOTFOUND, "user %v has no billing profile", user.ID)
+	}
+	monthlyInvoice, err := r.buildMonthlyInvoice(ctx, user, *billing, *invoice)
+	if err != nil {
+		return MonthlyInvoice{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return monthlyInvoice, nil
+}
+
+// GetMonthlyInvoice returns the invoice of a month to the business rider, month being formatted as 2006-01
+func (r *RideService) GetMonthlyInvoice(ctx context.Context, userID string, month string) (MonthlyInvoice, error) {
+	periodStart, err := time.Parse("2006-01", month)
+	if err != nil {
+		return MonthlyInvoice{}, core.Errorf(core.EINVALID, "invalid month %v, must be formatted as YYYY-MM", month)
+	}
+	user, err := r.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return MonthlyInvoice{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return r.GetMonthlyInvoiceByID(ctx, user.ID, periodStart)
+}
@@ -0,0 +1,174 @@
+package rides
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/organisations"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/users"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+	"github.com/samber/lo"
+)
+
+// Longest period an organisation dashboard can cover
+const maxOrganisationPeriod = 366 * 24 * time.Hour
+
+// MemberSpend is what an organisation was billed for the finished rides of a member in a currency
+type MemberSpend struct {
+	UserID   int64  `json:"userId"`
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
+	Rides    int    `json:"rides"`
+	// Fares and surcharges. Tips are paid by the member
+	Spend    int `json:"spend"`
+	Refunded int `json:"refunded"`
+}
+
+// OrganisationDashboard is the rides billed to an organisation created in a period, and what they cost it
+type OrganisationDashboard struct {
+	OrganisationID int64         `json:"organisationId"`
+	From           time.Time     `json:"from"`
+	To             time.Time     `json:"to"`
+	Rides          []RideRequest `json:"rides"`
+	// Spend per member and currency, ordered by member
+	Spend []MemberSpend `json:"spend"`
+	// Balance of the organisation's account per currency. A negative balance is owed by the organisation
+	Balances []payments.Balance `json:"balances"`
+}
+
+// billedAccount returns the account the fare of the ride is billed to
+func billedAccount(ride RideRequest) payments.Account {
+	if ride.OrganisationID != nil {
+		return payments.OrganisationAccount(*ride.OrganisationID)
+	}
+	return payments.RiderAccount(ride.RiderID)
+}
+
+// checkOrganisationBilling returns an error if the user cannot bill the ride to the organisation, or the ride breaks the policy of the organisation
+func (r *RideService) checkOrganisationBilling(ctx context.Context, user users.User, input *CreateRideInput) error {
+	if len(input.PromoCodes) > 0 {
+		return core.Errorf(core.EINVALID, "promo codes cannot be applied to rides billed to an organisation")
+	}
+	policy, err := r.organisationService.BillingPolicy(ctx, *input.OrganisationID, user.ID)
+	if err != nil {
+		return err
+	}
+	pickupAt := time.Now().UTC()
+	if input.PickupAt != nil {
+		pickupAt = input.PickupAt.UTC()
+	}
+	err = policy.Check(pickupAt, vehicles.ClassOrDefault(input.VehicleClass), input.ExpenseCode)
+	if err != nil {
+		return err
+	}
+	if policy.MaxFare == nil {
+		return nil
+	}
+	quote, err := r.quoteRide(input)
+	if err != nil {
+		return err
+	}
+	return r.checkMaxFare(ctx, policy, quote.chargedPrice(), quote.Currency)
+}
+
+// checkMaxFare returns an error if the fare exceeds the maximum fare allowed by the policy
+func (r *RideService) checkMaxFare(ctx context.Context, policy organisations.RidePolicy, price int, currency string) error {
+	if policy.MaxFare == nil {
+		return nil
+	}
+	maxFare, err := r.paymentsService.LocalAmount(ctx, *policy.MaxFare, currency)
+	if err != nil {
+		return err
+	}
+	if price > maxFare {
+		return core.Errorf(core.EINVALID, "fare of %v %v exceeds the maximum fare of %v %v allowed by the policy of the organisation",
+			price, currency, maxFare, currency)
+	}
+	return nil
+}
+
+// memberSpend sums what the organisation was billed for the finished rides per member and currency
+func memberSpend(ridesList []RideRequest, lineItems []RideLineItem, refunds []RideRefund, names map[int64]string) []MemberSpend {
+	lineItemsByRide := lo.GroupBy(lineItems, func(item RideLineItem) int64 { return item.RideID })
+	refundsByRide := lo.GroupBy(refunds, func(item RideRefund) int64 { return item.RideID })
+	type spendKey struct {
+		userID   int64
+		currency string
+	}
+	spendByKey := make(map[spendKey]*MemberSpend)
+	for _, ride := range ridesList {
+		if ride.State != RiderRequestStateFinished {
+			continue
+		}
+		key := spendKey{userID: ride.RiderID, currency: ride.Currency}
+		spend, ok := spendByKey[key]
+		if !ok {
+			spend = &MemberSpend{UserID: ride.RiderID, Name: names[ride.RiderID], Currency: ride.Currency}
+			spendByKey[key] = spend
+		}
+		spend.Rides++
+		spend.Spend += ride.Price + lo.SumBy(lineItemsByRide[ride.ID], func(item RideLineItem) int {
+			if item.Type == LineItemTip {
+				return 0
+			}
+			return item.Amount
+		})
+		spend.Refunded += lo.SumBy(refundsByRide[ride.ID], func(item RideRefund) int { return item.Amount })
+	}
+	spendList := lo.MapToSlice(spendByKey, func(key spendKey, value *MemberSpend) MemberSpend { return *value })
+	sort.Slice(spendList, func(i, j int) bool {
+		if spendList[i].UserID != spendList[j].UserID {
+			return spendList[i].UserID < spendList[j].UserID
+		}
+		return spendList[i].Currency < spendList[j].Currency
+	})
+	return spendList
+}
+
+// GetOrganisationDashboard returns the rides members billed to the organisation from from until to, and the spend per member, to admins of the organisation
+func (r *RideService) GetOrganisationDashboard(ctx context.Context, userID string, organisationID int64, from time.Time, to time.Time) (OrganisationDashboard, error) {
+	if !to.After(from) || to.Sub(from) > maxOrganisationPeriod {
+		return OrganisationDashboard{}, core.Errorf(core.EINVALID, "invalid period")
+	}
+	_, err := r.organisationService.RequireAdmin(ctx, userID, organisationID)
+	if err != nil {
+		return OrganisationDashboard{}, err
+	}
+	ridesList, err := r.rideRepo.GetByOrganisationID(ctx, organisationID, from, to)
+	if err != nil {
+		return OrganisationDashboard{}, core.Errorw(core.EINTERNAL, err)
+	}
+	rideIDs := lo.Map(ridesList, func(item RideRequest, index int) int64 { return item.ID })
+	lineItems, err := r.rideRepo.GetLineItems(ctx, rideIDs)
+	if err != nil {
+		return OrganisationDashboard{}, core.Errorw(core.EINTERNAL, err)
+	}
+	refunds, err := r.rideRepo.GetRefundsByRideIDs(ctx, rideIDs)
+	if err != nil {
+		return OrganisationDashboard{}, core.Errorw(core.EINTERNAL, err)
+	}
+	// Riders that have left the organisation are still named
+	names := make(map[int64]string)
+	for _, riderID := range lo.Uniq(lo.Map(ridesList, func(item RideRequest, index int) int64 { return item.RiderID })) {
+		rider, err := r.userRepo.GetByID(ctx, riderID)
+		if err != nil {
+			return OrganisationDashboard{}, core.Errorw(core.EINTERNAL, err)
+		}
+		names[riderID] = rider.Name
+	}
+	balances, err := r.paymentsService.GetOrganisationBalances(ctx, organisationID)
+	if err != nil {
+		return OrganisationDashboard{}, err
+	}
+	return OrganisationDashboard{
+		OrganisationID: organisationID,
+		From:           from,
+		To:             to,
+		Rides:          ridesList,
+		Spend:          memberSpend(ridesList, lineItems, refunds, names),
+		Balances:       balances,
+	}, nil
+}
@@ -0,0 +1,60 @@
+package rides
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMemberSpend(t *testing.T) {
+	names := map[int64]string{1: "Alice", 2: "Bob"}
+	tests := []struct {
+		name      string
+		rides     []RideRequest
+		lineItems []RideLineItem
+		refunds   []RideRefund
+		want      []MemberSpend
+	}{
+		{
+			name: "fares and surcharges without tips",
+			rides: []RideRequest{
+				{ID: 1, RiderID: 1, State: RiderRequestStateFinished, Price: 10000, Currency: "DKK"},
+				{ID: 2, RiderID: 1, State: RiderRequestStateFinished, Price: 5000, Currency: "DKK"},
+			},
+			lineItems: []RideLineItem{
+				{RideID: 1, Type: LineItemWaitingTime, Amount: 300},
+				{RideID: 1, Type: LineItemTip, Amount: 1000},
+				{RideID: 2, Type: LineItemZoneFee, Amount: 200},
+			},
+			refunds: []RideRefund{{RideID: 2, Amount: 1500}},
+			want:    []MemberSpend{{UserID: 1, Name: "Alice", Currency: "DKK", Rides: 2, Spend: 15500, Refunded: 1500}},
+		},
+		{
+			name: "per member and currency",
+			rides: []RideRequest{
+				{ID: 1, RiderID: 2, State: RiderRequestStateFinished, Price: 3000, Currency: "SEK"},
+				{ID: 2, RiderID: 1, State: RiderRequestStateFinished, Price: 1000, Currency: "EUR"},
+				{ID: 3, RiderID: 1, State: RiderRequestStateFinished, Price: 10000, Currency: "DKK"},
+			},
+			want: []MemberSpend{
+				{UserID: 1, Name: "Alice", Currency: "DKK", Rides: 1, Spend: 10000},
+				{UserID: 1, Name: "Alice", Currency: "EUR", Rides: 1, Spend: 1000},
+				{UserID: 2, Name: "Bob", Currency: "SEK", Rides: 1, Spend: 3000},
+			},
+		},
+		{
+			name: "only finished rides",
+			rides: []RideRequest{
+				{ID: 1, RiderID: 1, State: RiderRequestStateCancelled, Price: 10000, Currency: "DKK"},
+				{ID: 2, RiderID: 1, State: RiderRequestStateInProgress, Price: 10000, Currency: "DKK"},
+			},
+			want: []MemberSpend{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := memberSpend(tt.rides, tt.lineItems, tt.refunds, names); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("memberSpend() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package rides
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+	"github.com/samber/lo"
+)
+
+const (
+	TopicRidePooled = "ride-pooled"
+)
+
+const (
+	PoolStopPickup  = "pickup"
+	PoolStopDropoff = "dropoff"
+)
+
+// Number of stop orders, shortest by straight-line distance first, that are routed when planning a pool
+const poolPlansToRoute = 3
+
+type PoolingConfig struct {
+	// Maximum extra time a pooled rider spends in the vehicle compared to riding alone
+	MaxDetour time.Duration
+	// Seats available to the riders of a pool
+	SeatCapacity int
+	// Pooled rides are matched if their pickup times are within MatchWindow of each other
+	MatchWindow time.Duration
+	// Pooled rides are matched if both their pickups and their drop-offs are within MatchRadiusMeters of each other
+	MatchRadiusMeters float64
+}
+
+// PoolStop is a pickup or drop-off of a ride in a pool
+type PoolStop struct {
+	RideID int64   `json:"rideId"`
+	Type   string  `json:"type"`
+	Lat    float64 `json:"lat"`
+	Lng    float64 `json:"lng"`
+}
+
+func (s PoolStop) Point() geo.Point {
+	return geo.Point{Lat: s.Lat, Lng: s.Lng}
+}
+
+// RidePool is a group of pooled rides driven by one driver, visiting the stops in order
+type RidePool struct {
+	ID    int64      `json:"id"`
+	Stops []PoolStop `json:"stops"`
+	// Distance in meters
+	Distance float64 `json:"distance"`
+	// Duration in seconds
+	Duration  float64   `json:"duration"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type RidePooledEvent struct {
+	RideID  int64 `json:"rideId"`
+	RiderID int64 `json:"riderId"`
+	PoolID  int64 `json:"poolId"`
+	Price   int   `json:"price"`
+}
+
+func (r *RideService) validatePooling(input *CreateRideInput) error {
+	if !input.Pooled {
+		return nil
+	}
+	if len(input.Stops) > 0 {
+		return core.Errorf(core.EINVALID, "pooled rides cannot have stops")
+	}
+	seatCapacity := r.poolSeatCapacity(vehicles.ClassOrDefault(input.VehicleClass))
+	if max(1, input.Seats) > seatCapacity {
+		return core.Errorf(core.EINVALID, "pooled rides can have at most %v seats", seatCapacity)
+	}
+	return nil
+}
+
+// poolSeatCapacity returns the number of seats available to the riders of a pool in a vehicle of the class
+func (r *RideService) poolSeatCapacity(vehicleClass vehicles.VehicleClass) int {
+	classInfo, ok := vehicles.GetVehicleClass(vehicleClass)
+	if !ok {
+		return r.config.Pooling.SeatCapacity
+	}
+	return min(r.config.Pooling.SeatCapacity, classInfo.Seats)
+}
+
+// poolPickupTime returns the time the rider wants to be picked up
+func poolPickupTime(ride RideRequest) time.Time {
+	if ride.ScheduledPickupAt != nil {
+		return *ride.ScheduledPickupAt
+	}
+	return ride.CreatedAt
+}
+
+// poolCompatible returns true if the ride can be matched with all rides of the group
+func (r *RideService) poolCompatible(group []RideRequest, ride RideRequest) bool {
+	seats := ride.Seats
+	for _, other := range group {
+		seats += other.Seats
+		if other.VehicleClass != ride.VehicleClass || other.Currency != ride.Currency {
+			return false
+		}
+		if poolPickupTime(other).Sub(poolPickupTime(ride)).Abs() > r.config.Pooling.MatchWindow {
+			return false
+		}
+		pickupDistance := geo.Distance(geo.Point{Lat: other.FromLat, Lng: other.FromLng}, geo.Point{Lat: ride.FromLat, Lng: ride.FromLng})
+		dropoffDistance := geo.Distance(geo.Point{Lat: other.ToLat, Lng: other.ToLng}, geo.Point{Lat: ride.ToLat, Lng: ride.ToLng})
+		if pickupDistance > r.config.Pooling.MatchRadiusMeters || dropoffDistance > r.config.Pooling.MatchRadiusMeters {
+			return false
+		}
+	}
+	return seats <= r.poolSeatCapacity(ride.VehicleClass)
+}
+
+// poolOrders returns the orders the stops of the rides can be visited in, with each pickup before its drop-off
+func poolOrders(ridesList []RideRequest) [][]PoolStop {
+	orders := make([][]PoolStop, 0)
+	var visit func(order []PoolStop, pickedUp map[int64]bool, droppedOff map[int64]bool)
+	visit = func(order []PoolStop, pickedUp map[int64]bool, droppedOff map[int64]bool) {
+		if len(order) == 2*len(ridesList) {
+			orders = append(orders, append([]PoolStop{}, order...))
+			return
+		}
+		for _, ride := range ridesList {
+			if !pickedUp[ride.ID] {
+				pickedUp[ride.ID] = true
+				visit(append(order, PoolStop{RideID: ride.ID, Type: PoolStopPickup, Lat: ride.FromLat, Lng: ride.FromLng}), pickedUp, droppedOff)
+				pickedUp[ride.ID] = false
+			} else if !droppedOff[ride.ID] {
+				droppedOff[ride.ID] = true
+				visit(append(order, PoolStop{RideID: ride.ID, Type: PoolStopDropoff, Lat: ride.ToLat, Lng: ride.ToLng}), pickedUp, droppedOff)
+				droppedOff[ride.ID] = false
+			}
+		}
+	}
+	visit(make([]PoolStop, 0, 2*len(ridesList)), map[int64]bool{}, map[int64]bool{})
+	return orders
+}
+
+func poolStopPoints(stops []PoolStop) []geo.Point {
+	return lo.Map(stops, func(item PoolStop, index int) geo.Point { return item.Point() })
+}
+
+// soloRoute returns the directions of the ride without pooling, cached in soloRoutes
+func (r *RideService) soloRoute(ride RideRequest, soloRoutes map[int64]*Directions) (*Directions, error) {
+	if directions, ok := soloRoutes[ride.ID]; ok {
+		return directions, nil
+	}
+	directions, err := r.routeServiceClient.GetDirections(routeLocations(
+		geo.Point{Lat: ride.FromLat, Lng: ride.FromLng}, geo.Point{Lat: ride.ToLat, Lng: ride.ToLng}))
+	if err != nil {
+		return nil, err
+	}
+	soloRoutes[ride.ID] = directions
+	return directions, nil
+}
+
+// planPool finds the stop order with the shortest route where no rider exceeds the maximum detour.
+// Returns nil if the rides cannot be pooled
+func (r *RideService) planPool(ridesList []RideRequest, soloRoutes map[int64]*Directions) ([]PoolStop, *Directions, error) {
+	orders := poolOrders(ridesList)
+	sort.Slice(orders, func(i, j int) bool {
+		return geo.LineLength(poolStopPoints(orders[i])) < geo.LineLength(poolStopPoints(orders[j]))
+	})
+	for _, order := range orders[:min(len(orders), poolPlansToRoute)] {
+		directions, err := r.routeServiceClient.GetDirections(routeLocations(poolStopPoints(order)...))
+		if err != nil {
+			return nil, nil, err
+		}
+		// Leg i goes from stop i to stop i+1
+		if len(directions.Legs) != len(order)-1 {
+			continue
+		}
+		feasible := true
+		for _, ride := range ridesList {
+			solo, err := r.soloRoute(ride, soloRoutes)
+			if err != nil {
+				return nil, nil, err
+			}
+			_, pickup, _ := lo.FindIndexOf(order, func(item PoolStop) bool { return item.RideID == ride.ID && item.Type == PoolStopPickup })
+			_, dropoff, _ := lo.FindIndexOf(order, func(item PoolStop) bool { return item.RideID == ride.ID && item.Type == PoolStopDropoff })
+			duration := lo.SumBy(directions.Legs[pickup:dropoff], func(item DirectionsLeg) float64 { return item.Duration })
+			if duration-solo.Duration > r.config.Pooling.MaxDetour.Seconds() {
+				feasible = false
+				break
+			}
+		}
+		if feasible {
+			return order, directions, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// MatchPooledRides groups available pooled rides going the same way into pools
+func (r *RideService) MatchPooledRides(ctx context.Context) error {
+	candidates, err := r.rideRepo.GetUnpooledRequests(ctx)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	now := time.Now().UTC()
+	candidates = lo.Filter(candidates, func(item RideRequest, index int) bool { return !r.isExpired(item, now) })
+	sort.Slice(candidates, func(i, j int) bool { return poolPickupTime(candidates[i]).Before(poolPickupTime(candidates[j])) })
+
+	soloRoutes := make(map[int64]*Directions)
+	matched := make(map[int64]bool)
+	for i, seed := range candidates {
+		if matched[seed.ID] {
+			continue
+		}
+		group := []RideRequest{seed}
+		var stops []PoolStop
+		var directions *Directions
+		for _, candidate := range candidates[i+1:] {
+			if matched[candidate.ID] || !r.poolCompatible(group, candidate) {
+				continue
+			}
+			candidateStops, candidateDirections, err := r.planPool(append(group, candidate), soloRoutes)
+			if err != nil {
+				return core.Errorw(core.EINTERNAL, err)
+			}
+			if candidateStops == nil {
+				continue
+			}
+			group = append(group, candidate)
+			stops, directions = candidateStops, candidateDirections
+		}
+		if len(group) < 2 {
+			continue
+		}
+		err = r.createPool(ctx, group, stops, directions, soloRoutes)
+		if err != nil {
+			return err
+		}
+		for _, ride := range group {
+			matched[ride.ID] = true
+		}
+	}
+	return nil
+}
+
+// createPool stores the pool, splits the fare between the riders and notifies them
+func (r *RideService) createPool(ctx context.Context, group []RideRequest, stops []PoolStop, directions *Directions, soloRoutes map[int64]*Directions) error {
+	pool := &RidePool{
+		Stops:     stops,
+		Distance:  directions.Distance,
+		Duration:  directions.Duration,
+		CreatedAt: time.Now().UTC(),
+	}
+	err := r.rideRepo.CreatePool(ctx, pool)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	soloPrices := lo.Map(group, func(item RideRequest, index int) int {
+		return r.paymentsService.CalculatePrice(item.VehicleClass, item.Currency, int(math.Ceil(soloRoutes[item.ID].Distance)))
+	})
+	total := r.paymentsService.CalculatePrice(group[0].VehicleClass, group[0].Currency, int(math.Ceil(directions.Distance)))
+	prices := r.paymentsService.SplitPooledFare(total, soloPrices)
+	for i, ride := range group {
+		err = r.rideRepo.AssignPool(ctx, ride.ID, pool.ID, directions, prices[i])
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		event := RidePooledEvent{
+			RideID:  ride.ID,
+			RiderID: ride.RiderID,
+			PoolID:  pool.ID,
+			Price:   prices[i],
+		}
+		eventBytes, err := json.Marshal(event)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		r.pubsub.Publish(ctx, TopicRidePooled, eventBytes)
+	}
+	return nil
+}
+
+// ridePrice calculates the price of the ride over the directions. Pooled rides that have not been matched pay the pooled price they were quoted
+func (r *RideService) ridePrice(ride RideRequest, directions *Directions) int {
+	price := r.priceForDirections(ride.VehicleClass, geo.Point{Lat: ride.FromLat, Lng: ride.FromLng}, directions)
+	if ride.Pooled && ride.PoolID == nil {
+		return r.paymentsService.MaxPooledPrice(price)
+	}
+	return price
+}
+
+// remainingPoolStops returns the stops the driver still has to visit for the rides still in the pool
+func remainingPoolStops(stops []PoolStop, ridesList []RideRequest) []PoolStop {
+	ridesByID := lo.KeyBy(ridesList, func(item RideRequest) int64 { return item.ID })
+	return lo.Filter(stops, func(item PoolStop, index int) bool {
+		ride, ok := ridesByID[item.RideID]
+		if !ok {
+			return false
+		}
+		switch ride.State {
+		case RiderRequestStateAvailable, RiderRequestStateAccepted, RiderRequestStateDriverArrived:
+			return true
+		case RiderRequestStateInProgress:
+			return item.Type == PoolStopDropoff
+		}
+		return false
+	})
+}
+
+// reroutePool routes the pool over the stops still to be visited, from the drivers position once the pool is claimed,
+// and updates the directions of its rides. Stops of rides that left the pool are dropped. The riders keep their prices
+func (r *RideService) reroutePool(ctx context.Context, poolID int64) error {
+	pool, err := r.rideRepo.GetPool(ctx, poolID)
+	if err != nil {
+		return err
+	}
+	ridesList, err := r.rideRepo.GetByPoolID(ctx, poolID)
+	if err != nil {
+		return err
+	}
+	pool.Stops = remainingPoolStops(pool.Stops, ridesList)
+	if len(pool.Stops) == 0 {
+		return nil
+	}
+	points := poolStopPoints(pool.Stops)
+	if claimed, ok := lo.Find(ridesList, func(item RideRequest) bool { return item.DriverID != nil }); ok {
+		position, err := r.getDriverPosition(ctx, *claimed.DriverID)
+		if err != nil {
+			return err
+		}
+		if position != nil {
+			points = append([]geo.Point{{Lat: position.Lat, Lng: position.Lng}}, points...)
+		}
+	}
+	if len(points) < 2 {
+		return nil
+	}
+	directions, err := r.routeServiceClient.GetDirections(routeLocations(points...))
+	if err != nil {
+		return err
+	}
+	pool.Distance, pool.Duration = directions.Distance, directions.Duration
+	err = r.rideRepo.UpdatePool(ctx, pool)
+	if err != nil {
+		return err
+	}
+	for _, ride := range ridesList {
+		if !lo.ContainsBy(pool.Stops, func(item PoolStop) bool { return item.RideID == ride.ID }) {
+			continue
+		}
+		err = r.rideRepo.UpdateRideDirections(ctx, ride.ID, directions, ride.Price)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// claimablePoolRides returns the rides of the pool that can still be claimed
+func (r *RideService) claimablePoolRides(ctx context.Context, poolID int64) ([]RideRequest, error) {
+	ridesList, err := r.rideRepo.GetByPoolID(ctx, poolID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	return lo.Filter(ridesList, func(item RideRequest, index int) bool {
+		return item.State == RiderRequestStateAvailable && !r.isExpired(item, now)
+	}), nil
+}
@@ -0,0 +1,57 @@
+package rides
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRemainingPoolStops(t *testing.T) {
+	stops := []PoolStop{
+		{RideID: 1, Type: PoolStopPickup},
+		{RideID: 2, Type: PoolStopPickup},
+		{RideID: 1, Type: PoolStopDropoff},
+		{RideID: 2, Type: PoolStopDropoff},
+	}
+	tests := []struct {
+		name   string
+		states map[int64]RideRequestState
+		want   []PoolStop
+	}{
+		{
+			name:   "not picked up",
+			states: map[int64]RideRequestState{1: RiderRequestStateAccepted, 2: RiderRequestStateDriverArrived},
+			want:   stops,
+		},
+		{
+			name:   "on board",
+			states: map[int64]RideRequestState{1: RiderRequestStateInProgress, 2: RiderRequestStateAccepted},
+			want:   []PoolStop{stops[1], stops[2], stops[3]},
+		},
+		{
+			name:   "cancelled rider",
+			states: map[int64]RideRequestState{1: RiderRequestStateInProgress, 2: RiderRequestStateCancelled},
+			want:   []PoolStop{stops[2]},
+		},
+		{
+			name:   "finished riders",
+			states: map[int64]RideRequestState{1: RiderRequestStateFinished, 2: RiderRequestStateFinished},
+			want:   []PoolStop{},
+		},
+		{
+			name:   "ride no longer in pool",
+			states: map[int64]RideRequestState{1: RiderRequestStateAccepted},
+			want:   []PoolStop{stops[0], stops[2]},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ridesList := make([]RideRequest, 0, len(tt.states))
+			for id, state := range tt.states {
+				ridesList = append(ridesList, RideRequest{ID: id, State: state})
+			}
+			if got := remainingPoolStops(stops, ridesList); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("remainingPoolStops() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package rides
+
+import (
+	"context"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/promotions"
+	"github.com/samber/lo"
+)
+
+const (
+	// Discount of a promo code, the amount is negative
+	LineItemPromotion = "promotion"
+)
+
+// applicablePromotions returns the promotions of the promo codes in the input, and an error if any of them cannot be applied
+func (r *RideService) applicablePromotions(ctx context.Context, riderID int64, input *CreateRideInput, currency string) ([]promotions.Promotion, error) {
+	if len(input.PromoCodes) == 0 {
+		return []promotions.Promotion{}, nil
+	}
+	userRides, err := r.rideRepo.GetByUserID(ctx, riderID)
+	if err != nil {
+		return nil, core.Errorw(core.EINTERNAL, err)
+	}
+	city, _ := geo.CityAt(geo.Point{Lat: input.FromLat, Lng: input.FromLng})
+	rideContext := promotions.RideContext{
+		UserID:   riderID,
+		CityID:   city.ID,
+		Currency: currency,
+		FirstRide: !lo.SomeBy(userRides, func(item RideRequest) bool {
+			return item.RiderID == riderID && item.State == RiderRequestStateFinished
+		}),
+		Now: time.Now().UTC(),
+	}
+	return r.promotionService.GetApplicable(ctx, input.PromoCodes, rideContext)
+}
+
+// redeemPromotions adds the discounts of the promo codes of a finished ride as line items, funded by marketing.
+// A code is only marked redeemed once its line item and ledger entry exist, so a ride finished again picks up where it failed.
+// Returns the total discount
+func (r *RideService) redeemPromotions(ctx context.Context, ride RideRequest) (int, error) {
+	redemptions, err := r.promotionService.RideDiscounts(ctx, ride.ID, ride.Price)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, redemption := range redemptions {
+		total += redemption.Discount
+		if redemption.State != promotions.RedemptionStateReserved {
+			continue
+		}
+		if redemption.Discount > 0 {
+			lineItem := RideLineItem{
+				RideID:      ride.ID,
+				Type:        LineItemPromotion,
+				Amount:      -redemption.Discount,
+				Currency:    ride.Currency,
+				Description: redemption.Code,
+				CreatedBy:   ride.RiderID,
+				CreatedAt:   time.Now().UTC(),
+			}
+			_, err = r.rideRepo.CreateLineItem(ctx, &lineItem)
+			if err != nil {
+				return 0, core.Errorw(core.EINTERNAL, err)
+			}
+			err = r.paymentsService.RecordDiscount(ctx, redemption.ID, ride.ID, ride.RiderID, redemption.Discount, ride.Currency)
+			if err != nil {
+				return 0, core.Errorw(core.EINTERNAL, err)
+			}
+		}
+		err = r.promotionService.Redeem(ctx, redemption)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,103 @@
+package rides
+
+import (
+	"context"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/promotions"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+	"github.com/samber/lo"
+)
+
+// Currency of rides, matches the column default of ride_requests.currency
+// Currency of rides outside the cities
+const defaultCurrency = "EUR"
+
+// currencyAt returns the currency of rides picked up at the point
+func currencyAt(pickup geo.Point) string {
+	if city, ok := geo.CityAt(pickup); ok {
+		return city.Currency
+	}
+	return defaultCurrency
+}
+
+type RideQuote struct {
+	Price    int    `json:"price"`
+	Currency string `json:"currency"`
+	// Distance in meters
+	Distance float64 `json:"distance"`
+	// Duration in seconds
+	Duration float64 `json:"duration"`
+	// Most the rider pays if the ride is pooled, set for pooled quotes
+	PooledPrice *int `json:"pooledPrice,omitempty"`
+	// Discount of the promo codes on the price
+	Discount   int                           `json:"discount"`
+	Promotions []promotions.AppliedPromotion `json:"promotions,omitempty"`
+
+	directions *Directions
+}
+
+// chargedPrice is the price the rider is charged, the pooled price for pooled rides
+func (q RideQuote) chargedPrice() int {
+	if q.PooledPrice != nil {
+		return *q.PooledPrice
+	}
+	return q.Price
+}
+
+// QuoteRide calculates the price of a ride from the pickup via the stops to the drop-off location,
+// and the discount of the promo codes the rider applies
+func (r *RideService) QuoteRide(ctx context.Context, userID string, input *CreateRideInput) (RideQuote, error) {
+	if err := input.Validate(); err != nil {
+		return RideQuote{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	user, err := r.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return RideQuote{}, core.Errorw(core.EINTERNAL, err)
+	}
+	quote, err := r.quoteRide(input)
+	if err != nil {
+		return RideQuote{}, err
+	}
+	promotionList, err := r.applicablePromotions(ctx, user.ID, input, quote.Currency)
+	if err != nil {
+		return RideQuote{}, err
+	}
+	if len(promotionList) > 0 {
+		quote.Promotions = r.promotionService.Discounts(promotionList, quote.Price)
+		quote.Discount = lo.SumBy(quote.Promotions, func(item promotions.AppliedPromotion) int { return item.Discount })
+	}
+	return quote, nil
+}
+
+func (r *RideService) quoteRide(input *CreateRideInput) (RideQuote, error) {
+	if err := r.validateStopCount(len(input.Stops)); err != nil {
+		return RideQuote{}, err
+	}
+	if err := r.validateVehicleClass(input); err != nil {
+		return RideQuote{}, err
+	}
+	if err := r.validatePooling(input); err != nil {
+		return RideQuote{}, err
+	}
+	pickup := geo.Point{Lat: input.FromLat, Lng: input.FromLng}
+	stops := newRideStops(0, 0, input.Stops)
+	locations := routeLocations(ridePoints(nil, pickup, stops, geo.Point{Lat: input.ToLat, Lng: input.ToLng})...)
+	directions, err := r.routeServiceClient.GetDirections(locations)
+	if err != nil {
+		return RideQuote{}, core.Errorw(core.EINTERNAL, err)
+	}
+	quote := RideQuote{
+		Price:      r.priceForDirections(vehicles.ClassOrDefault(input.VehicleClass), pickup, directions),
+		Currency:   currencyAt(pickup),
+		Distance:   directions.Distance,
+		Duration:   directions.Duration,
+		directions: directions,
+	}
+	if input.Pooled {
+		pooledPrice := r.paymentsService.MaxPooledPrice(quote.Price)
+		quote.PooledPrice = &pooledPrice
+	}
+	return quote, nil
+}
@@ -0,0 +1,212 @@
+package rides
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+	"github.com/samber/lo"
+)
+
+const (
+	TopicRideReceiptIssued = "ride-receipt-issued"
+)
+
+// ReceiptVAT is the VAT included in the amounts of a receipt taxed in a jurisdiction
+type ReceiptVAT struct {
+	Jurisdiction string  `json:"jurisdiction"`
+	Rate         float64 `json:"rate"`
+	// Taxed amount excluding VAT
+	Net int `json:"net"`
+	VAT int `json:"vat"`
+}
+
+// RideReceipt is the summary of what the rider paid for a finished ride
+type RideReceipt struct {
+	InvoiceNumber string    `json:"invoiceNumber"`
+	IssuedAt      time.Time `json:"issuedAt"`
+	RideID        int64     `json:"rideId"`
+	RiderID       int64     `json:"riderId"`
+	RiderName     string    `json:"riderName"`
+	// Set if the rider is a business rider
+	Billing             *payments.BillingProfile `json:"billing"`
+	DriverID            *int64                   `json:"driverId"`
+	DriverName          string                   `json:"driverName"`
+	VehicleRegistration string                   `json:"vehicleRegistration"`
+	FromName            string                   `json:"fromName"`
+	ToName              string                   `json:"toName"`
+	VehicleClass        vehicles.VehicleClass    `json:"vehicleClass"`
+	Currency            string                   `json:"currency"`
+	Fare                int                      `json:"fare"`
+	// What the fare is made of, sums to Fare
+	FareComponents []payments.FareComponent `json:"fareComponents"`
+	LineItems      []RideLineItem           `json:"lineItems"`
+	Total          int                      `json:"total"`
+	// Refunded to the rider after the ride
+	Refunded int          `json:"refunded"`
+	VAT      []ReceiptVAT `json:"vat"`
+	// Route of the ride as an encoded polyline, the driven route if it was recorded and otherwise the planned route
+	Route      string     `json:"route"`
+	FinishedAt *time.Time `json:"finishedAt"`
+}
+
+type RideReceiptIssuedEvent struct {
+	RiderID int64       `json:"riderId"`
+	Receipt RideReceipt `json:"receipt"`
+}
+
+// fareComponents splits the fare into the components of the rate card.
+// Shared rides and fares that changed with the route are shown with the difference as its own component
+func (r *RideService) fareComponents(ride RideRequest) []payments.FareComponent {
+	if ride.Pooled || ride.Directions == nil {
+		return []payments.FareComponent{{Name: "Fare", Amount: ride.Price}}
+	}
+	components := r.paymentsService.FareComponents(ride.VehicleClass, ride.Currency, int(math.Ceil(ride.Directions.Distance)))
+	if difference := ride.Price - lo.SumBy(components, func(item payments.FareComponent) int { return item.Amount }); difference != 0 {
+		components = append(components, payments.FareComponent{Name: "Route adjustment", Amount: difference})
+	}
+	return components
+}
+
+// receiptVAT returns the VAT included in what the rider paid, taxed where the ride started.
+// Tips are not taxed, and refunds are taken to reduce the taxed amount
+func receiptVAT(ride RideRequest, lineItems []RideLineItem, refunded int) []ReceiptVAT {
+	city, ok := geo.CityAt(geo.Point{Lat: ride.FromLat, Lng: ride.FromLng})
+	if !ok {
+		return []ReceiptVAT{}
+	}
+	rate := payments.GetVATRate(city.Country)
+	gross := ride.Price - refunded + lo.SumBy(lineItems, func(item RideLineItem) int {
+		if item.Type == LineItemTip {
+			return 0
+		}
+		return item.Amount
+	})
+	vat := payments.VATIncluded(gross, rate.Rate)
+	return []ReceiptVAT{{Jurisdiction: rate.Jurisdiction, Rate: rate.Rate, Net: gross - vat, VAT: vat}}
+}
+
+// receiptRoute returns the encoded polyline of the route of the ride
+func receiptRoute(ride RideRequest, breadcrumbs []RideBreadcrumb) string {
+	if len(breadcrumbs) > 1 {
+		return geo.EncodePolyline(lo.Map(breadcrumbs, func(item RideBreadcrumb, index int) []float64 { return []float64{item.Lat, item.Lng} }))
+	}
+	if ride.Directions != nil {
+		return geo.EncodePolyline(ride.Directions.Coordinates)
+	}
+	return geo.EncodePolyline([][]float64{{ride.FromLat, ride.FromLng}, {ride.ToLat, ride.ToLng}})
+}
+
+// buildRideReceipt returns the receipt of a finished ride, numbering it the first time
+func (r *RideService) buildRideReceipt(ctx context.Context, ride RideRequest) (RideReceipt, error) {
+	invoice, err := r.paymentsService.IssueRideInvoice(ctx, ride.ID, ride.RiderID)
+	if err != nil {
+		return RideReceipt{}, err
+	}
+	rider, err := r.userRepo.GetByID(ctx, ride.RiderID)
+	if err != nil {
+		return RideReceipt{}, err
+	}
+	billing, err := r.paymentsService.GetBillingProfile(ctx, ride.RiderID)
+	if err != nil {
+		return RideReceipt{}, err
+	}
+	lineItems, err := r.rideRepo.GetLineItems(ctx, []int64{ride.ID})
+	if err != nil {
+		return RideReceipt{}, err
+	}
+	refunds, err := r.rideRepo.GetRefunds(ctx, ride.ID)
+	if err != nil {
+		return RideReceipt{}, err
+	}
+	breadcrumbs, err := r.rideRepo.GetBreadcrumbs(ctx, ride.ID)
+	if err != nil {
+		return RideReceipt{}, err
+	}
+	refunded := lo.SumBy(refunds, func(item RideRefund) int { return item.Amount })
+	receipt := RideReceipt{
+		InvoiceNumber:  invoice.InvoiceNumber(),
+		IssuedAt:       invoice.CreatedAt,
+		RideID:         ride.ID,
+		RiderID:        ride.RiderID,
+		RiderName:      rider.Name,
+		Billing:        billing,
+		DriverID:       ride.DriverID,
+		FromName:       ride.FromName,
+		ToName:         ride.ToName,
+		VehicleClass:   ride.VehicleClass,
+		Currency:       ride.Currency,
+		Fare:           ride.Price,
+		FareComponents: r.fareComponents(ride),
+		LineItems:      lineItems,
+		Total:          ride.Price + lo.SumBy(lineItems, func(item RideLineItem) int { return item.Amount }),
+		Refunded:       refunded,
+		VAT:            receiptVAT(ride, lineItems, refunded),
+		Route:          receiptRoute(ride, breadcrumbs),
+		FinishedAt:     ride.FinishedAt,
+	}
+	if ride.DriverID != nil {
+		driver, err := r.userRepo.GetByID(ctx, *ride.DriverID)
+		if err != nil {
+			return RideReceipt{}, err
+		}
+		receipt.DriverName = driver.Name
+	}
+	if ride.VehicleID != nil {
+		vehicle, err := r.vehicleRepo.GetByID(ctx, *ride.VehicleID)
+		if err != nil {
+			return RideReceipt{}, err
+		}
+		receipt.VehicleRegistration = fmt.Sprintf("%v %v", vehicle.RegistrationCountry, vehicle.RegistrationNumber)
+	}
+	return receipt, nil
+}
+
+// GetRideReceipt returns the receipt of a finished ride to its rider
+func (r *RideService) GetRideReceipt(ctx context.Context, userID string, rideRequestId int64) (RideReceipt, error) {
+	user, err := r.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return RideReceipt{}, core.Errorw(core.EINTERNAL, err)
+	}
+	rideReq, err := r.rideRepo.GetByID(ctx, rideRequestId)
+	if err != nil {
+		return RideReceipt{}, core.WrapErr(err)
+	}
+	if rideReq.RiderID != user.ID {
+		return RideReceipt{}, core.Errorf(core.EUNAUTHORIZED, "cannot view receipt of ride you are not the rider of")
+	}
+	if rideReq.State != RiderRequestStateFinished {
+		return RideReceipt{}, core.Errorf(core.EINVALID, "only finished rides have receipts")
+	}
+	receipt, err := r.buildRideReceipt(ctx, rideReq)
+	if err != nil {
+		return RideReceipt{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return receipt, nil
+}
+
+// HandleRideFinished issues the receipt of a finished ride, so the rider can be sent it.
+// Tips given later are on the receipt when it is downloaded again
+func (r *RideService) HandleRideFinished(ctx context.Context, event RideFinishedEvent) error {
+	rideReq, err := r.rideRepo.GetByID(ctx, event.RideID)
+	if err != nil {
+		return core.WrapErr(err)
+	}
+	receipt, err := r.buildRideReceipt(ctx, rideReq)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	issuedEvent := RideReceiptIssuedEvent{RiderID: rideReq.RiderID, Receipt: receipt}
+	eventBytes, err := json.Marshal(issuedEvent)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	r.pubsub.Publish(ctx, TopicRideReceiptIssued, eventBytes)
+	return nil
+}
@@ -0,0 +1,206 @@
+package rides
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/samber/lo"
+)
+
+const (
+	TopicRideRefunded = "ride-refunded"
+)
+
+type RefundType string
+
+const (
+	// Money returned to the rider by the platform, such as for a service issue
+	RefundTypeRefund RefundType = "refund"
+	// Correction of a wrong fare, taken back from the driver's earnings
+	RefundTypeAdjustment RefundType = "adjustment"
+)
+
+const (
+	RefundReasonFareTooHigh     = "fare_too_high"
+	RefundReasonWrongRoute      = "wrong_route"
+	RefundReasonDriverBehaviour = "driver_behaviour"
+	RefundReasonServiceIssue    = "service_issue"
+	RefundReasonDuplicateCharge = "duplicate_charge"
+	RefundReasonGoodwill        = "goodwill"
+	RefundReasonDispute         = "dispute"
+)
+
+var refundReasons = []string{
+	RefundReasonFareTooHigh,
+	RefundReasonWrongRoute,
+	RefundReasonDriverBehaviour,
+	RefundReasonServiceIssue,
+	RefundReasonDuplicateCharge,
+	RefundReasonGoodwill,
+	RefundReasonDispute,
+}
+
+// RideRefund is money returned to the rider of a finished ride. Refunds are never changed, so they are the audit trail of fare corrections
+type RideRefund struct {
+	ID       int64      `json:"id"`
+	RideID   int64      `json:"rideId"`
+	Type     RefundType `json:"type"`
+	Amount   int        `json:"amount"`
+	Currency string     `json:"currency"`
+	Reason   string     `json:"reason"`
+	Note     string     `json:"note"`
+	// The support agent or admin that issued the refund, and their role at the time
+	IssuedBy   int64     `json:"issuedBy"`
+	IssuerRole string    `json:"issuerRole"`
+	DisputeID  *int64    `json:"disputeId"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type IssueRefundInput struct {
+	Type RefundType `json:"type"`
+	// Refund everything that has not been refunded yet, instead of Amount
+	Full   bool   `json:"full"`
+	Amount int    `json:"amount"`
+	Reason string `json:"reason"`
+	Note   string `json:"note"`
+}
+
+func (i *IssueRefundInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.Type, validation.Required, validation.In(RefundTypeRefund, RefundTypeAdjustment)),
+		validation.Field(&i.Amount, validation.Min(0)),
+		validation.Field(&i.Reason, validation.Required, validation.In(lo.ToAnySlice(refundReasons)...)),
+	)
+}
+
+type RideRefundedEvent struct {
+	RiderID int64      `json:"riderId"`
+	Refund  RideRefund `json:"refund"`
+	// Amount returned to the rider's card, the rest is credited to the rider's wallet
+	CardAmount int `json:"cardAmount"`
+}
+
+// refundable returns how much of the ride can still be refunded with a refund of the type.
+// Fare adjustments cannot take back more than the fare, refunds can also refund the tip
+func refundable(ride RideRequest, lineItems []RideLineItem, refunds []RideRefund, refundType RefundType) int {
+	total := ride.Price + lo.SumBy(lineItems, func(item RideLineItem) int { return item.Amount })
+	remaining := total - lo.SumBy(refunds, func(item RideRefund) int { return item.Amount })
+	if refundType == RefundTypeAdjustment {
+		adjusted := lo.SumBy(refunds, func(item RideRefund) int {
+			return lo.Ternary(item.Type == RefundTypeAdjustment, item.Amount, 0)
+		})
+		remaining = min(remaining, ride.Price-adjusted)
+	}
+	return max(0, remaining)
+}
+
+// IssueRefund refunds part or all of a finished ride. Support agents and admins can refund up to the limit of their role on each ride
+func (r *RideService) IssueRefund(ctx context.Context, userID string, rideRequestId int64, input *IssueRefundInput) (RideRefund, error) {
+	return r.issueRefund(ctx, userID, rideRequestId, nil, input)
+}
+
+func (r *RideService) issueRefund(ctx context.Context, userID string, rideRequestId int64, disputeID *int64, input *IssueRefundInput) (RideRefund, error) {
+	if err := input.Validate(); err != nil {
+		return RideRefund{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	user, err := r.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return RideRefund{}, core.Errorw(core.EINTERNAL, err)
+	}
+	limit, ok := r.paymentsService.RefundLimit(user.Role)
+	if !ok {
+		return RideRefund{}, core.Errorf(core.EUNAUTHORIZED, "role %v cannot issue refunds", user.Role)
+	}
+	rideReq, err := r.rideRepo.GetByID(ctx, rideRequestId)
+	if err != nil {
+		return RideRefund{}, core.WrapErr(err)
+	}
+	if rideReq.State != RiderRequestStateFinished || rideReq.DriverID == nil {
+		return RideRefund{}, core.Errorf(core.EINVALID, "only finished rides can be refunded")
+	}
+	limit, err = r.paymentsService.LocalAmount(ctx, limit, rideReq.Currency)
+	if err != nil {
+		return RideRefund{}, err
+	}
+	lineItems, err := r.rideRepo.GetLineItems(ctx, []int64{rideReq.ID})
+	if err != nil {
+		return RideRefund{}, core.Errorw(core.EINTERNAL, err)
+	}
+	refunds, err := r.rideRepo.GetRefunds(ctx, rideReq.ID)
+	if err != nil {
+		return RideRefund{}, core.Errorw(core.EINTERNAL, err)
+	}
+
+	remaining := refundable(rideReq, lineItems, refunds, input.Type)
+	amount := lo.Ternary(input.Full, remaining, input.Amount)
+	if amount <= 0 {
+		return RideRefund{}, core.Errorf(core.EINVALID, "nothing left to refund")
+	}
+	if amount > remaining {
+		return RideRefund{}, core.Errorf(core.EINVALID, "at most %v can be refunded", remaining)
+	}
+	refunded := lo.SumBy(refunds, func(item RideRefund) int { return item.Amount })
+	if refunded+amount > limit {
+		return RideRefund{}, core.Errorf(core.EUNAUTHORIZED, "refunds on a ride cannot exceed %v for role %v", limit, user.Role)
+	}
+
+	refund := RideRefund{
+		RideID:     rideReq.ID,
+		Type:       input.Type,
+		Amount:     amount,
+		Currency:   rideReq.Currency,
+		Reason:     input.Reason,
+		Note:       input.Note,
+		IssuedBy:   user.ID,
+		IssuerRole: user.Role,
+		DisputeID:  disputeID,
+		CreatedAt:  time.Now().UTC(),
+	}
+	created, err := r.rideRepo.CreateRefund(ctx, &refund, refunded)
+	if err != nil {
+		return RideRefund{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if !created {
+		return RideRefund{}, core.Errorf(core.ECONFLICT, "ride was refunded at the same time, try again")
+	}
+	entryType, payer := payments.EntryRefund, payments.PlatformRevenueAccount
+	if refund.Type == RefundTypeAdjustment {
+		entryType, payer = payments.EntryAdjustment, payments.DriverAccount(*rideReq.DriverID)
+	}
+	err = r.paymentsService.RecordRefund(ctx, entryType, refund.ID, rideReq.ID, payer, billedAccount(rideReq), refund.Amount, refund.Currency)
+	if err != nil {
+		return RideRefund{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if refund.Type == RefundTypeAdjustment {
+		err = r.paymentsService.RecordCommissionRefund(ctx, refund.ID, rideReq.ID, *rideReq.DriverID,
+			payments.Commission(refund.Amount, rideReq.CommissionRate), refund.Currency)
+		if err != nil {
+			return RideRefund{}, core.Errorw(core.EINTERNAL, err)
+		}
+	}
+	cardAmount, err := r.paymentsService.RefundRide(ctx, rideReq.ID, refund.ID, refund.Amount)
+	if err != nil {
+		return RideRefund{}, core.WrapErr(err)
+	}
+
+	event := RideRefundedEvent{RiderID: rideReq.RiderID, Refund: refund, CardAmount: cardAmount}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return RideRefund{}, core.Errorw(core.EINTERNAL, err)
+	}
+	r.pubsub.Publish(ctx, TopicRideRefunded, eventBytes)
+	return refund, nil
+}
+
+// GetRefunds returns the refunds of the ride, oldest first
+func (r *RideService) GetRefunds(ctx context.Context, rideRequestId int64) ([]RideRefund, error) {
+	refunds, err := r.rideRepo.GetRefunds(ctx, rideRequestId)
+	if err != nil {
+		return []RideRefund{}, core.Errorw(core.EINTERNAL, err)
+	}
+	return refunds, nil
+}
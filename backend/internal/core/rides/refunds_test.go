@@ -0,0 +1,33 @@
+package rides
+
+import "testing"
+
+func TestRefundable(t *testing.T) {
+	ride := RideRequest{ID: 1, Price: 10000}
+	tip := RideLineItem{RideID: 1, Type: LineItemTip, Amount: 2000}
+	promotion := RideLineItem{RideID: 1, Type: LineItemPromotion, Amount: -1000}
+	tests := []struct {
+		name       string
+		lineItems  []RideLineItem
+		refunds    []RideRefund
+		refundType RefundType
+		want       int
+	}{
+		{"fare", nil, nil, RefundTypeRefund, 10000},
+		{"fare and tip", []RideLineItem{tip}, nil, RefundTypeRefund, 12000},
+		{"after discount", []RideLineItem{promotion}, nil, RefundTypeRefund, 9000},
+		{"after refunds", []RideLineItem{tip}, []RideRefund{{Type: RefundTypeRefund, Amount: 5000}}, RefundTypeRefund, 7000},
+		{"adjustment excludes the tip", []RideLineItem{tip}, nil, RefundTypeAdjustment, 10000},
+		{"adjustment after adjustments", []RideLineItem{tip}, []RideRefund{{Type: RefundTypeAdjustment, Amount: 4000}}, RefundTypeAdjustment, 6000},
+		{"adjustment after refunds of the tip", []RideLineItem{tip}, []RideRefund{{Type: RefundTypeRefund, Amount: 11000}}, RefundTypeAdjustment, 1000},
+		{"fully refunded", nil, []RideRefund{{Type: RefundTypeRefund, Amount: 10000}}, RefundTypeRefund, 0},
+		{"never negative", nil, []RideRefund{{Type: RefundTypeRefund, Amount: 12000}}, RefundTypeRefund, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refundable(ride, tt.lineItems, tt.refunds, tt.refundType); got != tt.want {
+				t.Errorf("refundable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,9 +4,15 @@ import (
 	"context"
 	"time"
 
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
 	validation "github.com/go-ozzo/ozzo-validation"
 )
 
+const (
+	TopicRideFinished = "ride-finished"
+)
+
 type RideRequestState int
 
 const (
@@ -14,52 +20,20 @@ const (
 	RiderRequestStateAccepted
 	RiderRequestStateInProgress
 	RiderRequestStateFinished
+	RiderRequestStateDriverArrived
+	RiderRequestStateCancelled
+	RiderRequestStateExpired
+	RiderRequestStateScheduled
 )
 
-type ORSDirections struct {
-	Bbox   []float64 `json:"bbox"`
-	Routes []struct {
-		Summary struct {
-			Distance float64 `json:"distance"`
-			Duration float64 `json:"duration"`
-		} `json:"summary"`
-		Segments []struct {
-			Distance float64 `json:"distance"`
-			Duration float64 `json:"duration"`
-			Steps    []struct {
-				Distance    float64 `json:"distance"`
-				Duration    float64 `json:"duration"`
-				Type        int     `json:"type"`
-				Instruction string  `json:"instruction"`
-				Name        string  `json:"name"`
-				WayPoints   []int   `json:"way_points"`
-				Maneuver    struct {
-					Location      []float64 `json:"location"`
-					BearingBefore int       `json:"bearing_before"`
-					BearingAfter  int       `json:"bearing_after"`
-				} `json:"maneuver"`
-			} `json:"steps"`
-		} `json:"segments"`
-		Bbox      []float64 `json:"bbox"`
-		Geometry  string    `json:"geometry"`
-		WayPoints []int     `json:"way_points"`
-		Legs      []any     `json:"legs"`
-	} `json:"routes"`
-	Metadata struct {
-		Attribution string `json:"attribution"`
-		Service     string `json:"service"`
-		Timestamp   int64  `json:"timestamp"`
-		Query       struct {
-			Coordinates [][]float64 `json:"coordinates"`
-			Profile     string      `json:"profile"`
-			Format      string      `json:"format"`
-		} `json:"query"`
-		Engine struct {
-			Version   string    `json:"version"`
-			BuildDate time.Time `json:"build_date"`
-			GraphDate time.Time `json:"graph_date"`
-		} `json:"engine"`
-	} `json:"metadata"`
+// RideFinishedEvent is published when a ride changes to the finished state
+type RideFinishedEvent struct {
+	RideID     int64     `json:"rideId"`
+	RiderID    int64     `json:"riderId"`
+	DriverID   int64     `json:"driverId"`
+	Price      int       `json:"price"`
+	Currency   string    `json:"currency"`
+	FinishedAt time.Time `json:"finishedAt"`
 }
 
 type RideRequest struct {
@@ -67,6 +41,8 @@ type RideRequest struct {
 
 	RiderID  int64  `json:"riderId"`
 	DriverID *int64 `json:"driverId"`
+	// The vehicle the driver claimed the ride with
+	VehicleID *int64 `json:"vehicleId"`
 
 	FromLat  float64 `json:"fromLat"`
 	FromLng  float64 `json:"fromLng"`
@@ -76,15 +52,50 @@ type RideRequest struct {
 	ToLng  float64 `json:"toLng"`
 	ToName string  `json:"toName"`
 
+	// Intermediate stops between the pickup and the drop-off, in route order
+	Stops []RideStop `json:"stops"`
+
 	State RideRequestState `json:"state"`
 
-	DirectionsJsonVersion *int           `json:"directionsVersion"`
-	DirectionsJson        *string        `json:"-"`
-	DirectionsV1          *ORSDirections `json:"directions"`
+	VehicleClass vehicles.VehicleClass `json:"vehicleClass"`
+
+	// Set if the rider wants to share the ride
+	Pooled bool `json:"pooled"`
+	Seats  int  `json:"seats"`
+	// Set when the ride has been matched with other pooled rides
+	PoolID *int64 `json:"poolId"`
+
+	// Set for rides booked for a later pickup
+	ScheduledPickupAt *time.Time `json:"scheduledPickupAt"`
+	// When the ride last became available to drivers, on creation, release of a scheduled ride or when a driver cancels it
+	AvailableSince *time.Time `json:"availableSince"`
+
+	// Set when the ride is accepted
+	AcceptedAt       *time.Time    `json:"acceptedAt"`
+	PickupGeofence   *geo.Geofence `json:"pickupGeofence"`
+	DriverArrivedAt  *time.Time    `json:"driverArrivedAt"`
+	FreeWaitingUntil *time.Time    `json:"freeWaitingUntil"`
+	// Set when the rider has been picked up
+	StartedAt *time.Time `json:"startedAt"`
+
+	DirectionsJsonVersion *int        `json:"-"`
+	DirectionsJson        *string     `json:"-"`
+	Directions            *Directions `json:"directions"`
 
 	Price    int    `json:"price"`
 	Currency string `json:"currency"`
 
+	// Only set for accepted and in progress rides
+	ETA *RideETA `json:"eta"`
+
+	FinishedAt *time.Time `json:"finishedAt"`
+	// Share of the fare the platform takes, set when the ride finishes
+	CommissionRate float64 `json:"-"`
+
+	// Set if the ride is billed to an organisation instead of the rider's payment method
+	OrganisationID *int64  `json:"organisationId"`
+	ExpenseCode    *string `json:"expenseCode"`
+
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
@@ -106,11 +117,81 @@ type RideRepository interface {
 	GetByUserID(context.Context, int64) ([]RideRequest, error)
 	GetByUserIDs(ctx context.Context, userIds []int64, states []RideRequestState) ([]RideRequest, error)
 	CreateRequest(context.Context, *RideRequest) error
-	UpdateRequestState(context.Context, int64, RideRequestState) error
-	ClaimRequest(ctx context.Context, requestID int64, driverID int64) error
-	UpdateRideDirections(ctx context.Context, requestId int64, directionsVersion int, directions *ORSDirections, price int) error
+	// UpdateRequestState moves the ride from one state to another. Returns false if the ride is no longer in the from state
+	UpdateRequestState(ctx context.Context, requestID int64, from RideRequestState, to RideRequestState) (bool, error)
+	// StartRequest starts an accepted ride. Returns false if the ride is not accepted or the driver has not arrived
+	StartRequest(ctx context.Context, requestID int64, startedAt time.Time) (bool, error)
+	// FinishRequest finishes an in progress ride. Returns false if the ride is not in progress
+	FinishRequest(ctx context.Context, requestID int64, finishedAt time.Time, commissionRate float64) (bool, error)
+	// ClaimRequests accepts the available requests for the driver in one transaction. Returns false, and claims none of them, if any is not available
+	ClaimRequests(ctx context.Context, requestIDs []int64, driverID int64, vehicleID int64, pickupGeofenceRadius float64) (bool, error)
+	// MarkDriverArrived moves an accepted ride to driver arrived. Returns false if the ride is not accepted
+	MarkDriverArrived(ctx context.Context, requestID int64, arrivedAt time.Time, freeWaitingUntil time.Time) (bool, error)
+	// MarkFreeWaitingEnded marks the rides still waiting for the rider whose free waiting time ended before endedBefore, and returns them
+	MarkFreeWaitingEnded(ctx context.Context, endedBefore time.Time) ([]RideRequest, error)
+	// ReleaseRequest makes an accepted ride available to other drivers. Returns false if the ride is not accepted or the driver has not arrived
+	ReleaseRequest(ctx context.Context, requestID int64) (bool, error)
+	// ExpireRequests expires requests that have been available since before availableBefore and returns them
+	ExpireRequests(ctx context.Context, availableBefore time.Time) ([]RideRequest, error)
+	// ReleaseScheduledRequests makes scheduled requests with pickup before pickupBefore available and returns them
+	ReleaseScheduledRequests(ctx context.Context, pickupBefore time.Time) ([]RideRequest, error)
+	// CancelUnclaimedScheduledRequests cancels available scheduled requests with pickup before pickupBefore and returns them
+	CancelUnclaimedScheduledRequests(ctx context.Context, pickupBefore time.Time) ([]RideRequest, error)
+	// MarkDueReminders marks the scheduled rides with pickup before pickupBefore that the party has not been reminded of, and returns them
+	MarkDueReminders(ctx context.Context, party string, pickupBefore time.Time) ([]RideRequest, error)
+	CreateCancellation(ctx context.Context, cancellation *RideCancellation) error
+	GetCancellationsByUserID(ctx context.Context, userID int64, party string, since time.Time) ([]RideCancellation, error)
+	// ReplacePendingStops deletes the pending stops of the ride and creates stops, in one transaction
+	ReplacePendingStops(ctx context.Context, requestID int64, stops []RideStop) error
+	CompleteStop(ctx context.Context, stopID int64, completedAt time.Time) error
+	// GetUnpooledRequests returns available pooled requests that have not been matched
+	GetUnpooledRequests(ctx context.Context) ([]RideRequest, error)
+	GetByPoolID(ctx context.Context, poolID int64) ([]RideRequest, error)
+	CreatePool(ctx context.Context, pool *RidePool) error
+	GetPool(ctx context.Context, poolID int64) (RidePool, error)
+	// UpdatePool updates the stops and the route of the pool
+	UpdatePool(ctx context.Context, pool RidePool) error
+	AssignPool(ctx context.Context, requestID int64, poolID int64, directions *Directions, price int) error
+	UpdateRideDirections(ctx context.Context, requestId int64, directions *Directions, price int) error
+	UpdatePrice(ctx context.Context, requestID int64, price int) error
+	// GetOutdatedDirections returns the stored directions older than the current version of the rides after afterID, by ride id
+	GetOutdatedDirections(ctx context.Context, afterID int64, limit int) ([]StoredDirections, error)
+	// GetFinishedByDriverID returns the rides of the driver finished from from until to, oldest first
+	GetFinishedByDriverID(ctx context.Context, driverID int64, from time.Time, to time.Time) ([]RideRequest, error)
+	// GetFinishedByRiderID returns the rides of the rider finished from from until to, oldest first
+	GetFinishedByRiderID(ctx context.Context, riderID int64, from time.Time, to time.Time) ([]RideRequest, error)
+	// GetByOrganisationID returns the rides billed to the organisation created from from until to, newest first
+	GetByOrganisationID(ctx context.Context, organisationID int64, from time.Time, to time.Time) ([]RideRequest, error)
+	// CreateLineItem creates the line item. Returns false if the ride already has a line item that can only be added once
+	CreateLineItem(ctx context.Context, lineItem *RideLineItem) (bool, error)
+	GetLineItems(ctx context.Context, rideIDs []int64) ([]RideLineItem, error)
+	// CreateRefund creates the refund if the refunds of the ride still sum to refundedBefore. Returns false if the ride was refunded since
+	CreateRefund(ctx context.Context, refund *RideRefund, refundedBefore int) (bool, error)
+	// GetRefunds returns the refunds of the ride, oldest first
+	GetRefunds(ctx context.Context, rideID int64) ([]RideRefund, error)
+	GetRefundsByRideIDs(ctx context.Context, rideIDs []int64) ([]RideRefund, error)
+	// CreateDispute creates the dispute. Returns false if the ride already has an open dispute
+	CreateDispute(ctx context.Context, dispute *FareDispute) (bool, error)
+	GetDispute(ctx context.Context, disputeID int64) (FareDispute, error)
+	GetDisputesByState(ctx context.Context, state DisputeState) ([]FareDispute, error)
+	// ResolveDispute stores the resolution of an open dispute. Returns false if the dispute is not open
+	ResolveDispute(ctx context.Context, dispute *FareDispute) (bool, error)
+	CreateExtra(ctx context.Context, extra *RideExtra) error
+	GetExtra(ctx context.Context, extraID int64) (RideExtra, error)
+	// GetExtrasByRideID returns the extras of the ride, oldest first
+	GetExtrasByRideID(ctx context.Context, rideID int64) ([]RideExtra, error)
+	GetExtrasByState(ctx context.Context, state ExtraState) ([]RideExtra, error)
+	// ReviewExtra stores the review of a pending extra and creates the line item, if any, in one go.
+	// Returns false if the extra is not pending
+	ReviewExtra(ctx context.Context, extra *RideExtra, lineItem *RideLineItem) (bool, error)
+	AddBreadcrumb(ctx context.Context, rideID int64, breadcrumb RideBreadcrumb) error
+	// GetBreadcrumbs returns the breadcrumbs of the ride, oldest first
+	GetBreadcrumbs(ctx context.Context, rideID int64) ([]RideBreadcrumb, error)
+	CreateAlert(ctx context.Context, alert RideAlert) error
+	// GetRecentAlerts returns the latest alerts, newest first
+	GetRecentAlerts(ctx context.Context, limit int) ([]RideAlert, error)
 }
 
 type RouteServiceClient interface {
-	GetDirections(locations [][]float64) (*ORSDirections, error)
+	GetDirections(locations [][]float64) (*Directions, error)
 }
@@ -0,0 +1,71 @@
+package rides
+
+import (
+	"context"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+)
+
+// priceRide prices a ride that has not been priced yet over its route from the pickup.
+// The route is not stored as the directions of the ride, since those start at the driver once the ride is claimed
+func (r *RideService) priceRide(ctx context.Context, ride RideRequest) (int, error) {
+	pickup := geo.Point{Lat: ride.FromLat, Lng: ride.FromLng}
+	dropoff := geo.Point{Lat: ride.ToLat, Lng: ride.ToLng}
+	directions, err := r.routeServiceClient.GetDirections(routeLocations(ridePoints(nil, pickup, ride.Stops, dropoff)...))
+	if err != nil {
+		return 0, err
+	}
+	price := r.ridePrice(ride, directions)
+	err = r.rideRepo.UpdatePrice(ctx, ride.ID, price)
+	if err != nil {
+		return 0, err
+	}
+	return price, nil
+}
+
+// authoriseRide places a hold for the fare of the ride on the rider's payment method.
+// Rides billed to an organisation are priced, but not held on a payment method
+func (r *RideService) authoriseRide(ctx context.Context, ride RideRequest) error {
+	if ride.Price == 0 {
+		// Immediate rides are priced when they are claimed, unless their directions have been fetched
+		price, err := r.priceRide(ctx, ride)
+		if err != nil {
+			return err
+		}
+		ride.Price = price
+	}
+	if ride.OrganisationID != nil {
+		return nil
+	}
+	_, err := r.paymentsService.AuthoriseRide(ctx, ride.ID, ride.RiderID, ride.Price, ride.Currency)
+	return err
+}
+
+// authoriseClaimedRides authorises the claimed rides. If a ride cannot be authorised, all of them are released again
+func (r *RideService) authoriseClaimedRides(ctx context.Context, claimed []RideRequest) error {
+	for _, ride := range claimed {
+		authErr := r.authoriseRide(ctx, ride)
+		if authErr == nil {
+			continue
+		}
+		for _, release := range claimed {
+			if err := r.paymentsService.VoidRide(ctx, release.ID); err != nil {
+				return err
+			}
+			if _, err := r.rideRepo.ReleaseRequest(ctx, release.ID); err != nil {
+				return err
+			}
+		}
+		return authErr
+	}
+	return nil
+}
+
+// settleCancellation captures the cancellation fee paid by the rider from the hold on the ride, and releases the rest of the hold.
+// Driver penalties are not charged to the rider, so the hold is released
+func (r *RideService) settleCancellation(ctx context.Context, cancellation RideCancellation) error {
+	if cancellation.FeeParty == PartyRider && cancellation.Fee > 0 {
+		return r.paymentsService.CaptureRide(ctx, cancellation.RideID, cancellation.Fee)
+	}
+	return r.paymentsService.VoidRide(ctx, cancellation.RideID)
+}
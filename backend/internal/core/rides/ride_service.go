@@ -2,29 +2,59 @@ package rides
 
 import (
 	"context"
-	"math"
+	"encoding/json"
 	"time"
 
 	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/drivers"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/organisations"
 	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/promotions"
 	"github.com/bjarke-xyz/uber-clone-backend/internal/core/users"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/samber/lo"
 )
 
+type Config struct {
+	// Radius of the geofence around the pickup location that marks the driver as arrived
+	PickupGeofenceRadiusMeters float64
+	// Time the driver waits for the rider free of charge after arriving
+	FreeWaitingTime time.Duration
+	// Time a ride request can be available before it expires
+	RequestTTL time.Duration
+	// Maximum number of intermediate stops of a ride
+	MaxStops int
+	Schedule ScheduleConfig
+	Pooling  PoolingConfig
+}
+
 type RideService struct {
-	rideRepo           RideRepository
-	userRepo           users.UserRepository
-	routeServiceClient RouteServiceClient
-	paymentsService    *payments.PaymentsService
+	config              Config
+	rideRepo            RideRepository
+	userRepo            users.UserRepository
+	vehicleRepo         vehicles.VehicleRepository
+	driverRepo          drivers.DriverRepository
+	routeServiceClient  RouteServiceClient
+	paymentsService     *payments.PaymentsService
+	promotionService    *promotions.PromotionService
+	organisationService *organisations.OrganisationService
+	pubsub              core.Pubsub
 }
 
-func NewService(rideRepo RideRepository, userRepo users.UserRepository, routeServiceClient RouteServiceClient, paymentsService *payments.PaymentsService) *RideService {
+func NewService(config Config, rideRepo RideRepository, userRepo users.UserRepository, vehicleRepo vehicles.VehicleRepository, driverRepo drivers.DriverRepository, routeServiceClient RouteServiceClient, paymentsService *payments.PaymentsService, promotionService *promotions.PromotionService, organisationService *organisations.OrganisationService, pubsub core.Pubsub) *RideService {
 	return &RideService{
-		rideRepo:           rideRepo,
-		userRepo:           userRepo,
-		routeServiceClient: routeServiceClient,
-		paymentsService:    paymentsService,
+		config:              config,
+		rideRepo:            rideRepo,
+		userRepo:            userRepo,
+		vehicleRepo:         vehicleRepo,
+		driverRepo:          driverRepo,
+		routeServiceClient:  routeServiceClient,
+		paymentsService:     paymentsService,
+		promotionService:    promotionService,
+		organisationService: organisationService,
+		pubsub:              pubsub,
 	}
 }
 
@@ -37,11 +67,129 @@ func (r *RideService) GetRideRequestsByUserID(ctx context.Context, userID string
 	if err != nil {
 		return []RideRequest{}, core.Errorw(core.EINTERNAL, err)
 	}
+	err = r.enrichWithETAs(ctx, rideRequests)
+	if err != nil {
+		return []RideRequest{}, core.Errorw(core.EINTERNAL, err)
+	}
 	return rideRequests, nil
 }
 
-func (r *RideService) GetAvailableRideRequests(ctx context.Context) ([]RideRequest, error) {
-	return r.rideRepo.GetRequests(ctx, RiderRequestStateAvailable)
+func hasETA(ride RideRequest) bool {
+	return (ride.State == RiderRequestStateAccepted || ride.State == RiderRequestStateInProgress) &&
+		ride.DriverID != nil && ride.Directions != nil
+}
+
+// getDriverPosition returns the most recently recorded position of the drivers vehicles
+func (r *RideService) getDriverPosition(ctx context.Context, driverID int64) (*vehicles.VehiclePosition, error) {
+	vehicleList, err := r.vehicleRepo.GetByOwnerId(ctx, driverID)
+	if err != nil {
+		return nil, err
+	}
+	vehicleIds := lo.Map(vehicleList, func(item vehicles.Vehicle, index int) int64 { return item.ID })
+	positions, err := r.vehicleRepo.GetVehiclePositions(ctx, vehicleIds)
+	if err != nil {
+		return nil, err
+	}
+	if len(positions) == 0 {
+		return nil, nil
+	}
+	latest := lo.MaxBy(positions, func(a vehicles.VehiclePosition, b vehicles.VehiclePosition) bool {
+		return a.RecordedAt.After(b.RecordedAt)
+	})
+	return &latest, nil
+}
+
+func (r *RideService) enrichWithETAs(ctx context.Context, rideRequests []RideRequest) error {
+	now := time.Now().UTC()
+	for i, ride := range rideRequests {
+		if !hasETA(ride) {
+			continue
+		}
+		position, err := r.getDriverPosition(ctx, *ride.DriverID)
+		if err != nil {
+			return err
+		}
+		if position == nil {
+			continue
+		}
+		eta := calculateRideETA(ride, geo.Point{Lat: position.Lat, Lng: position.Lng}, position.VehicleID, now)
+		rideRequests[i].ETA = &eta
+	}
+	return nil
+}
+
+// States of rides that have a driver assigned and are not finished
+var activeRideStates = []RideRequestState{RiderRequestStateAccepted, RiderRequestStateDriverArrived, RiderRequestStateInProgress}
+
+// activeRidesForVehicle returns the active rides the vehicle's owner is driving.
+// A driver has more than one active ride when driving a pool
+func activeRidesForVehicle(ctx context.Context, rideRepo RideRepository, vehicle vehicles.Vehicle) ([]RideRequest, error) {
+	ridesList, err := rideRepo.GetByUserIDs(ctx, []int64{vehicle.OwnerID}, activeRideStates)
+	if err != nil {
+		return nil, err
+	}
+	return lo.Filter(ridesList, func(item RideRequest, index int) bool {
+		return item.DriverID != nil && *item.DriverID == vehicle.OwnerID
+	}), nil
+}
+
+// HandlePositionUpdate detects driver arrival and publishes the ETAs of the rides the vehicle is assigned to
+func (r *RideService) HandlePositionUpdate(ctx context.Context, position vehicles.VehiclePosition) error {
+	vehicle, err := r.vehicleRepo.GetByID(ctx, position.VehicleID)
+	if err != nil {
+		return core.WrapErr(err)
+	}
+	ridesList, err := activeRidesForVehicle(ctx, r.rideRepo, vehicle)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	point := geo.Point{Lat: position.Lat, Lng: position.Lng}
+	now := time.Now().UTC()
+	for _, ride := range ridesList {
+		err = r.rideRepo.AddBreadcrumb(ctx, ride.ID, RideBreadcrumb{Lat: position.Lat, Lng: position.Lng, RecordedAt: now})
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		err = r.detectDriverArrival(ctx, ride, vehicle.ID, point)
+		if err != nil {
+			return err
+		}
+		if !hasETA(ride) {
+			continue
+		}
+		// Each rider of a pool only gets the ETA of their own pickup and drop-off
+		eta := calculateRideETA(ride, point, vehicle.ID, now)
+		etaBytes, err := json.Marshal(eta)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		r.pubsub.Publish(ctx, TopicRideETA, etaBytes)
+	}
+	return nil
+}
+
+// GetAvailableRideRequests returns the available rides of the class of the drivers active vehicle.
+// Drivers that are offline or on a ride get no rides
+func (r *RideService) GetAvailableRideRequests(ctx context.Context, userID string) ([]RideRequest, error) {
+	user, err := r.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return []RideRequest{}, core.Errorw(core.EINTERNAL, err)
+	}
+	vehicle, err := r.dispatchableVehicle(ctx, user.ID)
+	if err != nil {
+		return []RideRequest{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if vehicle == nil {
+		return []RideRequest{}, nil
+	}
+	rideRequests, err := r.rideRepo.GetRequests(ctx, RiderRequestStateAvailable)
+	if err != nil {
+		return []RideRequest{}, core.Errorw(core.EINTERNAL, err)
+	}
+	now := time.Now().UTC()
+	return lo.Filter(rideRequests, func(item RideRequest, index int) bool {
+		return !r.isExpired(item, now) && item.VehicleClass == vehicle.Class
+	}), nil
 }
 
 type CreateRideInput struct {
@@ -51,6 +199,22 @@ type CreateRideInput struct {
 	ToLat    float64 `json:"toLat"`
 	ToLng    float64 `json:"toLng"`
 	ToName   string  `json:"toName"`
+	// Intermediate stops in route order
+	Stops []RideStopInput `json:"stops"`
+	// Defaults to economy
+	VehicleClass vehicles.VehicleClass `json:"vehicleClass"`
+	// Set to share the ride with other riders going the same way
+	Pooled bool `json:"pooled"`
+	// Number of seats needed, defaults to 1
+	Seats int `json:"seats"`
+	// Set to book the ride for a later pickup
+	PickupAt *time.Time `json:"pickupAt"`
+	// Promo codes to apply, the discount is taken off the fare when the ride finishes
+	PromoCodes []string `json:"promoCodes"`
+	// Set to bill the ride to an organisation the rider is a member of, instead of the rider's payment method
+	OrganisationID *int64 `json:"organisationId"`
+	// Expense code the ride is billed to the organisation with
+	ExpenseCode string `json:"expenseCode"`
 }
 
 func (c *CreateRideInput) Validate() error {
@@ -61,6 +225,10 @@ func (c *CreateRideInput) Validate() error {
 		validation.Field(&c.ToLat, validation.Required),
 		validation.Field(&c.ToLng, validation.Required),
 		validation.Field(&c.ToName, validation.Required),
+		validation.Field(&c.Stops),
+		validation.Field(&c.Seats, validation.Min(0)),
+		validation.Field(&c.PromoCodes, validation.Length(0, promotions.MaxCodesPerRide)),
+		validation.Field(&c.ExpenseCode, validation.Length(0, 100)),
 	)
 }
 func (r *RideService) CreateRideRequest(ctx context.Context, userID string, input *CreateRideInput) (RideRequest, error) {
@@ -72,22 +240,96 @@ func (r *RideService) CreateRideRequest(ctx context.Context, userID string, inpu
 		return RideRequest{}, core.Errorw(core.EINTERNAL, err)
 	}
 
+	err = r.validateStopCount(len(input.Stops))
+	if err != nil {
+		return RideRequest{}, err
+	}
+	err = r.validateVehicleClass(input)
+	if err != nil {
+		return RideRequest{}, err
+	}
+	err = r.validatePooling(input)
+	if err != nil {
+		return RideRequest{}, err
+	}
+	if input.OrganisationID != nil {
+		err = r.checkOrganisationBilling(ctx, user, input)
+	} else {
+		err = r.paymentsService.EnsurePaymentMethod(ctx, user)
+	}
+	if err != nil {
+		return RideRequest{}, err
+	}
+	currency := currencyAt(geo.Point{Lat: input.FromLat, Lng: input.FromLng})
+	promotionList, err := r.applicablePromotions(ctx, user.ID, input, currency)
+	if err != nil {
+		return RideRequest{}, err
+	}
+
+	now := time.Now().UTC()
 	rideRequest := &RideRequest{
-		RiderID:   user.ID,
-		FromLat:   input.FromLat,
-		FromLng:   input.FromLng,
-		FromName:  input.FromName,
-		ToLat:     input.ToLat,
-		ToLng:     input.ToLng,
-		ToName:    input.ToName,
-		State:     RiderRequestStateAvailable,
-		CreatedAt: time.Now().UTC(),
-		UpdatedAt: time.Now().UTC(),
+		RiderID:        user.ID,
+		FromLat:        input.FromLat,
+		FromLng:        input.FromLng,
+		FromName:       input.FromName,
+		ToLat:          input.ToLat,
+		ToLng:          input.ToLng,
+		ToName:         input.ToName,
+		VehicleClass:   vehicles.ClassOrDefault(input.VehicleClass),
+		Pooled:         input.Pooled,
+		Seats:          max(1, input.Seats),
+		Currency:       currency,
+		State:          RiderRequestStateAvailable,
+		AvailableSince: &now,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if input.OrganisationID != nil {
+		rideRequest.OrganisationID = input.OrganisationID
+		rideRequest.ExpenseCode = lo.EmptyableToPtr(input.ExpenseCode)
+	}
+	var quote RideQuote
+	if input.PickupAt != nil {
+		pickupAt := input.PickupAt.UTC()
+		err = r.validatePickupAt(pickupAt, now)
+		if err != nil {
+			return RideRequest{}, err
+		}
+		quote, err = r.quoteRide(input)
+		if err != nil {
+			return RideRequest{}, err
+		}
+		rideRequest.State = RiderRequestStateScheduled
+		rideRequest.AvailableSince = nil
+		rideRequest.ScheduledPickupAt = &pickupAt
+	}
+	redemptions, err := r.promotionService.Reserve(ctx, user.ID, promotionList)
+	if err != nil {
+		return RideRequest{}, err
 	}
 	err = r.rideRepo.CreateRequest(ctx, rideRequest)
 	if err != nil {
+		if releaseErr := r.promotionService.Release(ctx, redemptions); releaseErr != nil {
+			return RideRequest{}, releaseErr
+		}
 		return RideRequest{}, core.Errorw(core.EINTERNAL, err)
 	}
+	err = r.promotionService.AssignRide(ctx, redemptions, rideRequest.ID)
+	if err != nil {
+		return RideRequest{}, err
+	}
+	if len(input.Stops) > 0 {
+		err = r.rideRepo.ReplacePendingStops(ctx, rideRequest.ID, newRideStops(rideRequest.ID, 0, input.Stops))
+		if err != nil {
+			return RideRequest{}, core.Errorw(core.EINTERNAL, err)
+		}
+	}
+	if quote.directions != nil {
+		err = r.rideRepo.UpdateRideDirections(ctx, rideRequest.ID, quote.directions, quote.chargedPrice())
+		if err != nil {
+			return RideRequest{}, core.Errorw(core.EINTERNAL, err)
+		}
+	}
 	rideReq, err := r.rideRepo.GetByID(ctx, rideRequest.ID)
 	if err != nil {
 		return RideRequest{}, core.Errorw(core.EINTERNAL, err)
@@ -106,18 +348,63 @@ func (r *RideService) ClaimRideRequest(ctx context.Context, userID string, rideR
 		return core.Errorw(core.EINTERNAL, err)
 	}
 
-	if rideReq.State != RiderRequestStateAvailable {
+	if rideReq.State != RiderRequestStateAvailable || r.isExpired(rideReq, time.Now().UTC()) {
 		return core.Errorf(core.EINVALID, "cannot claim non-available ride")
 	}
+	vehicle, err := r.dispatchableVehicle(ctx, user.ID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if vehicle == nil {
+		return core.Errorf(core.EINVALID, "must be online and not on a ride to claim rides")
+	}
+	if vehicle.Class != rideReq.VehicleClass {
+		return core.Errorf(core.EINVALID, "cannot claim ride requiring a %v vehicle", rideReq.VehicleClass)
+	}
 
-	err = r.rideRepo.ClaimRequest(ctx, rideReq.ID, user.ID)
+	cooldownUntil, inCooldown, err := r.driverCooldownUntil(ctx, user.ID, time.Now().UTC())
 	if err != nil {
 		return core.Errorw(core.EINTERNAL, err)
 	}
+	if inCooldown {
+		return core.Errorf(core.EINVALID, "too many recent cancellations, cannot claim rides until %v", cooldownUntil.Format(time.RFC3339))
+	}
+
+	// The rides of a pool are claimed together
+	claimRides := []RideRequest{rideReq}
+	if rideReq.PoolID != nil {
+		claimRides, err = r.claimablePoolRides(ctx, *rideReq.PoolID)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+	}
+	claimIDs := lo.Map(claimRides, func(item RideRequest, index int) int64 { return item.ID })
+	claimed, err := r.rideRepo.ClaimRequests(ctx, claimIDs, user.ID, vehicle.ID, r.config.PickupGeofenceRadiusMeters)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if !claimed {
+		return core.Errorf(core.ECONFLICT, "ride was claimed by another driver")
+	}
+	// The pool is routed from the driver to the first pickup
+	if rideReq.PoolID != nil {
+		err = r.reroutePool(ctx, *rideReq.PoolID)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+	}
+	authErr := r.authoriseClaimedRides(ctx, claimRides)
+	err = r.refreshDriverAvailability(ctx, user.ID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if authErr != nil {
+		return core.WrapErr(authErr)
+	}
 	return nil
 }
 
-func (r *RideService) GetRideDirections(ctx context.Context, rideRequestId int64, optionalStartLat float64, optionalStartLng float64) (*ORSDirections, error) {
+func (r *RideService) GetRideDirections(ctx context.Context, rideRequestId int64, optionalStartLat float64, optionalStartLng float64) (*Directions, error) {
 	// user, err := a.userRepo.GetByUserID(r.Context(), token.Subject)
 	// if err != nil {
 	// 	a.errorResponse(w, r, http.StatusInternalServerError, err)
@@ -134,23 +421,19 @@ func (r *RideService) GetRideDirections(ctx context.Context, rideRequestId int64
 	// 	return
 	// }
 
-	directions := rideReq.DirectionsV1
+	directions := rideReq.Directions
 	if directions == nil {
-		locations := make([][]float64, 0)
+		var start *geo.Point
 		if optionalStartLat > 0 && optionalStartLng > 0 {
-			locations = append(locations, []float64{optionalStartLng, optionalStartLat})
+			start = &geo.Point{Lat: optionalStartLat, Lng: optionalStartLng}
 		}
-		locations = append(locations, []float64{rideReq.FromLng, rideReq.FromLat}, []float64{rideReq.ToLng, rideReq.ToLat})
-		directions, err = r.routeServiceClient.GetDirections(locations)
+		pickup := geo.Point{Lat: rideReq.FromLat, Lng: rideReq.FromLng}
+		dropoff := geo.Point{Lat: rideReq.ToLat, Lng: rideReq.ToLng}
+		directions, err = r.routeServiceClient.GetDirections(routeLocations(ridePoints(start, pickup, rideReq.Stops, dropoff)...))
 		if err != nil {
 			return nil, core.Errorw(core.EINTERNAL, err)
 		}
-		totalDistance := 0
-		for _, route := range directions.Routes {
-			totalDistance += int(math.Ceil(route.Summary.Distance))
-		}
-		price := r.paymentsService.CalculatePrice(totalDistance)
-		err = r.rideRepo.UpdateRideDirections(ctx, rideRequestId, 1, directions, price)
+		err = r.rideRepo.UpdateRideDirections(ctx, rideRequestId, directions, r.ridePrice(rideReq, directions))
 		if err != nil {
 			return nil, core.Errorw(core.EINTERNAL, err)
 		}
@@ -158,6 +441,70 @@ func (r *RideService) GetRideDirections(ctx context.Context, rideRequestId int64
 	return directions, nil
 }
 
+// MigrateDirections re-encodes directions stored in an older version in the current version.
+// Directions that cannot be decoded are left as they are and passed to onSkip. Returns the number of migrated rides
+func (r *RideService) MigrateDirections(ctx context.Context, onSkip func(rideID int64, err error)) (int, error) {
+	migrated := 0
+	afterID := int64(0)
+	for {
+		storedList, err := r.rideRepo.GetOutdatedDirections(ctx, afterID, 100)
+		if err != nil {
+			return migrated, core.Errorw(core.EINTERNAL, err)
+		}
+		if len(storedList) == 0 {
+			return migrated, nil
+		}
+		for _, stored := range storedList {
+			afterID = stored.RideID
+			if len(stored.Json) == 0 {
+				continue
+			}
+			directions, err := DecodeDirections(stored.Version, []byte(stored.Json))
+			if err != nil {
+				onSkip(stored.RideID, err)
+				continue
+			}
+			err = r.rideRepo.UpdateRideDirections(ctx, stored.RideID, directions, stored.Price)
+			if err != nil {
+				return migrated, core.Errorw(core.EINTERNAL, err)
+			}
+			migrated++
+		}
+	}
+}
+
+// StartRide marks that the driver has picked up the rider
+func (r *RideService) StartRide(ctx context.Context, userID string, rideRequestId int64) error {
+	user, err := r.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+
+	rideReq, err := r.rideRepo.GetByID(ctx, rideRequestId)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if rideReq.DriverID == nil || *rideReq.DriverID != user.ID {
+		return core.Errorf(core.EINVALID, "cannot change ride")
+	}
+	if rideReq.State != RiderRequestStateAccepted && rideReq.State != RiderRequestStateDriverArrived {
+		return core.Errorf(core.EINVALID, "cannot start ride that is not accepted")
+	}
+
+	started, err := r.rideRepo.StartRequest(ctx, rideReq.ID, time.Now().UTC())
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	if !started {
+		return core.Errorf(core.ECONFLICT, "ride is no longer waiting to be started")
+	}
+	err = r.refreshDriverAvailability(ctx, user.ID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	return nil
+}
+
 func (r *RideService) FinishRide(ctx context.Context, userID string, rideRequestId int64) error {
 	user, err := r.userRepo.GetByUserID(ctx, userID)
 	if err != nil {
@@ -171,11 +518,73 @@ func (r *RideService) FinishRide(ctx context.Context, userID string, rideRequest
 	if rideReq.DriverID == nil || *rideReq.DriverID != user.ID {
 		return core.Errorf(core.EINVALID, "cannot change ride")
 	}
+	if len(rideReq.PendingStops()) > 0 {
+		return core.Errorf(core.EINVALID, "cannot finish ride with pending stops")
+	}
 
-	err = r.rideRepo.UpdateRequestState(ctx, rideReq.ID, RiderRequestStateFinished)
+	if rideReq.State != RiderRequestStateInProgress && rideReq.State != RiderRequestStateFinished {
+		return core.Errorf(core.EINVALID, "cannot finish ride that is not in progress")
+	}
+
+	// A ride finished again is settled again, keeping the time and commission rate it was first finished with
+	firstFinish := rideReq.State == RiderRequestStateInProgress
+	commissionRate := rideReq.CommissionRate
+	finishedAt := lo.FromPtr(rideReq.FinishedAt)
+	if firstFinish {
+		commissionRate, err = r.paymentsService.CommissionRateAt(ctx, geo.Point{Lat: rideReq.FromLat, Lng: rideReq.FromLng}, rideReq.VehicleClass)
+		if err != nil {
+			return core.WrapErr(err)
+		}
+		finishedAt = time.Now().UTC()
+		finished, err := r.rideRepo.FinishRequest(ctx, rideReq.ID, finishedAt, commissionRate)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		if !finished {
+			return core.Errorf(core.ECONFLICT, "ride is no longer in progress")
+		}
+		rideReq.FinishedAt = &finishedAt
+	}
+	err = r.paymentsService.RecordFare(ctx, rideReq.ID, billedAccount(rideReq), user.ID, rideReq.Price, rideReq.Currency)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	err = r.paymentsService.RecordCommission(ctx, rideReq.ID, user.ID, payments.Commission(rideReq.Price, commissionRate), rideReq.Currency)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	discount, err := r.redeemPromotions(ctx, rideReq)
+	if err != nil {
+		return core.WrapErr(err)
+	}
+	surcharges, err := r.addSurcharges(ctx, rideReq)
+	if err != nil {
+		return core.WrapErr(err)
+	}
+	// Surcharges beyond the authorisation buffer are charged separately. Rides billed to an organisation have no hold to capture
+	err = r.paymentsService.CaptureRide(ctx, rideReq.ID, rideReq.Price-discount+surcharges)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	err = r.refreshDriverAvailability(ctx, user.ID)
 	if err != nil {
 		return core.Errorw(core.EINTERNAL, err)
 	}
+	if firstFinish {
+		event := RideFinishedEvent{
+			RideID:     rideReq.ID,
+			RiderID:    rideReq.RiderID,
+			DriverID:   user.ID,
+			Price:      rideReq.Price,
+			Currency:   rideReq.Currency,
+			FinishedAt: finishedAt,
+		}
+		eventBytes, err := json.Marshal(event)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		r.pubsub.Publish(ctx, TopicRideFinished, eventBytes)
+	}
 	return nil
 }
 
@@ -185,7 +594,7 @@ func (r *RideService) GetSimulatedRides(ctx context.Context) ([]RideRequest, err
 		return []RideRequest{}, core.Errorw(core.EINTERNAL, err)
 	}
 	simUserIds := lo.Map(simUsers, func(item users.User, index int) int64 { return item.ID })
-	states := []RideRequestState{RiderRequestStateAvailable, RiderRequestStateAccepted, RiderRequestStateInProgress}
+	states := append([]RideRequestState{RiderRequestStateAvailable}, activeRideStates...)
 	rides, err := r.rideRepo.GetByUserIDs(ctx, simUserIds, states)
 	if err != nil {
 		return []RideRequest{}, core.Errorw(core.EINTERNAL, err)
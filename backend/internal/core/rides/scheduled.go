@@ -0,0 +1,107 @@
+package rides
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+)
+
+const (
+	TopicRideReminder = "ride-reminder"
+)
+
+type ScheduleConfig struct {
+	// How far ahead a ride can be booked
+	MaxAhead time.Duration
+	// Scheduled rides are made available to drivers this long before pickup
+	ReleaseLeadTime    time.Duration
+	RiderReminderLead  time.Duration
+	DriverReminderLead time.Duration
+}
+
+type RideReminderEvent struct {
+	RideID   int64     `json:"rideId"`
+	UserID   int64     `json:"userId"`
+	Party    string    `json:"party"`
+	PickupAt time.Time `json:"pickupAt"`
+}
+
+func (r *RideService) validatePickupAt(pickupAt time.Time, now time.Time) error {
+	if pickupAt.Before(now.Add(r.config.Schedule.ReleaseLeadTime)) {
+		return core.Errorf(core.EINVALID, "scheduled pickup must be at least %v ahead", r.config.Schedule.ReleaseLeadTime)
+	}
+	if pickupAt.After(now.Add(r.config.Schedule.MaxAhead)) {
+		return core.Errorf(core.EINVALID, "scheduled pickup can be at most %v ahead", r.config.Schedule.MaxAhead)
+	}
+	return nil
+}
+
+// ProcessScheduledRides sends reminders, releases scheduled rides to the available board
+// and cancels released rides no driver has claimed before the pickup time
+func (r *RideService) ProcessScheduledRides(ctx context.Context) error {
+	now := time.Now().UTC()
+	err := r.sendReminders(ctx, PartyRider, now.Add(r.config.Schedule.RiderReminderLead))
+	if err != nil {
+		return err
+	}
+	err = r.sendReminders(ctx, PartyDriver, now.Add(r.config.Schedule.DriverReminderLead))
+	if err != nil {
+		return err
+	}
+	_, err = r.rideRepo.ReleaseScheduledRequests(ctx, now.Add(r.config.Schedule.ReleaseLeadTime))
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	unclaimed, err := r.rideRepo.CancelUnclaimedScheduledRequests(ctx, now)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	for _, ride := range unclaimed {
+		cancellation := RideCancellation{
+			RideID:    ride.ID,
+			Party:     PartySystem,
+			Reason:    CancellationReasonNoDriverFound,
+			Currency:  ride.Currency,
+			CreatedAt: now,
+		}
+		err = r.rideRepo.CreateCancellation(ctx, &cancellation)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		err = r.promotionService.ReleaseRide(ctx, ride.ID)
+		if err != nil {
+			return err
+		}
+		err = r.publishCancellation(ctx, ride, cancellation, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RideService) sendReminders(ctx context.Context, party string, pickupBefore time.Time) error {
+	due, err := r.rideRepo.MarkDueReminders(ctx, party, pickupBefore)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	for _, ride := range due {
+		event := RideReminderEvent{
+			RideID:   ride.ID,
+			UserID:   ride.RiderID,
+			Party:    party,
+			PickupAt: *ride.ScheduledPickupAt,
+		}
+		if party == PartyDriver {
+			event.UserID = *ride.DriverID
+		}
+		eventBytes, err := json.Marshal(event)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		r.pubsub.Publish(ctx, TopicRideReminder, eventBytes)
+	}
+	return nil
+}
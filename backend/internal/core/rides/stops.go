@@ -0,0 +1,290 @@
+package rides
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/samber/lo"
+)
+
+const (
+	TopicRideStopsUpdated  = "ride-stops-updated"
+	TopicRideStopCompleted = "ride-stop-completed"
+)
+
+type RideStopState int
+
+const (
+	RideStopStatePending RideStopState = iota
+	RideStopStateCompleted
+)
+
+// RideStop is an intermediate stop between the pickup and the drop-off
+type RideStop struct {
+	ID     int64 `json:"id"`
+	RideID int64 `json:"rideId"`
+	// Position of the stop on the route, starting at 0
+	Order       int           `json:"order"`
+	Lat         float64       `json:"lat"`
+	Lng         float64       `json:"lng"`
+	Name        string        `json:"name"`
+	State       RideStopState `json:"state"`
+	CompletedAt *time.Time    `json:"completedAt"`
+}
+
+func (s RideStop) Point() geo.Point {
+	return geo.Point{Lat: s.Lat, Lng: s.Lng}
+}
+
+type RideStopInput struct {
+	Lat  float64 `json:"lat"`
+	Lng  float64 `json:"lng"`
+	Name string  `json:"name"`
+}
+
+func (s RideStopInput) Validate() error {
+	return validation.ValidateStruct(&s,
+		validation.Field(&s.Lat, validation.Required),
+		validation.Field(&s.Lng, validation.Required),
+		validation.Field(&s.Name, validation.Required),
+	)
+}
+
+type UpdateStopsInput struct {
+	// The stops that have not been completed yet, in route order
+	Stops []RideStopInput `json:"stops"`
+}
+
+func (u *UpdateStopsInput) Validate() error {
+	return validation.ValidateStruct(u,
+		validation.Field(&u.Stops),
+	)
+}
+
+type RideStopsEvent struct {
+	RideID   int64  `json:"rideId"`
+	RiderID  int64  `json:"riderId"`
+	DriverID *int64 `json:"driverId"`
+	// Set when a stop was completed
+	StopID *int64     `json:"stopId,omitempty"`
+	Stops  []RideStop `json:"stops"`
+}
+
+// States in which the rider can change the stops of the ride
+var editableStopsStates = []RideRequestState{
+	RiderRequestStateAvailable,
+	RiderRequestStateScheduled,
+	RiderRequestStateAccepted,
+	RiderRequestStateDriverArrived,
+	RiderRequestStateInProgress,
+}
+
+// PendingStops returns the stops that have not been completed, in route order
+func (r *RideRequest) PendingStops() []RideStop {
+	return lo.Filter(r.Stops, func(item RideStop, index int) bool { return item.State == RideStopStatePending })
+}
+
+// routeLocations converts points to the [lng, lat] locations used by the route service
+func routeLocations(points ...geo.Point) [][]float64 {
+	return lo.Map(points, func(item geo.Point, index int) []float64 { return []float64{item.Lng, item.Lat} })
+}
+
+// ridePoints returns the pickup, the stops and the drop-off of the ride, prefixed by start if given
+func ridePoints(start *geo.Point, pickup geo.Point, stops []RideStop, dropoff geo.Point) []geo.Point {
+	points := make([]geo.Point, 0, len(stops)+3)
+	if start != nil {
+		points = append(points, *start)
+	}
+	points = append(points, pickup)
+	for _, stop := range stops {
+		points = append(points, stop.Point())
+	}
+	return append(points, dropoff)
+}
+
+func (r *RideService) validateStopCount(count int) error {
+	if count > r.config.MaxStops {
+		return core.Errorf(core.EINVALID, "a ride can have at most %v stops", r.config.MaxStops)
+	}
+	return nil
+}
+
+func newRideStops(rideID int64, firstOrder int, inputs []RideStopInput) []RideStop {
+	return lo.Map(inputs, func(item RideStopInput, index int) RideStop {
+		return RideStop{
+			RideID: rideID,
+			Order:  firstOrder + index,
+			Lat:    item.Lat,
+			Lng:    item.Lng,
+			Name:   item.Name,
+			State:  RideStopStatePending,
+		}
+	})
+}
+
+// priceForDirections calculates the price of the route from the pickup, excluding the drivers way to the pickup
+func (r *RideService) priceForDirections(vehicleClass vehicles.VehicleClass, pickup geo.Point, directions *Directions) int {
+	distance := directions.DistanceFrom(directions.NearestWayPointIndex(pickup))
+	return r.paymentsService.CalculatePrice(vehicleClass, currencyAt(pickup), int(math.Ceil(distance)))
+}
+
+// routeRide fetches directions over all stops of the ride and prices them.
+// Rides not yet picked up are routed from the drivers position, if known
+func (r *RideService) routeRide(ctx context.Context, ride RideRequest) (*Directions, int, error) {
+	var start *geo.Point
+	if ride.DriverID != nil && ride.State != RiderRequestStateInProgress {
+		position, err := r.getDriverPosition(ctx, *ride.DriverID)
+		if err != nil {
+			return nil, 0, err
+		}
+		if position != nil {
+			start = &geo.Point{Lat: position.Lat, Lng: position.Lng}
+		}
+	}
+	pickup := geo.Point{Lat: ride.FromLat, Lng: ride.FromLng}
+	dropoff := geo.Point{Lat: ride.ToLat, Lng: ride.ToLng}
+	directions, err := r.routeServiceClient.GetDirections(routeLocations(ridePoints(start, pickup, ride.Stops, dropoff)...))
+	if err != nil {
+		return nil, 0, err
+	}
+	return directions, r.ridePrice(ride, directions), nil
+}
+
+func (r *RideService) publishStopsEvent(ctx context.Context, topic string, ride RideRequest, stopID *int64) error {
+	event := RideStopsEvent{
+		RideID:   ride.ID,
+		RiderID:  ride.RiderID,
+		DriverID: ride.DriverID,
+		StopID:   stopID,
+		Stops:    ride.Stops,
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	r.pubsub.Publish(ctx, topic, eventBytes)
+	return nil
+}
+
+// UpdateRideStops replaces the pending stops of the ride and recalculates its directions and price.
+// Completed stops are kept. If the price grows beyond the hold on the rider's payment method, a larger hold is placed first
+func (r *RideService) UpdateRideStops(ctx context.Context, userID string, rideRequestId int64, input *UpdateStopsInput) (RideRequest, error) {
+	if err := input.Validate(); err != nil {
+		return RideRequest{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	user, err := r.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return RideRequest{}, core.Errorw(core.EINTERNAL, err)
+	}
+	rideReq, err := r.rideRepo.GetByID(ctx, rideRequestId)
+	if err != nil {
+		return RideRequest{}, core.WrapErr(err)
+	}
+	if rideReq.RiderID != user.ID {
+		return RideRequest{}, core.Errorf(core.EINVALID, "cannot change ride")
+	}
+	if rideReq.Pooled {
+		return RideRequest{}, core.Errorf(core.EINVALID, "pooled rides cannot have stops")
+	}
+	if !lo.Contains(editableStopsStates, rideReq.State) {
+		return RideRequest{}, core.Errorf(core.EINVALID, "cannot change stops of ride in state %v", rideReq.State)
+	}
+	completed := len(rideReq.Stops) - len(rideReq.PendingStops())
+	err = r.validateStopCount(completed + len(input.Stops))
+	if err != nil {
+		return RideRequest{}, err
+	}
+
+	stops := newRideStops(rideReq.ID, completed, input.Stops)
+	// Available rides get their directions when a driver asks for them, unless they are billed to an organisation,
+	// whose policy may limit the fare the new stops lead to
+	var directions *Directions
+	if rideReq.Directions != nil || rideReq.OrganisationID != nil {
+		routed := rideReq
+		routed.Stops = append(lo.Filter(rideReq.Stops, func(item RideStop, index int) bool { return item.State == RideStopStateCompleted }), stops...)
+		var price int
+		directions, price, err = r.routeRide(ctx, routed)
+		if err != nil {
+			return RideRequest{}, core.Errorw(core.EINTERNAL, err)
+		}
+		if rideReq.OrganisationID != nil {
+			policy, err := r.organisationService.BillingPolicy(ctx, *rideReq.OrganisationID, rideReq.RiderID)
+			if err != nil {
+				return RideRequest{}, core.WrapErr(err)
+			}
+			err = r.checkMaxFare(ctx, policy, price, rideReq.Currency)
+			if err != nil {
+				return RideRequest{}, core.WrapErr(err)
+			}
+		}
+		err = r.paymentsService.AdjustRideHold(ctx, rideReq.ID, rideReq.RiderID, price, rideReq.Currency)
+		if err != nil {
+			return RideRequest{}, core.WrapErr(err)
+		}
+		rideReq.Price = price
+	}
+
+	err = r.rideRepo.ReplacePendingStops(ctx, rideReq.ID, stops)
+	if err != nil {
+		return RideRequest{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if directions != nil {
+		err = r.rideRepo.UpdateRideDirections(ctx, rideReq.ID, directions, rideReq.Price)
+		if err != nil {
+			return RideRequest{}, core.Errorw(core.EINTERNAL, err)
+		}
+	}
+	rideReq, err = r.rideRepo.GetByID(ctx, rideReq.ID)
+	if err != nil {
+		return RideRequest{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if rideReq.DriverID != nil {
+		err = r.publishStopsEvent(ctx, TopicRideStopsUpdated, rideReq, nil)
+		if err != nil {
+			return RideRequest{}, core.Errorw(core.EINTERNAL, err)
+		}
+	}
+	return rideReq, nil
+}
+
+// CompleteStop marks that the driver has reached the stop. Stops must be completed in order
+func (r *RideService) CompleteStop(ctx context.Context, userID string, rideRequestId int64, stopID int64) error {
+	user, err := r.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	rideReq, err := r.rideRepo.GetByID(ctx, rideRequestId)
+	if err != nil {
+		return core.WrapErr(err)
+	}
+	if rideReq.DriverID == nil || *rideReq.DriverID != user.ID {
+		return core.Errorf(core.EINVALID, "cannot change ride")
+	}
+	if rideReq.State != RiderRequestStateInProgress {
+		return core.Errorf(core.EINVALID, "cannot complete stop of ride that is not in progress")
+	}
+	pending := rideReq.PendingStops()
+	if len(pending) == 0 || pending[0].ID != stopID {
+		return core.Errorf(core.EINVALID, "stop %v is not the next stop of the ride", stopID)
+	}
+
+	err = r.rideRepo.CompleteStop(ctx, stopID, time.Now().UTC())
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	rideReq, err = r.rideRepo.GetByID(ctx, rideReq.ID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	err = r.publishStopsEvent(ctx, TopicRideStopCompleted, rideReq, &stopID)
+	if err != nil {
+		return core.Errorw(core.EINTERNAL, err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package rides
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/samber/lo"
+)
+
+// Surcharges added to the fare when a ride finishes
+const (
+	LineItemWaitingTime = "waiting_time"
+	LineItemToll        = "toll"
+	LineItemAirportFee  = "airport_fee"
+	LineItemZoneFee     = "zone_fee"
+)
+
+var zoneLineItemTypes = map[payments.SurchargeZoneType]string{
+	payments.SurchargeZoneToll:    LineItemToll,
+	payments.SurchargeZoneAirport: LineItemAirportFee,
+	payments.SurchargeZoneEntry:   LineItemZoneFee,
+}
+
+// surchargeLineItemTypes are the line items paid to the driver on top of the fare
+var surchargeLineItemTypes = []string{LineItemWaitingTime, LineItemToll, LineItemAirportFee, LineItemZoneFee, LineItemExtra}
+
+func isSurcharge(lineItem RideLineItem) bool {
+	return slices.Contains(surchargeLineItemTypes, lineItem.Type)
+}
+
+// waitedAfterFreeWaiting returns how long the driver waited for the rider after the free waiting time
+func waitedAfterFreeWaiting(ride RideRequest) time.Duration {
+	if ride.FreeWaitingUntil == nil || ride.StartedAt == nil {
+		return 0
+	}
+	return ride.StartedAt.Sub(*ride.FreeWaitingUntil)
+}
+
+// tripPath returns the path driven with the rider on board. It is made of the breadcrumbs recorded after the rider was picked up,
+// or the planned route from the pickup if too few breadcrumbs were recorded
+func tripPath(ride RideRequest, breadcrumbs []RideBreadcrumb) []geo.Point {
+	if ride.StartedAt != nil {
+		onBoard := lo.Filter(breadcrumbs, func(item RideBreadcrumb, index int) bool { return !item.RecordedAt.Before(*ride.StartedAt) })
+		if len(onBoard) >= 2 {
+			return lo.Map(onBoard, func(item RideBreadcrumb, index int) geo.Point { return geo.Point{Lat: item.Lat, Lng: item.Lng} })
+		}
+	}
+	if ride.Directions == nil || len(ride.Directions.Coordinates) == 0 {
+		return []geo.Point{{Lat: ride.FromLat, Lng: ride.FromLng}, {Lat: ride.ToLat, Lng: ride.ToLng}}
+	}
+	// The route of an accepted ride starts where the driver accepted it
+	route := ride.Directions.Points()
+	pickup := geo.NearestPointOnLine(route, geo.Point{Lat: ride.FromLat, Lng: ride.FromLng})
+	return append([]geo.Point{pickup.Point}, route[min(pickup.Index+1, len(route)):]...)
+}
+
+// rideSurcharges returns the waiting time and zone fees of a ride as line items
+func (r *RideService) rideSurcharges(ctx context.Context, ride RideRequest) ([]RideLineItem, error) {
+	now := time.Now().UTC()
+	lineItems := make([]RideLineItem, 0)
+	waited := waitedAfterFreeWaiting(ride)
+	waitingFee, err := r.paymentsService.WaitingFee(ctx, waited, ride.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if waitingFee > 0 {
+		lineItems = append(lineItems, RideLineItem{
+			RideID:      ride.ID,
+			Type:        LineItemWaitingTime,
+			Amount:      waitingFee,
+			Currency:    ride.Currency,
+			Description: fmt.Sprintf("%v min", int(math.Ceil(waited.Minutes()))),
+			CreatedBy:   *ride.DriverID,
+			CreatedAt:   now,
+		})
+	}
+	breadcrumbs, err := r.rideRepo.GetBreadcrumbs(ctx, ride.ID)
+	if err != nil {
+		return nil, core.Errorw(core.EINTERNAL, err)
+	}
+	zoneFees, err := r.paymentsService.ZoneFees(ctx, tripPath(ride, breadcrumbs), ride.Currency)
+	if err != nil {
+		return nil, err
+	}
+	for _, zoneFee := range zoneFees {
+		lineItems = append(lineItems, RideLineItem{
+			RideID:      ride.ID,
+			Type:        zoneLineItemTypes[zoneFee.Zone.Type],
+			Amount:      zoneFee.Amount,
+			Currency:    ride.Currency,
+			Description: zoneFee.Zone.Name,
+			CreatedBy:   *ride.DriverID,
+			CreatedAt:   now,
+		})
+	}
+	return lineItems, nil
+}
+
+// addSurcharges adds the waiting time and zone fees of a finished ride as line items, paid to the driver by whoever the ride is billed to.
+// A ride finished again keeps the surcharges it was first finished with. Returns the total of the surcharges, including extras approved
+// before the ride finished. Extras approved later are charged when they are approved
+func (r *RideService) addSurcharges(ctx context.Context, ride RideRequest) (int, error) {
+	surcharges, err := r.rideSurcharges(ctx, ride)
+	if err != nil {
+		return 0, err
+	}
+	for i := range surcharges {
+		_, err = r.rideRepo.CreateLineItem(ctx, &surcharges[i])
+		if err != nil {
+			return 0, core.Errorw(core.EINTERNAL, err)
+		}
+	}
+	// Recorded from the stored line items, as surcharges already added when the ride was first finished are not created again.
+	// Extras approved during the ride have been recorded already, recording them again does nothing
+	lineItems, err := r.rideRepo.GetLineItems(ctx, []int64{ride.ID})
+	if err != nil {
+		return 0, core.Errorw(core.EINTERNAL, err)
+	}
+	total := 0
+	for _, lineItem := range lineItems {
+		if !isSurcharge(lineItem) {
+			continue
+		}
+		err = r.paymentsService.RecordSurcharge(ctx, lineItem.ID, ride.ID, billedAccount(ride), *ride.DriverID, lineItem.Amount, lineItem.Currency)
+		if err != nil {
+			return 0, core.Errorw(core.EINTERNAL, err)
+		}
+		if !chargedSeparately(ride, lineItem) {
+			total += lineItem.Amount
+		}
+	}
+	return total, nil
+}
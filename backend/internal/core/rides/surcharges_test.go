@@ -0,0 +1,31 @@
+package rides
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+func TestWaitedAfterFreeWaiting(t *testing.T) {
+	freeWaitingUntil := time.Date(2024, 3, 13, 8, 5, 0, 0, time.UTC)
+	tests := []struct {
+		name             string
+		freeWaitingUntil *time.Time
+		startedAt        *time.Time
+		want             time.Duration
+	}{
+		{"started after free waiting", &freeWaitingUntil, lo.ToPtr(freeWaitingUntil.Add(3 * time.Minute)), 3 * time.Minute},
+		{"started during free waiting", &freeWaitingUntil, lo.ToPtr(freeWaitingUntil.Add(-time.Minute)), -time.Minute},
+		{"driver did not arrive", nil, lo.ToPtr(freeWaitingUntil), 0},
+		{"not started", &freeWaitingUntil, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ride := RideRequest{FreeWaitingUntil: tt.freeWaitingUntil, StartedAt: tt.startedAt}
+			if got := waitedAfterFreeWaiting(ride); got != tt.want {
+				t.Errorf("waitedAfterFreeWaiting() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
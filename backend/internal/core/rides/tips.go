@@ -0,0 +1,148 @@
+package rides
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/samber/lo"
+)
+
+const (
+	TopicRideTipped = "ride-tipped"
+)
+
+const (
+	LineItemTip = "tip"
+)
+
+// RideLineItem is an amount charged to the rider in addition to the fare of the ride, or taken off it if negative
+type RideLineItem struct {
+	ID       int64  `json:"id"`
+	RideID   int64  `json:"rideId"`
+	Type     string `json:"type"`
+	Amount   int    `json:"amount"`
+	Currency string `json:"currency"`
+	// Shown with the type on receipts, for example the name of the zone a fee was charged for
+	Description string `json:"description"`
+	// The user that added the line item
+	CreatedBy int64     `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type TipInput struct {
+	Amount int `json:"amount"`
+}
+
+type RideTippedEvent struct {
+	RideID   int64        `json:"rideId"`
+	RiderID  int64        `json:"riderId"`
+	DriverID int64        `json:"driverId"`
+	Tip      RideLineItem `json:"tip"`
+}
+
+// tipOf returns the tip of the ride, if any
+func tipOf(lineItems []RideLineItem) (RideLineItem, bool) {
+	return lo.Find(lineItems, func(item RideLineItem) bool { return item.Type == LineItemTip })
+}
+
+// idempotentTip returns the existing tip of the ride if it has the same amount, and an error if it differs
+func (r *RideService) idempotentTip(ctx context.Context, rideID int64, amount int) (RideLineItem, bool, error) {
+	lineItems, err := r.rideRepo.GetLineItems(ctx, []int64{rideID})
+	if err != nil {
+		return RideLineItem{}, false, core.Errorw(core.EINTERNAL, err)
+	}
+	tip, ok := tipOf(lineItems)
+	if !ok {
+		return RideLineItem{}, false, nil
+	}
+	if tip.Amount != amount {
+		return RideLineItem{}, false, core.Errorf(core.ECONFLICT, "ride has already been tipped")
+	}
+	return tip, true, nil
+}
+
+// chargeTip charges the tip to the rider's payment method. The charge is identified by the ride, which is tipped once,
+// so repeating a tip that was charged does not charge it again, and repeating a declined tip tries the card again
+func (r *RideService) chargeTip(ctx context.Context, ride RideRequest, amount int) error {
+	return r.paymentsService.ChargeRide(ctx, ride.ID, ride.RiderID, amount, ride.Currency, fmt.Sprintf("ride:%v:tip", ride.ID))
+}
+
+// TipRide charges a tip on a finished ride and adds it as a line item. The line item is only added once the tip is charged,
+// so receipts and earnings only show tips that were paid. A ride can be tipped once; repeating the same tip returns the existing tip
+func (r *RideService) TipRide(ctx context.Context, userID string, rideRequestId int64, input *TipInput) (RideLineItem, error) {
+	user, err := r.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return RideLineItem{}, core.Errorw(core.EINTERNAL, err)
+	}
+	rideReq, err := r.rideRepo.GetByID(ctx, rideRequestId)
+	if err != nil {
+		return RideLineItem{}, core.WrapErr(err)
+	}
+	if rideReq.RiderID != user.ID {
+		return RideLineItem{}, core.Errorf(core.EUNAUTHORIZED, "cannot tip ride you are not the rider of")
+	}
+	if rideReq.State != RiderRequestStateFinished || rideReq.FinishedAt == nil || rideReq.DriverID == nil {
+		return RideLineItem{}, core.Errorf(core.EINVALID, "only finished rides can be tipped")
+	}
+	tip, exists, err := r.idempotentTip(ctx, rideReq.ID, input.Amount)
+	if err != nil {
+		return RideLineItem{}, err
+	}
+	if exists {
+		// The tip was charged, but may not have been recorded
+		err = r.paymentsService.RecordTip(ctx, rideReq.ID, rideReq.RiderID, *rideReq.DriverID, tip.Amount, tip.Currency)
+		if err != nil {
+			return RideLineItem{}, core.Errorw(core.EINTERNAL, err)
+		}
+		return tip, nil
+	}
+	now := time.Now().UTC()
+	if now.After(rideReq.FinishedAt.Add(r.paymentsService.TipWindow())) {
+		return RideLineItem{}, core.Errorf(core.EINVALID, "ride can no longer be tipped")
+	}
+	if err := r.paymentsService.ValidateTip(ctx, input.Amount, rideReq.Currency); err != nil {
+		return RideLineItem{}, err
+	}
+	err = r.chargeTip(ctx, rideReq, input.Amount)
+	if err != nil {
+		return RideLineItem{}, core.WrapErr(err)
+	}
+
+	tip = RideLineItem{
+		RideID:    rideReq.ID,
+		Type:      LineItemTip,
+		Amount:    input.Amount,
+		Currency:  rideReq.Currency,
+		CreatedBy: user.ID,
+		CreatedAt: now,
+	}
+	created, err := r.rideRepo.CreateLineItem(ctx, &tip)
+	if err != nil {
+		return RideLineItem{}, core.Errorw(core.EINTERNAL, err)
+	}
+	if !created {
+		// Tipped concurrently
+		tip, _, err = r.idempotentTip(ctx, rideReq.ID, input.Amount)
+		return tip, err
+	}
+	err = r.paymentsService.RecordTip(ctx, rideReq.ID, rideReq.RiderID, *rideReq.DriverID, tip.Amount, tip.Currency)
+	if err != nil {
+		return RideLineItem{}, core.Errorw(core.EINTERNAL, err)
+	}
+
+	event := RideTippedEvent{
+		RideID:   rideReq.ID,
+		RiderID:  rideReq.RiderID,
+		DriverID: *rideReq.DriverID,
+		Tip:      tip,
+	}
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return RideLineItem{}, core.Errorw(core.EINTERNAL, err)
+	}
+	r.pubsub.Publish(ctx, TopicRideTipped, eventBytes)
+	return tip, nil
+}
@@ -0,0 +1,17 @@
+package rides
+
+import (
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+)
+
+func (r *RideService) validateVehicleClass(input *CreateRideInput) error {
+	class, ok := vehicles.GetVehicleClass(vehicles.ClassOrDefault(input.VehicleClass))
+	if !ok {
+		return core.Errorf(core.EINVALID, "unknown vehicle class %v", input.VehicleClass)
+	}
+	if max(1, input.Seats) > class.Seats {
+		return core.Errorf(core.EINVALID, "%v vehicles have %v seats", class.Name, class.Seats)
+	}
+	return nil
+}
@@ -4,17 +4,27 @@ import (
 	"context"
 
 	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
 )
 
 const (
 	TopicUserLog = "user-log"
 )
 
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
 type User struct {
 	ID int64 `json:"id"`
 
 	Name      string `json:"name"`
 	Simulated bool   `json:"simulated"`
+	Role      string `json:"role"`
+	// Receipts and invoices are emailed to the address, if set
+	Email string `json:"email"`
 	// Firebase auth info
 	UserID string `json:"userId"`
 }
@@ -29,6 +39,18 @@ type UserRepository interface {
 	GetByID(context.Context, int64) (User, error)
 	GetByUserID(context.Context, string) (User, error)
 	GetSimulatedUsers(context.Context) ([]User, error)
+	GetByRole(ctx context.Context, role string) ([]User, error)
 	CreateOrUpdate(context.Context, *User) error
+	SetEmail(ctx context.Context, id int64, email string) error
 	Delete(context.Context, int64) error
 }
+
+type SetEmailInput struct {
+	Email string `json:"email"`
+}
+
+func (i *SetEmailInput) Validate() error {
+	return validation.ValidateStruct(i,
+		validation.Field(&i.Email, validation.Required, is.Email),
+	)
+}
@@ -26,6 +26,23 @@ func (s *UserService) GetUserByID(ctx context.Context, userID string) (User, err
 	return user, core.WrapErr(err)
 }
 
+// SetEmail sets the address the user's receipts and invoices are emailed to
+func (s *UserService) SetEmail(ctx context.Context, userID string, input *SetEmailInput) (User, error) {
+	if err := input.Validate(); err != nil {
+		return User{}, core.Errorf(core.EINVALID, "invalid input: %v", err)
+	}
+	user, err := s.userRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return User{}, core.Errorw(core.EINTERNAL, err)
+	}
+	err = s.userRepo.SetEmail(ctx, user.ID, input.Email)
+	if err != nil {
+		return User{}, core.Errorw(core.EINTERNAL, err)
+	}
+	user.Email = input.Email
+	return user, nil
+}
+
 func (s *UserService) GetSimulatedUsers(ctx context.Context) ([]User, error) {
 	users, err := s.userRepo.GetSimulatedUsers(ctx)
 	return users, core.WrapErr(err)
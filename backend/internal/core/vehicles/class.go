@@ -0,0 +1,52 @@
+package vehicles
+
+import "github.com/samber/lo"
+
+type VehicleClass string
+
+const (
+	VehicleClassEconomy    VehicleClass = "economy"
+	VehicleClassXL         VehicleClass = "xl"
+	VehicleClassPremium    VehicleClass = "premium"
+	VehicleClassAccessible VehicleClass = "accessible"
+)
+
+// DefaultVehicleClass is used for vehicles and rides without a class
+const DefaultVehicleClass = VehicleClassEconomy
+
+type VehicleClassInfo struct {
+	Class VehicleClass `json:"class"`
+	Name  string       `json:"name"`
+	// Number of passenger seats
+	Seats int `json:"seats"`
+	// Number of large suitcases that fit in the trunk
+	Luggage              int  `json:"luggage"`
+	WheelchairAccessible bool `json:"wheelchairAccessible"`
+}
+
+var vehicleClasses = []VehicleClassInfo{
+	{Class: VehicleClassEconomy, Name: "Economy", Seats: 4, Luggage: 2},
+	{Class: VehicleClassXL, Name: "XL", Seats: 6, Luggage: 4},
+	{Class: VehicleClassPremium, Name: "Premium", Seats: 4, Luggage: 3},
+	{Class: VehicleClassAccessible, Name: "Accessible", Seats: 4, Luggage: 2, WheelchairAccessible: true},
+}
+
+// GetVehicleClasses returns all vehicle classes
+func GetVehicleClasses() []VehicleClassInfo {
+	classes := make([]VehicleClassInfo, len(vehicleClasses))
+	copy(classes, vehicleClasses)
+	return classes
+}
+
+// GetVehicleClass returns the attributes of the class, false if the class does not exist
+func GetVehicleClass(class VehicleClass) (VehicleClassInfo, bool) {
+	return lo.Find(vehicleClasses, func(item VehicleClassInfo) bool { return item.Class == class })
+}
+
+// ClassOrDefault returns the class, or DefaultVehicleClass if it is empty
+func ClassOrDefault(class VehicleClass) VehicleClass {
+	if class == "" {
+		return DefaultVehicleClass
+	}
+	return class
+}
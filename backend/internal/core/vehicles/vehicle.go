@@ -18,6 +18,7 @@ type Vehicle struct {
 	RegistrationNumber  string
 	OwnerID             int64
 	Icon                string
+	Class               VehicleClass `json:"class"`
 
 	LastRecordedPosition *VehiclePosition `json:"lastRecordedPosition"`
 }
@@ -74,6 +74,10 @@ func (s *VehicleService) GetSimulatedVehicles(ctx context.Context) ([]Vehicle, e
 	return vehicleList, nil
 }
 
+func (s *VehicleService) GetVehicleClasses(ctx context.Context) []VehicleClassInfo {
+	return GetVehicleClasses()
+}
+
 type UpdateVehiclePositionInput struct {
 	Lat     float64 `json:"lat"`
 	Lng     float64 `json:"lng"`
@@ -0,0 +1,82 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+)
+
+// localBlobStore stores blobs as files in a directory, for development
+type localBlobStore struct {
+	dir string
+}
+
+func NewLocalBlobStore(dir string) (core.BlobStore, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blob dir: %w", err)
+	}
+	return &localBlobStore{dir: dir}, nil
+}
+
+func (l *localBlobStore) path(key string) (string, error) {
+	path := filepath.Join(l.dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, filepath.Clean(l.dir)+string(os.PathSeparator)) {
+		return "", core.Errorf(core.EINVALID, "invalid blob key %v", key)
+	}
+	return path, nil
+}
+
+// Put implements core.BlobStore.
+func (l *localBlobStore) Put(ctx context.Context, key string, data io.Reader) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, data)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Get implements core.BlobStore.
+func (l *localBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, core.Errorf(core.ENOTFOUND, "blob %v not found", key)
+	}
+	return file, err
+}
+
+// Delete implements core.BlobStore.
+func (l *localBlobStore) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -9,10 +9,16 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/bjarke-xyz/uber-clone-backend/internal/cfg"
 	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/drivers"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/organisations"
 	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/promotions"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/ratings"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/referrals"
 	"github.com/bjarke-xyz/uber-clone-backend/internal/core/rides"
 	"github.com/bjarke-xyz/uber-clone-backend/internal/core/users"
 	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
@@ -41,50 +47,161 @@ type api struct {
 	logger *slog.Logger
 	cfg    *cfg.Cfg
 
-	paymentsService *payments.PaymentsService
-	rideService     *rides.RideService
-	userService     *users.UserService
-	vehicleService  *vehicles.VehicleService
+	paymentsService     *payments.PaymentsService
+	promotionService    *promotions.PromotionService
+	organisationService *organisations.OrganisationService
+	rideService         *rides.RideService
+	rideMonitor         *rides.RideMonitor
+	driverService       *drivers.DriverService
+	ratingService       *ratings.RatingService
+	referralService     *referrals.ReferralService
+	userService         *users.UserService
+	vehicleService      *vehicles.VehicleService
 
 	userRepo    users.UserRepository
 	vehicleRepo vehicles.VehicleRepository
 	rideRepo    rides.RideRepository
 
 	pubSub core.Pubsub
+	locker core.Locker
+	mailer core.Mailer
 
 	broker *broker
 }
 
-func NewAPI(ctx context.Context, logger *slog.Logger, cfg *cfg.Cfg, pool *pgxpool.Pool, osrClient rides.RouteServiceClient, pubSub core.Pubsub) *api {
+func NewAPI(ctx context.Context, logger *slog.Logger, cfg *cfg.Cfg, pool *pgxpool.Pool, osrClient rides.RouteServiceClient, pubSub core.Pubsub, blobStore core.BlobStore, paymentProvider payments.PaymentProvider, mailer core.Mailer) *api {
 	userRepo := postgres.NewPostgresUser(pool)
 	vehicleRepo := postgres.NewPostgresVehicle(pool)
 	rideRepo := postgres.NewPostgresRide(pool)
-
-	paymentsService := payments.NewService()
-	rideService := rides.NewService(rideRepo, userRepo, osrClient, paymentsService)
+	driverRepo := postgres.NewPostgresDriver(pool)
+	documentRepo := postgres.NewPostgresDocument(pool)
+	ratingRepo := postgres.NewPostgresRating(pool)
+	ledgerRepo := postgres.NewPostgresLedger(pool)
+	fxRateRepo := postgres.NewPostgresFxRate(pool)
+	commissionRateRepo := postgres.NewPostgresCommissionRate(pool)
+	invoiceRepo := postgres.NewPostgresInvoice(pool)
+	paymentRepo := postgres.NewPostgresPayment(pool)
+	payoutRepo := postgres.NewPostgresPayout(pool)
+	surchargeZoneRepo := postgres.NewPostgresSurchargeZone(pool)
+	promotionRepo := postgres.NewPostgresPromotion(pool)
+	referralRepo := postgres.NewPostgresReferral(pool)
+	organisationRepo := postgres.NewPostgresOrganisation(pool)
+
+	paymentsService := payments.NewService(payments.Config{
+		Cancellation: payments.CancellationPolicy{
+			RiderGracePeriod:         cfg.RiderCancellationGracePeriod,
+			RiderLateFee:             cfg.RiderLateCancellationFee,
+			RiderNoShowFee:           cfg.RiderNoShowFee,
+			DriverMaxCancellations:   cfg.DriverMaxCancellations,
+			DriverCancellationWindow: cfg.DriverCancellationWindow,
+			DriverCooldown:           cfg.DriverCancellationCooldown,
+			DriverPenaltyFee:         cfg.DriverCancellationPenaltyFee,
+		},
+		PooledDiscount: cfg.PooledDiscount,
+		Tips: payments.TipPolicy{
+			Window: cfg.TipWindow,
+			Min:    cfg.TipMin,
+			Max:    cfg.TipMax,
+		},
+		Refunds: payments.RefundPolicy{
+			Limits: map[string]int{
+				users.RoleSupport: cfg.RefundLimitSupport,
+				users.RoleAdmin:   cfg.RefundLimitAdmin,
+			},
+		},
+		Commission: payments.CommissionPolicy{
+			DefaultRate: cfg.CommissionRate,
+		},
+		Payouts: payments.PayoutPolicy{
+			MinAmount: cfg.PayoutMinAmount,
+		},
+		Surcharges: payments.SurchargePolicy{
+			WaitingFeePerMinute: cfg.WaitingFeePerMinute,
+			ExtraMax:            cfg.RideExtraMax,
+			ExtraWindow:         cfg.RideExtraWindow,
+		},
+		AuthorisationBuffer: cfg.PaymentAuthorisationBuffer,
+		BaseCurrency:        cfg.BaseCurrency,
+	}, ledgerRepo, fxRateRepo, commissionRateRepo, invoiceRepo, paymentRepo, payoutRepo, surchargeZoneRepo, userRepo, paymentProvider, pubSub)
+	if cfg.FxRatesFile != "" {
+		err := paymentsService.LoadFxRatesFile(ctx, cfg.FxRatesFile)
+		if err != nil {
+			logger.Error("failed to load fx rates", "error", err, "file", cfg.FxRatesFile)
+		}
+	}
+	promotionService := promotions.NewService(promotionRepo, userRepo)
+	organisationService := organisations.NewService(organisationRepo, userRepo, pubSub)
+	rideConfig := rides.Config{
+		PickupGeofenceRadiusMeters: cfg.PickupGeofenceRadiusMeters,
+		FreeWaitingTime:            cfg.FreeWaitingTime,
+		RequestTTL:                 cfg.RideRequestTTL,
+		MaxStops:                   cfg.MaxRideStops,
+		Pooling: rides.PoolingConfig{
+			MaxDetour:         cfg.PoolMaxDetour,
+			SeatCapacity:      cfg.PoolSeatCapacity,
+			MatchWindow:       cfg.PoolMatchWindow,
+			MatchRadiusMeters: cfg.PoolMatchRadiusMeters,
+		},
+		Schedule: rides.ScheduleConfig{
+			MaxAhead:           cfg.ScheduledRideMaxAhead,
+			ReleaseLeadTime:    cfg.ScheduledRideReleaseLeadTime,
+			RiderReminderLead:  cfg.ScheduledRideRiderReminderLead,
+			DriverReminderLead: cfg.ScheduledRideDriverReminderLead,
+		},
+	}
+	rideService := rides.NewService(rideConfig, rideRepo, userRepo, vehicleRepo, driverRepo, osrClient, paymentsService, promotionService, organisationService, pubSub)
+	rideMonitor := rides.NewMonitor(rideRepo, vehicleRepo, osrClient, pubSub, rides.MonitorConfig{
+		DeviationThresholdMeters: cfg.DeviationThresholdMeters,
+		StationaryRadiusMeters:   cfg.StationaryRadiusMeters,
+		StationaryDuration:       cfg.StationaryDuration,
+		RerouteOnDeviation:       cfg.RerouteOnDeviation,
+	})
 	userService := users.NewService(userRepo, pubSub)
 	vehicleService := vehicles.NewService(vehicleRepo, userRepo, pubSub)
+	driverService := drivers.NewService(drivers.Config{
+		InactivityTimeout:          cfg.DriverInactivityTimeout,
+		DocumentExpiryReminderLead: cfg.DriverDocumentReminderLead,
+	}, driverRepo, documentRepo, userRepo, vehicleRepo, blobStore, pubSub)
+	ratingService := ratings.NewService(ratings.Config{
+		RatingWindow:          cfg.RatingWindow,
+		RollingWindow:         cfg.RatingRollingWindow,
+		DriverAlertThreshold:  cfg.DriverRatingAlertThreshold,
+		DriverAlertMinRatings: cfg.DriverRatingAlertMinRatings,
+	}, ratingRepo, rideRepo, userRepo, pubSub)
+	referralService := referrals.NewService(referrals.Config{
+		ReferrerReward: cfg.ReferralReferrerReward,
+		RefereeReward:  cfg.ReferralRefereeReward,
+	}, referralRepo, userRepo, paymentsService, pubSub)
 
 	broker := &broker{
 		Notifier:       make(chan []byte, 1),
-		newClients:     make(chan chan []byte),
+		UserNotifier:   make(chan userMessage, 1),
+		newClients:     make(chan brokerClient),
 		closingClients: make(chan chan []byte),
-		clients:        make(map[chan []byte]bool),
+		clients:        make(map[chan []byte]int64),
 	}
 	go broker.listen(logger)
 
 	return &api{
-		logger:          logger,
-		cfg:             cfg,
-		paymentsService: paymentsService,
-		rideService:     rideService,
-		userService:     userService,
-		vehicleService:  vehicleService,
-		userRepo:        userRepo,
-		vehicleRepo:     vehicleRepo,
-		rideRepo:        rideRepo,
-		pubSub:          pubSub,
-		broker:          broker,
+		logger:              logger,
+		cfg:                 cfg,
+		paymentsService:     paymentsService,
+		promotionService:    promotionService,
+		organisationService: organisationService,
+		rideService:         rideService,
+		rideMonitor:         rideMonitor,
+		driverService:       driverService,
+		ratingService:       ratingService,
+		referralService:     referralService,
+		userService:         userService,
+		vehicleService:      vehicleService,
+		userRepo:            userRepo,
+		vehicleRepo:         vehicleRepo,
+		rideRepo:            rideRepo,
+		pubSub:              pubSub,
+		locker:              postgres.NewAdvisoryLocker(pool),
+		mailer:              mailer,
+		broker:              broker,
 	}
 }
 
@@ -98,6 +215,31 @@ func (a *api) Server(port int) *http.Server {
 func (a *api) PubsubSubscribe(ctx context.Context) {
 	go a.pubsubSubscribeVehicle(ctx)
 	go a.pubsubSubscribeUser(ctx)
+	go a.pubsubSubscribeRides(ctx)
+	go a.pubsubSubscribeMonitor(ctx)
+	go a.pubsubSubscribeDrivers(ctx)
+	go a.pubsubSubscribeDocuments(ctx)
+	go a.pubsubSubscribeRatings(ctx)
+	go a.pubsubSubscribeDisputes(ctx)
+	go a.pubsubSubscribeReferrals(ctx)
+	go a.pubsubSubscribeReceipts(ctx)
+	go a.pubsubSubscribePayouts(ctx)
+	go a.pubsubSubscribeExtras(ctx)
+	go a.pubsubSubscribeOrganisations(ctx)
+}
+
+func (a *api) BackgroundJobs(ctx context.Context) {
+	go a.runJob(ctx, "migrate-directions", a.cfg.DirectionsMigrationInterval, a.migrateDirections)
+	go a.runJob(ctx, "expire-ride-requests", a.cfg.RideRequestExpiryInterval, a.rideService.ExpireRideRequests)
+	go a.runJob(ctx, "end-free-waiting", a.cfg.FreeWaitingCheckInterval, a.rideService.EndFreeWaiting)
+	go a.runJob(ctx, "process-scheduled-rides", a.cfg.ScheduledRidesInterval, a.rideService.ProcessScheduledRides)
+	go a.runJob(ctx, "match-pooled-rides", a.cfg.PoolMatchInterval, a.rideService.MatchPooledRides)
+	go a.runJob(ctx, "offline-inactive-drivers", a.cfg.DriverInactivityCheckInterval, a.driverService.OfflineInactiveDrivers)
+	go a.runJob(ctx, "process-driver-documents", a.cfg.DriverDocumentExpiryInterval, a.driverService.ProcessDocumentExpiry)
+	go a.runJob(ctx, "check-ledger", a.cfg.LedgerCheckInterval, a.paymentsService.CheckLedger)
+	go a.runJob(ctx, "issue-monthly-invoices", a.cfg.MonthlyInvoiceInterval, a.rideService.IssueMonthlyInvoices)
+	go a.runJob(ctx, "create-payout-batches", a.cfg.PayoutBatchInterval, a.paymentsService.CreatePayoutBatches)
+	go a.runJob(ctx, "reward-finished-referrals", a.cfg.ReferralSweepInterval, a.referralService.RewardFinishedReferrals)
 }
 
 func (a *api) routes() *chi.Mux {
@@ -112,6 +254,8 @@ func (a *api) routes() *chi.Mux {
 	r.Route("/v1/vehicles", func(r chi.Router) {
 		r.Use(a.firebaseJwtVerifier)
 		r.Get("/", a.requestWrapper(a.getVehiclesHandler))
+		r.Get("/classes", a.requestWrapper(a.getVehicleClassesHandler))
+		r.Get("/nearby", a.requestWrapper(a.handleGetNearbyVehicles))
 		r.Put("/{vehicleID}/position", a.requestWrapper(a.updateVehiclePositionHandler))
 	})
 	r.Get("/v1/sim/events", a.handleEvents)
@@ -123,21 +267,126 @@ func (a *api) routes() *chi.Mux {
 		r.Get("/mine", a.requestWrapper(a.handleGetMyRideRequests))
 		r.Get("/available", a.requestWrapper(a.handleGetAvailableRideRequests))
 		r.Post("/", a.requestWrapper(a.handleCreateRideRequest))
+		r.Post("/quote", a.requestWrapper(a.handleQuoteRide))
 		r.Put("/{rideRequestID}/claim", a.requestWrapper(a.handleClaimRideRequest))
 		r.Post("/{rideRequestID}/directions", a.requestWrapper(a.handleGetRideDirections))
+		r.Put("/{rideRequestID}/start", a.requestWrapper(a.handleStartRide))
+		r.Put("/{rideRequestID}/stops", a.requestWrapper(a.handleUpdateRideStops))
+		r.Put("/{rideRequestID}/stops/{stopID}/complete", a.requestWrapper(a.handleCompleteStop))
 		r.Put("/{rideRequestID}/finish", a.requestWrapper(a.handleFinishRide))
+		r.Put("/{rideRequestID}/cancel", a.requestWrapper(a.handleCancelRide))
+		r.Post("/{rideRequestID}/rating", a.requestWrapper(a.handleRateRide))
+		r.Get("/{rideRequestID}/ratings", a.requestWrapper(a.handleGetRideRatings))
+		r.Put("/{rideRequestID}/tip", a.requestWrapper(a.handleTipRide))
+		r.Get("/{rideRequestID}/receipt", a.requestWrapper(a.handleGetRideReceipt))
+		r.Post("/{rideRequestID}/disputes", a.requestWrapper(a.handleOpenDispute))
+		r.Get("/{rideRequestID}/extras", a.requestWrapper(a.handleGetRideExtras))
+		r.Post("/{rideRequestID}/extras", a.requestWrapper(a.handleLogExtra))
 	})
 	r.Get("/v1/sim-rides", a.requestWrapper(a.handleGetSimulatedRides))
 
 	r.Route("/v1/me", func(r chi.Router) {
 		r.Use(a.firebaseJwtVerifier)
 		r.Get("/user", a.requestWrapper(a.handleGetMyUser))
+		r.Post("/signup", a.requestWrapper(a.handleSignup))
+		r.Put("/email", a.requestWrapper(a.handleSetMyEmail))
+		r.Get("/billing-profile", a.requestWrapper(a.handleGetMyBillingProfile))
+		r.Put("/billing-profile", a.requestWrapper(a.handleSetMyBillingProfile))
+		r.Get("/invoices", a.requestWrapper(a.handleGetMyInvoices))
+		r.Get("/invoices/{month}", a.requestWrapper(a.handleGetMyInvoice))
+		r.Get("/referrals", a.requestWrapper(a.handleGetMyReferrals))
+		r.Get("/organisations", a.requestWrapper(a.handleGetMyOrganisations))
+		r.Get("/organisation-invites/{inviteID}", a.requestWrapper(a.handleGetOrganisationInvite))
+		r.Put("/organisation-invites/{inviteID}/accept", a.requestWrapper(a.handleAcceptOrganisationInvite))
+		r.Get("/events", a.handleMyEvents)
+		r.Get("/availability", a.requestWrapper(a.handleGetMyAvailability))
+		r.Put("/online", a.requestWrapper(a.handleGoOnline))
+		r.Put("/offline", a.requestWrapper(a.handleGoOffline))
+		r.Get("/shifts", a.requestWrapper(a.handleGetMyShifts))
+		r.Get("/documents", a.requestWrapper(a.handleGetMyDocuments))
+		r.Post("/documents", a.requestWrapper(a.handleUploadDocument))
+		r.Get("/ratings", a.requestWrapper(a.handleGetMyRatings))
+		r.Get("/earnings", a.requestWrapper(a.handleGetMyEarnings))
+		r.Get("/payout-account", a.requestWrapper(a.handleGetMyPayoutAccount))
+		r.Put("/payout-account", a.requestWrapper(a.handleSetMyPayoutAccount))
+		r.Get("/payouts", a.requestWrapper(a.handleGetMyPayouts))
+		r.Get("/wallet", a.requestWrapper(a.handleGetMyWallet))
+		r.Get("/wallet/transactions", a.requestWrapper(a.handleGetMyWalletTransactions))
+		r.Get("/payment-method", a.requestWrapper(a.handleGetMyPaymentMethod))
+		r.Put("/payment-method", a.requestWrapper(a.handleSetMyPaymentMethod))
 		r.Post("/log", a.requestWrapper(a.handlePostUserLog))
 	})
+
+	r.Route("/v1/organisations", func(r chi.Router) {
+		r.Use(a.firebaseJwtVerifier)
+		r.Post("/", a.requestWrapper(a.handleCreateOrganisation))
+		r.Get("/{organisationID}", a.requestWrapper(a.handleGetOrganisation))
+		r.Put("/{organisationID}", a.requestWrapper(a.handleUpdateOrganisation))
+		r.Get("/{organisationID}/members", a.requestWrapper(a.handleGetOrganisationMembers))
+		r.Delete("/{organisationID}/members/{userID}", a.requestWrapper(a.handleRemoveOrganisationMember))
+		r.Get("/{organisationID}/invites", a.requestWrapper(a.handleGetOrganisationInvites))
+		r.Post("/{organisationID}/invites", a.requestWrapper(a.handleInviteOrganisationMember))
+		r.Delete("/{organisationID}/invites/{inviteID}", a.requestWrapper(a.handleRevokeOrganisationInvite))
+		r.Get("/{organisationID}/policy", a.requestWrapper(a.handleGetOrganisationPolicy))
+		r.Put("/{organisationID}/policy", a.requestWrapper(a.handleSetOrganisationPolicy))
+		r.Get("/{organisationID}/dashboard", a.requestWrapper(a.handleGetOrganisationDashboard))
+	})
+
+	r.Route("/v1/users", func(r chi.Router) {
+		r.Use(a.firebaseJwtVerifier)
+		r.Get("/{userID}/profile", a.requestWrapper(a.handleGetUserProfile))
+	})
 	r.Get("/v1/sim-users", a.requestWrapper(a.handleGetSimUsers))
 
+	r.Route("/v1/ops", func(r chi.Router) {
+		r.Use(a.firebaseJwtVerifier)
+		r.Use(a.requireRole(users.RoleSupport, users.RoleAdmin))
+		r.Get("/alerts", a.requestWrapper(a.handleGetRecentAlerts))
+	})
+
+	r.Route("/v1/support", func(r chi.Router) {
+		r.Use(a.firebaseJwtVerifier)
+		r.Use(a.requireRole(users.RoleSupport, users.RoleAdmin))
+		r.Get("/rides/{rideRequestID}/refunds", a.requestWrapper(a.handleGetRefunds))
+		r.Post("/rides/{rideRequestID}/refunds", a.requestWrapper(a.handleIssueRefund))
+		r.Get("/disputes", a.requestWrapper(a.handleGetDisputes))
+		r.Get("/disputes/{disputeID}", a.requestWrapper(a.handleGetDispute))
+		r.Put("/disputes/{disputeID}/resolve", a.requestWrapper(a.handleResolveDispute))
+		r.Get("/extras", a.requestWrapper(a.handleGetExtras))
+		r.Put("/extras/{extraID}/review", a.requestWrapper(a.handleReviewExtra))
+	})
+
+	r.Route("/v1/admin", func(r chi.Router) {
+		r.Use(a.firebaseJwtVerifier)
+		r.Use(a.requireRole(users.RoleAdmin))
+		r.Get("/documents", a.requestWrapper(a.handleGetDocuments))
+		r.Get("/documents/{documentID}/file", a.requestWrapper(a.handleGetDocumentFile))
+		r.Put("/documents/{documentID}/review", a.requestWrapper(a.handleReviewDocument))
+		r.Get("/ledger/check", a.requestWrapper(a.handleCheckLedger))
+		r.Get("/ledger/report", a.requestWrapper(a.handleGetPlatformReport))
+		r.Get("/fx-rates", a.requestWrapper(a.handleGetFxRates))
+		r.Put("/fx-rates", a.requestWrapper(a.handleSetFxRates))
+		r.Get("/commission-rates", a.requestWrapper(a.handleGetCommissionRates))
+		r.Put("/commission-rates", a.requestWrapper(a.handleSetCommissionRate))
+		r.Delete("/commission-rates", a.requestWrapper(a.handleDeleteCommissionRate))
+		r.Get("/payouts/batches", a.requestWrapper(a.handleGetPayoutBatches))
+		r.Get("/payouts/batches/{batchID}", a.requestWrapper(a.handleGetPayoutBatch))
+		r.Get("/payouts/batches/{batchID}/export", a.requestWrapper(a.handleExportPayoutBatch))
+		r.Put("/payouts/batches/{batchID}/results", a.requestWrapper(a.handleSettlePayouts))
+		r.Get("/surcharge-zones", a.requestWrapper(a.handleGetSurchargeZones))
+		r.Post("/surcharge-zones", a.requestWrapper(a.handleCreateSurchargeZone))
+		r.Put("/surcharge-zones/{zoneID}", a.requestWrapper(a.handleUpdateSurchargeZone))
+		r.Delete("/surcharge-zones/{zoneID}", a.requestWrapper(a.handleDeleteSurchargeZone))
+		r.Get("/promotions", a.requestWrapper(a.handleGetPromotions))
+		r.Post("/promotions", a.requestWrapper(a.handleCreatePromotion))
+		r.Put("/promotions/{promotionID}/deactivate", a.requestWrapper(a.handleDeactivatePromotion))
+	})
+
 	r.Route("/v1/payments", func(r chi.Router) {
 		r.Get("/currencies", a.requestWrapper(a.handleGetCurrencies))
+		r.Get("/cities", a.requestWrapper(a.handleGetCities))
+		// Called by the payment provider, authenticated by the signature of the request
+		r.Post("/webhook", a.requestWrapper(a.handlePaymentWebhook))
 	})
 
 	return r
@@ -224,19 +473,45 @@ func queryParamFloat(r *http.Request, key string) (float64, bool, error) {
 	return valueFloat, true, nil
 }
 
+func queryParamTime(r *http.Request, key string) (time.Time, bool, error) {
+	valueStr := r.URL.Query().Get(key)
+	if valueStr == "" {
+		return time.Time{}, false, nil
+	}
+	valueTime, err := time.Parse(time.RFC3339, valueStr)
+	if err != nil {
+		return time.Time{}, true, core.Errorw(core.EINVALID, err)
+	}
+	return valueTime, true, nil
+}
+
 type broker struct {
 
 	// Events are pushed to this channel by the main events-gathering routine
 	Notifier chan []byte
 
+	// Events for a single user are pushed to this channel
+	UserNotifier chan userMessage
+
 	// New client connections
-	newClients chan chan []byte
+	newClients chan brokerClient
 
 	// Closed client connections
 	closingClients chan chan []byte
 
-	// Client connections registry
-	clients map[chan []byte]bool
+	// Client connections registry, mapped to the id of the user the client belongs to.
+	// Anonymous clients are mapped to 0
+	clients map[chan []byte]int64
+}
+
+type brokerClient struct {
+	messages chan []byte
+	userID   int64
+}
+
+type userMessage struct {
+	userID int64
+	msg    []byte
 }
 
 func (broker *broker) listen(logger *slog.Logger) {
@@ -246,7 +521,7 @@ func (broker *broker) listen(logger *slog.Logger) {
 
 			// A new client has connected.
 			// Register their message channel
-			broker.clients[s] = true
+			broker.clients[s.messages] = s.userID
 			logger.Info("Client added", "clients", len(broker.clients))
 			sseClientGauge.Inc()
 		case s := <-broker.closingClients:
@@ -259,9 +534,19 @@ func (broker *broker) listen(logger *slog.Logger) {
 		case event := <-broker.Notifier:
 
 			// We got a new event from the outside!
-			// Send event to all connected clients
-			for clientMessageChan := range broker.clients {
-				clientMessageChan <- event
+			// Send event to all connected anonymous clients
+			for clientMessageChan, userID := range broker.clients {
+				if userID == 0 {
+					clientMessageChan <- event
+				}
+			}
+		case event := <-broker.UserNotifier:
+
+			// Send event to the clients of the user
+			for clientMessageChan, userID := range broker.clients {
+				if userID == event.userID {
+					clientMessageChan <- event.msg
+				}
 			}
 		}
 	}
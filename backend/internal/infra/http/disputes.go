@@ -0,0 +1,167 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/rides"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/users"
+)
+
+func (a *api) handleIssueRefund(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	rideRequestID, err := urlParamInt(r, "rideRequestID")
+	if err != nil {
+		return err
+	}
+	input := &rides.IssueRefundInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	refund, err := a.rideService.IssueRefund(ctx, token.Subject, rideRequestID, input)
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusCreated, refund)
+}
+
+func (a *api) handleGetRefunds(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	rideRequestID, err := urlParamInt(r, "rideRequestID")
+	if err != nil {
+		return err
+	}
+	refunds, err := a.rideService.GetRefunds(ctx, rideRequestID)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, refunds)
+}
+
+func (a *api) handleOpenDispute(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	rideRequestID, err := urlParamInt(r, "rideRequestID")
+	if err != nil {
+		return err
+	}
+	input := &rides.OpenDisputeInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	dispute, err := a.rideService.OpenDispute(ctx, token.Subject, rideRequestID, input)
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusCreated, dispute)
+}
+
+// handleGetDisputes returns the support queue of disputes. The state query parameter defaults to open disputes
+func (a *api) handleGetDisputes(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	state := rides.DisputeStateOpen
+	if stateStr := r.URL.Query().Get("state"); stateStr != "" {
+		stateInt, err := strconv.Atoi(stateStr)
+		if err != nil {
+			return core.Errorw(core.EINVALID, err)
+		}
+		state = rides.DisputeState(stateInt)
+	}
+	disputes, err := a.rideService.GetDisputes(ctx, state)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, disputes)
+}
+
+func (a *api) handleGetDispute(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	disputeID, err := urlParamInt(r, "disputeID")
+	if err != nil {
+		return err
+	}
+	details, err := a.rideService.GetDisputeDetails(ctx, disputeID)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, details)
+}
+
+func (a *api) handleResolveDispute(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	disputeID, err := urlParamInt(r, "disputeID")
+	if err != nil {
+		return err
+	}
+	input := &rides.ResolveDisputeInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	dispute, err := a.rideService.ResolveDispute(ctx, token.Subject, disputeID, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, dispute)
+}
+
+func (a *api) pubsubSubscribeDisputes(ctx context.Context) {
+	go func() {
+		ch := a.pubSub.Subscribe(rides.TopicRideRefunded)
+		for {
+			select {
+			case msg := <-ch:
+				event := rides.RideRefundedEvent{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal RideRefundedEvent", "error", err)
+					continue
+				}
+				err = a.emitUserEvent(event.RiderID, rides.TopicRideRefunded, event)
+				if err != nil {
+					a.logger.Error("error emitting ride refunded event", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		ch := a.pubSub.Subscribe(rides.TopicDisputeOpened)
+		for {
+			select {
+			case msg := <-ch:
+				dispute := rides.FareDispute{}
+				err := json.Unmarshal(msg, &dispute)
+				if err != nil {
+					a.logger.Error("failed to unmarshal FareDispute", "error", err)
+					continue
+				}
+				err = a.emitRoleEvent(ctx, rides.TopicDisputeOpened, dispute, users.RoleSupport, users.RoleAdmin)
+				if err != nil {
+					a.logger.Error("error emitting dispute opened event", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		ch := a.pubSub.Subscribe(rides.TopicDisputeResolved)
+		for {
+			select {
+			case msg := <-ch:
+				dispute := rides.FareDispute{}
+				err := json.Unmarshal(msg, &dispute)
+				if err != nil {
+					a.logger.Error("failed to unmarshal FareDispute", "error", err)
+					continue
+				}
+				err = a.emitUserEvent(dispute.RiderID, rides.TopicDisputeResolved, dispute)
+				if err != nil {
+					a.logger.Error("error emitting dispute resolved event", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,130 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/drivers"
+)
+
+// Maximum size of an uploaded driver document
+const maxDocumentBytes = 10 << 20
+
+func (a *api) handleGetMyDocuments(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	verification, err := a.driverService.GetVerification(ctx, token.Subject)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, verification)
+}
+
+// handleUploadDocument accepts a multipart form with the fields type, expiresAt (RFC 3339) and file
+func (a *api) handleUploadDocument(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	r.Body = http.MaxBytesReader(w, r.Body, maxDocumentBytes)
+	if err := r.ParseMultipartForm(maxDocumentBytes); err != nil {
+		return core.Errorf(core.EINVALID, "failed to parse form: %v", err)
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return core.Errorf(core.EINVALID, "file is required: %v", err)
+	}
+	defer file.Close()
+	input := &drivers.UploadDocumentInput{
+		Type:        drivers.DocumentType(r.FormValue("type")),
+		FileName:    header.Filename,
+		ContentType: header.Header.Get("Content-Type"),
+	}
+	if expiresAt := r.FormValue("expiresAt"); expiresAt != "" {
+		input.ExpiresAt, err = time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			return core.Errorw(core.EINVALID, err)
+		}
+	}
+	document, err := a.driverService.UploadDocument(ctx, token.Subject, input, file)
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusCreated, document)
+}
+
+func (a *api) handleGetDocuments(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	state := drivers.DocumentStatePending
+	if stateStr := r.URL.Query().Get("state"); stateStr != "" {
+		stateInt, err := strconv.Atoi(stateStr)
+		if err != nil {
+			return core.Errorw(core.EINVALID, err)
+		}
+		state = drivers.DocumentState(stateInt)
+	}
+	documents, err := a.driverService.GetDocumentsByState(ctx, state)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, documents)
+}
+
+func (a *api) handleGetDocumentFile(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	documentID, err := urlParamInt(r, "documentID")
+	if err != nil {
+		return err
+	}
+	document, file, err := a.driverService.GetDocumentFile(ctx, documentID)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w.Header().Set("Content-Type", document.ContentType)
+	w.Header().Set("Content-Disposition", "inline; filename="+strconv.Quote(document.FileName))
+	_, err = io.Copy(w, file)
+	return err
+}
+
+func (a *api) handleReviewDocument(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	documentID, err := urlParamInt(r, "documentID")
+	if err != nil {
+		return err
+	}
+	input := &drivers.ReviewDocumentInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	document, err := a.driverService.ReviewDocument(ctx, token.Subject, documentID, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, document)
+}
+
+func (a *api) pubsubSubscribeDocuments(ctx context.Context) {
+	topics := []string{drivers.TopicDocumentReviewed, drivers.TopicDocumentExpiryReminder, drivers.TopicDocumentExpired}
+	for _, topic := range topics {
+		go func(topic string) {
+			ch := a.pubSub.Subscribe(topic)
+			for {
+				select {
+				case msg := <-ch:
+					event := drivers.DocumentEvent{}
+					err := json.Unmarshal(msg, &event)
+					if err != nil {
+						a.logger.Error("failed to unmarshal DocumentEvent", "error", err, "topic", topic)
+						continue
+					}
+					err = a.emitUserEvent(event.DriverID, topic, event)
+					if err != nil {
+						a.logger.Error("error emitting document event", "error", err, "topic", topic)
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(topic)
+	}
+}
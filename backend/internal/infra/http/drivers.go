@@ -0,0 +1,103 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/drivers"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+)
+
+// Radius used for nearby vehicles when the request does not specify one
+const defaultNearbyRadiusMeters = 3000
+
+func (a *api) handleGetMyAvailability(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	availability, err := a.driverService.GetAvailability(ctx, token.Subject)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, availability)
+}
+
+func (a *api) handleGoOnline(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	input := &drivers.GoOnlineInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	availability, err := a.driverService.GoOnline(ctx, token.Subject, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, availability)
+}
+
+func (a *api) handleGoOffline(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	err := a.driverService.GoOffline(ctx, token.Subject)
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusNoContent, nil)
+}
+
+func (a *api) handleGetMyShifts(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	shifts, err := a.driverService.GetShifts(ctx, token.Subject)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, shifts)
+}
+
+func (a *api) handleGetNearbyVehicles(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	lat, latOk, err := queryParamFloat(r, "lat")
+	if err != nil {
+		return err
+	}
+	lng, lngOk, err := queryParamFloat(r, "lng")
+	if err != nil {
+		return err
+	}
+	if !latOk || !lngOk {
+		return core.Errorf(core.EINVALID, "lat and lng are required")
+	}
+	radius, radiusOk, err := queryParamFloat(r, "radius")
+	if err != nil {
+		return err
+	}
+	if !radiusOk {
+		radius = defaultNearbyRadiusMeters
+	}
+	vehicleList, err := a.driverService.GetNearbyVehicles(ctx, geo.Point{Lat: lat, Lng: lng}, radius)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, vehicleList)
+}
+
+func (a *api) pubsubSubscribeDrivers(ctx context.Context) {
+	go func() {
+		ch := a.pubSub.Subscribe(drivers.TopicDriverAvailability)
+		for {
+			select {
+			case msg := <-ch:
+				event := drivers.DriverAvailability{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal DriverAvailability", "error", err)
+					continue
+				}
+				err = a.emitUserEvent(event.DriverID, drivers.TopicDriverAvailability, event)
+				if err != nil {
+					a.logger.Error("error emitting driver availability event", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,25 @@
+package http
+
+import (
+	"context"
+	"time"
+)
+
+// runJob runs job every interval on one instance at a time, until ctx is cancelled
+func (a *api) runJob(ctx context.Context, name string, interval time.Duration, job func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ran, err := a.locker.TryWithLock(ctx, name, job)
+			if err != nil {
+				a.logger.Error("job failed", "job", name, "error", err)
+			} else if !ran {
+				a.logger.Debug("job is running on another instance", "job", name)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
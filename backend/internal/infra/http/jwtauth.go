@@ -3,6 +3,7 @@ package http
 import (
 	"context"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/bjarke-xyz/auth/pkg/jwt"
@@ -40,6 +41,25 @@ func (a *api) firebaseJwtVerifier(next http.Handler) http.Handler {
 	})
 }
 
+// requireRole only lets users with one of the roles through. Must be used after firebaseJwtVerifier
+func (a *api) requireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, _ := TokenFromContext(r.Context())
+			user, err := a.userRepo.GetByUserID(r.Context(), token.Subject)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if !slices.Contains(roles, user.Role) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // contextKey is a value for use with context.WithValue. It's used as
 // a pointer so it fits in an interface{} without allocation. This technique
 // for defining context keys was copied from Go 1.7's new use of context in net/http.
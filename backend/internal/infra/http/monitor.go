@@ -0,0 +1,84 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/rides"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/users"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+)
+
+func (a *api) handleGetRecentAlerts(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	alerts, err := a.rideMonitor.GetRecentAlerts(ctx)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, alerts)
+}
+
+// emitRideAlertEvent sends the alert to support and admins, who are the only ones allowed to see alerts
+func (a *api) emitRideAlertEvent(ctx context.Context, alert rides.RideAlert) {
+	err := a.emitRoleEvent(ctx, alert.Type, alert, users.RoleSupport, users.RoleAdmin)
+	if err != nil {
+		a.logger.Error("error emitting ride alert event", "error", err, "rideId", alert.RideID)
+	}
+}
+
+func (a *api) rerouteRide(ctx context.Context, alert rides.RideAlert) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	err := a.rideMonitor.Reroute(ctx, alert)
+	if err != nil {
+		a.logger.Error("failed to reroute ride", "error", err, "rideId", alert.RideID)
+	}
+}
+
+func (a *api) pubsubSubscribeMonitor(ctx context.Context) {
+	go func() {
+		ch := a.pubSub.Subscribe(vehicles.TopicPositionUpdate)
+		for {
+			select {
+			case msg := <-ch:
+				event := vehicles.VehiclePosition{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal VehiclePosition", "error", err)
+					continue
+				}
+				err = a.rideMonitor.HandlePositionUpdate(ctx, event)
+				if err != nil {
+					a.logger.Error("failed to monitor position update", "error", err, "vehicleId", event.VehicleID)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		deviationCh := a.pubSub.Subscribe(rides.TopicRideDeviation)
+		stationaryCh := a.pubSub.Subscribe(rides.TopicVehicleStationary)
+		for {
+			var msg []byte
+			select {
+			case msg = <-deviationCh:
+			case msg = <-stationaryCh:
+			case <-ctx.Done():
+				return
+			}
+			alert := rides.RideAlert{}
+			err := json.Unmarshal(msg, &alert)
+			if err != nil {
+				a.logger.Error("failed to unmarshal RideAlert", "error", err)
+				continue
+			}
+			a.logger.Warn("ride alert", "type", alert.Type, "rideId", alert.RideID, "message", alert.Message)
+			a.emitRideAlertEvent(ctx, alert)
+			if alert.Type == rides.TopicRideDeviation {
+				go a.rerouteRide(ctx, alert)
+			}
+		}
+	}()
+}
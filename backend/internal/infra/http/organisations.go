@@ -0,0 +1,266 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/organisations"
+)
+
+// Period the organisation dashboard covers by default
+const defaultOrganisationPeriod = 30 * 24 * time.Hour
+
+func (a *api) handleCreateOrganisation(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	input := &organisations.OrganisationInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	organisation, err := a.organisationService.CreateOrganisation(ctx, token.Subject, input)
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusCreated, organisation)
+}
+
+func (a *api) handleGetMyOrganisations(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	organisationList, err := a.organisationService.GetMyOrganisations(ctx, token.Subject)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, organisationList)
+}
+
+func (a *api) handleGetOrganisation(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	organisationID, err := urlParamInt(r, "organisationID")
+	if err != nil {
+		return err
+	}
+	organisation, err := a.organisationService.GetOrganisation(ctx, token.Subject, organisationID)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, organisation)
+}
+
+func (a *api) handleUpdateOrganisation(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	organisationID, err := urlParamInt(r, "organisationID")
+	if err != nil {
+		return err
+	}
+	input := &organisations.OrganisationInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	organisation, err := a.organisationService.UpdateOrganisation(ctx, token.Subject, organisationID, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, organisation)
+}
+
+func (a *api) handleGetOrganisationMembers(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	organisationID, err := urlParamInt(r, "organisationID")
+	if err != nil {
+		return err
+	}
+	members, err := a.organisationService.GetMembers(ctx, token.Subject, organisationID)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, members)
+}
+
+func (a *api) handleRemoveOrganisationMember(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	organisationID, err := urlParamInt(r, "organisationID")
+	if err != nil {
+		return err
+	}
+	memberUserID, err := urlParamInt(r, "userID")
+	if err != nil {
+		return err
+	}
+	err = a.organisationService.RemoveMember(ctx, token.Subject, organisationID, memberUserID)
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusNoContent, nil)
+}
+
+func (a *api) handleGetOrganisationInvites(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	organisationID, err := urlParamInt(r, "organisationID")
+	if err != nil {
+		return err
+	}
+	invites, err := a.organisationService.GetInvites(ctx, token.Subject, organisationID)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, invites)
+}
+
+func (a *api) handleInviteOrganisationMember(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	organisationID, err := urlParamInt(r, "organisationID")
+	if err != nil {
+		return err
+	}
+	input := &organisations.InviteInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	invite, err := a.organisationService.InviteMember(ctx, token.Subject, organisationID, input)
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusCreated, invite)
+}
+
+func (a *api) handleRevokeOrganisationInvite(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	organisationID, err := urlParamInt(r, "organisationID")
+	if err != nil {
+		return err
+	}
+	inviteID, err := urlParamInt(r, "inviteID")
+	if err != nil {
+		return err
+	}
+	err = a.organisationService.RevokeInvite(ctx, token.Subject, organisationID, inviteID)
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusNoContent, nil)
+}
+
+func (a *api) handleGetOrganisationPolicy(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	organisationID, err := urlParamInt(r, "organisationID")
+	if err != nil {
+		return err
+	}
+	policy, err := a.organisationService.GetPolicy(ctx, token.Subject, organisationID)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, policy)
+}
+
+func (a *api) handleSetOrganisationPolicy(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	organisationID, err := urlParamInt(r, "organisationID")
+	if err != nil {
+		return err
+	}
+	input := &organisations.RidePolicyInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	policy, err := a.organisationService.SetPolicy(ctx, token.Subject, organisationID, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, policy)
+}
+
+// handleGetOrganisationDashboard returns the rides billed to the organisation created between the from and to query parameters,
+// by default the last 30 days, and the spend per member
+func (a *api) handleGetOrganisationDashboard(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	organisationID, err := urlParamInt(r, "organisationID")
+	if err != nil {
+		return err
+	}
+	to, toOk, err := queryParamTime(r, "to")
+	if err != nil {
+		return err
+	}
+	if !toOk {
+		to = time.Now().UTC()
+	}
+	from, fromOk, err := queryParamTime(r, "from")
+	if err != nil {
+		return err
+	}
+	if !fromOk {
+		from = to.Add(-defaultOrganisationPeriod)
+	}
+	dashboard, err := a.rideService.GetOrganisationDashboard(ctx, token.Subject, organisationID, from, to)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, dashboard)
+}
+
+// handleGetOrganisationInvite returns the invite the token query parameter was mailed with
+func (a *api) handleGetOrganisationInvite(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	inviteID, err := urlParamInt(r, "inviteID")
+	if err != nil {
+		return err
+	}
+	invite, err := a.organisationService.GetInvite(ctx, inviteID, r.URL.Query().Get("token"))
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, invite)
+}
+
+func (a *api) handleAcceptOrganisationInvite(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	inviteID, err := urlParamInt(r, "inviteID")
+	if err != nil {
+		return err
+	}
+	input := &organisations.AcceptInviteInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	member, err := a.organisationService.AcceptInvite(ctx, token.Subject, inviteID, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, member)
+}
+
+// mailOrganisationInvite emails the invite and the token it is accepted with to the invited address
+func (a *api) mailOrganisationInvite(ctx context.Context, event organisations.InviteCreatedEvent) error {
+	return a.mailer.Send(ctx, core.Mail{
+		To:      event.Invite.Email,
+		Subject: fmt.Sprintf("You have been invited to %v", event.OrganisationName),
+		Text: fmt.Sprintf("%v has invited you to bill your rides to %v. Accept invite %v in the app with the code %v. The code can be used once.",
+			event.InvitedByName, event.OrganisationName, event.Invite.ID, event.Token),
+	})
+}
+
+func (a *api) pubsubSubscribeOrganisations(ctx context.Context) {
+	go func() {
+		ch := a.pubSub.Subscribe(organisations.TopicOrganisationInviteCreated)
+		for {
+			select {
+			case msg := <-ch:
+				event := organisations.InviteCreatedEvent{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal InviteCreatedEvent", "error", err)
+					continue
+				}
+				err = a.mailOrganisationInvite(ctx, event)
+				if err != nil {
+					a.logger.Error("failed to mail organisation invite", "error", err, "inviteId", event.Invite.ID)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
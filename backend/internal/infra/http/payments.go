@@ -2,10 +2,115 @@ package http
 
 import (
 	"context"
+	"io"
 	"net/http"
+	"strconv"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
 )
 
+// Maximum size of a payment provider webhook request
+const maxWebhookSize = 1 << 16
+
 func (a *api) handleGetCurrencies(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	currencies := a.paymentsService.GetCurrencies()
 	return a.respond(w, r, currencies)
 }
+
+func (a *api) handleGetMyWallet(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	wallet, err := a.paymentsService.GetWallet(ctx, token.Subject)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, wallet)
+}
+
+// handleGetMyWalletTransactions returns a page of wallet transactions. The before query parameter is the entry ID to page from
+func (a *api) handleGetMyWalletTransactions(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	var before int64
+	if beforeStr := r.URL.Query().Get("before"); beforeStr != "" {
+		var err error
+		before, err = strconv.ParseInt(beforeStr, 10, 64)
+		if err != nil {
+			return core.Errorw(core.EINVALID, err)
+		}
+	}
+	transactions, err := a.paymentsService.GetWalletTransactions(ctx, token.Subject, before)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, transactions)
+}
+
+func (a *api) handleCheckLedger(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	err := a.paymentsService.CheckLedger(ctx)
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusNoContent, nil)
+}
+
+func (a *api) handleGetPlatformReport(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	report, err := a.paymentsService.GetPlatformReport(ctx)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, report)
+}
+
+func (a *api) handleGetFxRates(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	rates, err := a.paymentsService.GetFxRates(ctx)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, rates)
+}
+
+func (a *api) handleSetFxRates(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	input := &payments.SetFxRatesInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	rates, err := a.paymentsService.SetFxRates(ctx, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, rates)
+}
+
+func (a *api) handleGetMyPaymentMethod(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	customer, err := a.paymentsService.GetPaymentMethod(ctx, token.Subject)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, customer)
+}
+
+func (a *api) handleSetMyPaymentMethod(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	input := &payments.SetPaymentMethodInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	customer, err := a.paymentsService.SetPaymentMethod(ctx, token.Subject, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, customer)
+}
+
+func (a *api) handlePaymentWebhook(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookSize))
+	if err != nil {
+		return core.Errorw(core.EINVALID, err)
+	}
+	err = a.paymentsService.HandleWebhook(ctx, payload, r.Header.Get("Stripe-Signature"))
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusNoContent, nil)
+}
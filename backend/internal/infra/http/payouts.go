@@ -0,0 +1,184 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/infra/render"
+)
+
+// Formats of payout batch exports, chosen with the format query parameter
+const (
+	exportFormatSEPA = "sepa"
+	exportFormatCSV  = "csv"
+)
+
+func (a *api) handleGetCommissionRates(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	rates, err := a.paymentsService.GetCommissionRates(ctx)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, rates)
+}
+
+func (a *api) handleSetCommissionRate(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	input := &payments.SetCommissionRateInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	rates, err := a.paymentsService.SetCommissionRate(ctx, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, rates)
+}
+
+// handleDeleteCommissionRate deletes the rate of the cityId and vehicleClass query parameters, empty for all cities or classes
+func (a *api) handleDeleteCommissionRate(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	rates, err := a.paymentsService.DeleteCommissionRate(ctx, query.Get("cityId"), vehicles.VehicleClass(query.Get("vehicleClass")))
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, rates)
+}
+
+func (a *api) handleGetMyPayoutAccount(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	account, err := a.paymentsService.GetMyPayoutAccount(ctx, token.Subject)
+	if err != nil {
+		return err
+	}
+	if account == nil {
+		return core.Errorf(core.ENOTFOUND, "no payout account")
+	}
+	return a.respond(w, r, account)
+}
+
+func (a *api) handleSetMyPayoutAccount(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	input := &payments.SetPayoutAccountInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	account, err := a.paymentsService.SetPayoutAccount(ctx, token.Subject, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, account)
+}
+
+func (a *api) handleGetMyPayouts(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	payouts, err := a.paymentsService.GetMyPayouts(ctx, token.Subject)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, payouts)
+}
+
+func (a *api) handleGetPayoutBatches(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	batches, err := a.paymentsService.GetPayoutBatches(ctx)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, batches)
+}
+
+func (a *api) handleGetPayoutBatch(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	batchID, err := urlParamInt(r, "batchID")
+	if err != nil {
+		return err
+	}
+	batch, err := a.paymentsService.GetPayoutBatch(ctx, batchID)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, batch)
+}
+
+// handleExportPayoutBatch returns the batch as a file for the bank, a SEPA credit transfer file or CSV by the format query parameter
+func (a *api) handleExportPayoutBatch(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	batchID, err := urlParamInt(r, "batchID")
+	if err != nil {
+		return err
+	}
+	batch, err := a.paymentsService.GetPayoutBatch(ctx, batchID)
+	if err != nil {
+		return err
+	}
+	var content []byte
+	filename := fmt.Sprintf("payout-batch-%v", batch.ID)
+	switch format := r.URL.Query().Get("format"); format {
+	case "", exportFormatSEPA:
+		if batch.Currency != "EUR" {
+			return core.Errorf(core.EINVALID, "batch is in %v, only EUR batches can be exported as SEPA", batch.Currency)
+		}
+		debtor := render.SEPADebtor{Name: a.cfg.PayoutDebtorName, IBAN: a.cfg.PayoutDebtorIBAN, BIC: a.cfg.PayoutDebtorBIC}
+		content, err = render.PayoutsSEPA(batch, debtor, time.Now())
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		filename += ".xml"
+	case exportFormatCSV:
+		content, err = render.PayoutsCSV(batch)
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		filename += ".csv"
+	default:
+		return core.Errorf(core.EINVALID, "unknown format %v, must be sepa or csv", format)
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(filename))
+	_, err = w.Write(content)
+	return err
+}
+
+// handleSettlePayouts records the outcome of the payouts of a batch reported by the bank
+func (a *api) handleSettlePayouts(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	batchID, err := urlParamInt(r, "batchID")
+	if err != nil {
+		return err
+	}
+	input := &payments.SettlePayoutsInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	batch, err := a.paymentsService.SettlePayouts(ctx, batchID, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, batch)
+}
+
+func (a *api) pubsubSubscribePayouts(ctx context.Context) {
+	go func() {
+		ch := a.pubSub.Subscribe(payments.TopicPayoutUpdated)
+		for {
+			select {
+			case msg := <-ch:
+				event := payments.PayoutUpdatedEvent{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal PayoutUpdatedEvent", "error", err)
+					continue
+				}
+				err = a.emitUserEvent(event.DriverID, payments.TopicPayoutUpdated, event.Payout)
+				if err != nil {
+					a.logger.Error("error emitting payout updated event", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,47 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/promotions"
+)
+
+func (a *api) handleGetPromotions(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	promotionList, err := a.promotionService.GetPromotions(ctx)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, promotionList)
+}
+
+func (a *api) handleCreatePromotion(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	input := &promotions.CreatePromotionInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	promotion, err := a.promotionService.CreatePromotion(ctx, token.Subject, input)
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusCreated, promotion)
+}
+
+func (a *api) handleDeactivatePromotion(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	promotionID, err := urlParamInt(r, "promotionID")
+	if err != nil {
+		return err
+	}
+	err = a.promotionService.DeactivatePromotion(ctx, promotionID)
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusNoContent, nil)
+}
+
+// handleGetCities returns the cities promotions can be restricted to
+func (a *api) handleGetCities(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return a.respond(w, r, geo.GetCities())
+}
@@ -0,0 +1,127 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/ratings"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/users"
+)
+
+func (a *api) handleRateRide(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	rideRequestID, err := urlParamInt(r, "rideRequestID")
+	if err != nil {
+		return err
+	}
+	input := &ratings.RateRideInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	rating, err := a.ratingService.RateRide(ctx, token.Subject, rideRequestID, input)
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusCreated, rating)
+}
+
+func (a *api) handleGetRideRatings(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	rideRequestID, err := urlParamInt(r, "rideRequestID")
+	if err != nil {
+		return err
+	}
+	ratingList, err := a.ratingService.GetRideRatings(ctx, token.Subject, rideRequestID)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, ratingList)
+}
+
+func (a *api) handleGetMyRatings(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	myRatings, err := a.ratingService.GetMyRatings(ctx, token.Subject)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, myRatings)
+}
+
+func (a *api) handleGetUserProfile(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	userID, err := urlParamInt(r, "userID")
+	if err != nil {
+		return err
+	}
+	profile, err := a.ratingService.GetUserProfile(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, profile)
+}
+
+// emitAdminEvent sends an event to all admins
+func (a *api) emitAdminEvent(ctx context.Context, eventType string, data any) error {
+	return a.emitRoleEvent(ctx, eventType, data, users.RoleAdmin)
+}
+
+// emitRoleEvent sends an event to all users with one of the roles
+func (a *api) emitRoleEvent(ctx context.Context, eventType string, data any, roles ...string) error {
+	for _, role := range roles {
+		roleUsers, err := a.userRepo.GetByRole(ctx, role)
+		if err != nil {
+			return err
+		}
+		for _, user := range roleUsers {
+			err = a.emitUserEvent(user.ID, eventType, data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (a *api) pubsubSubscribeRatings(ctx context.Context) {
+	go func() {
+		ch := a.pubSub.Subscribe(ratings.TopicRideRated)
+		for {
+			select {
+			case msg := <-ch:
+				rating := ratings.Rating{}
+				err := json.Unmarshal(msg, &rating)
+				if err != nil {
+					a.logger.Error("failed to unmarshal Rating", "error", err)
+					continue
+				}
+				err = a.emitUserEvent(rating.RateeID, ratings.TopicRideRated, rating)
+				if err != nil {
+					a.logger.Error("error emitting ride rated event", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		ch := a.pubSub.Subscribe(ratings.TopicDriverRatingLow)
+		for {
+			select {
+			case msg := <-ch:
+				alert := ratings.DriverRatingAlert{}
+				err := json.Unmarshal(msg, &alert)
+				if err != nil {
+					a.logger.Error("failed to unmarshal DriverRatingAlert", "error", err)
+					continue
+				}
+				a.logger.Warn("driver rating low", "driverId", alert.DriverID, "average", alert.Average, "ratings", alert.Ratings)
+				err = a.emitAdminEvent(ctx, ratings.TopicDriverRatingLow, alert)
+				if err != nil {
+					a.logger.Error("error emitting driver rating alert", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
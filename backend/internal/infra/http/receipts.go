@@ -0,0 +1,239 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/rides"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/infra/render"
+	"github.com/go-chi/chi/v5"
+)
+
+// Formats of receipts and invoices, chosen with the format query parameter
+const (
+	formatJSON = "json"
+	formatHTML = "html"
+	formatPDF  = "pdf"
+)
+
+// respondDocument responds with data as JSON, or rendered as HTML or PDF if the format query parameter asks for it
+func (a *api) respondDocument(w http.ResponseWriter, r *http.Request, filename string, data any, html func() ([]byte, error), pdf func() []byte) error {
+	var content []byte
+	var err error
+	switch format := r.URL.Query().Get("format"); format {
+	case "", formatJSON:
+		return a.respond(w, r, data)
+	case formatHTML:
+		content, err = html()
+		if err != nil {
+			return core.Errorw(core.EINTERNAL, err)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	case formatPDF:
+		content = pdf()
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(filename+".pdf"))
+	default:
+		return core.Errorf(core.EINVALID, "unknown format %v, must be one of json, html or pdf", format)
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+func (a *api) handleGetRideReceipt(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	rideRequestId, err := urlParamInt(r, "rideRequestID")
+	if err != nil {
+		return err
+	}
+	receipt, err := a.rideService.GetRideReceipt(ctx, token.Subject, rideRequestId)
+	if err != nil {
+		return err
+	}
+	return a.respondDocument(w, r, "receipt-"+receipt.InvoiceNumber, receipt,
+		func() ([]byte, error) { return render.ReceiptHTML(receipt) },
+		func() []byte { return render.ReceiptPDF(receipt) })
+}
+
+func (a *api) handleGetMyInvoices(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	invoices, err := a.paymentsService.GetMonthlyInvoices(ctx, token.Subject)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, invoices)
+}
+
+// handleGetMyInvoice returns the monthly invoice of the month URL parameter, formatted as YYYY-MM
+func (a *api) handleGetMyInvoice(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	invoice, err := a.rideService.GetMonthlyInvoice(ctx, token.Subject, chi.URLParam(r, "month"))
+	if err != nil {
+		return err
+	}
+	return a.respondDocument(w, r, "invoice-"+invoice.InvoiceNumber, invoice,
+		func() ([]byte, error) { return render.MonthlyInvoiceHTML(invoice) },
+		func() []byte { return render.MonthlyInvoicePDF(invoice) })
+}
+
+func (a *api) handleGetMyBillingProfile(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	profile, err := a.paymentsService.GetMyBillingProfile(ctx, token.Subject)
+	if err != nil {
+		return err
+	}
+	if profile == nil {
+		return core.Errorf(core.ENOTFOUND, "no billing profile")
+	}
+	return a.respond(w, r, profile)
+}
+
+func (a *api) handleSetMyBillingProfile(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	input := &payments.SetBillingProfileInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	profile, err := a.paymentsService.SetBillingProfile(ctx, token.Subject, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, profile)
+}
+
+// mailReceipt emails the receipt to the rider, as HTML with the PDF attached
+func (a *api) mailReceipt(ctx context.Context, receipt rides.RideReceipt) error {
+	rider, err := a.userRepo.GetByID(ctx, receipt.RiderID)
+	if err != nil {
+		return err
+	}
+	if rider.Email == "" {
+		return nil
+	}
+	html, err := render.ReceiptHTML(receipt)
+	if err != nil {
+		return err
+	}
+	return a.mailer.Send(ctx, core.Mail{
+		To:      rider.Email,
+		Subject: fmt.Sprintf("Your receipt for your ride to %v", receipt.ToName),
+		Text:    fmt.Sprintf("Thanks for riding. Your receipt %v is attached.", receipt.InvoiceNumber),
+		HTML:    string(html),
+		Attachments: []core.MailAttachment{{
+			Filename:    fmt.Sprintf("receipt-%v.pdf", receipt.InvoiceNumber),
+			ContentType: "application/pdf",
+			Content:     render.ReceiptPDF(receipt),
+		}},
+	})
+}
+
+// mailMonthlyInvoice emails the invoice of the month to the business rider
+func (a *api) mailMonthlyInvoice(ctx context.Context, event rides.MonthlyInvoiceIssuedEvent) error {
+	invoice, err := a.rideService.GetMonthlyInvoiceByID(ctx, event.UserID, event.PeriodStart)
+	if err != nil {
+		return err
+	}
+	rider, err := a.userRepo.GetByID(ctx, event.UserID)
+	if err != nil {
+		return err
+	}
+	if rider.Email == "" {
+		return nil
+	}
+	html, err := render.MonthlyInvoiceHTML(invoice)
+	if err != nil {
+		return err
+	}
+	return a.mailer.Send(ctx, core.Mail{
+		To:      rider.Email,
+		Subject: fmt.Sprintf("Your invoice for %v", invoice.PeriodStart.Format("January 2006")),
+		Text:    fmt.Sprintf("Your invoice %v of the rides of %v is attached.", invoice.InvoiceNumber, invoice.PeriodStart.Format("January 2006")),
+		HTML:    string(html),
+		Attachments: []core.MailAttachment{{
+			Filename:    fmt.Sprintf("invoice-%v.pdf", invoice.InvoiceNumber),
+			ContentType: "application/pdf",
+			Content:     render.MonthlyInvoicePDF(invoice),
+		}},
+	})
+}
+
+func (a *api) pubsubSubscribeReceipts(ctx context.Context) {
+	go func() {
+		ch := a.pubSub.Subscribe(rides.TopicRideFinished)
+		for {
+			select {
+			case msg := <-ch:
+				event := rides.RideFinishedEvent{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal RideFinishedEvent", "error", err)
+					continue
+				}
+				err = a.rideService.HandleRideFinished(ctx, event)
+				if err != nil {
+					a.logger.Error("failed to issue receipt of finished ride", "error", err, "rideId", event.RideID)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		ch := a.pubSub.Subscribe(rides.TopicRideReceiptIssued)
+		for {
+			select {
+			case msg := <-ch:
+				event := rides.RideReceiptIssuedEvent{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal RideReceiptIssuedEvent", "error", err)
+					continue
+				}
+				err = a.emitUserEvent(event.RiderID, rides.TopicRideReceiptIssued, event.Receipt)
+				if err != nil {
+					a.logger.Error("error emitting receipt issued event", "error", err)
+				}
+				// Sent in the background so a slow mail server does not hold up the subscription
+				go func() {
+					err := a.mailReceipt(ctx, event.Receipt)
+					if err != nil {
+						a.logger.Error("failed to mail receipt", "error", err, "rideId", event.Receipt.RideID)
+					}
+				}()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		ch := a.pubSub.Subscribe(rides.TopicMonthlyInvoiceIssued)
+		for {
+			select {
+			case msg := <-ch:
+				event := rides.MonthlyInvoiceIssuedEvent{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal MonthlyInvoiceIssuedEvent", "error", err)
+					continue
+				}
+				err = a.emitUserEvent(event.UserID, rides.TopicMonthlyInvoiceIssued, event)
+				if err != nil {
+					a.logger.Error("error emitting monthly invoice issued event", "error", err)
+				}
+				go func() {
+					err := a.mailMonthlyInvoice(ctx, event)
+					if err != nil {
+						a.logger.Error("failed to mail monthly invoice", "error", err, "userId", event.UserID)
+					}
+				}()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
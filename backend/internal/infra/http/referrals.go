@@ -0,0 +1,75 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/referrals"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/rides"
+)
+
+func (a *api) handleSignup(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	input := &referrals.SignupInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	user, err := a.referralService.Signup(ctx, token.Subject, input)
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusCreated, user)
+}
+
+func (a *api) handleGetMyReferrals(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	stats, err := a.referralService.GetStats(ctx, token.Subject)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, stats)
+}
+
+func (a *api) pubsubSubscribeReferrals(ctx context.Context) {
+	go func() {
+		ch := a.pubSub.Subscribe(rides.TopicRideFinished)
+		for {
+			select {
+			case msg := <-ch:
+				event := rides.RideFinishedEvent{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal RideFinishedEvent", "error", err)
+					continue
+				}
+				err = a.referralService.HandleRideFinished(ctx, event)
+				if err != nil {
+					a.logger.Error("failed to handle referral of finished ride", "error", err, "rideId", event.RideID)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		ch := a.pubSub.Subscribe(referrals.TopicReferralRewarded)
+		for {
+			select {
+			case msg := <-ch:
+				event := referrals.ReferralRewardedEvent{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal ReferralRewardedEvent", "error", err)
+					continue
+				}
+				err = a.emitUserEvent(event.UserID, referrals.TopicReferralRewarded, event)
+				if err != nil {
+					a.logger.Error("error emitting referral rewarded event", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -2,12 +2,18 @@ package http
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
 	"github.com/bjarke-xyz/uber-clone-backend/internal/core/rides"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
 )
 
+// Period of the earnings report when the request does not specify one
+const defaultEarningsPeriod = 7 * 24 * time.Hour
+
 func (a *api) handleGetMyRideRequests(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	token, _ := TokenFromContext(r.Context())
 	rideRequests, err := a.rideService.GetRideRequestsByUserID(ctx, token.Subject)
@@ -18,7 +24,8 @@ func (a *api) handleGetMyRideRequests(ctx context.Context, w http.ResponseWriter
 }
 
 func (a *api) handleGetAvailableRideRequests(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-	rideRequests, err := a.rideService.GetAvailableRideRequests(ctx)
+	token, _ := TokenFromContext(r.Context())
+	rideRequests, err := a.rideService.GetAvailableRideRequests(ctx, token.Subject)
 	if err != nil {
 		return core.Errorw(core.EINTERNAL, err)
 	}
@@ -38,6 +45,19 @@ func (a *api) handleCreateRideRequest(ctx context.Context, w http.ResponseWriter
 	return a.respond(w, r, rideReq)
 }
 
+func (a *api) handleQuoteRide(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	input := &rides.CreateRideInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	quote, err := a.rideService.QuoteRide(ctx, token.Subject, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, quote)
+}
+
 func (a *api) handleClaimRideRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	token, _ := TokenFromContext(r.Context())
 	rideRequestId, err := urlParamInt(r, "rideRequestID")
@@ -71,6 +91,53 @@ func (a *api) handleGetRideDirections(ctx context.Context, w http.ResponseWriter
 	return a.respond(w, r, directions)
 }
 
+func (a *api) handleStartRide(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	rideRequestId, err := urlParamInt(r, "rideRequestID")
+	if err != nil {
+		return err
+	}
+	err = a.rideService.StartRide(ctx, token.Subject, rideRequestId)
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusNoContent, nil)
+}
+
+func (a *api) handleUpdateRideStops(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	rideRequestId, err := urlParamInt(r, "rideRequestID")
+	if err != nil {
+		return err
+	}
+	input := &rides.UpdateStopsInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	rideReq, err := a.rideService.UpdateRideStops(ctx, token.Subject, rideRequestId, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, rideReq)
+}
+
+func (a *api) handleCompleteStop(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	rideRequestId, err := urlParamInt(r, "rideRequestID")
+	if err != nil {
+		return err
+	}
+	stopID, err := urlParamInt(r, "stopID")
+	if err != nil {
+		return err
+	}
+	err = a.rideService.CompleteStop(ctx, token.Subject, rideRequestId, stopID)
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusNoContent, nil)
+}
+
 func (a *api) handleFinishRide(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	token, _ := TokenFromContext(r.Context())
 	rideRequestId, err := urlParamInt(r, "rideRequestID")
@@ -84,6 +151,65 @@ func (a *api) handleFinishRide(ctx context.Context, w http.ResponseWriter, r *ht
 	return a.respondStatus(w, r, http.StatusNoContent, nil)
 }
 
+func (a *api) handleCancelRide(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	rideRequestId, err := urlParamInt(r, "rideRequestID")
+	if err != nil {
+		return err
+	}
+	input := &rides.CancelRideInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	cancellation, err := a.rideService.CancelRide(ctx, token.Subject, rideRequestId, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, cancellation)
+}
+
+func (a *api) handleTipRide(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	rideRequestId, err := urlParamInt(r, "rideRequestID")
+	if err != nil {
+		return err
+	}
+	input := &rides.TipInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	tip, err := a.rideService.TipRide(ctx, token.Subject, rideRequestId, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, tip)
+}
+
+// handleGetMyEarnings returns the earnings of rides finished between the from and to query parameters, by default the last 7 days.
+// The period query parameter summarises them per day or week
+func (a *api) handleGetMyEarnings(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	to, toOk, err := queryParamTime(r, "to")
+	if err != nil {
+		return err
+	}
+	if !toOk {
+		to = time.Now().UTC()
+	}
+	from, fromOk, err := queryParamTime(r, "from")
+	if err != nil {
+		return err
+	}
+	if !fromOk {
+		from = to.Add(-defaultEarningsPeriod)
+	}
+	earnings, err := a.rideService.GetDriverEarnings(ctx, token.Subject, from, to, r.URL.Query().Get("period"))
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, earnings)
+}
+
 func (a *api) handleGetSimulatedRides(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	rides, err := a.rideService.GetSimulatedRides(ctx)
 	if err != nil {
@@ -91,3 +217,229 @@ func (a *api) handleGetSimulatedRides(ctx context.Context, w http.ResponseWriter
 	}
 	return a.respond(w, r, rides)
 }
+
+func (a *api) migrateDirections(ctx context.Context) error {
+	migrated, err := a.rideService.MigrateDirections(ctx, func(rideID int64, err error) {
+		a.logger.Warn("skipped directions that could not be decoded", "error", err, "rideId", rideID)
+	})
+	if migrated > 0 {
+		a.logger.Info("migrated directions", "migrated", migrated, "version", rides.DirectionsVersionCurrent)
+	}
+	return err
+}
+
+func (a *api) pubsubSubscribeRides(ctx context.Context) {
+	go func() {
+		ch := a.pubSub.Subscribe(vehicles.TopicPositionUpdate)
+		for {
+			select {
+			case msg := <-ch:
+				event := vehicles.VehiclePosition{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal VehiclePosition", "error", err)
+					continue
+				}
+				err = a.rideService.HandlePositionUpdate(ctx, event)
+				if err != nil {
+					a.logger.Error("failed to handle position update", "error", err, "vehicleId", event.VehicleID)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		ch := a.pubSub.Subscribe(rides.TopicRideETA)
+		for {
+			select {
+			case msg := <-ch:
+				event := rides.RideETA{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal RideETA", "error", err)
+					continue
+				}
+				err = a.emitUserEvent(event.RiderID, rides.TopicRideETA, event)
+				if err != nil {
+					a.logger.Error("error emitting ride eta event", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		arrivedCh := a.pubSub.Subscribe(rides.TopicRideDriverArrived)
+		waitingEndedCh := a.pubSub.Subscribe(rides.TopicRideFreeWaitingEnded)
+		for {
+			var topic string
+			var msg []byte
+			select {
+			case msg = <-arrivedCh:
+				topic = rides.TopicRideDriverArrived
+			case msg = <-waitingEndedCh:
+				topic = rides.TopicRideFreeWaitingEnded
+			case <-ctx.Done():
+				return
+			}
+			event := rides.RideArrivalEvent{}
+			err := json.Unmarshal(msg, &event)
+			if err != nil {
+				a.logger.Error("failed to unmarshal RideArrivalEvent", "error", err)
+				continue
+			}
+			err = a.emitUserEvent(event.RiderID, topic, event)
+			if err == nil && topic == rides.TopicRideFreeWaitingEnded {
+				err = a.emitUserEvent(event.DriverID, topic, event)
+			}
+			if err != nil {
+				a.logger.Error("error emitting ride arrival event", "error", err)
+			}
+		}
+	}()
+	go func() {
+		ch := a.pubSub.Subscribe(rides.TopicRideCancelled)
+		for {
+			select {
+			case msg := <-ch:
+				event := rides.RideCancelledEvent{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal RideCancelledEvent", "error", err)
+					continue
+				}
+				// Notify the other party
+				var userID int64
+				if event.Cancellation.Party == rides.PartyRider && event.DriverID != nil {
+					userID = *event.DriverID
+				} else if event.Cancellation.Party == rides.PartyDriver || event.Cancellation.Party == rides.PartySystem {
+					userID = event.RiderID
+				}
+				if userID == 0 {
+					continue
+				}
+				err = a.emitUserEvent(userID, rides.TopicRideCancelled, event)
+				if err != nil {
+					a.logger.Error("error emitting ride cancelled event", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		ch := a.pubSub.Subscribe(rides.TopicRideExpired)
+		for {
+			select {
+			case msg := <-ch:
+				event := rides.RideExpiredEvent{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal RideExpiredEvent", "error", err)
+					continue
+				}
+				err = a.emitUserEvent(event.RiderID, rides.TopicRideExpired, event)
+				if err != nil {
+					a.logger.Error("error emitting ride expired event", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		ch := a.pubSub.Subscribe(rides.TopicRideReminder)
+		for {
+			select {
+			case msg := <-ch:
+				event := rides.RideReminderEvent{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal RideReminderEvent", "error", err)
+					continue
+				}
+				err = a.emitUserEvent(event.UserID, rides.TopicRideReminder, event)
+				if err != nil {
+					a.logger.Error("error emitting ride reminder event", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		updatedCh := a.pubSub.Subscribe(rides.TopicRideStopsUpdated)
+		completedCh := a.pubSub.Subscribe(rides.TopicRideStopCompleted)
+		for {
+			var topic string
+			var msg []byte
+			select {
+			case msg = <-updatedCh:
+				topic = rides.TopicRideStopsUpdated
+			case msg = <-completedCh:
+				topic = rides.TopicRideStopCompleted
+			case <-ctx.Done():
+				return
+			}
+			event := rides.RideStopsEvent{}
+			err := json.Unmarshal(msg, &event)
+			if err != nil {
+				a.logger.Error("failed to unmarshal RideStopsEvent", "error", err)
+				continue
+			}
+			// The rider changes the stops and the driver completes them, notify the other party
+			userID := event.RiderID
+			if topic == rides.TopicRideStopsUpdated {
+				if event.DriverID == nil {
+					continue
+				}
+				userID = *event.DriverID
+			}
+			err = a.emitUserEvent(userID, topic, event)
+			if err != nil {
+				a.logger.Error("error emitting ride stops event", "error", err)
+			}
+		}
+	}()
+	go func() {
+		ch := a.pubSub.Subscribe(rides.TopicRidePooled)
+		for {
+			select {
+			case msg := <-ch:
+				event := rides.RidePooledEvent{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal RidePooledEvent", "error", err)
+					continue
+				}
+				err = a.emitUserEvent(event.RiderID, rides.TopicRidePooled, event)
+				if err != nil {
+					a.logger.Error("error emitting ride pooled event", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		ch := a.pubSub.Subscribe(rides.TopicRideTipped)
+		for {
+			select {
+			case msg := <-ch:
+				event := rides.RideTippedEvent{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal RideTippedEvent", "error", err)
+					continue
+				}
+				err = a.emitUserEvent(event.DriverID, rides.TopicRideTipped, event)
+				if err != nil {
+					a.logger.Error("error emitting ride tipped event", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,174 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/rides"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/users"
+)
+
+func (a *api) handleGetSurchargeZones(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	zones, err := a.paymentsService.GetSurchargeZones(ctx)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, zones)
+}
+
+func (a *api) handleCreateSurchargeZone(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	input := &payments.SurchargeZoneInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	zone, err := a.paymentsService.CreateSurchargeZone(ctx, input)
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusCreated, zone)
+}
+
+func (a *api) handleUpdateSurchargeZone(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	zoneID, err := urlParamInt(r, "zoneID")
+	if err != nil {
+		return err
+	}
+	input := &payments.SurchargeZoneInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	zone, err := a.paymentsService.UpdateSurchargeZone(ctx, zoneID, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, zone)
+}
+
+func (a *api) handleDeleteSurchargeZone(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	zoneID, err := urlParamInt(r, "zoneID")
+	if err != nil {
+		return err
+	}
+	err = a.paymentsService.DeleteSurchargeZone(ctx, zoneID)
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusNoContent, nil)
+}
+
+func (a *api) handleLogExtra(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	rideRequestID, err := urlParamInt(r, "rideRequestID")
+	if err != nil {
+		return err
+	}
+	input := &rides.LogExtraInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	extra, err := a.rideService.LogExtra(ctx, token.Subject, rideRequestID, input)
+	if err != nil {
+		return err
+	}
+	return a.respondStatus(w, r, http.StatusCreated, extra)
+}
+
+func (a *api) handleGetRideExtras(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	rideRequestID, err := urlParamInt(r, "rideRequestID")
+	if err != nil {
+		return err
+	}
+	extras, err := a.rideService.GetRideExtras(ctx, token.Subject, rideRequestID)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, extras)
+}
+
+// handleGetExtras returns the support queue of extras. The state query parameter defaults to pending extras
+func (a *api) handleGetExtras(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	state := rides.ExtraStatePending
+	if stateStr := r.URL.Query().Get("state"); stateStr != "" {
+		stateInt, err := strconv.Atoi(stateStr)
+		if err != nil {
+			return core.Errorw(core.EINVALID, err)
+		}
+		state = rides.ExtraState(stateInt)
+	}
+	extras, err := a.rideService.GetExtras(ctx, state)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, extras)
+}
+
+func (a *api) handleReviewExtra(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	extraID, err := urlParamInt(r, "extraID")
+	if err != nil {
+		return err
+	}
+	input := &rides.ReviewExtraInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	extra, err := a.rideService.ReviewExtra(ctx, token.Subject, extraID, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, extra)
+}
+
+func (a *api) pubsubSubscribeExtras(ctx context.Context) {
+	go func() {
+		ch := a.pubSub.Subscribe(rides.TopicRideExtraLogged)
+		for {
+			select {
+			case msg := <-ch:
+				event := rides.RideExtraEvent{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal RideExtraEvent", "error", err)
+					continue
+				}
+				err = a.emitRoleEvent(ctx, rides.TopicRideExtraLogged, event.Extra, users.RoleSupport, users.RoleAdmin)
+				if err != nil {
+					a.logger.Error("error emitting ride extra logged event", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		ch := a.pubSub.Subscribe(rides.TopicRideExtraReviewed)
+		for {
+			select {
+			case msg := <-ch:
+				event := rides.RideExtraEvent{}
+				err := json.Unmarshal(msg, &event)
+				if err != nil {
+					a.logger.Error("failed to unmarshal RideExtraEvent", "error", err)
+					continue
+				}
+				err = a.emitUserEvent(event.Extra.DriverID, rides.TopicRideExtraReviewed, event.Extra)
+				if err != nil {
+					a.logger.Error("error emitting ride extra reviewed event", "error", err)
+				}
+				if event.Extra.State == rides.ExtraStateApproved {
+					err = a.emitUserEvent(event.RiderID, rides.TopicRideExtraReviewed, event.Extra)
+					if err != nil {
+						a.logger.Error("error emitting ride extra reviewed event", "error", err)
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -17,6 +17,29 @@ func (a *api) handleGetMyUser(ctx context.Context, w http.ResponseWriter, r *htt
 	return a.respond(w, r, user)
 }
 
+func (a *api) handleSetMyEmail(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, _ := TokenFromContext(r.Context())
+	input := &users.SetEmailInput{}
+	if err := decodeBody(r.Body, input); err != nil {
+		return err
+	}
+	user, err := a.userService.SetEmail(ctx, token.Subject, input)
+	if err != nil {
+		return err
+	}
+	return a.respond(w, r, user)
+}
+
+func (a *api) handleMyEvents(w http.ResponseWriter, r *http.Request) {
+	token, _ := TokenFromContext(r.Context())
+	user, err := a.userService.GetUserByID(r.Context(), token.Subject)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	a.serveEvents(w, r, user.ID)
+}
+
 func (a *api) handleGetSimUsers(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	users, err := a.userService.GetSimulatedUsers(ctx)
 	if err != nil {
@@ -21,6 +21,10 @@ func (a *api) getVehiclesHandler(ctx context.Context, w http.ResponseWriter, r *
 	return a.respond(w, r, vehicleList)
 }
 
+func (a *api) getVehicleClassesHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return a.respond(w, r, a.vehicleService.GetVehicleClasses(ctx))
+}
+
 type GetSimulatedVehiclesResponse struct {
 	Vehicles  []vehicles.Vehicle         `json:"vehicles"`
 	Positions []vehicles.VehiclePosition `json:"positions"`
@@ -63,6 +67,10 @@ func (a *api) updateVehiclePositionHandler(ctx context.Context, w http.ResponseW
 }
 
 func (a *api) handleEvents(w http.ResponseWriter, r *http.Request) {
+	a.serveEvents(w, r, 0)
+}
+
+func (a *api) serveEvents(w http.ResponseWriter, r *http.Request, userID int64) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		http.Error(w, "SSE not supported", http.StatusInternalServerError)
@@ -75,7 +83,7 @@ func (a *api) handleEvents(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	// Each connection registers its own message channel with the Broker's connections registry
 	messageChan := make(chan []byte)
-	a.broker.newClients <- messageChan
+	a.broker.newClients <- brokerClient{messages: messageChan, userID: userID}
 	// Remove this client from the map of connected clients
 	// when this handler exits.
 	defer func() {
@@ -127,6 +135,15 @@ func (a *api) emitPositionUpdateEvent(vehiclePos vehicles.VehiclePosition) error
 	return nil
 }
 
+func (a *api) emitUserEvent(userID int64, event string, data any) error {
+	sseStr, err := formatServerSentEvent(event, data)
+	if err != nil {
+		return err
+	}
+	a.broker.UserNotifier <- userMessage{userID: userID, msg: []byte(sseStr)}
+	return nil
+}
+
 func formatServerSentEvent(event string, data any) (string, error) {
 	m := map[string]any{
 		"data": data,
@@ -0,0 +1,27 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+)
+
+// logMailer logs mails instead of sending them, for development
+type logMailer struct {
+	logger *slog.Logger
+}
+
+func NewLogMailer(logger *slog.Logger) core.Mailer {
+	return &logMailer{logger: logger}
+}
+
+// Send implements core.Mailer.
+func (l *logMailer) Send(ctx context.Context, mail core.Mail) error {
+	attachments := make([]string, 0, len(mail.Attachments))
+	for _, attachment := range mail.Attachments {
+		attachments = append(attachments, attachment.Filename)
+	}
+	l.logger.Info("mail", "to", mail.To, "subject", mail.Subject, "attachments", attachments)
+	return nil
+}
@@ -0,0 +1,129 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+)
+
+// Length of the lines of base64 encoded attachments
+const base64LineLength = 76
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer sends mails through the SMTP server at host:port. Authenticates with PLAIN auth if username is set
+func NewSMTPMailer(host string, port int, username string, password string, from string) core.Mailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &smtpMailer{
+		addr: net.JoinHostPort(host, fmt.Sprint(port)),
+		auth: auth,
+		from: from,
+	}
+}
+
+// Send implements core.Mailer.
+func (s *smtpMailer) Send(ctx context.Context, mail core.Mail) error {
+	msg, err := s.message(mail)
+	if err != nil {
+		return fmt.Errorf("failed to build mail: %w", err)
+	}
+	err = smtp.SendMail(s.addr, s.auth, s.from, []string{mail.To}, msg)
+	if err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// message builds a multipart/mixed message of the bodies as multipart/alternative, followed by the attachments
+func (s *smtpMailer) message(mail core.Mail) ([]byte, error) {
+	var buf bytes.Buffer
+	mixed := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "From: %v\r\n", s.from)
+	fmt.Fprintf(&buf, "To: %v\r\n", mail.To)
+	fmt.Fprintf(&buf, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8", mail.Subject))
+	fmt.Fprintf(&buf, "Date: %v\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%v\r\n\r\n", mixed.Boundary())
+
+	var bodies bytes.Buffer
+	alternative := multipart.NewWriter(&bodies)
+	err := writeQuotedPrintable(alternative, "text/plain; charset=utf-8", mail.Text)
+	if err != nil {
+		return nil, err
+	}
+	if mail.HTML != "" {
+		err = writeQuotedPrintable(alternative, "text/html; charset=utf-8", mail.HTML)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = alternative.Close()
+	if err != nil {
+		return nil, err
+	}
+	part, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {fmt.Sprintf("multipart/alternative; boundary=%v", alternative.Boundary())},
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = part.Write(bodies.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range mail.Attachments {
+		part, err := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(attachment.Content)
+		for len(encoded) > base64LineLength {
+			fmt.Fprintf(part, "%v\r\n", encoded[:base64LineLength])
+			encoded = encoded[base64LineLength:]
+		}
+		fmt.Fprintf(part, "%v\r\n", encoded)
+	}
+	err = mixed.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w *multipart.Writer, contentType string, body string) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	_, err = qp.Write([]byte(body))
+	if err != nil {
+		return err
+	}
+	return qp.Close()
+}
@@ -0,0 +1,173 @@
+package paymentprovider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+)
+
+// Payment method token the fake provider declines, to test failed payments
+const DeclinedToken = "tok_chargeDeclined"
+
+type fakePayment struct {
+	intent   payments.PaymentIntent
+	refunded int
+}
+
+// fakeProvider is an in-process payment provider for development and the simulator.
+// Every payment method is accepted, except DeclinedToken
+type fakeProvider struct {
+	webhookSecret  string
+	mu             sync.Mutex
+	nextID         int
+	customers      map[string]bool
+	paymentMethods map[string]string
+	intents        map[string]*fakePayment
+	// Results of calls by idempotency key
+	results map[string]any
+}
+
+func NewFakeProvider(webhookSecret string) payments.PaymentProvider {
+	return &fakeProvider{
+		webhookSecret:  webhookSecret,
+		customers:      make(map[string]bool),
+		paymentMethods: make(map[string]string),
+		intents:        make(map[string]*fakePayment),
+		results:        make(map[string]any),
+	}
+}
+
+func (f *fakeProvider) newID(prefix string) string {
+	f.nextID++
+	return fmt.Sprintf("%v_fake_%v", prefix, f.nextID)
+}
+
+// CreateCustomer implements payments.PaymentProvider.
+func (f *fakeProvider) CreateCustomer(ctx context.Context, userID int64, name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := f.newID("cus")
+	f.customers[id] = true
+	return id, nil
+}
+
+// AttachPaymentMethod implements payments.PaymentProvider.
+func (f *fakeProvider) AttachPaymentMethod(ctx context.Context, customerID string, token string) (payments.PaymentMethod, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.customers[customerID] {
+		return payments.PaymentMethod{}, fmt.Errorf("no such customer: %v", customerID)
+	}
+	id := f.newID("pm")
+	f.paymentMethods[id] = token
+	return payments.PaymentMethod{ID: id, Brand: "visa", Last4: "4242", Fingerprint: token}, nil
+}
+
+// Authorise implements payments.PaymentProvider.
+func (f *fakeProvider) Authorise(ctx context.Context, input payments.AuthoriseInput) (payments.PaymentIntent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if result, ok := f.results[input.IdempotencyKey].(payments.PaymentIntent); ok {
+		return result, nil
+	}
+	token, ok := f.paymentMethods[input.PaymentMethodID]
+	if !ok {
+		return payments.PaymentIntent{}, fmt.Errorf("no such payment method: %v", input.PaymentMethodID)
+	}
+	intent := payments.PaymentIntent{
+		ID:       f.newID("pi"),
+		Status:   payments.IntentStatusAuthorised,
+		Amount:   input.Amount,
+		Currency: input.Currency,
+	}
+	if token == DeclinedToken {
+		intent.Status = payments.IntentStatusFailed
+	}
+	f.intents[intent.ID] = &fakePayment{intent: intent}
+	f.results[input.IdempotencyKey] = intent
+	return intent, nil
+}
+
+// Capture implements payments.PaymentProvider.
+func (f *fakeProvider) Capture(ctx context.Context, intentID string, amount int, idempotencyKey string) (payments.PaymentIntent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if result, ok := f.results[idempotencyKey].(payments.PaymentIntent); ok {
+		return result, nil
+	}
+	payment, ok := f.intents[intentID]
+	if !ok {
+		return payments.PaymentIntent{}, fmt.Errorf("no such payment intent: %v", intentID)
+	}
+	if payment.intent.Status != payments.IntentStatusAuthorised {
+		return payments.PaymentIntent{}, fmt.Errorf("payment intent %v cannot be captured in status %v", intentID, payment.intent.Status)
+	}
+	if amount > payment.intent.Amount {
+		return payments.PaymentIntent{}, fmt.Errorf("amount %v exceeds authorised amount %v", amount, payment.intent.Amount)
+	}
+	payment.intent.Status = payments.IntentStatusCaptured
+	payment.intent.AmountCaptured = amount
+	f.results[idempotencyKey] = payment.intent
+	return payment.intent, nil
+}
+
+// Void implements payments.PaymentProvider.
+func (f *fakeProvider) Void(ctx context.Context, intentID string, idempotencyKey string) (payments.PaymentIntent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if result, ok := f.results[idempotencyKey].(payments.PaymentIntent); ok {
+		return result, nil
+	}
+	payment, ok := f.intents[intentID]
+	if !ok {
+		return payments.PaymentIntent{}, fmt.Errorf("no such payment intent: %v", intentID)
+	}
+	if payment.intent.Status != payments.IntentStatusAuthorised && payment.intent.Status != payments.IntentStatusPending {
+		return payments.PaymentIntent{}, fmt.Errorf("payment intent %v cannot be voided in status %v", intentID, payment.intent.Status)
+	}
+	payment.intent.Status = payments.IntentStatusVoided
+	f.results[idempotencyKey] = payment.intent
+	return payment.intent, nil
+}
+
+// Refund implements payments.PaymentProvider.
+func (f *fakeProvider) Refund(ctx context.Context, intentID string, amount int, idempotencyKey string) (payments.ProviderRefund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if result, ok := f.results[idempotencyKey].(payments.ProviderRefund); ok {
+		return result, nil
+	}
+	payment, ok := f.intents[intentID]
+	if !ok {
+		return payments.ProviderRefund{}, fmt.Errorf("no such payment intent: %v", intentID)
+	}
+	if payment.intent.Status != payments.IntentStatusCaptured {
+		return payments.ProviderRefund{}, fmt.Errorf("payment intent %v has not been captured", intentID)
+	}
+	if payment.refunded+amount > payment.intent.AmountCaptured {
+		return payments.ProviderRefund{}, fmt.Errorf("amount %v exceeds the unrefunded amount of %v", amount, intentID)
+	}
+	payment.refunded += amount
+	refund := payments.ProviderRefund{ID: f.newID("re"), IntentID: intentID, Amount: amount}
+	f.results[idempotencyKey] = refund
+	return refund, nil
+}
+
+// ParseWebhook implements payments.PaymentProvider. The payload is a payments.ProviderEvent, signed with the webhook secret like Stripe events.
+// Webhooks are rejected if no secret is configured
+func (f *fakeProvider) ParseWebhook(payload []byte, signature string) (payments.ProviderEvent, error) {
+	if err := verifySignature(f.webhookSecret, payload, signature); err != nil {
+		return payments.ProviderEvent{}, err
+	}
+	var event payments.ProviderEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return payments.ProviderEvent{}, fmt.Errorf("failed to parse event: %w", err)
+	}
+	if event.ID == "" || event.IntentID == "" {
+		return payments.ProviderEvent{}, fmt.Errorf("event must have an id and an intent id")
+	}
+	return event, nil
+}
@@ -0,0 +1,294 @@
+package paymentprovider
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+)
+
+const stripeBaseUrl string = "https://api.stripe.com/v1"
+
+// Oldest webhook signature timestamp accepted
+const webhookTolerance = 5 * time.Minute
+
+type stripeProvider struct {
+	secretKey     string
+	webhookSecret string
+	httpClient    *http.Client
+}
+
+func NewStripeProvider(secretKey string, webhookSecret string) payments.PaymentProvider {
+	return &stripeProvider{
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		httpClient:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type stripeError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type stripePaymentIntent struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	Amount         int    `json:"amount"`
+	AmountReceived int    `json:"amount_received"`
+	Currency       string `json:"currency"`
+}
+
+func (i stripePaymentIntent) toPaymentIntent() payments.PaymentIntent {
+	return payments.PaymentIntent{
+		ID:             i.ID,
+		Status:         intentStatus(i.Status),
+		Amount:         i.Amount,
+		AmountCaptured: i.AmountReceived,
+		Currency:       strings.ToUpper(i.Currency),
+	}
+}
+
+func intentStatus(status string) payments.IntentStatus {
+	switch status {
+	case "requires_capture":
+		return payments.IntentStatusAuthorised
+	case "succeeded":
+		return payments.IntentStatusCaptured
+	case "canceled":
+		return payments.IntentStatusVoided
+	case "requires_payment_method":
+		return payments.IntentStatusFailed
+	default:
+		return payments.IntentStatusPending
+	}
+}
+
+type stripePaymentMethod struct {
+	ID   string `json:"id"`
+	Card struct {
+		Brand       string `json:"brand"`
+		Last4       string `json:"last4"`
+		Fingerprint string `json:"fingerprint"`
+	} `json:"card"`
+}
+
+func (s *stripeProvider) post(ctx context.Context, path string, form url.Values, idempotencyKey string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", stripeBaseUrl+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.secretKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode > 299 {
+		var stripeErr stripeError
+		if err := json.Unmarshal(respBytes, &stripeErr); err == nil && stripeErr.Error.Message != "" {
+			return fmt.Errorf("stripe: %v", stripeErr.Error.Message)
+		}
+		return fmt.Errorf("got error response from stripe: status=%v body=%v", resp.StatusCode, string(respBytes))
+	}
+	return json.Unmarshal(respBytes, result)
+}
+
+// CreateCustomer implements payments.PaymentProvider.
+func (s *stripeProvider) CreateCustomer(ctx context.Context, userID int64, name string) (string, error) {
+	form := url.Values{}
+	form.Set("name", name)
+	form.Set("metadata[user_id]", strconv.FormatInt(userID, 10))
+	var customer struct {
+		ID string `json:"id"`
+	}
+	err := s.post(ctx, "/customers", form, fmt.Sprintf("user:%v:customer", userID), &customer)
+	return customer.ID, err
+}
+
+// AttachPaymentMethod implements payments.PaymentProvider. The token is a payment method ID, or a card token such as tok_visa
+func (s *stripeProvider) AttachPaymentMethod(ctx context.Context, customerID string, token string) (payments.PaymentMethod, error) {
+	paymentMethodID := token
+	if !strings.HasPrefix(token, "pm_") {
+		form := url.Values{}
+		form.Set("type", "card")
+		form.Set("card[token]", token)
+		var method stripePaymentMethod
+		if err := s.post(ctx, "/payment_methods", form, "", &method); err != nil {
+			return payments.PaymentMethod{}, err
+		}
+		paymentMethodID = method.ID
+	}
+	form := url.Values{}
+	form.Set("customer", customerID)
+	var method stripePaymentMethod
+	err := s.post(ctx, "/payment_methods/"+url.PathEscape(paymentMethodID)+"/attach", form, "", &method)
+	if err != nil {
+		return payments.PaymentMethod{}, err
+	}
+	return payments.PaymentMethod{ID: method.ID, Brand: method.Card.Brand, Last4: method.Card.Last4, Fingerprint: method.Card.Fingerprint}, nil
+}
+
+// Authorise implements payments.PaymentProvider.
+func (s *stripeProvider) Authorise(ctx context.Context, input payments.AuthoriseInput) (payments.PaymentIntent, error) {
+	form := url.Values{}
+	form.Set("amount", strconv.Itoa(input.Amount))
+	form.Set("currency", strings.ToLower(input.Currency))
+	form.Set("customer", input.CustomerID)
+	form.Set("payment_method", input.PaymentMethodID)
+	form.Set("description", input.Description)
+	form.Set("capture_method", "manual")
+	form.Set("confirm", "true")
+	form.Set("off_session", "true")
+	var intent stripePaymentIntent
+	err := s.post(ctx, "/payment_intents", form, input.IdempotencyKey, &intent)
+	if err != nil {
+		return payments.PaymentIntent{}, err
+	}
+	return intent.toPaymentIntent(), nil
+}
+
+// Capture implements payments.PaymentProvider.
+func (s *stripeProvider) Capture(ctx context.Context, intentID string, amount int, idempotencyKey string) (payments.PaymentIntent, error) {
+	form := url.Values{}
+	form.Set("amount_to_capture", strconv.Itoa(amount))
+	var intent stripePaymentIntent
+	err := s.post(ctx, "/payment_intents/"+url.PathEscape(intentID)+"/capture", form, idempotencyKey, &intent)
+	if err != nil {
+		return payments.PaymentIntent{}, err
+	}
+	return intent.toPaymentIntent(), nil
+}
+
+// Void implements payments.PaymentProvider.
+func (s *stripeProvider) Void(ctx context.Context, intentID string, idempotencyKey string) (payments.PaymentIntent, error) {
+	var intent stripePaymentIntent
+	err := s.post(ctx, "/payment_intents/"+url.PathEscape(intentID)+"/cancel", url.Values{}, idempotencyKey, &intent)
+	if err != nil {
+		return payments.PaymentIntent{}, err
+	}
+	return intent.toPaymentIntent(), nil
+}
+
+// Refund implements payments.PaymentProvider.
+func (s *stripeProvider) Refund(ctx context.Context, intentID string, amount int, idempotencyKey string) (payments.ProviderRefund, error) {
+	form := url.Values{}
+	form.Set("payment_intent", intentID)
+	form.Set("amount", strconv.Itoa(amount))
+	var refund struct {
+		ID     string `json:"id"`
+		Amount int    `json:"amount"`
+	}
+	err := s.post(ctx, "/refunds", form, idempotencyKey, &refund)
+	if err != nil {
+		return payments.ProviderRefund{}, err
+	}
+	return payments.ProviderRefund{ID: refund.ID, IntentID: intentID, Amount: refund.Amount}, nil
+}
+
+type stripeEvent struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		Object struct {
+			ID             string `json:"id"`
+			Object         string `json:"object"`
+			AmountReceived int    `json:"amount_received"`
+			AmountRefunded int    `json:"amount_refunded"`
+			PaymentIntent  string `json:"payment_intent"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+// verifySignature verifies a Stripe-Signature header, of the form t=<timestamp>,v1=<signature>,
+// where the signature is a HMAC-SHA256 of the timestamp and the payload with the webhook secret
+func verifySignature(secret string, payload []byte, header string) error {
+	if secret == "" {
+		return fmt.Errorf("no webhook secret configured")
+	}
+	var timestamp string
+	signatures := make([]string, 0)
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid signature timestamp")
+	}
+	if time.Since(time.Unix(seconds, 0)) > webhookTolerance {
+		return fmt.Errorf("signature timestamp is too old")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+	for _, signature := range signatures {
+		actual, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(actual, expected) {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid signature")
+}
+
+// ParseWebhook implements payments.PaymentProvider.
+func (s *stripeProvider) ParseWebhook(payload []byte, signature string) (payments.ProviderEvent, error) {
+	if err := verifySignature(s.webhookSecret, payload, signature); err != nil {
+		return payments.ProviderEvent{}, err
+	}
+	var event stripeEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return payments.ProviderEvent{}, fmt.Errorf("failed to parse event: %w", err)
+	}
+	object := event.Data.Object
+	providerEvent := payments.ProviderEvent{
+		ID:        event.ID,
+		Type:      payments.ProviderEventUnknown,
+		IntentID:  object.ID,
+		CreatedAt: time.Unix(event.Created, 0).UTC(),
+	}
+	switch event.Type {
+	case "payment_intent.amount_capturable_updated":
+		providerEvent.Type = payments.ProviderEventAuthorised
+	case "payment_intent.succeeded":
+		providerEvent.Type = payments.ProviderEventCaptured
+		providerEvent.Amount = object.AmountReceived
+	case "payment_intent.canceled":
+		providerEvent.Type = payments.ProviderEventVoided
+	case "payment_intent.payment_failed":
+		providerEvent.Type = payments.ProviderEventFailed
+	case "charge.refunded":
+		providerEvent.Type = payments.ProviderEventRefunded
+		providerEvent.IntentID = object.PaymentIntent
+		providerEvent.Amount = object.AmountRefunded
+	}
+	return providerEvent, nil
+}
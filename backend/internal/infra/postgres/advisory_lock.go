@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type advisoryLocker struct {
+	pool *pgxpool.Pool
+}
+
+func NewAdvisoryLocker(pool *pgxpool.Pool) core.Locker {
+	return &advisoryLocker{pool: pool}
+}
+
+// TryWithLock implements core.Locker.
+// The lock is a transaction level advisory lock, so it is released when the transaction ends,
+// which also works when connecting through pgbouncer
+func (l *advisoryLocker) TryWithLock(ctx context.Context, name string, fn func(ctx context.Context) error) (bool, error) {
+	tx, err := l.pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var acquired bool
+	err = tx.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock(hashtext($1))", name).Scan(&acquired)
+	if err != nil {
+		return false, err
+	}
+	if !acquired {
+		return false, nil
+	}
+	err = fn(ctx)
+	if err != nil {
+		return true, err
+	}
+	return true, tx.Commit(ctx)
+}
@@ -0,0 +1,3 @@
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS free_waiting_until;
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS driver_arrived_at;
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS pickup_geofence_radius;
@@ -0,0 +1,3 @@
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS pickup_geofence_radius DOUBLE PRECISION NULL;
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS driver_arrived_at TIMESTAMP WITH TIME ZONE NULL;
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS free_waiting_until TIMESTAMP WITH TIME ZONE NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ride_cancellations;
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS accepted_at;
@@ -0,0 +1,15 @@
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS accepted_at TIMESTAMP WITH TIME ZONE NULL;
+
+CREATE TABLE IF NOT EXISTS ride_cancellations (
+    id SERIAL PRIMARY KEY,
+    ride_id int references ride_requests(id),
+    cancelled_by int references users(id),
+    party text,
+    fee_party text,
+    reason text,
+    fee int default(0),
+    currency text default('EUR'),
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS ride_cancellations_cancelled_by_index ON ride_cancellations(cancelled_by, created_at);
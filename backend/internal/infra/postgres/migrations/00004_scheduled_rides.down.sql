@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS ride_requests_scheduled_pickup_at_index;
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS driver_reminded_at;
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS rider_reminded_at;
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS scheduled_pickup_at;
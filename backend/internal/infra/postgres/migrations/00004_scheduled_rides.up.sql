@@ -0,0 +1,5 @@
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS scheduled_pickup_at TIMESTAMP WITH TIME ZONE NULL;
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS rider_reminded_at TIMESTAMP WITH TIME ZONE NULL;
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS driver_reminded_at TIMESTAMP WITH TIME ZONE NULL;
+
+CREATE INDEX IF NOT EXISTS ride_requests_scheduled_pickup_at_index ON ride_requests(state, scheduled_pickup_at);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS ride_stops (
+    id SERIAL PRIMARY KEY,
+    ride_id int references ride_requests(id),
+    stop_order int,
+    lat DOUBLE PRECISION,
+    lng DOUBLE PRECISION,
+    name text,
+    state int default(0),
+    completed_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX IF NOT EXISTS ride_stops_ride_id_index ON ride_stops(ride_id, stop_order);
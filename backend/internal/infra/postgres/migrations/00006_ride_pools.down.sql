@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS ride_requests_pool_id_index;
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS pool_id;
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS seats;
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS pooled;
+DROP TABLE IF EXISTS ride_pools;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS ride_pools (
+    id SERIAL PRIMARY KEY,
+    stops_json text,
+    distance DOUBLE PRECISION,
+    duration DOUBLE PRECISION,
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS pooled BOOLEAN DEFAULT(false);
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS seats int DEFAULT(1);
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS pool_id int references ride_pools(id) NULL;
+
+CREATE INDEX IF NOT EXISTS ride_requests_pool_id_index ON ride_requests(pool_id);
@@ -0,0 +1,2 @@
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS vehicle_class;
+ALTER TABLE vehicles DROP COLUMN IF EXISTS class;
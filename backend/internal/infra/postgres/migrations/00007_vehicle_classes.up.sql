@@ -0,0 +1,2 @@
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS class text DEFAULT('economy');
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS vehicle_class text DEFAULT('economy');
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS driver_availability;
+DROP INDEX IF EXISTS driver_shifts_driver_id_index;
+DROP TABLE IF EXISTS driver_shifts;
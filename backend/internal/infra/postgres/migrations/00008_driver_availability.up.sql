@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS driver_shifts (
+    id SERIAL PRIMARY KEY,
+    driver_id int references users(id),
+    vehicle_id int references vehicles(id),
+    started_at TIMESTAMP WITH TIME ZONE,
+    ended_at TIMESTAMP WITH TIME ZONE NULL,
+    end_reason text NULL
+);
+
+CREATE INDEX IF NOT EXISTS driver_shifts_driver_id_index ON driver_shifts(driver_id, started_at);
+
+CREATE TABLE IF NOT EXISTS driver_availability (
+    driver_id int PRIMARY KEY references users(id),
+    state int default(0),
+    vehicle_id int references vehicles(id) NULL,
+    shift_id int references driver_shifts(id) NULL,
+    online_at TIMESTAMP WITH TIME ZONE NULL,
+    updated_at TIMESTAMP WITH TIME ZONE
+);
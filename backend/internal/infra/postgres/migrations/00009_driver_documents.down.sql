@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS driver_documents_state_index;
+DROP INDEX IF EXISTS driver_documents_driver_id_index;
+DROP TABLE IF EXISTS driver_documents;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
@@ -0,0 +1,26 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role text NOT NULL DEFAULT('user');
+
+CREATE TABLE IF NOT EXISTS driver_documents (
+    id SERIAL PRIMARY KEY,
+    driver_id int references users(id),
+    type text,
+    state int default(0),
+    file_name text,
+    content_type text,
+    blob_key text,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    reviewed_by int references users(id) NULL,
+    reviewed_at TIMESTAMP WITH TIME ZONE NULL,
+    rejection_reason text NULL,
+    expiry_reminded_at TIMESTAMP WITH TIME ZONE NULL,
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS driver_documents_driver_id_index ON driver_documents(driver_id, created_at);
+CREATE INDEX IF NOT EXISTS driver_documents_state_index ON driver_documents(state, expires_at);
+
+-- Drivers have not uploaded documents yet, so only simulated drivers may stay online
+UPDATE driver_shifts SET ended_at = now(), end_reason = 'unverified'
+    WHERE ended_at IS NULL AND driver_id IN (SELECT id FROM users WHERE simulated IS NOT TRUE);
+UPDATE driver_availability SET state = 0, vehicle_id = NULL, shift_id = NULL, online_at = NULL, updated_at = now()
+    WHERE driver_id IN (SELECT id FROM users WHERE simulated IS NOT TRUE);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS ride_ratings_ratee_id_index;
+DROP TABLE IF EXISTS ride_ratings;
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS finished_at;
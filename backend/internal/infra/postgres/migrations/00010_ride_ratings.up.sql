@@ -0,0 +1,17 @@
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS finished_at TIMESTAMP WITH TIME ZONE NULL;
+UPDATE ride_requests SET finished_at = updated_at WHERE state = 3 AND finished_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS ride_ratings (
+    id SERIAL PRIMARY KEY,
+    ride_id int references ride_requests(id),
+    rater_id int references users(id),
+    ratee_id int references users(id),
+    rater_party text,
+    stars int,
+    tags text[] DEFAULT('{}'),
+    comment text NULL,
+    created_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (ride_id, rater_id)
+);
+
+CREATE INDEX IF NOT EXISTS ride_ratings_ratee_id_index ON ride_ratings(ratee_id, rater_party, created_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS ride_line_items_tip_index;
+DROP INDEX IF EXISTS ride_line_items_ride_id_index;
+DROP TABLE IF EXISTS ride_line_items;
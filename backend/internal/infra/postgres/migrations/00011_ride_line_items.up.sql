@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS ride_line_items (
+    id SERIAL PRIMARY KEY,
+    ride_id int references ride_requests(id),
+    type text,
+    amount int,
+    currency text,
+    created_by int references users(id),
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS ride_line_items_ride_id_index ON ride_line_items(ride_id);
+-- A ride can only be tipped once
+CREATE UNIQUE INDEX IF NOT EXISTS ride_line_items_tip_index ON ride_line_items(ride_id) WHERE type = 'tip';
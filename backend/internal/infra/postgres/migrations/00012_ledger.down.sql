@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS ledger_postings_immutable ON ledger_postings;
+DROP TRIGGER IF EXISTS journal_entries_immutable ON journal_entries;
+DROP FUNCTION IF EXISTS ledger_immutable;
+DROP INDEX IF EXISTS ledger_postings_owner_index;
+DROP INDEX IF EXISTS ledger_postings_entry_id_index;
+DROP TABLE IF EXISTS ledger_postings;
+DROP TABLE IF EXISTS journal_entries;
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id SERIAL PRIMARY KEY,
+    type text,
+    reference text UNIQUE,
+    description text,
+    currency text,
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS ledger_postings (
+    id SERIAL PRIMARY KEY,
+    entry_id int references journal_entries(id),
+    account_type text,
+    -- User owning a rider or driver account, 0 for platform accounts
+    owner_id int,
+    amount bigint,
+    currency text
+);
+
+CREATE INDEX IF NOT EXISTS ledger_postings_entry_id_index ON ledger_postings(entry_id);
+CREATE INDEX IF NOT EXISTS ledger_postings_owner_index ON ledger_postings(owner_id, account_type, entry_id);
+
+-- Journal entries are immutable, corrections are recorded as new entries
+CREATE OR REPLACE FUNCTION ledger_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger entries are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER journal_entries_immutable BEFORE UPDATE OR DELETE ON journal_entries
+    FOR EACH ROW EXECUTE FUNCTION ledger_immutable();
+CREATE TRIGGER ledger_postings_immutable BEFORE UPDATE OR DELETE ON ledger_postings
+    FOR EACH ROW EXECUTE FUNCTION ledger_immutable();
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS payment_events;
+DROP INDEX IF EXISTS ride_payments_ride_id_index;
+DROP TABLE IF EXISTS ride_payments;
+DROP TABLE IF EXISTS payment_customers;
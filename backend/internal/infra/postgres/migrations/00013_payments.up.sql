@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS payment_customers (
+    user_id int PRIMARY KEY references users(id),
+    customer_id text,
+    payment_method_id text,
+    card_brand text,
+    card_last4 text,
+    updated_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS ride_payments (
+    id SERIAL PRIMARY KEY,
+    ride_id int references ride_requests(id),
+    rider_id int references users(id),
+    intent_id text UNIQUE,
+    state int,
+    amount bigint,
+    captured_amount bigint,
+    currency text,
+    created_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS ride_payments_ride_id_index ON ride_payments(ride_id);
+
+-- Webhook events that have been processed, providers may send an event more than once
+CREATE TABLE IF NOT EXISTS payment_events (
+    id text PRIMARY KEY,
+    type text,
+    intent_id text,
+    amount bigint,
+    created_at TIMESTAMP WITH TIME ZONE,
+    processed_at TIMESTAMP WITH TIME ZONE
+);
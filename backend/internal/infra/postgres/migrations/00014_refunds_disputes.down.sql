@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS ride_breadcrumbs_ride_id_index;
+DROP TABLE IF EXISTS ride_breadcrumbs;
+DROP INDEX IF EXISTS ride_disputes_state_index;
+DROP INDEX IF EXISTS ride_disputes_open_index;
+DROP TABLE IF EXISTS ride_disputes;
+DROP TRIGGER IF EXISTS ride_refunds_immutable ON ride_refunds;
+DROP INDEX IF EXISTS ride_refunds_ride_id_index;
+DROP TABLE IF EXISTS ride_refunds;
+ALTER TABLE ride_payments DROP COLUMN IF EXISTS refunded_amount;
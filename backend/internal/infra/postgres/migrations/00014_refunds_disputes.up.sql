@@ -0,0 +1,49 @@
+ALTER TABLE ride_payments ADD COLUMN IF NOT EXISTS refunded_amount bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS ride_refunds (
+    id SERIAL PRIMARY KEY,
+    ride_id int references ride_requests(id),
+    type text,
+    amount bigint,
+    currency text,
+    reason text,
+    note text,
+    issued_by int references users(id),
+    issuer_role text,
+    dispute_id int null,
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS ride_refunds_ride_id_index ON ride_refunds(ride_id);
+
+-- Refunds are the audit trail of fare corrections and are never changed
+CREATE TRIGGER ride_refunds_immutable BEFORE UPDATE OR DELETE ON ride_refunds
+    FOR EACH ROW EXECUTE FUNCTION ledger_immutable();
+
+CREATE TABLE IF NOT EXISTS ride_disputes (
+    id SERIAL PRIMARY KEY,
+    ride_id int references ride_requests(id),
+    rider_id int references users(id),
+    reason text,
+    description text,
+    state int,
+    resolved_by int null references users(id),
+    resolved_at TIMESTAMP WITH TIME ZONE NULL,
+    resolution_note text NULL,
+    refund_id int null references ride_refunds(id),
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+-- A ride has at most one open dispute
+CREATE UNIQUE INDEX IF NOT EXISTS ride_disputes_open_index ON ride_disputes(ride_id) WHERE state = 0;
+CREATE INDEX IF NOT EXISTS ride_disputes_state_index ON ride_disputes(state, created_at);
+
+CREATE TABLE IF NOT EXISTS ride_breadcrumbs (
+    id SERIAL PRIMARY KEY,
+    ride_id int references ride_requests(id),
+    lat DOUBLE PRECISION,
+    lng DOUBLE PRECISION,
+    recorded_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS ride_breadcrumbs_ride_id_index ON ride_breadcrumbs(ride_id, recorded_at);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS promotion_redemptions_ride_id_index;
+DROP TABLE IF EXISTS promotion_redemptions;
+DROP TABLE IF EXISTS promotion_user_counts;
+DROP TABLE IF EXISTS promotions;
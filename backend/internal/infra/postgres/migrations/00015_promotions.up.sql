@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS promotions (
+    id SERIAL PRIMARY KEY,
+    code text UNIQUE,
+    discount_type text,
+    percent_off int,
+    amount_off bigint,
+    currency text,
+    max_discount bigint,
+    valid_from TIMESTAMP WITH TIME ZONE NULL,
+    valid_until TIMESTAMP WITH TIME ZONE NULL,
+    cities text[],
+    first_ride_only boolean,
+    -- 0 if unlimited
+    per_user_limit int,
+    global_limit int,
+    stackable boolean,
+    active boolean,
+    redemptions int NOT NULL DEFAULT 0,
+    created_by int references users(id),
+    created_at TIMESTAMP WITH TIME ZONE,
+    -- Redeeming fails instead of exceeding the limit, also under concurrent use
+    CONSTRAINT promotions_global_limit CHECK (global_limit = 0 OR redemptions <= global_limit)
+);
+
+CREATE TABLE IF NOT EXISTS promotion_user_counts (
+    promotion_id int references promotions(id),
+    user_id int references users(id),
+    count int NOT NULL,
+    max_count int NOT NULL,
+    PRIMARY KEY (promotion_id, user_id),
+    CONSTRAINT promotion_user_counts_limit CHECK (max_count = 0 OR count <= max_count)
+);
+
+CREATE TABLE IF NOT EXISTS promotion_redemptions (
+    id SERIAL PRIMARY KEY,
+    promotion_id int references promotions(id),
+    code text,
+    user_id int references users(id),
+    ride_id int null references ride_requests(id),
+    state int,
+    discount bigint NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS promotion_redemptions_ride_id_index ON promotion_redemptions(ride_id);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS referrals_referrer_id_index;
+DROP TABLE IF EXISTS referrals;
+DROP INDEX IF EXISTS user_devices_device_id_index;
+DROP TABLE IF EXISTS user_devices;
+DROP TABLE IF EXISTS referral_codes;
+ALTER TABLE payment_customers DROP COLUMN IF EXISTS card_fingerprint;
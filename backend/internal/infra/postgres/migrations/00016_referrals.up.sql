@@ -0,0 +1,34 @@
+ALTER TABLE payment_customers ADD COLUMN IF NOT EXISTS card_fingerprint text NOT NULL DEFAULT('');
+
+CREATE TABLE IF NOT EXISTS referral_codes (
+    user_id int PRIMARY KEY references users(id),
+    code text NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS user_devices (
+    user_id int references users(id),
+    device_id text NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (user_id, device_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_devices_device_id_index ON user_devices(device_id);
+
+CREATE TABLE IF NOT EXISTS referrals (
+    id SERIAL PRIMARY KEY,
+    referrer_id int references users(id),
+    -- A user can only be referred once
+    referee_id int UNIQUE references users(id),
+    code text NOT NULL,
+    state int NOT NULL,
+    rejection_reason text NULL,
+    ride_id int NULL references ride_requests(id),
+    referrer_reward bigint NOT NULL DEFAULT 0,
+    referee_reward bigint NOT NULL DEFAULT 0,
+    currency text NULL,
+    created_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS referrals_referrer_id_index ON referrals(referrer_id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS billing_profiles;
+DROP TABLE IF EXISTS invoices;
+DROP TABLE IF EXISTS invoice_series;
+ALTER TABLE users DROP COLUMN IF EXISTS email;
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS vehicle_id;
@@ -0,0 +1,37 @@
+-- The vehicle the driver used for the ride, set when the ride is claimed
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS vehicle_id int NULL references vehicles(id);
+
+-- Address receipts and invoices are emailed to
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email text NOT NULL DEFAULT('');
+
+-- Last number given in each invoice series
+CREATE TABLE IF NOT EXISTS invoice_series (
+    series text PRIMARY KEY,
+    last_number bigint NOT NULL DEFAULT 0
+);
+
+INSERT INTO invoice_series (series, last_number) VALUES ('R', 0), ('M', 0)
+ON CONFLICT (series) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS invoices (
+    id SERIAL PRIMARY KEY,
+    series text NOT NULL references invoice_series(series),
+    number bigint NOT NULL,
+    user_id int NOT NULL references users(id),
+    -- Set for receipts, a ride has one receipt
+    ride_id int NULL UNIQUE references ride_requests(id),
+    -- Set for monthly invoices, a month of a user is invoiced once
+    period_start TIMESTAMP WITH TIME ZONE NULL,
+    created_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (series, number),
+    UNIQUE (user_id, period_start)
+);
+
+CREATE TABLE IF NOT EXISTS billing_profiles (
+    user_id int PRIMARY KEY references users(id),
+    company_name text NOT NULL,
+    vat_number text NOT NULL DEFAULT(''),
+    address text NOT NULL,
+    monthly_invoice boolean NOT NULL DEFAULT(false),
+    updated_at TIMESTAMP WITH TIME ZONE
+);
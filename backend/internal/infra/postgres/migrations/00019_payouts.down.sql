@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS payouts;
+DROP TABLE IF EXISTS payout_batches;
+DROP TABLE IF EXISTS payout_accounts;
+DROP TABLE IF EXISTS commission_rates;
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS commission_rate;
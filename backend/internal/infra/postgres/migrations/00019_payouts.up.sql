@@ -0,0 +1,46 @@
+-- Share of the fare the platform took as commission, set when the ride finishes
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS commission_rate double precision NOT NULL DEFAULT(0);
+
+-- Commission rate of rides in a city and vehicle class. An empty city or class applies to all cities or classes
+CREATE TABLE IF NOT EXISTS commission_rates (
+    city_id text NOT NULL,
+    vehicle_class text NOT NULL,
+    rate double precision NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (city_id, vehicle_class)
+);
+
+-- Bank account driver earnings are paid out to
+CREATE TABLE IF NOT EXISTS payout_accounts (
+    driver_id int PRIMARY KEY references users(id),
+    holder_name text NOT NULL,
+    iban text NOT NULL,
+    bic text NOT NULL DEFAULT(''),
+    updated_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS payout_batches (
+    id SERIAL PRIMARY KEY,
+    currency text NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS payouts (
+    id SERIAL PRIMARY KEY,
+    batch_id int NOT NULL references payout_batches(id),
+    driver_id int NOT NULL references users(id),
+    amount bigint NOT NULL,
+    currency text NOT NULL,
+    state text NOT NULL,
+    -- Copied from the payout account when the payout is created
+    holder_name text NOT NULL,
+    iban text NOT NULL,
+    bic text NOT NULL,
+    failure_reason text NULL,
+    created_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS payouts_batch_id_index ON payouts(batch_id);
+CREATE INDEX IF NOT EXISTS payouts_driver_id_index ON payouts(driver_id, created_at);
+CREATE INDEX IF NOT EXISTS payouts_state_index ON payouts(state);
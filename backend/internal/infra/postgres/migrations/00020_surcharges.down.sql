@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS ride_extras;
+DROP TABLE IF EXISTS surcharge_zones;
+DROP INDEX IF EXISTS ride_line_items_surcharge_index;
+ALTER TABLE ride_line_items DROP COLUMN IF EXISTS description;
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS started_at;
@@ -0,0 +1,39 @@
+-- Set when the driver starts the ride with the rider on board
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS started_at TIMESTAMP WITH TIME ZONE NULL;
+
+-- Shown on receipts, for example the name of the zone a fee was charged for
+ALTER TABLE ride_line_items ADD COLUMN IF NOT EXISTS description text NOT NULL DEFAULT('');
+-- Surcharges added when a ride finishes are added once, also if the ride is finished again
+CREATE UNIQUE INDEX IF NOT EXISTS ride_line_items_surcharge_index ON ride_line_items(ride_id, type, description)
+    WHERE type IN ('waiting_time', 'toll', 'airport_fee', 'zone_fee');
+
+-- Area a fee is charged for entering during a ride. The fee is in minor units of the base currency
+CREATE TABLE IF NOT EXISTS surcharge_zones (
+    id SERIAL PRIMARY KEY,
+    name text NOT NULL,
+    type text NOT NULL,
+    polygon jsonb NOT NULL,
+    fee int NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Fee logged by the driver, charged to the rider once approved by support
+CREATE TABLE IF NOT EXISTS ride_extras (
+    id SERIAL PRIMARY KEY,
+    ride_id int NOT NULL references ride_requests(id),
+    driver_id int NOT NULL references users(id),
+    type text NOT NULL,
+    amount int NOT NULL,
+    currency text NOT NULL,
+    description text NOT NULL,
+    state int NOT NULL,
+    reviewed_by int NULL references users(id),
+    reviewed_at TIMESTAMP WITH TIME ZONE NULL,
+    review_note text NULL,
+    line_item_id int NULL references ride_line_items(id),
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS ride_extras_ride_id_index ON ride_extras(ride_id);
+CREATE INDEX IF NOT EXISTS ride_extras_state_index ON ride_extras(state);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS ride_requests_organisation_id_index;
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS expense_code;
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS organisation_id;
+DROP TABLE IF EXISTS organisation_policies;
+DROP TABLE IF EXISTS organisation_invites;
+DROP TABLE IF EXISTS organisation_members;
+DROP TABLE IF EXISTS organisations;
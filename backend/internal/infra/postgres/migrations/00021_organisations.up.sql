@@ -0,0 +1,58 @@
+-- Organisation billed centrally for the rides its members bill to it
+CREATE TABLE IF NOT EXISTS organisations (
+    id SERIAL PRIMARY KEY,
+    name text NOT NULL,
+    billing_email text NOT NULL,
+    vat_number text NOT NULL DEFAULT(''),
+    address text NOT NULL DEFAULT(''),
+    created_by int NOT NULL references users(id),
+    created_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS organisation_members (
+    organisation_id int NOT NULL references organisations(id),
+    user_id int NOT NULL references users(id),
+    role text NOT NULL,
+    joined_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (organisation_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS organisation_members_user_id_index ON organisation_members(user_id);
+
+CREATE TABLE IF NOT EXISTS organisation_invites (
+    id SERIAL PRIMARY KEY,
+    organisation_id int NOT NULL references organisations(id),
+    email text NOT NULL,
+    role text NOT NULL,
+    state int NOT NULL,
+    invited_by int NOT NULL references users(id),
+    accepted_by int NULL references users(id),
+    created_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE
+);
+
+-- An address can have one pending invite to an organisation
+CREATE UNIQUE INDEX IF NOT EXISTS organisation_invites_pending_index ON organisation_invites(organisation_id, lower(email)) WHERE state = 0;
+CREATE INDEX IF NOT EXISTS organisation_invites_email_index ON organisation_invites(lower(email));
+
+-- Rules the rides members bill to the organisation must follow. Empty values do not restrict rides
+CREATE TABLE IF NOT EXISTS organisation_policies (
+    organisation_id int PRIMARY KEY references organisations(id),
+    -- Pickup times of day rides are allowed at, as HH:MM in the time zone
+    allowed_from text NOT NULL DEFAULT(''),
+    allowed_until text NOT NULL DEFAULT(''),
+    weekdays int[] NOT NULL DEFAULT('{}'),
+    time_zone text NOT NULL DEFAULT('UTC'),
+    vehicle_classes text[] NOT NULL DEFAULT('{}'),
+    -- In minor units of the base currency
+    max_fare int NULL,
+    require_expense_code boolean NOT NULL DEFAULT(false),
+    expense_codes text[] NOT NULL DEFAULT('{}'),
+    updated_at TIMESTAMP WITH TIME ZONE
+);
+
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS organisation_id int NULL references organisations(id);
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS expense_code text NULL;
+
+CREATE INDEX IF NOT EXISTS ride_requests_organisation_id_index ON ride_requests(organisation_id, created_at) WHERE organisation_id IS NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS free_waiting_ended_at;
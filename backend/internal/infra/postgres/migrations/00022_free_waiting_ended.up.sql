@@ -0,0 +1,2 @@
+-- Set when the rider is notified that the free waiting time is over
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS free_waiting_ended_at TIMESTAMP WITH TIME ZONE NULL;
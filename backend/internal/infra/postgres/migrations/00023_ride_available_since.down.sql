@@ -0,0 +1 @@
+ALTER TABLE ride_requests DROP COLUMN IF EXISTS available_since;
@@ -0,0 +1,3 @@
+-- When the ride last became available to drivers, rides expire if not claimed within the TTL of it
+ALTER TABLE ride_requests ADD COLUMN IF NOT EXISTS available_since TIMESTAMP WITH TIME ZONE NULL;
+UPDATE ride_requests SET available_since = updated_at WHERE state = 0;
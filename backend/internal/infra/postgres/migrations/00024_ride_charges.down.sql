@@ -0,0 +1 @@
+ALTER TABLE ride_payments DROP COLUMN IF EXISTS reference;
@@ -0,0 +1,2 @@
+-- Charges for amounts added to a ride after it finished, like tips, are identified by a reference. The hold on the fare has none
+ALTER TABLE ride_payments ADD COLUMN IF NOT EXISTS reference text NULL UNIQUE;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS ride_line_items_promotion_index;
@@ -0,0 +1,3 @@
+-- The discount of a promo code is added once per ride, also if the ride is finished again. The description is the code
+CREATE UNIQUE INDEX IF NOT EXISTS ride_line_items_promotion_index ON ride_line_items(ride_id, description)
+    WHERE type = 'promotion' AND description <> '';
@@ -0,0 +1 @@
+ALTER TABLE organisation_invites DROP COLUMN IF EXISTS token_hash;
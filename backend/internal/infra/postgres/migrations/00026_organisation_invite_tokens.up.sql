@@ -0,0 +1,4 @@
+-- Hash of the single use token mailed with an invite, which the invite is accepted with
+ALTER TABLE organisation_invites ADD COLUMN IF NOT EXISTS token_hash text NULL;
+-- Pending invites were accepted by the unverified email address of the user. They are revoked, so they can be sent again with a token
+UPDATE organisation_invites SET state = 2 WHERE state = 0 AND token_hash IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS ride_alerts_created_at_index;
+DROP TABLE IF EXISTS ride_alerts;
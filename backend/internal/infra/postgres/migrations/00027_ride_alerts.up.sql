@@ -0,0 +1,14 @@
+-- Alerts raised by the ride monitor, shared by all replicas
+CREATE TABLE IF NOT EXISTS ride_alerts (
+    id SERIAL PRIMARY KEY,
+    type text,
+    ride_id int references ride_requests(id),
+    driver_id int references users(id),
+    vehicle_id int references vehicles(id),
+    lat double precision,
+    lng double precision,
+    message text,
+    created_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS ride_alerts_created_at_index ON ride_alerts(created_at);
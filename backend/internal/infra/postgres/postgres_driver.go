@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/drivers"
+)
+
+type postgresDriverRepository struct {
+	conn Connection
+}
+
+func NewPostgresDriver(conn Connection) drivers.DriverRepository {
+	return &postgresDriverRepository{conn: conn}
+}
+
+const driverAvailabilityColumns = "driver_id, state, vehicle_id, shift_id, online_at, updated_at"
+
+func (p *postgresDriverRepository) fetch(ctx context.Context, query string, args ...interface{}) ([]drivers.DriverAvailability, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dd := make([]drivers.DriverAvailability, 0)
+	for rows.Next() {
+		var d drivers.DriverAvailability
+		if err := rows.Scan(
+			&d.DriverID,
+			&d.State,
+			&d.VehicleID,
+			&d.ShiftID,
+			&d.OnlineAt,
+			&d.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		dd = append(dd, d)
+	}
+	return dd, nil
+}
+
+// GetAvailability implements drivers.DriverRepository.
+func (p *postgresDriverRepository) GetAvailability(ctx context.Context, driverID int64) (drivers.DriverAvailability, error) {
+	sql := fmt.Sprintf("SELECT %v FROM driver_availability WHERE driver_id = $1", driverAvailabilityColumns)
+	availabilities, err := p.fetch(ctx, sql, driverID)
+	if err != nil {
+		return drivers.DriverAvailability{}, err
+	}
+	if len(availabilities) == 0 {
+		return drivers.DriverAvailability{DriverID: driverID, State: drivers.AvailabilityOffline}, nil
+	}
+	return availabilities[0], nil
+}
+
+// GetByState implements drivers.DriverRepository.
+func (p *postgresDriverRepository) GetByState(ctx context.Context, state drivers.AvailabilityState) ([]drivers.DriverAvailability, error) {
+	sql := fmt.Sprintf("SELECT %v FROM driver_availability WHERE state = $1", driverAvailabilityColumns)
+	return p.fetch(ctx, sql, state)
+}
+
+// StartShift implements drivers.DriverRepository.
+func (p *postgresDriverRepository) StartShift(ctx context.Context, driverID int64, vehicleID int64, startedAt time.Time) (drivers.Shift, error) {
+	shift := drivers.Shift{
+		DriverID:  driverID,
+		VehicleID: vehicleID,
+		StartedAt: startedAt,
+	}
+	sql := `WITH shift AS (
+				INSERT INTO driver_shifts (driver_id, vehicle_id, started_at) VALUES ($1, $2, $3) RETURNING id
+			)
+			INSERT INTO driver_availability (driver_id, state, vehicle_id, shift_id, online_at, updated_at)
+			SELECT $1, $4, $2, id, $3, $3 FROM shift
+			ON CONFLICT (driver_id) DO UPDATE SET state = EXCLUDED.state, vehicle_id = EXCLUDED.vehicle_id,
+				shift_id = EXCLUDED.shift_id, online_at = EXCLUDED.online_at, updated_at = EXCLUDED.updated_at
+			RETURNING shift_id`
+	err := p.conn.QueryRow(ctx, sql, driverID, vehicleID, startedAt, drivers.AvailabilityIdle).Scan(&shift.ID)
+	return shift, err
+}
+
+// EndShift implements drivers.DriverRepository.
+func (p *postgresDriverRepository) EndShift(ctx context.Context, driverID int64, endedAt time.Time, reason string) error {
+	sql := "UPDATE driver_shifts SET ended_at = $2, end_reason = $3 WHERE driver_id = $1 AND ended_at IS NULL"
+	_, err := p.conn.Exec(ctx, sql, driverID, endedAt, reason)
+	if err != nil {
+		return err
+	}
+	sql = `UPDATE driver_availability SET state = $2, vehicle_id = NULL, shift_id = NULL, online_at = NULL, updated_at = $3
+			WHERE driver_id = $1`
+	_, err = p.conn.Exec(ctx, sql, driverID, drivers.AvailabilityOffline, endedAt)
+	return err
+}
+
+// UpdateState implements drivers.DriverRepository.
+func (p *postgresDriverRepository) UpdateState(ctx context.Context, driverID int64, state drivers.AvailabilityState) error {
+	sql := "UPDATE driver_availability SET state = $2, updated_at = $3 WHERE driver_id = $1 AND state != $4"
+	_, err := p.conn.Exec(ctx, sql, driverID, state, time.Now().UTC(), drivers.AvailabilityOffline)
+	return err
+}
+
+// GetInactive implements drivers.DriverRepository.
+func (p *postgresDriverRepository) GetInactive(ctx context.Context, lastSeenBefore time.Time) ([]drivers.DriverAvailability, error) {
+	sql := `SELECT da.driver_id, da.state, da.vehicle_id, da.shift_id, da.online_at, da.updated_at FROM driver_availability da
+			LEFT JOIN vehicle_positions vp ON vp.vehicle_id = da.vehicle_id
+			WHERE da.state != $1 AND GREATEST(da.online_at, vp.recorded_at) < $2`
+	return p.fetch(ctx, sql, drivers.AvailabilityOffline, lastSeenBefore)
+}
+
+// GetShifts implements drivers.DriverRepository.
+func (p *postgresDriverRepository) GetShifts(ctx context.Context, driverID int64, limit int) ([]drivers.Shift, error) {
+	sql := fmt.Sprintf(`SELECT %v FROM driver_shifts
+			WHERE driver_id = $1 ORDER BY started_at DESC LIMIT $2`, shiftColumns)
+	return p.fetchShifts(ctx, sql, driverID, limit)
+}
+
+// GetShiftsBetween implements drivers.DriverRepository.
+func (p *postgresDriverRepository) GetShiftsBetween(ctx context.Context, driverID int64, from time.Time, to time.Time) ([]drivers.Shift, error) {
+	sql := fmt.Sprintf(`SELECT %v FROM driver_shifts
+			WHERE driver_id = $1 AND started_at < $3 AND (ended_at IS NULL OR ended_at >= $2)
+			ORDER BY started_at`, shiftColumns)
+	return p.fetchShifts(ctx, sql, driverID, from, to)
+}
+
+const shiftColumns = "id, driver_id, vehicle_id, started_at, ended_at, end_reason"
+
+func (p *postgresDriverRepository) fetchShifts(ctx context.Context, query string, args ...interface{}) ([]drivers.Shift, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	shifts := make([]drivers.Shift, 0)
+	for rows.Next() {
+		var s drivers.Shift
+		if err := rows.Scan(&s.ID, &s.DriverID, &s.VehicleID, &s.StartedAt, &s.EndedAt, &s.EndReason); err != nil {
+			return nil, err
+		}
+		shifts = append(shifts, s)
+	}
+	return shifts, rows.Err()
+}
@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/drivers"
+)
+
+type postgresDocumentRepository struct {
+	conn Connection
+}
+
+func NewPostgresDocument(conn Connection) drivers.DocumentRepository {
+	return &postgresDocumentRepository{conn: conn}
+}
+
+const driverDocumentColumns = "id, driver_id, type, state, file_name, content_type, blob_key, expires_at, reviewed_by, reviewed_at, rejection_reason, expiry_reminded_at, created_at"
+
+func (p *postgresDocumentRepository) fetch(ctx context.Context, query string, args ...interface{}) ([]drivers.DriverDocument, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dd := make([]drivers.DriverDocument, 0)
+	for rows.Next() {
+		var d drivers.DriverDocument
+		if err := rows.Scan(
+			&d.ID,
+			&d.DriverID,
+			&d.Type,
+			&d.State,
+			&d.FileName,
+			&d.ContentType,
+			&d.BlobKey,
+			&d.ExpiresAt,
+			&d.ReviewedBy,
+			&d.ReviewedAt,
+			&d.RejectionReason,
+			&d.ExpiryRemindedAt,
+			&d.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		dd = append(dd, d)
+	}
+	return dd, rows.Err()
+}
+
+// CreateDocument implements drivers.DocumentRepository.
+func (p *postgresDocumentRepository) CreateDocument(ctx context.Context, document *drivers.DriverDocument) error {
+	sql := `INSERT INTO driver_documents (driver_id, type, state, file_name, content_type, blob_key, expires_at, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+	return p.conn.QueryRow(ctx, sql, document.DriverID, document.Type, document.State, document.FileName,
+		document.ContentType, document.BlobKey, document.ExpiresAt, document.CreatedAt).Scan(&document.ID)
+}
+
+// GetDocument implements drivers.DocumentRepository.
+func (p *postgresDocumentRepository) GetDocument(ctx context.Context, id int64) (drivers.DriverDocument, error) {
+	sql := fmt.Sprintf("SELECT %v FROM driver_documents WHERE id = $1", driverDocumentColumns)
+	documents, err := p.fetch(ctx, sql, id)
+	if err != nil {
+		return drivers.DriverDocument{}, err
+	}
+	if len(documents) == 0 {
+		return drivers.DriverDocument{}, core.Errorf(core.ENOTFOUND, "document with id %v not found", id)
+	}
+	return documents[0], nil
+}
+
+// GetDocumentsByDriverID implements drivers.DocumentRepository.
+func (p *postgresDocumentRepository) GetDocumentsByDriverID(ctx context.Context, driverID int64) ([]drivers.DriverDocument, error) {
+	sql := fmt.Sprintf("SELECT %v FROM driver_documents WHERE driver_id = $1 ORDER BY created_at DESC, id DESC", driverDocumentColumns)
+	return p.fetch(ctx, sql, driverID)
+}
+
+// GetDocumentsByState implements drivers.DocumentRepository.
+func (p *postgresDocumentRepository) GetDocumentsByState(ctx context.Context, state drivers.DocumentState) ([]drivers.DriverDocument, error) {
+	sql := fmt.Sprintf("SELECT %v FROM driver_documents WHERE state = $1 ORDER BY created_at", driverDocumentColumns)
+	return p.fetch(ctx, sql, state)
+}
+
+// ReviewDocument implements drivers.DocumentRepository.
+func (p *postgresDocumentRepository) ReviewDocument(ctx context.Context, id int64, state drivers.DocumentState, reviewedBy int64, reviewedAt time.Time, rejectionReason *string) (bool, error) {
+	sql := `UPDATE driver_documents SET state = $2, reviewed_by = $3, reviewed_at = $4, rejection_reason = $5
+			WHERE id = $1 AND state = $6`
+	tag, err := p.conn.Exec(ctx, sql, id, state, reviewedBy, reviewedAt, rejectionReason, drivers.DocumentStatePending)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ExpireDocuments implements drivers.DocumentRepository.
+func (p *postgresDocumentRepository) ExpireDocuments(ctx context.Context, expiresBefore time.Time) ([]drivers.DriverDocument, error) {
+	sql := fmt.Sprintf(`UPDATE driver_documents SET state = $1 WHERE state = $2 AND expires_at < $3
+			RETURNING %v`, driverDocumentColumns)
+	return p.fetch(ctx, sql, drivers.DocumentStateExpired, drivers.DocumentStateApproved, expiresBefore)
+}
+
+// MarkDueExpiryReminders implements drivers.DocumentRepository.
+func (p *postgresDocumentRepository) MarkDueExpiryReminders(ctx context.Context, expiresBefore time.Time) ([]drivers.DriverDocument, error) {
+	sql := fmt.Sprintf(`UPDATE driver_documents SET expiry_reminded_at = $1
+			WHERE state = $2 AND expires_at < $3 AND expiry_reminded_at IS NULL
+			RETURNING %v`, driverDocumentColumns)
+	return p.fetch(ctx, sql, time.Now().UTC(), drivers.DocumentStateApproved, expiresBefore)
+}
@@ -0,0 +1,164 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/samber/lo"
+)
+
+type postgresInvoiceRepository struct {
+	conn Connection
+}
+
+func NewPostgresInvoice(conn Connection) payments.InvoiceRepository {
+	return &postgresInvoiceRepository{conn: conn}
+}
+
+const invoiceColumns = "id, series, number, user_id, ride_id, period_start, created_at"
+
+const billingProfileColumns = "user_id, company_name, vat_number, address, monthly_invoice, updated_at"
+
+func (p *postgresInvoiceRepository) fetch(ctx context.Context, query string, args ...interface{}) ([]payments.Invoice, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invoices := make([]payments.Invoice, 0)
+	for rows.Next() {
+		var i payments.Invoice
+		if err := rows.Scan(&i.ID, &i.Series, &i.Number, &i.UserID, &i.RideID, &i.PeriodStart, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, i)
+	}
+	return invoices, rows.Err()
+}
+
+func (p *postgresInvoiceRepository) fetchBillingProfiles(ctx context.Context, query string, args ...interface{}) ([]payments.BillingProfile, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := make([]payments.BillingProfile, 0)
+	for rows.Next() {
+		var b payments.BillingProfile
+		if err := rows.Scan(&b.UserID, &b.CompanyName, &b.VATNumber, &b.Address, &b.MonthlyInvoice, &b.UpdatedAt); err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, b)
+	}
+	return profiles, rows.Err()
+}
+
+// issue numbers a new invoice unless one matching existingWhere exists.
+// The series counter is incremented in the same statement as the invoice is inserted, so a failed insert leaves no gap
+func (p *postgresInvoiceRepository) issue(ctx context.Context, existingWhere string, series string, userID int64, rideID *int64, periodStart *time.Time, issuedAt time.Time) (payments.Invoice, bool, error) {
+	sql := fmt.Sprintf(`WITH existing AS (
+				SELECT %[1]v FROM invoices WHERE %[2]v
+			), next AS (
+				UPDATE invoice_series SET last_number = last_number + 1
+				WHERE series = $1 AND NOT EXISTS (SELECT 1 FROM existing)
+				RETURNING last_number
+			), inserted AS (
+				INSERT INTO invoices (series, number, user_id, ride_id, period_start, created_at)
+				SELECT $1, next.last_number, $2, $3, $4, $5 FROM next
+				RETURNING %[1]v
+			)
+			SELECT %[1]v, true FROM inserted
+			UNION ALL
+			SELECT %[1]v, false FROM existing`, invoiceColumns, existingWhere)
+	var i payments.Invoice
+	var created bool
+	err := p.conn.QueryRow(ctx, sql, series, userID, rideID, periodStart, issuedAt).
+		Scan(&i.ID, &i.Series, &i.Number, &i.UserID, &i.RideID, &i.PeriodStart, &i.CreatedAt, &created)
+	if err != nil {
+		return payments.Invoice{}, false, err
+	}
+	return i, created, nil
+}
+
+// IssueRideInvoice implements payments.InvoiceRepository.
+func (p *postgresInvoiceRepository) IssueRideInvoice(ctx context.Context, rideID int64, userID int64, issuedAt time.Time) (payments.Invoice, error) {
+	invoice, _, err := p.issue(ctx, "ride_id = $3", payments.InvoiceSeriesReceipt, userID, &rideID, nil, issuedAt)
+	if err != nil {
+		// A concurrent request numbered the ride first
+		invoices, getErr := p.GetRideInvoices(ctx, []int64{rideID})
+		if getErr == nil && len(invoices) > 0 {
+			return invoices[0], nil
+		}
+	}
+	return invoice, err
+}
+
+// IssuePeriodInvoice implements payments.InvoiceRepository.
+func (p *postgresInvoiceRepository) IssuePeriodInvoice(ctx context.Context, userID int64, periodStart time.Time, issuedAt time.Time) (payments.Invoice, bool, error) {
+	invoice, created, err := p.issue(ctx, "user_id = $2 AND period_start = $4", payments.InvoiceSeriesMonthly, userID, nil, &periodStart, issuedAt)
+	if err != nil {
+		existing, getErr := p.GetPeriodInvoice(ctx, userID, periodStart)
+		if getErr == nil && existing != nil {
+			return *existing, false, nil
+		}
+	}
+	return invoice, created, err
+}
+
+// GetPeriodInvoice implements payments.InvoiceRepository.
+func (p *postgresInvoiceRepository) GetPeriodInvoice(ctx context.Context, userID int64, periodStart time.Time) (*payments.Invoice, error) {
+	sql := fmt.Sprintf(`SELECT %v FROM invoices WHERE user_id = $1 AND period_start = $2`, invoiceColumns)
+	invoices, err := p.fetch(ctx, sql, userID, periodStart)
+	if err != nil || len(invoices) == 0 {
+		return nil, err
+	}
+	return &invoices[0], nil
+}
+
+// GetPeriodInvoices implements payments.InvoiceRepository.
+func (p *postgresInvoiceRepository) GetPeriodInvoices(ctx context.Context, userID int64) ([]payments.Invoice, error) {
+	sql := fmt.Sprintf(`SELECT %v FROM invoices WHERE user_id = $1 AND period_start IS NOT NULL ORDER BY period_start DESC`, invoiceColumns)
+	return p.fetch(ctx, sql, userID)
+}
+
+// GetRideInvoices implements payments.InvoiceRepository.
+func (p *postgresInvoiceRepository) GetRideInvoices(ctx context.Context, rideIDs []int64) ([]payments.Invoice, error) {
+	if len(rideIDs) == 0 {
+		return make([]payments.Invoice, 0), nil
+	}
+	rideIdsStr := strings.Join(lo.Map(rideIDs, func(item int64, index int) string { return strconv.FormatInt(item, 10) }), ",")
+	sql := fmt.Sprintf(`SELECT %v FROM invoices WHERE ride_id IN (%v) ORDER BY number`, invoiceColumns, rideIdsStr)
+	return p.fetch(ctx, sql)
+}
+
+// GetBillingProfile implements payments.InvoiceRepository.
+func (p *postgresInvoiceRepository) GetBillingProfile(ctx context.Context, userID int64) (*payments.BillingProfile, error) {
+	sql := fmt.Sprintf(`SELECT %v FROM billing_profiles WHERE user_id = $1`, billingProfileColumns)
+	profiles, err := p.fetchBillingProfiles(ctx, sql, userID)
+	if err != nil || len(profiles) == 0 {
+		return nil, err
+	}
+	return &profiles[0], nil
+}
+
+// SaveBillingProfile implements payments.InvoiceRepository.
+func (p *postgresInvoiceRepository) SaveBillingProfile(ctx context.Context, profile *payments.BillingProfile) error {
+	sql := `INSERT INTO billing_profiles (user_id, company_name, vat_number, address, monthly_invoice, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (user_id) DO UPDATE SET company_name = EXCLUDED.company_name, vat_number = EXCLUDED.vat_number,
+			address = EXCLUDED.address, monthly_invoice = EXCLUDED.monthly_invoice, updated_at = EXCLUDED.updated_at`
+	_, err := p.conn.Exec(ctx, sql, profile.UserID, profile.CompanyName, profile.VATNumber, profile.Address, profile.MonthlyInvoice, profile.UpdatedAt)
+	return err
+}
+
+// GetMonthlyBillingProfiles implements payments.InvoiceRepository.
+func (p *postgresInvoiceRepository) GetMonthlyBillingProfiles(ctx context.Context) ([]payments.BillingProfile, error) {
+	sql := fmt.Sprintf(`SELECT %v FROM billing_profiles WHERE monthly_invoice ORDER BY user_id`, billingProfileColumns)
+	return p.fetchBillingProfiles(ctx, sql)
+}
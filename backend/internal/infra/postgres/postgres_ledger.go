@@ -0,0 +1,219 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+	"github.com/jackc/pgx/v5"
+	"github.com/samber/lo"
+)
+
+type postgresLedgerRepository struct {
+	conn Connection
+}
+
+func NewPostgresLedger(conn Connection) payments.LedgerRepository {
+	return &postgresLedgerRepository{conn: conn}
+}
+
+func accountTypesIn(accountTypes []payments.AccountType) string {
+	return strings.Join(lo.Map(accountTypes, func(item payments.AccountType, index int) string { return fmt.Sprintf("'%v'", item) }), ",")
+}
+
+// CreateEntry implements payments.LedgerRepository.
+func (p *postgresLedgerRepository) CreateEntry(ctx context.Context, entry *payments.JournalEntry) (bool, error) {
+	// A single statement, so the entry is never stored without its postings
+	sql := `WITH entry AS (
+				INSERT INTO journal_entries (type, reference, description, currency, created_at) VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (reference) DO NOTHING
+				RETURNING id
+			), postings AS (
+				INSERT INTO ledger_postings (entry_id, account_type, owner_id, amount, currency)
+				SELECT entry.id, p.account_type, p.owner_id, p.amount, $4
+				FROM entry, unnest($6::text[], $7::bigint[], $8::bigint[]) AS p(account_type, owner_id, amount)
+			)
+			SELECT id FROM entry`
+	accountTypes := lo.Map(entry.Postings, func(item payments.Posting, index int) string { return string(item.Account.Type) })
+	ownerIds := lo.Map(entry.Postings, func(item payments.Posting, index int) int64 { return item.Account.OwnerID })
+	amounts := lo.Map(entry.Postings, func(item payments.Posting, index int) int64 { return int64(item.Amount) })
+	err := p.conn.QueryRow(ctx, sql, entry.Type, entry.Reference, entry.Description, entry.Currency, entry.CreatedAt,
+		accountTypes, ownerIds, amounts).Scan(&entry.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetBalances implements payments.LedgerRepository.
+func (p *postgresLedgerRepository) GetBalances(ctx context.Context, ownerID int64, accountTypes []payments.AccountType) ([]payments.Balance, error) {
+	sql := fmt.Sprintf(`SELECT account_type, currency, SUM(amount) FROM ledger_postings
+			WHERE owner_id = $1 AND account_type IN (%v)
+			GROUP BY account_type, currency ORDER BY account_type, currency`, accountTypesIn(accountTypes))
+	rows, err := p.conn.Query(ctx, sql, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	balances := make([]payments.Balance, 0)
+	for rows.Next() {
+		var b payments.Balance
+		if err := rows.Scan(&b.AccountType, &b.Currency, &b.Amount); err != nil {
+			return nil, err
+		}
+		balances = append(balances, b)
+	}
+	return balances, rows.Err()
+}
+
+// GetOwnerBalances implements payments.LedgerRepository.
+func (p *postgresLedgerRepository) GetOwnerBalances(ctx context.Context, accountType payments.AccountType) ([]payments.OwnerBalance, error) {
+	sql := `SELECT owner_id, currency, SUM(amount) FROM ledger_postings
+			WHERE account_type = $1
+			GROUP BY owner_id, currency ORDER BY owner_id, currency`
+	rows, err := p.conn.Query(ctx, sql, accountType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	balances := make([]payments.OwnerBalance, 0)
+	for rows.Next() {
+		var b payments.OwnerBalance
+		if err := rows.Scan(&b.OwnerID, &b.Currency, &b.Amount); err != nil {
+			return nil, err
+		}
+		balances = append(balances, b)
+	}
+	return balances, rows.Err()
+}
+
+// GetPostings implements payments.LedgerRepository.
+func (p *postgresLedgerRepository) GetPostings(ctx context.Context, ownerID int64, accountTypes []payments.AccountType, beforeEntryID int64, limit int) ([]payments.AccountPosting, error) {
+	sql := fmt.Sprintf(`SELECT e.id, e.type, e.reference, e.description, lp.account_type, lp.amount, lp.currency, e.created_at
+			FROM ledger_postings lp
+			JOIN journal_entries e ON e.id = lp.entry_id
+			WHERE lp.owner_id = $1 AND lp.account_type IN (%v) AND ($2 = 0 OR e.id < $2)
+			ORDER BY e.id DESC, lp.id
+			LIMIT $3`, accountTypesIn(accountTypes))
+	rows, err := p.conn.Query(ctx, sql, ownerID, beforeEntryID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	postings := make([]payments.AccountPosting, 0)
+	for rows.Next() {
+		var ap payments.AccountPosting
+		if err := rows.Scan(&ap.EntryID, &ap.Type, &ap.Reference, &ap.Description, &ap.AccountType, &ap.Amount, &ap.Currency, &ap.CreatedAt); err != nil {
+			return nil, err
+		}
+		postings = append(postings, ap)
+	}
+	return postings, rows.Err()
+}
+
+// GetUnbalancedEntries implements payments.LedgerRepository.
+func (p *postgresLedgerRepository) GetUnbalancedEntries(ctx context.Context) ([]int64, error) {
+	sql := `SELECT e.id FROM journal_entries e
+			LEFT JOIN ledger_postings lp ON lp.entry_id = e.id
+			GROUP BY e.id
+			HAVING COALESCE(SUM(lp.amount), 0) != 0 OR COUNT(lp.id) < 2
+			ORDER BY e.id`
+	rows, err := p.conn.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+type postgresFxRateRepository struct {
+	conn Connection
+}
+
+func NewPostgresFxRate(conn Connection) payments.FxRateRepository {
+	return &postgresFxRateRepository{conn: conn}
+}
+
+// GetRates implements payments.FxRateRepository.
+func (p *postgresFxRateRepository) GetRates(ctx context.Context) ([]payments.FxRate, error) {
+	sql := `SELECT currency, rate, updated_at FROM fx_rates ORDER BY currency`
+	rows, err := p.conn.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rates := make([]payments.FxRate, 0)
+	for rows.Next() {
+		var r payments.FxRate
+		if err := rows.Scan(&r.Currency, &r.Rate, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		rates = append(rates, r)
+	}
+	return rates, rows.Err()
+}
+
+// SaveRates implements payments.FxRateRepository.
+func (p *postgresFxRateRepository) SaveRates(ctx context.Context, rates []payments.FxRate) error {
+	sql := `INSERT INTO fx_rates (currency, rate, updated_at)
+			SELECT * FROM unnest($1::text[], $2::double precision[], $3::timestamptz[])
+			ON CONFLICT (currency) DO UPDATE SET rate = EXCLUDED.rate, updated_at = EXCLUDED.updated_at`
+	_, err := p.conn.Exec(ctx, sql,
+		lo.Map(rates, func(item payments.FxRate, index int) string { return item.Currency }),
+		lo.Map(rates, func(item payments.FxRate, index int) float64 { return item.Rate }),
+		lo.Map(rates, func(item payments.FxRate, index int) time.Time { return item.UpdatedAt }))
+	return err
+}
+
+type postgresCommissionRateRepository struct {
+	conn Connection
+}
+
+func NewPostgresCommissionRate(conn Connection) payments.CommissionRateRepository {
+	return &postgresCommissionRateRepository{conn: conn}
+}
+
+// GetRates implements payments.CommissionRateRepository.
+func (p *postgresCommissionRateRepository) GetRates(ctx context.Context) ([]payments.CommissionRate, error) {
+	sql := `SELECT city_id, vehicle_class, rate, updated_at FROM commission_rates ORDER BY city_id, vehicle_class`
+	rows, err := p.conn.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rates := make([]payments.CommissionRate, 0)
+	for rows.Next() {
+		var r payments.CommissionRate
+		if err := rows.Scan(&r.CityID, &r.VehicleClass, &r.Rate, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		rates = append(rates, r)
+	}
+	return rates, rows.Err()
+}
+
+// SaveRate implements payments.CommissionRateRepository.
+func (p *postgresCommissionRateRepository) SaveRate(ctx context.Context, rate payments.CommissionRate) error {
+	sql := `INSERT INTO commission_rates (city_id, vehicle_class, rate, updated_at) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (city_id, vehicle_class) DO UPDATE SET rate = EXCLUDED.rate, updated_at = EXCLUDED.updated_at`
+	_, err := p.conn.Exec(ctx, sql, rate.CityID, rate.VehicleClass, rate.Rate, rate.UpdatedAt)
+	return err
+}
+
+// DeleteRate implements payments.CommissionRateRepository.
+func (p *postgresCommissionRateRepository) DeleteRate(ctx context.Context, cityID string, vehicleClass vehicles.VehicleClass) error {
+	_, err := p.conn.Exec(ctx, "DELETE FROM commission_rates WHERE city_id = $1 AND vehicle_class = $2", cityID, vehicleClass)
+	return err
+}
@@ -0,0 +1,256 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/organisations"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
+	"github.com/jackc/pgx/v5"
+	"github.com/samber/lo"
+)
+
+type postgresOrganisationRepository struct {
+	conn Connection
+}
+
+func NewPostgresOrganisation(conn Connection) organisations.OrganisationRepository {
+	return &postgresOrganisationRepository{conn: conn}
+}
+
+const organisationColumns = "id, name, billing_email, vat_number, address, created_by, created_at, updated_at"
+
+func (p *postgresOrganisationRepository) fetch(ctx context.Context, query string, args ...interface{}) ([]organisations.Organisation, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	organisationList := make([]organisations.Organisation, 0)
+	for rows.Next() {
+		var o organisations.Organisation
+		if err := rows.Scan(&o.ID, &o.Name, &o.BillingEmail, &o.VATNumber, &o.Address, &o.CreatedBy, &o.CreatedAt, &o.UpdatedAt); err != nil {
+			return nil, err
+		}
+		organisationList = append(organisationList, o)
+	}
+	return organisationList, rows.Err()
+}
+
+// CreateOrganisation implements organisations.OrganisationRepository.
+func (p *postgresOrganisationRepository) CreateOrganisation(ctx context.Context, organisation *organisations.Organisation, admin organisations.Member) error {
+	// A single statement, so an organisation is never created without its admin
+	sql := `WITH organisation AS (
+				INSERT INTO organisations (name, billing_email, vat_number, address, created_by, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id
+			), member AS (
+				INSERT INTO organisation_members (organisation_id, user_id, role, joined_at)
+				SELECT id, $8, $9, $10 FROM organisation
+			)
+			SELECT id FROM organisation`
+	err := p.conn.QueryRow(ctx, sql, organisation.Name, organisation.BillingEmail, organisation.VATNumber, organisation.Address,
+		organisation.CreatedBy, organisation.CreatedAt, organisation.UpdatedAt, admin.UserID, admin.Role, admin.JoinedAt).Scan(&organisation.ID)
+	return err
+}
+
+// GetOrganisation implements organisations.OrganisationRepository.
+func (p *postgresOrganisationRepository) GetOrganisation(ctx context.Context, organisationID int64) (organisations.Organisation, error) {
+	sql := fmt.Sprintf("SELECT %v FROM organisations WHERE id = $1", organisationColumns)
+	organisationList, err := p.fetch(ctx, sql, organisationID)
+	if err != nil {
+		return organisations.Organisation{}, err
+	}
+	if len(organisationList) == 0 {
+		return organisations.Organisation{}, core.Errorf(core.ENOTFOUND, "organisation with id %v not found", organisationID)
+	}
+	return organisationList[0], nil
+}
+
+// GetOrganisationsByUserID implements organisations.OrganisationRepository.
+func (p *postgresOrganisationRepository) GetOrganisationsByUserID(ctx context.Context, userID int64) ([]organisations.Organisation, error) {
+	sql := fmt.Sprintf(`SELECT %v FROM organisations
+			WHERE id IN (SELECT organisation_id FROM organisation_members WHERE user_id = $1) ORDER BY name, id`, organisationColumns)
+	return p.fetch(ctx, sql, userID)
+}
+
+// UpdateOrganisation implements organisations.OrganisationRepository.
+func (p *postgresOrganisationRepository) UpdateOrganisation(ctx context.Context, organisation organisations.Organisation) error {
+	sql := "UPDATE organisations SET name = $2, billing_email = $3, vat_number = $4, address = $5, updated_at = $6 WHERE id = $1"
+	_, err := p.conn.Exec(ctx, sql, organisation.ID, organisation.Name, organisation.BillingEmail, organisation.VATNumber,
+		organisation.Address, organisation.UpdatedAt)
+	return err
+}
+
+const organisationMemberColumns = "m.organisation_id, m.user_id, u.name, u.email, m.role, m.joined_at"
+
+func (p *postgresOrganisationRepository) fetchMembers(ctx context.Context, query string, args ...interface{}) ([]organisations.Member, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make([]organisations.Member, 0)
+	for rows.Next() {
+		var m organisations.Member
+		if err := rows.Scan(&m.OrganisationID, &m.UserID, &m.Name, &m.Email, &m.Role, &m.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// GetMember implements organisations.OrganisationRepository.
+func (p *postgresOrganisationRepository) GetMember(ctx context.Context, organisationID int64, userID int64) (*organisations.Member, error) {
+	sql := fmt.Sprintf(`SELECT %v FROM organisation_members m JOIN users u ON u.id = m.user_id
+			WHERE m.organisation_id = $1 AND m.user_id = $2`, organisationMemberColumns)
+	members, err := p.fetchMembers(ctx, sql, organisationID, userID)
+	if err != nil || len(members) == 0 {
+		return nil, err
+	}
+	return &members[0], nil
+}
+
+// GetMembers implements organisations.OrganisationRepository.
+func (p *postgresOrganisationRepository) GetMembers(ctx context.Context, organisationID int64) ([]organisations.Member, error) {
+	sql := fmt.Sprintf(`SELECT %v FROM organisation_members m JOIN users u ON u.id = m.user_id
+			WHERE m.organisation_id = $1 ORDER BY m.joined_at, m.user_id`, organisationMemberColumns)
+	return p.fetchMembers(ctx, sql, organisationID)
+}
+
+// RemoveMember implements organisations.OrganisationRepository.
+func (p *postgresOrganisationRepository) RemoveMember(ctx context.Context, organisationID int64, userID int64) error {
+	_, err := p.conn.Exec(ctx, "DELETE FROM organisation_members WHERE organisation_id = $1 AND user_id = $2", organisationID, userID)
+	return err
+}
+
+const organisationInviteColumns = "id, organisation_id, email, role, state, invited_by, accepted_by, COALESCE(token_hash, ''), created_at, updated_at"
+
+func (p *postgresOrganisationRepository) fetchInvites(ctx context.Context, query string, args ...interface{}) ([]organisations.Invite, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := make([]organisations.Invite, 0)
+	for rows.Next() {
+		var i organisations.Invite
+		if err := rows.Scan(&i.ID, &i.OrganisationID, &i.Email, &i.Role, &i.State, &i.InvitedBy, &i.AcceptedBy, &i.TokenHash, &i.CreatedAt, &i.UpdatedAt); err != nil {
+			return nil, err
+		}
+		invites = append(invites, i)
+	}
+	return invites, rows.Err()
+}
+
+// CreateInvite implements organisations.OrganisationRepository.
+func (p *postgresOrganisationRepository) CreateInvite(ctx context.Context, invite *organisations.Invite) (bool, error) {
+	sql := `INSERT INTO organisation_invites (organisation_id, email, role, state, invited_by, token_hash, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT DO NOTHING RETURNING id`
+	err := p.conn.QueryRow(ctx, sql, invite.OrganisationID, invite.Email, invite.Role, invite.State, invite.InvitedBy,
+		invite.TokenHash, invite.CreatedAt, invite.UpdatedAt).Scan(&invite.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetInvite implements organisations.OrganisationRepository.
+func (p *postgresOrganisationRepository) GetInvite(ctx context.Context, inviteID int64) (organisations.Invite, error) {
+	sql := fmt.Sprintf("SELECT %v FROM organisation_invites WHERE id = $1", organisationInviteColumns)
+	invites, err := p.fetchInvites(ctx, sql, inviteID)
+	if err != nil {
+		return organisations.Invite{}, err
+	}
+	if len(invites) == 0 {
+		return organisations.Invite{}, core.Errorf(core.ENOTFOUND, "invite with id %v not found", inviteID)
+	}
+	return invites[0], nil
+}
+
+// GetInvitesByOrganisationID implements organisations.OrganisationRepository.
+func (p *postgresOrganisationRepository) GetInvitesByOrganisationID(ctx context.Context, organisationID int64) ([]organisations.Invite, error) {
+	sql := fmt.Sprintf("SELECT %v FROM organisation_invites WHERE organisation_id = $1 ORDER BY created_at DESC, id DESC", organisationInviteColumns)
+	return p.fetchInvites(ctx, sql, organisationID)
+}
+
+// AcceptInvite implements organisations.OrganisationRepository.
+func (p *postgresOrganisationRepository) AcceptInvite(ctx context.Context, invite *organisations.Invite, member organisations.Member) (bool, error) {
+	// A single statement, so an accepted invite is never stored without its member.
+	// The pending invite is locked, so a concurrent accept finds it accepted and adds no member
+	sql := `WITH pending AS (
+				SELECT id FROM organisation_invites WHERE id = $1 AND state = $2 FOR UPDATE
+			), member AS (
+				INSERT INTO organisation_members (organisation_id, user_id, role, joined_at)
+				SELECT $6, $7, $8, $9 FROM pending
+				ON CONFLICT DO NOTHING
+			)
+			UPDATE organisation_invites i SET state = $3, accepted_by = $4, updated_at = $5
+			FROM pending WHERE i.id = pending.id`
+	tag, err := p.conn.Exec(ctx, sql, invite.ID, organisations.InviteStatePending, invite.State, invite.AcceptedBy, invite.UpdatedAt,
+		member.OrganisationID, member.UserID, member.Role, member.JoinedAt)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// RevokeInvite implements organisations.OrganisationRepository.
+func (p *postgresOrganisationRepository) RevokeInvite(ctx context.Context, inviteID int64, updatedAt time.Time) (bool, error) {
+	sql := "UPDATE organisation_invites SET state = $2, updated_at = $3 WHERE id = $1 AND state = $4"
+	tag, err := p.conn.Exec(ctx, sql, inviteID, organisations.InviteStateRevoked, updatedAt, organisations.InviteStatePending)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetPolicy implements organisations.OrganisationRepository.
+func (p *postgresOrganisationRepository) GetPolicy(ctx context.Context, organisationID int64) (organisations.RidePolicy, error) {
+	sql := `SELECT allowed_from, allowed_until, weekdays, time_zone, vehicle_classes, max_fare, require_expense_code, expense_codes, updated_at
+			FROM organisation_policies WHERE organisation_id = $1`
+	policy := organisations.RidePolicy{OrganisationID: organisationID}
+	var vehicleClasses []string
+	var updatedAt *time.Time
+	err := p.conn.QueryRow(ctx, sql, organisationID).Scan(&policy.AllowedFrom, &policy.AllowedUntil, &policy.Weekdays, &policy.TimeZone,
+		&vehicleClasses, &policy.MaxFare, &policy.RequireExpenseCode, &policy.ExpenseCodes, &updatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return organisations.RidePolicy{
+			OrganisationID: organisationID,
+			Weekdays:       []int{},
+			TimeZone:       "UTC",
+			VehicleClasses: []vehicles.VehicleClass{},
+			ExpenseCodes:   []string{},
+		}, nil
+	}
+	if err != nil {
+		return organisations.RidePolicy{}, err
+	}
+	policy.VehicleClasses = lo.Map(vehicleClasses, func(item string, index int) vehicles.VehicleClass { return vehicles.VehicleClass(item) })
+	if updatedAt != nil {
+		policy.UpdatedAt = *updatedAt
+	}
+	return policy, nil
+}
+
+// SavePolicy implements organisations.OrganisationRepository.
+func (p *postgresOrganisationRepository) SavePolicy(ctx context.Context, policy organisations.RidePolicy) error {
+	sql := `INSERT INTO organisation_policies (organisation_id, allowed_from, allowed_until, weekdays, time_zone, vehicle_classes,
+				max_fare, require_expense_code, expense_codes, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (organisation_id) DO UPDATE SET allowed_from = excluded.allowed_from, allowed_until = excluded.allowed_until,
+				weekdays = excluded.weekdays, time_zone = excluded.time_zone, vehicle_classes = excluded.vehicle_classes,
+				max_fare = excluded.max_fare, require_expense_code = excluded.require_expense_code,
+				expense_codes = excluded.expense_codes, updated_at = excluded.updated_at`
+	vehicleClasses := lo.Map(policy.VehicleClasses, func(item vehicles.VehicleClass, index int) string { return string(item) })
+	_, err := p.conn.Exec(ctx, sql, policy.OrganisationID, policy.AllowedFrom, policy.AllowedUntil, policy.Weekdays, policy.TimeZone,
+		vehicleClasses, policy.MaxFare, policy.RequireExpenseCode, policy.ExpenseCodes, policy.UpdatedAt)
+	return err
+}
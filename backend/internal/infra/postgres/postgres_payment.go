@@ -0,0 +1,180 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/jackc/pgx/v5"
+	"github.com/samber/lo"
+)
+
+type postgresPaymentRepository struct {
+	conn Connection
+}
+
+func NewPostgresPayment(conn Connection) payments.PaymentRepository {
+	return &postgresPaymentRepository{conn: conn}
+}
+
+const ridePaymentColumns = "id, ride_id, rider_id, intent_id, state, amount, captured_amount, refunded_amount, currency, created_at, updated_at, reference"
+
+func (p *postgresPaymentRepository) fetch(ctx context.Context, query string, args ...interface{}) ([]payments.RidePayment, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pp := make([]payments.RidePayment, 0)
+	for rows.Next() {
+		var rp payments.RidePayment
+		if err := rows.Scan(
+			&rp.ID,
+			&rp.RideID,
+			&rp.RiderID,
+			&rp.IntentID,
+			&rp.State,
+			&rp.Amount,
+			&rp.CapturedAmount,
+			&rp.RefundedAmount,
+			&rp.Currency,
+			&rp.CreatedAt,
+			&rp.UpdatedAt,
+			&rp.Reference,
+		); err != nil {
+			return nil, err
+		}
+		pp = append(pp, rp)
+	}
+	return pp, rows.Err()
+}
+
+func (p *postgresPaymentRepository) fetchOne(ctx context.Context, query string, args ...interface{}) (*payments.RidePayment, error) {
+	pp, err := p.fetch(ctx, query, args...)
+	if err != nil || len(pp) == 0 {
+		return nil, err
+	}
+	return &pp[0], nil
+}
+
+// GetCustomer implements payments.PaymentRepository.
+func (p *postgresPaymentRepository) GetCustomer(ctx context.Context, userID int64) (*payments.PaymentCustomer, error) {
+	sql := `SELECT user_id, customer_id, payment_method_id, card_brand, card_last4, card_fingerprint, updated_at FROM payment_customers WHERE user_id = $1`
+	var c payments.PaymentCustomer
+	err := p.conn.QueryRow(ctx, sql, userID).Scan(&c.UserID, &c.CustomerID, &c.PaymentMethodID, &c.CardBrand, &c.CardLast4, &c.CardFingerprint, &c.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SaveCustomer implements payments.PaymentRepository.
+func (p *postgresPaymentRepository) SaveCustomer(ctx context.Context, customer *payments.PaymentCustomer) error {
+	sql := `INSERT INTO payment_customers (user_id, customer_id, payment_method_id, card_brand, card_last4, card_fingerprint, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (user_id) DO UPDATE SET customer_id = $2, payment_method_id = $3, card_brand = $4, card_last4 = $5, card_fingerprint = $6, updated_at = $7`
+	_, err := p.conn.Exec(ctx, sql, customer.UserID, customer.CustomerID, customer.PaymentMethodID, customer.CardBrand,
+		customer.CardLast4, customer.CardFingerprint, customer.UpdatedAt)
+	return err
+}
+
+// CreatePayment implements payments.PaymentRepository.
+func (p *postgresPaymentRepository) CreatePayment(ctx context.Context, payment *payments.RidePayment) (bool, error) {
+	sql := `INSERT INTO ride_payments (ride_id, rider_id, intent_id, state, amount, captured_amount, currency, created_at, updated_at, reference)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (reference) DO NOTHING
+			RETURNING id`
+	err := p.conn.QueryRow(ctx, sql, payment.RideID, payment.RiderID, payment.IntentID, payment.State, payment.Amount,
+		payment.CapturedAmount, payment.Currency, payment.CreatedAt, payment.UpdatedAt, payment.Reference).Scan(&payment.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SetPaymentIntent implements payments.PaymentRepository.
+func (p *postgresPaymentRepository) SetPaymentIntent(ctx context.Context, paymentID int64, intentID string) error {
+	sql := `UPDATE ride_payments SET intent_id = $2, updated_at = $3 WHERE id = $1`
+	_, err := p.conn.Exec(ctx, sql, paymentID, intentID, time.Now().UTC())
+	return err
+}
+
+// GetActivePayment implements payments.PaymentRepository.
+func (p *postgresPaymentRepository) GetActivePayment(ctx context.Context, rideID int64) (*payments.RidePayment, error) {
+	sql := fmt.Sprintf(`SELECT %v FROM ride_payments WHERE ride_id = $1 AND state IN ($2, $3) AND reference IS NULL
+			ORDER BY id DESC LIMIT 1`, ridePaymentColumns)
+	return p.fetchOne(ctx, sql, rideID, payments.PaymentStatePending, payments.PaymentStateAuthorised)
+}
+
+// GetCapturedPayment implements payments.PaymentRepository.
+func (p *postgresPaymentRepository) GetCapturedPayment(ctx context.Context, rideID int64) (*payments.RidePayment, error) {
+	sql := fmt.Sprintf(`SELECT %v FROM ride_payments WHERE ride_id = $1 AND state = $2 AND reference IS NULL
+			ORDER BY id DESC LIMIT 1`, ridePaymentColumns)
+	return p.fetchOne(ctx, sql, rideID, payments.PaymentStateCaptured)
+}
+
+// AddRefundedAmount implements payments.PaymentRepository.
+func (p *postgresPaymentRepository) AddRefundedAmount(ctx context.Context, paymentID int64, amount int) (bool, error) {
+	sql := `UPDATE ride_payments SET refunded_amount = refunded_amount + $2, updated_at = $3
+			WHERE id = $1 AND refunded_amount + $2 <= captured_amount`
+	tag, err := p.conn.Exec(ctx, sql, paymentID, amount, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetPaymentByIntentID implements payments.PaymentRepository.
+func (p *postgresPaymentRepository) GetPaymentByIntentID(ctx context.Context, intentID string) (*payments.RidePayment, error) {
+	sql := fmt.Sprintf("SELECT %v FROM ride_payments WHERE intent_id = $1", ridePaymentColumns)
+	return p.fetchOne(ctx, sql, intentID)
+}
+
+// GetPaymentByReference implements payments.PaymentRepository.
+func (p *postgresPaymentRepository) GetPaymentByReference(ctx context.Context, reference string) (*payments.RidePayment, error) {
+	sql := fmt.Sprintf("SELECT %v FROM ride_payments WHERE reference = $1", ridePaymentColumns)
+	return p.fetchOne(ctx, sql, reference)
+}
+
+// ReleaseReference implements payments.PaymentRepository.
+func (p *postgresPaymentRepository) ReleaseReference(ctx context.Context, paymentID int64) error {
+	// The reference is kept with the payment id appended, so the failed payment can still be traced
+	sql := `UPDATE ride_payments SET reference = reference || ':failed:' || id, updated_at = $2 WHERE id = $1 AND state = ANY($3)`
+	_, err := p.conn.Exec(ctx, sql, paymentID, time.Now().UTC(), []int{int(payments.PaymentStateFailed), int(payments.PaymentStateVoided)})
+	return err
+}
+
+// UpdatePaymentState implements payments.PaymentRepository.
+func (p *postgresPaymentRepository) UpdatePaymentState(ctx context.Context, paymentID int64, from []payments.PaymentState, state payments.PaymentState, capturedAmount int) (bool, error) {
+	sql := `UPDATE ride_payments SET state = $2, captured_amount = $3, updated_at = $4 WHERE id = $1 AND state = ANY($5)`
+	fromStates := lo.Map(from, func(item payments.PaymentState, index int) int { return int(item) })
+	tag, err := p.conn.Exec(ctx, sql, paymentID, state, capturedAmount, time.Now().UTC(), fromStates)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// SaveProviderEvent implements payments.PaymentRepository.
+func (p *postgresPaymentRepository) SaveProviderEvent(ctx context.Context, event payments.ProviderEvent) (bool, error) {
+	sql := `INSERT INTO payment_events (id, type, intent_id, amount, created_at, processed_at) VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (id) DO NOTHING`
+	tag, err := p.conn.Exec(ctx, sql, event.ID, event.Type, event.IntentID, event.Amount, event.CreatedAt, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// IsProviderEventProcessed implements payments.PaymentRepository.
+func (p *postgresPaymentRepository) IsProviderEventProcessed(ctx context.Context, eventID string) (bool, error) {
+	var processed bool
+	err := p.conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM payment_events WHERE id = $1)", eventID).Scan(&processed)
+	return processed, err
+}
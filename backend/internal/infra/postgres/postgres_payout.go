@@ -0,0 +1,206 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/samber/lo"
+)
+
+type postgresPayoutRepository struct {
+	conn Connection
+}
+
+func NewPostgresPayout(conn Connection) payments.PayoutRepository {
+	return &postgresPayoutRepository{conn: conn}
+}
+
+const payoutColumns = `id, batch_id, driver_id, amount, currency, state, holder_name, iban, bic, failure_reason,
+			created_at, updated_at`
+
+const payoutAccountColumns = "driver_id, holder_name, iban, bic, updated_at"
+
+// Batches with the number and sum of their payouts
+const payoutBatchQuery = `SELECT b.id, b.currency, COUNT(p.id), COALESCE(SUM(p.amount), 0), b.created_at
+			FROM payout_batches b
+			LEFT JOIN payouts p ON p.batch_id = b.id`
+
+func (p *postgresPayoutRepository) fetch(ctx context.Context, query string, args ...interface{}) ([]payments.Payout, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payouts := make([]payments.Payout, 0)
+	for rows.Next() {
+		var po payments.Payout
+		if err := rows.Scan(&po.ID, &po.BatchID, &po.DriverID, &po.Amount, &po.Currency, &po.State, &po.HolderName,
+			&po.IBAN, &po.BIC, &po.FailureReason, &po.CreatedAt, &po.UpdatedAt); err != nil {
+			return nil, err
+		}
+		payouts = append(payouts, po)
+	}
+	return payouts, rows.Err()
+}
+
+func (p *postgresPayoutRepository) fetchBatches(ctx context.Context, query string, args ...interface{}) ([]payments.PayoutBatch, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batches := make([]payments.PayoutBatch, 0)
+	for rows.Next() {
+		var b payments.PayoutBatch
+		if err := rows.Scan(&b.ID, &b.Currency, &b.Count, &b.Total, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		batches = append(batches, b)
+	}
+	return batches, rows.Err()
+}
+
+func (p *postgresPayoutRepository) fetchAccounts(ctx context.Context, query string, args ...interface{}) ([]payments.PayoutAccount, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := make([]payments.PayoutAccount, 0)
+	for rows.Next() {
+		var a payments.PayoutAccount
+		if err := rows.Scan(&a.DriverID, &a.HolderName, &a.IBAN, &a.BIC, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
+
+// GetPayoutAccount implements payments.PayoutRepository.
+func (p *postgresPayoutRepository) GetPayoutAccount(ctx context.Context, driverID int64) (*payments.PayoutAccount, error) {
+	sql := fmt.Sprintf("SELECT %v FROM payout_accounts WHERE driver_id = $1", payoutAccountColumns)
+	accounts, err := p.fetchAccounts(ctx, sql, driverID)
+	if err != nil || len(accounts) == 0 {
+		return nil, err
+	}
+	return &accounts[0], nil
+}
+
+// GetPayoutAccounts implements payments.PayoutRepository.
+func (p *postgresPayoutRepository) GetPayoutAccounts(ctx context.Context, driverIDs []int64) ([]payments.PayoutAccount, error) {
+	if len(driverIDs) == 0 {
+		return []payments.PayoutAccount{}, nil
+	}
+	idsStr := strings.Join(lo.Map(driverIDs, func(item int64, index int) string { return strconv.FormatInt(item, 10) }), ",")
+	sql := fmt.Sprintf("SELECT %v FROM payout_accounts WHERE driver_id IN (%v)", payoutAccountColumns, idsStr)
+	return p.fetchAccounts(ctx, sql)
+}
+
+// SavePayoutAccount implements payments.PayoutRepository.
+func (p *postgresPayoutRepository) SavePayoutAccount(ctx context.Context, account payments.PayoutAccount) error {
+	sql := `INSERT INTO payout_accounts (driver_id, holder_name, iban, bic, updated_at) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (driver_id) DO UPDATE SET holder_name = EXCLUDED.holder_name, iban = EXCLUDED.iban,
+				bic = EXCLUDED.bic, updated_at = EXCLUDED.updated_at`
+	_, err := p.conn.Exec(ctx, sql, account.DriverID, account.HolderName, account.IBAN, account.BIC, account.UpdatedAt)
+	return err
+}
+
+// CreateBatch implements payments.PayoutRepository.
+func (p *postgresPayoutRepository) CreateBatch(ctx context.Context, batch *payments.PayoutBatch, payouts []payments.Payout) error {
+	// A single statement, so the batch is never stored without its payouts. A batch has one payout per driver
+	sql := `WITH batch AS (
+				INSERT INTO payout_batches (currency, created_at) VALUES ($1, $2)
+				RETURNING id
+			), inserted AS (
+				INSERT INTO payouts (batch_id, driver_id, amount, currency, state, holder_name, iban, bic, created_at, updated_at)
+				SELECT batch.id, p.driver_id, p.amount, $1, $3, p.holder_name, p.iban, p.bic, $2, $2
+				FROM batch, unnest($4::bigint[], $5::bigint[], $6::text[], $7::text[], $8::text[]) AS p(driver_id, amount, holder_name, iban, bic)
+				RETURNING id, batch_id, driver_id
+			)
+			SELECT id, batch_id, driver_id FROM inserted`
+	rows, err := p.conn.Query(ctx, sql, batch.Currency, batch.CreatedAt, payments.PayoutStatePending,
+		lo.Map(payouts, func(item payments.Payout, index int) int64 { return item.DriverID }),
+		lo.Map(payouts, func(item payments.Payout, index int) int64 { return int64(item.Amount) }),
+		lo.Map(payouts, func(item payments.Payout, index int) string { return item.HolderName }),
+		lo.Map(payouts, func(item payments.Payout, index int) string { return item.IBAN }),
+		lo.Map(payouts, func(item payments.Payout, index int) string { return item.BIC }))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	ids := make(map[int64]int64)
+	for rows.Next() {
+		var id, batchID, driverID int64
+		if err := rows.Scan(&id, &batchID, &driverID); err != nil {
+			return err
+		}
+		batch.ID = batchID
+		ids[driverID] = id
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i := range payouts {
+		payouts[i].ID = ids[payouts[i].DriverID]
+		payouts[i].BatchID = batch.ID
+	}
+	batch.Count = len(payouts)
+	batch.Total = lo.SumBy(payouts, func(item payments.Payout) int { return item.Amount })
+	return nil
+}
+
+// GetBatches implements payments.PayoutRepository.
+func (p *postgresPayoutRepository) GetBatches(ctx context.Context, limit int) ([]payments.PayoutBatch, error) {
+	sql := payoutBatchQuery + ` GROUP BY b.id ORDER BY b.id DESC LIMIT $1`
+	return p.fetchBatches(ctx, sql, limit)
+}
+
+// GetBatch implements payments.PayoutRepository.
+func (p *postgresPayoutRepository) GetBatch(ctx context.Context, batchID int64) (payments.PayoutBatch, error) {
+	sql := payoutBatchQuery + ` WHERE b.id = $1 GROUP BY b.id`
+	batches, err := p.fetchBatches(ctx, sql, batchID)
+	if err != nil {
+		return payments.PayoutBatch{}, err
+	}
+	if len(batches) == 0 {
+		return payments.PayoutBatch{}, core.Errorf(core.ENOTFOUND, "payout batch with id %v not found", batchID)
+	}
+	return batches[0], nil
+}
+
+// GetPayoutsByBatchID implements payments.PayoutRepository.
+func (p *postgresPayoutRepository) GetPayoutsByBatchID(ctx context.Context, batchID int64) ([]payments.Payout, error) {
+	sql := fmt.Sprintf("SELECT %v FROM payouts WHERE batch_id = $1 ORDER BY id", payoutColumns)
+	return p.fetch(ctx, sql, batchID)
+}
+
+// GetPayoutsByDriverID implements payments.PayoutRepository.
+func (p *postgresPayoutRepository) GetPayoutsByDriverID(ctx context.Context, driverID int64, limit int) ([]payments.Payout, error) {
+	sql := fmt.Sprintf("SELECT %v FROM payouts WHERE driver_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2", payoutColumns)
+	return p.fetch(ctx, sql, driverID, limit)
+}
+
+// GetPayoutsByState implements payments.PayoutRepository.
+func (p *postgresPayoutRepository) GetPayoutsByState(ctx context.Context, state payments.PayoutState) ([]payments.Payout, error) {
+	sql := fmt.Sprintf("SELECT %v FROM payouts WHERE state = $1 ORDER BY id", payoutColumns)
+	return p.fetch(ctx, sql, state)
+}
+
+// SettlePayout implements payments.PayoutRepository.
+func (p *postgresPayoutRepository) SettlePayout(ctx context.Context, payoutID int64, state payments.PayoutState, failureReason *string, updatedAt time.Time) (bool, error) {
+	sql := "UPDATE payouts SET state = $2, failure_reason = $3, updated_at = $4 WHERE id = $1 AND state = $5"
+	tag, err := p.conn.Exec(ctx, sql, payoutID, state, failureReason, updatedAt, payments.PayoutStatePending)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,183 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/promotions"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SQLSTATE of check constraint violations
+const checkViolation = "23514"
+
+type postgresPromotionRepository struct {
+	conn Connection
+}
+
+func NewPostgresPromotion(conn Connection) promotions.PromotionRepository {
+	return &postgresPromotionRepository{conn: conn}
+}
+
+const promotionColumns = "id, code, discount_type, percent_off, amount_off, currency, max_discount, valid_from, valid_until, cities, first_ride_only, per_user_limit, global_limit, stackable, active, redemptions, created_by, created_at"
+
+func (p *postgresPromotionRepository) fetch(ctx context.Context, query string, args ...interface{}) ([]promotions.Promotion, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pp := make([]promotions.Promotion, 0)
+	for rows.Next() {
+		var pr promotions.Promotion
+		if err := rows.Scan(
+			&pr.ID,
+			&pr.Code,
+			&pr.DiscountType,
+			&pr.PercentOff,
+			&pr.AmountOff,
+			&pr.Currency,
+			&pr.MaxDiscount,
+			&pr.ValidFrom,
+			&pr.ValidUntil,
+			&pr.Cities,
+			&pr.FirstRideOnly,
+			&pr.PerUserLimit,
+			&pr.GlobalLimit,
+			&pr.Stackable,
+			&pr.Active,
+			&pr.Redemptions,
+			&pr.CreatedBy,
+			&pr.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		pp = append(pp, pr)
+	}
+	return pp, rows.Err()
+}
+
+// CreatePromotion implements promotions.PromotionRepository.
+func (p *postgresPromotionRepository) CreatePromotion(ctx context.Context, promotion *promotions.Promotion) error {
+	sql := `INSERT INTO promotions (code, discount_type, percent_off, amount_off, currency, max_discount, valid_from, valid_until,
+				cities, first_ride_only, per_user_limit, global_limit, stackable, active, created_by, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16) RETURNING id`
+	return p.conn.QueryRow(ctx, sql, promotion.Code, promotion.DiscountType, promotion.PercentOff, promotion.AmountOff,
+		promotion.Currency, promotion.MaxDiscount, promotion.ValidFrom, promotion.ValidUntil, promotion.Cities,
+		promotion.FirstRideOnly, promotion.PerUserLimit, promotion.GlobalLimit, promotion.Stackable, promotion.Active,
+		promotion.CreatedBy, promotion.CreatedAt).Scan(&promotion.ID)
+}
+
+// GetPromotions implements promotions.PromotionRepository.
+func (p *postgresPromotionRepository) GetPromotions(ctx context.Context) ([]promotions.Promotion, error) {
+	sql := fmt.Sprintf("SELECT %v FROM promotions ORDER BY created_at DESC, id DESC", promotionColumns)
+	return p.fetch(ctx, sql)
+}
+
+// GetByCodes implements promotions.PromotionRepository.
+func (p *postgresPromotionRepository) GetByCodes(ctx context.Context, codes []string) ([]promotions.Promotion, error) {
+	sql := fmt.Sprintf("SELECT %v FROM promotions WHERE code = ANY($1) ORDER BY id", promotionColumns)
+	return p.fetch(ctx, sql, codes)
+}
+
+// SetActive implements promotions.PromotionRepository.
+func (p *postgresPromotionRepository) SetActive(ctx context.Context, promotionID int64, active bool) error {
+	_, err := p.conn.Exec(ctx, "UPDATE promotions SET active = $2 WHERE id = $1", promotionID, active)
+	return err
+}
+
+// GetUserRedemptionCount implements promotions.PromotionRepository.
+func (p *postgresPromotionRepository) GetUserRedemptionCount(ctx context.Context, promotionID int64, userID int64) (int, error) {
+	var count int
+	err := p.conn.QueryRow(ctx, "SELECT count FROM promotion_user_counts WHERE promotion_id = $1 AND user_id = $2",
+		promotionID, userID).Scan(&count)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return count, err
+}
+
+// ReserveRedemption implements promotions.PromotionRepository.
+func (p *postgresPromotionRepository) ReserveRedemption(ctx context.Context, redemption *promotions.Redemption) (bool, error) {
+	// A single statement, so the counts and the redemption are stored together. The updated rows are locked until
+	// the statement ends, and the check constraints on the counts fail the statement if a limit would be exceeded
+	sql := `WITH promotion AS (
+				UPDATE promotions SET redemptions = redemptions + 1 WHERE id = $1
+				RETURNING id, per_user_limit
+			), user_count AS (
+				INSERT INTO promotion_user_counts (promotion_id, user_id, count, max_count)
+				SELECT id, $2, 1, per_user_limit FROM promotion
+				ON CONFLICT (promotion_id, user_id) DO UPDATE SET count = promotion_user_counts.count + 1
+				RETURNING promotion_id
+			)
+			INSERT INTO promotion_redemptions (promotion_id, code, user_id, state, created_at)
+			SELECT promotion_id, $3, $2, $4, $5 FROM user_count
+			RETURNING id`
+	err := p.conn.QueryRow(ctx, sql, redemption.PromotionID, redemption.UserID, redemption.Code, redemption.State,
+		redemption.CreatedAt).Scan(&redemption.ID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == checkViolation {
+		return false, nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// AssignRide implements promotions.PromotionRepository.
+func (p *postgresPromotionRepository) AssignRide(ctx context.Context, redemptionIDs []int64, rideID int64) error {
+	_, err := p.conn.Exec(ctx, "UPDATE promotion_redemptions SET ride_id = $2 WHERE id = ANY($1)", redemptionIDs, rideID)
+	return err
+}
+
+// GetRedemptionsByRideID implements promotions.PromotionRepository.
+func (p *postgresPromotionRepository) GetRedemptionsByRideID(ctx context.Context, rideID int64) ([]promotions.Redemption, error) {
+	sql := `SELECT id, promotion_id, code, user_id, ride_id, state, discount, created_at FROM promotion_redemptions
+			WHERE ride_id = $1 ORDER BY id`
+	rows, err := p.conn.Query(ctx, sql, rideID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	redemptions := make([]promotions.Redemption, 0)
+	for rows.Next() {
+		var r promotions.Redemption
+		if err := rows.Scan(&r.ID, &r.PromotionID, &r.Code, &r.UserID, &r.RideID, &r.State, &r.Discount, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		redemptions = append(redemptions, r)
+	}
+	return redemptions, rows.Err()
+}
+
+// RedeemRedemption implements promotions.PromotionRepository.
+func (p *postgresPromotionRepository) RedeemRedemption(ctx context.Context, redemptionID int64, discount int) (bool, error) {
+	sql := `UPDATE promotion_redemptions SET state = $2, discount = $3 WHERE id = $1 AND state = $4`
+	tag, err := p.conn.Exec(ctx, sql, redemptionID, promotions.RedemptionStateRedeemed, discount, promotions.RedemptionStateReserved)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ReleaseRedemptions implements promotions.PromotionRepository.
+func (p *postgresPromotionRepository) ReleaseRedemptions(ctx context.Context, redemptionIDs []int64) error {
+	// Only redemptions that are still reserved are uncounted, so releasing twice does not uncount twice
+	sql := `WITH released AS (
+				UPDATE promotion_redemptions SET state = $2 WHERE id = ANY($1) AND state = $3
+				RETURNING promotion_id, user_id
+			), promotion AS (
+				UPDATE promotions SET redemptions = redemptions - counts.count
+				FROM (SELECT promotion_id, COUNT(*) AS count FROM released GROUP BY promotion_id) counts
+				WHERE promotions.id = counts.promotion_id
+			)
+			UPDATE promotion_user_counts SET count = promotion_user_counts.count - counts.count
+			FROM (SELECT promotion_id, user_id, COUNT(*) AS count FROM released GROUP BY promotion_id, user_id) counts
+			WHERE promotion_user_counts.promotion_id = counts.promotion_id AND promotion_user_counts.user_id = counts.user_id`
+	_, err := p.conn.Exec(ctx, sql, redemptionIDs, promotions.RedemptionStateReleased, promotions.RedemptionStateReserved)
+	return err
+}
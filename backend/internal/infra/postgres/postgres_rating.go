@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/ratings"
+	"github.com/jackc/pgx/v5"
+)
+
+type postgresRatingRepository struct {
+	conn Connection
+}
+
+func NewPostgresRating(conn Connection) ratings.RatingRepository {
+	return &postgresRatingRepository{conn: conn}
+}
+
+const ratingColumns = "id, ride_id, rater_id, ratee_id, rater_party, stars, tags, comment, created_at"
+
+func (p *postgresRatingRepository) fetch(ctx context.Context, query string, args ...interface{}) ([]ratings.Rating, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rr := make([]ratings.Rating, 0)
+	for rows.Next() {
+		var r ratings.Rating
+		if err := rows.Scan(
+			&r.ID,
+			&r.RideID,
+			&r.RaterID,
+			&r.RateeID,
+			&r.RaterParty,
+			&r.Stars,
+			&r.Tags,
+			&r.Comment,
+			&r.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		rr = append(rr, r)
+	}
+	return rr, rows.Err()
+}
+
+// CreateRating implements ratings.RatingRepository.
+func (p *postgresRatingRepository) CreateRating(ctx context.Context, rating *ratings.Rating) error {
+	sql := `INSERT INTO ride_ratings (ride_id, rater_id, ratee_id, rater_party, stars, tags, comment, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (ride_id, rater_id) DO NOTHING
+			RETURNING id`
+	err := p.conn.QueryRow(ctx, sql, rating.RideID, rating.RaterID, rating.RateeID, rating.RaterParty,
+		rating.Stars, rating.Tags, rating.Comment, rating.CreatedAt).Scan(&rating.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return core.Errorf(core.ECONFLICT, "ride %v has already been rated", rating.RideID)
+	}
+	return err
+}
+
+// GetByRideID implements ratings.RatingRepository.
+func (p *postgresRatingRepository) GetByRideID(ctx context.Context, rideID int64) ([]ratings.Rating, error) {
+	sql := fmt.Sprintf("SELECT %v FROM ride_ratings WHERE ride_id = $1 ORDER BY created_at", ratingColumns)
+	return p.fetch(ctx, sql, rideID)
+}
+
+// GetReceived implements ratings.RatingRepository.
+func (p *postgresRatingRepository) GetReceived(ctx context.Context, rateeID int64, raterParty string, limit int) ([]ratings.Rating, error) {
+	sql := fmt.Sprintf(`SELECT %v FROM ride_ratings WHERE ratee_id = $1 AND rater_party = $2
+			ORDER BY created_at DESC, id DESC LIMIT $3`, ratingColumns)
+	return p.fetch(ctx, sql, rateeID, raterParty, limit)
+}
+
+// GetAverage implements ratings.RatingRepository.
+func (p *postgresRatingRepository) GetAverage(ctx context.Context, rateeID int64, raterParty string, window int) (ratings.RatingAverage, error) {
+	sql := `SELECT
+				COALESCE((SELECT AVG(stars) FROM (
+					SELECT stars FROM ride_ratings WHERE ratee_id = $1 AND rater_party = $2
+					ORDER BY created_at DESC, id DESC LIMIT $3
+				) recent), 0)::float8,
+				(SELECT COUNT(*) FROM ride_ratings WHERE ratee_id = $1 AND rater_party = $2)`
+	var average ratings.RatingAverage
+	err := p.conn.QueryRow(ctx, sql, rateeID, raterParty, window).Scan(&average.Average, &average.Count)
+	return average, err
+}
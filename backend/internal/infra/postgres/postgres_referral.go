@@ -0,0 +1,159 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/referrals"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/rides"
+	"github.com/jackc/pgx/v5"
+)
+
+type postgresReferralRepository struct {
+	conn Connection
+}
+
+func NewPostgresReferral(conn Connection) referrals.ReferralRepository {
+	return &postgresReferralRepository{conn: conn}
+}
+
+const referralColumns = "id, referrer_id, referee_id, code, state, rejection_reason, ride_id, referrer_reward, referee_reward, currency, created_at, updated_at"
+
+func (p *postgresReferralRepository) fetch(ctx context.Context, query string, args ...interface{}) ([]referrals.Referral, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rr := make([]referrals.Referral, 0)
+	for rows.Next() {
+		var r referrals.Referral
+		if err := rows.Scan(
+			&r.ID,
+			&r.ReferrerID,
+			&r.RefereeID,
+			&r.Code,
+			&r.State,
+			&r.RejectionReason,
+			&r.RideID,
+			&r.ReferrerReward,
+			&r.RefereeReward,
+			&r.Currency,
+			&r.CreatedAt,
+			&r.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		rr = append(rr, r)
+	}
+	return rr, rows.Err()
+}
+
+// CreateCode implements referrals.ReferralRepository.
+func (p *postgresReferralRepository) CreateCode(ctx context.Context, userID int64, code string) (bool, error) {
+	sql := `INSERT INTO referral_codes (user_id, code, created_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+	tag, err := p.conn.Exec(ctx, sql, userID, code, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetCode implements referrals.ReferralRepository.
+func (p *postgresReferralRepository) GetCode(ctx context.Context, userID int64) (string, error) {
+	sql := `SELECT code FROM referral_codes WHERE user_id = $1`
+	var code string
+	err := p.conn.QueryRow(ctx, sql, userID).Scan(&code)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return code, err
+}
+
+// GetUserIDByCode implements referrals.ReferralRepository.
+func (p *postgresReferralRepository) GetUserIDByCode(ctx context.Context, code string) (int64, bool, error) {
+	sql := `SELECT user_id FROM referral_codes WHERE code = $1`
+	var userID int64
+	err := p.conn.QueryRow(ctx, sql, code).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	return userID, err == nil, err
+}
+
+// AddDevice implements referrals.ReferralRepository.
+func (p *postgresReferralRepository) AddDevice(ctx context.Context, userID int64, deviceID string) error {
+	sql := `INSERT INTO user_devices (user_id, device_id, created_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+	_, err := p.conn.Exec(ctx, sql, userID, deviceID, time.Now().UTC())
+	return err
+}
+
+// HasDevice implements referrals.ReferralRepository.
+func (p *postgresReferralRepository) HasDevice(ctx context.Context, userID int64, deviceID string) (bool, error) {
+	sql := `SELECT EXISTS (SELECT 1 FROM user_devices WHERE user_id = $1 AND device_id = $2)`
+	var exists bool
+	err := p.conn.QueryRow(ctx, sql, userID, deviceID).Scan(&exists)
+	return exists, err
+}
+
+// CreateReferral implements referrals.ReferralRepository.
+func (p *postgresReferralRepository) CreateReferral(ctx context.Context, referral *referrals.Referral) error {
+	sql := `INSERT INTO referrals (referrer_id, referee_id, code, state, rejection_reason, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	return p.conn.QueryRow(ctx, sql, referral.ReferrerID, referral.RefereeID, referral.Code, referral.State,
+		referral.RejectionReason, referral.CreatedAt, referral.UpdatedAt).Scan(&referral.ID)
+}
+
+// GetByRefereeID implements referrals.ReferralRepository.
+func (p *postgresReferralRepository) GetByRefereeID(ctx context.Context, refereeID int64) (*referrals.Referral, error) {
+	sql := fmt.Sprintf(`SELECT %v FROM referrals WHERE referee_id = $1`, referralColumns)
+	referralList, err := p.fetch(ctx, sql, refereeID)
+	if err != nil || len(referralList) == 0 {
+		return nil, err
+	}
+	return &referralList[0], nil
+}
+
+// GetByReferrerID implements referrals.ReferralRepository.
+func (p *postgresReferralRepository) GetByReferrerID(ctx context.Context, referrerID int64) ([]referrals.Referral, error) {
+	sql := fmt.Sprintf(`SELECT %v FROM referrals WHERE referrer_id = $1 ORDER BY created_at DESC`, referralColumns)
+	return p.fetch(ctx, sql, referrerID)
+}
+
+// UpdateReferral implements referrals.ReferralRepository.
+func (p *postgresReferralRepository) UpdateReferral(ctx context.Context, referral *referrals.Referral) (bool, error) {
+	sql := `UPDATE referrals SET state = $2, rejection_reason = $3, ride_id = $4, referrer_reward = $5, referee_reward = $6, currency = $7, updated_at = $8
+			WHERE id = $1 AND state = $9`
+	tag, err := p.conn.Exec(ctx, sql, referral.ID, referral.State, referral.RejectionReason, referral.RideID,
+		referral.ReferrerReward, referral.RefereeReward, referral.Currency, referral.UpdatedAt, referrals.ReferralStatePending)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetPendingFinishedRides implements referrals.ReferralRepository.
+func (p *postgresReferralRepository) GetPendingFinishedRides(ctx context.Context) ([]rides.RideFinishedEvent, error) {
+	sql := `SELECT DISTINCT ON (rr.rider_id) rr.id, rr.rider_id, COALESCE(rr.driver_id, 0), rr.price, rr.currency, rr.finished_at
+			FROM ride_requests rr JOIN referrals r ON r.referee_id = rr.rider_id
+			WHERE r.state = $1 AND rr.state = $2 AND rr.finished_at IS NOT NULL
+			ORDER BY rr.rider_id, rr.finished_at`
+	rows, err := p.conn.Query(ctx, sql, referrals.ReferralStatePending, rides.RiderRequestStateFinished)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]rides.RideFinishedEvent, 0)
+	for rows.Next() {
+		var e rides.RideFinishedEvent
+		if err := rows.Scan(&e.RideID, &e.RiderID, &e.DriverID, &e.Price, &e.Currency, &e.FinishedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
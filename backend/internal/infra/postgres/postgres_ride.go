@@ -3,13 +3,16 @@ package postgres
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
 	"github.com/bjarke-xyz/uber-clone-backend/internal/core/rides"
+	"github.com/jackc/pgx/v5"
 	"github.com/samber/lo"
 )
 
@@ -18,7 +21,10 @@ type postgresRideRepository struct {
 }
 
 const rideRequestColumns = `id, rider_id, driver_id, from_lat, from_lng, from_name,
-			to_lat, to_lng, to_name, state, directions_json_version, directions_json, price, currency, created_at, updated_at`
+			to_lat, to_lng, to_name, state, directions_json_version, directions_json, price, currency, created_at, updated_at,
+			pickup_geofence_radius, driver_arrived_at, free_waiting_until, accepted_at, scheduled_pickup_at,
+			pooled, seats, pool_id, vehicle_class, finished_at, vehicle_id, commission_rate, started_at,
+			organisation_id, expense_code, available_since`
 
 func (p *postgresRideRepository) fetch(ctx context.Context, query string, args ...interface{}) ([]rides.RideRequest, error) {
 	rows, err := p.conn.Query(ctx, query, args...)
@@ -30,6 +36,7 @@ func (p *postgresRideRepository) fetch(ctx context.Context, query string, args .
 	rr := make([]rides.RideRequest, 0)
 	for rows.Next() {
 		var r rides.RideRequest
+		var pickupGeofenceRadius *float64
 		if err := rows.Scan(
 			&r.ID,
 			&r.RiderID,
@@ -47,37 +54,92 @@ func (p *postgresRideRepository) fetch(ctx context.Context, query string, args .
 			&r.Currency,
 			&r.CreatedAt,
 			&r.UpdatedAt,
+			&pickupGeofenceRadius,
+			&r.DriverArrivedAt,
+			&r.FreeWaitingUntil,
+			&r.AcceptedAt,
+			&r.ScheduledPickupAt,
+			&r.Pooled,
+			&r.Seats,
+			&r.PoolID,
+			&r.VehicleClass,
+			&r.FinishedAt,
+			&r.VehicleID,
+			&r.CommissionRate,
+			&r.StartedAt,
+			&r.OrganisationID,
+			&r.ExpenseCode,
+			&r.AvailableSince,
 		); err != nil {
 			return nil, err
 		}
-		if r.DirectionsJsonVersion != nil && r.DirectionsJson != nil && len(*r.DirectionsJson) > 0 {
-			switch *r.DirectionsJsonVersion {
-			case 1:
-				{
-					directionsObj := &rides.ORSDirections{}
-					err = json.Unmarshal([]byte(*r.DirectionsJson), directionsObj)
-					r.DirectionsV1 = directionsObj
-				}
+		if pickupGeofenceRadius != nil {
+			r.PickupGeofence = &geo.Geofence{
+				Center: geo.Point{Lat: r.FromLat, Lng: r.FromLng},
+				Radius: *pickupGeofenceRadius,
 			}
+		}
+		if r.DirectionsJsonVersion != nil && r.DirectionsJson != nil && len(*r.DirectionsJson) > 0 {
+			r.Directions, err = rides.DecodeDirections(*r.DirectionsJsonVersion, []byte(*r.DirectionsJson))
 			if err != nil {
-				return nil, fmt.Errorf("failed to unmarshal v%v directions json: %w", r.DirectionsJsonVersion, err)
+				return nil, err
 			}
 		}
 		rr = append(rr, r)
 	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	err = p.fetchStops(ctx, rr)
+	if err != nil {
+		return nil, err
+	}
 	return rr, nil
 }
 
+// fetchStops sets the stops of the rides
+func (p *postgresRideRepository) fetchStops(ctx context.Context, rr []rides.RideRequest) error {
+	if len(rr) == 0 {
+		return nil
+	}
+	rideIndices := make(map[int64]int, len(rr))
+	rideIdsStrs := make([]string, 0, len(rr))
+	for i, r := range rr {
+		rr[i].Stops = make([]rides.RideStop, 0)
+		rideIndices[r.ID] = i
+		rideIdsStrs = append(rideIdsStrs, strconv.FormatInt(r.ID, 10))
+	}
+	sql := fmt.Sprintf(`SELECT id, ride_id, stop_order, lat, lng, name, state, completed_at FROM ride_stops
+			WHERE ride_id IN (%v) ORDER BY ride_id, stop_order`, strings.Join(rideIdsStrs, ","))
+	rows, err := p.conn.Query(ctx, sql)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s rides.RideStop
+		if err := rows.Scan(&s.ID, &s.RideID, &s.Order, &s.Lat, &s.Lng, &s.Name, &s.State, &s.CompletedAt); err != nil {
+			return err
+		}
+		i := rideIndices[s.RideID]
+		rr[i].Stops = append(rr[i].Stops, s)
+	}
+	return rows.Err()
+}
+
 // CreateRequest implements rides.RideRepository.
 func (p *postgresRideRepository) CreateRequest(ctx context.Context, ride *rides.RideRequest) error {
 	if err := ride.Validate(); err != nil {
 		return err
 	}
 	sql := `INSERT INTO ride_requests (rider_id, driver_id, from_lat, from_lng, from_name,
-										to_lat, to_lng, to_name, state, created_at, updated_at) VALUES
-			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`
+										to_lat, to_lng, to_name, state, created_at, updated_at, scheduled_pickup_at, pooled, seats, vehicle_class, currency,
+										organisation_id, expense_code, available_since) VALUES
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19) RETURNING id`
 	return p.conn.QueryRow(ctx, sql, ride.RiderID, ride.DriverID, ride.FromLat, ride.FromLng, ride.FromName,
-		ride.ToLat, ride.ToLng, ride.ToName, ride.State, ride.CreatedAt, ride.UpdatedAt).Scan(&ride.ID)
+		ride.ToLat, ride.ToLng, ride.ToName, ride.State, ride.CreatedAt, ride.UpdatedAt, ride.ScheduledPickupAt,
+		ride.Pooled, ride.Seats, ride.VehicleClass, ride.Currency, ride.OrganisationID, ride.ExpenseCode, ride.AvailableSince).Scan(&ride.ID)
 }
 
 // GetRequests implements rides.RideRepository.
@@ -126,31 +188,638 @@ func (p *postgresRideRepository) GetByUserIDs(ctx context.Context, userIds []int
 }
 
 // UpdateRequestState implements rides.RideRepository.
-func (p *postgresRideRepository) UpdateRequestState(ctx context.Context, rideId int64, state rides.RideRequestState) error {
-	sql := "UPDATE ride_requests SET state = $2, updated_at = $3  WHERE id = $1"
-	_, err := p.conn.Exec(ctx, sql, rideId, state, time.Now().UTC())
+func (p *postgresRideRepository) UpdateRequestState(ctx context.Context, requestID int64, from rides.RideRequestState, to rides.RideRequestState) (bool, error) {
+	sql := "UPDATE ride_requests SET state = $2, updated_at = $3 WHERE id = $1 AND state = $4"
+	tag, err := p.conn.Exec(ctx, sql, requestID, to, time.Now().UTC(), from)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// StartRequest implements rides.RideRepository.
+func (p *postgresRideRepository) StartRequest(ctx context.Context, requestID int64, startedAt time.Time) (bool, error) {
+	sql := "UPDATE ride_requests SET state = $2, updated_at = $3, started_at = $3 WHERE id = $1 AND state IN ($4, $5)"
+	tag, err := p.conn.Exec(ctx, sql, requestID, rides.RiderRequestStateInProgress, startedAt,
+		rides.RiderRequestStateAccepted, rides.RiderRequestStateDriverArrived)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// FinishRequest implements rides.RideRepository.
+func (p *postgresRideRepository) FinishRequest(ctx context.Context, requestID int64, finishedAt time.Time, commissionRate float64) (bool, error) {
+	sql := "UPDATE ride_requests SET state = $2, updated_at = $3, finished_at = $3, commission_rate = $4 WHERE id = $1 AND state = $5"
+	tag, err := p.conn.Exec(ctx, sql, requestID, rides.RiderRequestStateFinished, finishedAt, commissionRate, rides.RiderRequestStateInProgress)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// errRequestsNotClaimable rolls back a claim where some of the requests were no longer available
+var errRequestsNotClaimable = errors.New("requests not claimable")
+
+// ClaimRequests implements rides.RideRepository.
+func (p *postgresRideRepository) ClaimRequests(ctx context.Context, requestIds []int64, driverID int64, vehicleID int64, pickupGeofenceRadius float64) (bool, error) {
+	sql := `UPDATE ride_requests SET state = $2, updated_at = $3, accepted_at = $3, driver_id = $4, vehicle_id = $5, pickup_geofence_radius = $6
+			WHERE id = ANY($1) AND state = $7`
+	err := pgx.BeginFunc(ctx, p.conn, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, sql, requestIds, rides.RiderRequestStateAccepted, time.Now().UTC(), driverID, vehicleID, pickupGeofenceRadius,
+			rides.RiderRequestStateAvailable)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() != int64(len(lo.Uniq(requestIds))) {
+			return errRequestsNotClaimable
+		}
+		return nil
+	})
+	if errors.Is(err, errRequestsNotClaimable) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// MarkDriverArrived implements rides.RideRepository.
+func (p *postgresRideRepository) MarkDriverArrived(ctx context.Context, requestId int64, arrivedAt time.Time, freeWaitingUntil time.Time) (bool, error) {
+	sql := `UPDATE ride_requests SET state = $2, updated_at = $3, driver_arrived_at = $3, free_waiting_until = $4, free_waiting_ended_at = NULL
+			WHERE id = $1 AND state = $5`
+	tag, err := p.conn.Exec(ctx, sql, requestId, rides.RiderRequestStateDriverArrived, arrivedAt, freeWaitingUntil, rides.RiderRequestStateAccepted)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// MarkFreeWaitingEnded implements rides.RideRepository.
+func (p *postgresRideRepository) MarkFreeWaitingEnded(ctx context.Context, endedBefore time.Time) ([]rides.RideRequest, error) {
+	sql := fmt.Sprintf(`UPDATE ride_requests SET free_waiting_ended_at = $1
+			WHERE free_waiting_ended_at IS NULL AND free_waiting_until < $2 AND state = $3
+			RETURNING %v`, rideRequestColumns)
+	return p.fetch(ctx, sql, time.Now().UTC(), endedBefore, rides.RiderRequestStateDriverArrived)
+}
+
+// ReleaseRequest implements rides.RideRepository.
+func (p *postgresRideRepository) ReleaseRequest(ctx context.Context, requestId int64) (bool, error) {
+	// Directions are cleared since they start at the previous drivers location.
+	// The ride leaves its pool so it can be matched again, and is priced again as an unmatched pooled ride
+	sql := `UPDATE ride_requests SET state = $2, updated_at = $3, available_since = $3, driver_id = NULL, vehicle_id = NULL, accepted_at = NULL,
+			pickup_geofence_radius = NULL, driver_arrived_at = NULL, free_waiting_until = NULL, free_waiting_ended_at = NULL,
+			directions_json_version = NULL, directions_json = NULL, price = CASE WHEN pool_id IS NULL THEN price ELSE 0 END, pool_id = NULL
+			WHERE id = $1 AND state IN ($4, $5)`
+	tag, err := p.conn.Exec(ctx, sql, requestId, rides.RiderRequestStateAvailable, time.Now().UTC(),
+		rides.RiderRequestStateAccepted, rides.RiderRequestStateDriverArrived)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ExpireRequests implements rides.RideRepository.
+func (p *postgresRideRepository) ExpireRequests(ctx context.Context, availableBefore time.Time) ([]rides.RideRequest, error) {
+	sql := fmt.Sprintf(`UPDATE ride_requests SET state = $1, updated_at = $2
+			WHERE state = $3 AND available_since < $4 AND scheduled_pickup_at IS NULL
+			RETURNING %v`, rideRequestColumns)
+	return p.fetch(ctx, sql, rides.RiderRequestStateExpired, time.Now().UTC(), rides.RiderRequestStateAvailable, availableBefore)
+}
+
+// ReleaseScheduledRequests implements rides.RideRepository.
+func (p *postgresRideRepository) ReleaseScheduledRequests(ctx context.Context, pickupBefore time.Time) ([]rides.RideRequest, error) {
+	sql := fmt.Sprintf(`UPDATE ride_requests SET state = $1, updated_at = $2, available_since = $2 WHERE state = $3 AND scheduled_pickup_at < $4
+			RETURNING %v`, rideRequestColumns)
+	return p.fetch(ctx, sql, rides.RiderRequestStateAvailable, time.Now().UTC(), rides.RiderRequestStateScheduled, pickupBefore)
+}
+
+// CancelUnclaimedScheduledRequests implements rides.RideRepository.
+func (p *postgresRideRepository) CancelUnclaimedScheduledRequests(ctx context.Context, pickupBefore time.Time) ([]rides.RideRequest, error) {
+	sql := fmt.Sprintf(`UPDATE ride_requests SET state = $1, updated_at = $2
+			WHERE state IN ($3, $4) AND scheduled_pickup_at < $5
+			RETURNING %v`, rideRequestColumns)
+	return p.fetch(ctx, sql, rides.RiderRequestStateCancelled, time.Now().UTC(),
+		rides.RiderRequestStateAvailable, rides.RiderRequestStateScheduled, pickupBefore)
+}
+
+// MarkDueReminders implements rides.RideRepository.
+func (p *postgresRideRepository) MarkDueReminders(ctx context.Context, party string, pickupBefore time.Time) ([]rides.RideRequest, error) {
+	var sql string
+	switch party {
+	case rides.PartyRider:
+		sql = fmt.Sprintf(`UPDATE ride_requests SET rider_reminded_at = $1
+				WHERE rider_reminded_at IS NULL AND scheduled_pickup_at < $2 AND state IN ($3, $4, $5)
+				RETURNING %v`, rideRequestColumns)
+	case rides.PartyDriver:
+		sql = fmt.Sprintf(`UPDATE ride_requests SET driver_reminded_at = $1
+				WHERE driver_reminded_at IS NULL AND scheduled_pickup_at < $2 AND state IN ($3, $4, $5) AND driver_id IS NOT NULL
+				RETURNING %v`, rideRequestColumns)
+	default:
+		return nil, fmt.Errorf("cannot remind party %v", party)
+	}
+	return p.fetch(ctx, sql, time.Now().UTC(), pickupBefore,
+		rides.RiderRequestStateScheduled, rides.RiderRequestStateAvailable, rides.RiderRequestStateAccepted)
+}
+
+// CreateCancellation implements rides.RideRepository.
+func (p *postgresRideRepository) CreateCancellation(ctx context.Context, c *rides.RideCancellation) error {
+	sql := `INSERT INTO ride_cancellations (ride_id, cancelled_by, party, fee_party, reason, fee, currency, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+	return p.conn.QueryRow(ctx, sql, c.RideID, c.CancelledBy, c.Party, c.FeeParty, c.Reason, c.Fee, c.Currency, c.CreatedAt).Scan(&c.ID)
+}
+
+// GetCancellationsByUserID implements rides.RideRepository.
+func (p *postgresRideRepository) GetCancellationsByUserID(ctx context.Context, userId int64, party string, since time.Time) ([]rides.RideCancellation, error) {
+	sql := `SELECT id, ride_id, cancelled_by, party, fee_party, reason, fee, currency, created_at FROM ride_cancellations
+			WHERE cancelled_by = $1 AND party = $2 AND created_at >= $3 ORDER BY created_at DESC`
+	rows, err := p.conn.Query(ctx, sql, userId, party, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cancellations := make([]rides.RideCancellation, 0)
+	for rows.Next() {
+		var c rides.RideCancellation
+		if err := rows.Scan(
+			&c.ID,
+			&c.RideID,
+			&c.CancelledBy,
+			&c.Party,
+			&c.FeeParty,
+			&c.Reason,
+			&c.Fee,
+			&c.Currency,
+			&c.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		cancellations = append(cancellations, c)
+	}
+	return cancellations, nil
+}
+
+// ReplacePendingStops implements rides.RideRepository.
+func (p *postgresRideRepository) ReplacePendingStops(ctx context.Context, requestID int64, stops []rides.RideStop) error {
+	return pgx.BeginFunc(ctx, p.conn, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "DELETE FROM ride_stops WHERE ride_id = $1 AND state = $2", requestID, rides.RideStopStatePending)
+		if err != nil {
+			return err
+		}
+		sql := "INSERT INTO ride_stops (ride_id, stop_order, lat, lng, name, state) VALUES ($1, $2, $3, $4, $5, $6)"
+		for _, stop := range stops {
+			_, err = tx.Exec(ctx, sql, requestID, stop.Order, stop.Lat, stop.Lng, stop.Name, stop.State)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CompleteStop implements rides.RideRepository.
+func (p *postgresRideRepository) CompleteStop(ctx context.Context, stopID int64, completedAt time.Time) error {
+	sql := "UPDATE ride_stops SET state = $2, completed_at = $3 WHERE id = $1"
+	_, err := p.conn.Exec(ctx, sql, stopID, rides.RideStopStateCompleted, completedAt)
 	return err
 }
 
-// ClaimRequest implements rides.RideRepository.
-func (p *postgresRideRepository) ClaimRequest(ctx context.Context, requestId int64, driverID int64) error {
-	sql := "UPDATE ride_requests SET state = $2, updated_at = $3, driver_id = $4 WHERE id = $1"
-	_, err := p.conn.Exec(ctx, sql, requestId, rides.RiderRequestStateAccepted, time.Now().UTC(), driverID)
+// GetUnpooledRequests implements rides.RideRepository.
+func (p *postgresRideRepository) GetUnpooledRequests(ctx context.Context) ([]rides.RideRequest, error) {
+	sql := fmt.Sprintf("SELECT %v FROM ride_requests WHERE state = $1 AND pooled AND pool_id IS NULL", rideRequestColumns)
+	return p.fetch(ctx, sql, rides.RiderRequestStateAvailable)
+}
+
+// GetByPoolID implements rides.RideRepository.
+func (p *postgresRideRepository) GetByPoolID(ctx context.Context, poolID int64) ([]rides.RideRequest, error) {
+	sql := fmt.Sprintf("SELECT %v FROM ride_requests WHERE pool_id = $1 ORDER BY id", rideRequestColumns)
+	return p.fetch(ctx, sql, poolID)
+}
+
+// CreatePool implements rides.RideRepository.
+func (p *postgresRideRepository) CreatePool(ctx context.Context, pool *rides.RidePool) error {
+	stopsBytes, err := json.Marshal(pool.Stops)
+	if err != nil {
+		return err
+	}
+	sql := "INSERT INTO ride_pools (stops_json, distance, duration, created_at) VALUES ($1, $2, $3, $4) RETURNING id"
+	return p.conn.QueryRow(ctx, sql, string(stopsBytes), pool.Distance, pool.Duration, pool.CreatedAt).Scan(&pool.ID)
+}
+
+// GetPool implements rides.RideRepository.
+func (p *postgresRideRepository) GetPool(ctx context.Context, poolID int64) (rides.RidePool, error) {
+	pool := rides.RidePool{}
+	var stopsJson string
+	sql := "SELECT id, stops_json, distance, duration, created_at FROM ride_pools WHERE id = $1"
+	err := p.conn.QueryRow(ctx, sql, poolID).Scan(&pool.ID, &stopsJson, &pool.Distance, &pool.Duration, &pool.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return rides.RidePool{}, core.Errorf(core.ENOTFOUND, "pool with id %v not found", poolID)
+	}
+	if err != nil {
+		return rides.RidePool{}, err
+	}
+	err = json.Unmarshal([]byte(stopsJson), &pool.Stops)
+	if err != nil {
+		return rides.RidePool{}, err
+	}
+	return pool, nil
+}
+
+// UpdatePool implements rides.RideRepository.
+func (p *postgresRideRepository) UpdatePool(ctx context.Context, pool rides.RidePool) error {
+	stopsBytes, err := json.Marshal(pool.Stops)
+	if err != nil {
+		return err
+	}
+	sql := "UPDATE ride_pools SET stops_json = $2, distance = $3, duration = $4 WHERE id = $1"
+	_, err = p.conn.Exec(ctx, sql, pool.ID, string(stopsBytes), pool.Distance, pool.Duration)
+	return err
+}
+
+// AssignPool implements rides.RideRepository.
+func (p *postgresRideRepository) AssignPool(ctx context.Context, requestID int64, poolID int64, directions *rides.Directions, price int) error {
+	directionsVersion, directionsBytes, err := rides.EncodeDirections(directions)
+	if err != nil {
+		return err
+	}
+	sql := `UPDATE ride_requests SET pool_id = $2, directions_json_version = $3, directions_json = $4, price = $5, updated_at = $6
+			WHERE id = $1`
+	_, err = p.conn.Exec(ctx, sql, requestID, poolID, directionsVersion, string(directionsBytes), price, time.Now().UTC())
 	return err
 }
 
 // UpdateRideDirections implements rides.RideRepository.
-func (p *postgresRideRepository) UpdateRideDirections(ctx context.Context, requestId int64, directionsVersion int, directions *rides.ORSDirections, price int) error {
+func (p *postgresRideRepository) UpdateRideDirections(ctx context.Context, requestId int64, directions *rides.Directions, price int) error {
 	sql := "UPDATE ride_requests SET directions_json_version = $2, directions_json = $3, price = $4 WHERE id = $1"
-	directionsBytes, err := json.Marshal(directions)
+	directionsVersion, directionsBytes, err := rides.EncodeDirections(directions)
 	if err != nil {
-		return fmt.Errorf("failed to marshal directions: %w", err)
+		return err
 	}
 	directionsStr := string(directionsBytes)
 	_, err = p.conn.Exec(ctx, sql, requestId, directionsVersion, directionsStr, price)
 	return err
 }
 
+// UpdatePrice implements rides.RideRepository.
+func (p *postgresRideRepository) UpdatePrice(ctx context.Context, requestID int64, price int) error {
+	_, err := p.conn.Exec(ctx, "UPDATE ride_requests SET price = $2 WHERE id = $1", requestID, price)
+	return err
+}
+
+// GetOutdatedDirections implements rides.RideRepository.
+func (p *postgresRideRepository) GetOutdatedDirections(ctx context.Context, afterID int64, limit int) ([]rides.StoredDirections, error) {
+	sql := `SELECT id, directions_json_version, directions_json, price FROM ride_requests
+			WHERE directions_json_version < $1 AND directions_json IS NOT NULL AND id > $2 ORDER BY id LIMIT $3`
+	rows, err := p.conn.Query(ctx, sql, rides.DirectionsVersionCurrent, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stored := make([]rides.StoredDirections, 0)
+	for rows.Next() {
+		var d rides.StoredDirections
+		if err := rows.Scan(&d.RideID, &d.Version, &d.Json, &d.Price); err != nil {
+			return nil, err
+		}
+		stored = append(stored, d)
+	}
+	return stored, rows.Err()
+}
+
 func NewPostgresRide(conn Connection) rides.RideRepository {
 	return &postgresRideRepository{conn: conn}
 }
+
+// GetFinishedByDriverID implements rides.RideRepository.
+func (p *postgresRideRepository) GetFinishedByDriverID(ctx context.Context, driverID int64, from time.Time, to time.Time) ([]rides.RideRequest, error) {
+	sql := fmt.Sprintf(`SELECT %v FROM ride_requests WHERE driver_id = $1 AND state = $2 AND finished_at >= $3 AND finished_at < $4
+			ORDER BY finished_at`, rideRequestColumns)
+	return p.fetch(ctx, sql, driverID, rides.RiderRequestStateFinished, from, to)
+}
+
+// GetFinishedByRiderID implements rides.RideRepository.
+func (p *postgresRideRepository) GetFinishedByRiderID(ctx context.Context, riderID int64, from time.Time, to time.Time) ([]rides.RideRequest, error) {
+	sql := fmt.Sprintf(`SELECT %v FROM ride_requests WHERE rider_id = $1 AND state = $2 AND finished_at >= $3 AND finished_at < $4
+			ORDER BY finished_at`, rideRequestColumns)
+	return p.fetch(ctx, sql, riderID, rides.RiderRequestStateFinished, from, to)
+}
+
+// GetByOrganisationID implements rides.RideRepository.
+func (p *postgresRideRepository) GetByOrganisationID(ctx context.Context, organisationID int64, from time.Time, to time.Time) ([]rides.RideRequest, error) {
+	sql := fmt.Sprintf(`SELECT %v FROM ride_requests WHERE organisation_id = $1 AND created_at >= $2 AND created_at < $3
+			ORDER BY created_at DESC`, rideRequestColumns)
+	return p.fetch(ctx, sql, organisationID, from, to)
+}
+
+// CreateLineItem implements rides.RideRepository.
+func (p *postgresRideRepository) CreateLineItem(ctx context.Context, lineItem *rides.RideLineItem) (bool, error) {
+	sql := `INSERT INTO ride_line_items (ride_id, type, amount, currency, description, created_by, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT DO NOTHING
+			RETURNING id`
+	err := p.conn.QueryRow(ctx, sql, lineItem.RideID, lineItem.Type, lineItem.Amount, lineItem.Currency,
+		lineItem.Description, lineItem.CreatedBy, lineItem.CreatedAt).Scan(&lineItem.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetLineItems implements rides.RideRepository.
+func (p *postgresRideRepository) GetLineItems(ctx context.Context, rideIDs []int64) ([]rides.RideLineItem, error) {
+	lineItems := make([]rides.RideLineItem, 0)
+	if len(rideIDs) == 0 {
+		return lineItems, nil
+	}
+	rideIdsStr := strings.Join(lo.Map(rideIDs, func(item int64, index int) string { return strconv.FormatInt(item, 10) }), ",")
+	sql := fmt.Sprintf(`SELECT id, ride_id, type, amount, currency, description, created_by, created_at FROM ride_line_items
+			WHERE ride_id IN (%v) ORDER BY ride_id, created_at`, rideIdsStr)
+	rows, err := p.conn.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var l rides.RideLineItem
+		if err := rows.Scan(&l.ID, &l.RideID, &l.Type, &l.Amount, &l.Currency, &l.Description, &l.CreatedBy, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		lineItems = append(lineItems, l)
+	}
+	return lineItems, rows.Err()
+}
+
+// CreateRefund implements rides.RideRepository.
+// The ride is locked, so concurrent refunds of the ride are created one at a time
+func (p *postgresRideRepository) CreateRefund(ctx context.Context, refund *rides.RideRefund, refundedBefore int) (bool, error) {
+	created := false
+	err := pgx.BeginFunc(ctx, p.conn, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "SELECT id FROM ride_requests WHERE id = $1 FOR UPDATE", refund.RideID)
+		if err != nil {
+			return err
+		}
+		var refunded int
+		err = tx.QueryRow(ctx, "SELECT coalesce(sum(amount), 0) FROM ride_refunds WHERE ride_id = $1", refund.RideID).Scan(&refunded)
+		if err != nil || refunded != refundedBefore {
+			return err
+		}
+		sql := `INSERT INTO ride_refunds (ride_id, type, amount, currency, reason, note, issued_by, issuer_role, dispute_id, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`
+		err = tx.QueryRow(ctx, sql, refund.RideID, refund.Type, refund.Amount, refund.Currency, refund.Reason, refund.Note,
+			refund.IssuedBy, refund.IssuerRole, refund.DisputeID, refund.CreatedAt).Scan(&refund.ID)
+		created = err == nil
+		return err
+	})
+	return created, err
+}
+
+const rideRefundColumns = "id, ride_id, type, amount, currency, reason, note, issued_by, issuer_role, dispute_id, created_at"
+
+// GetRefunds implements rides.RideRepository.
+func (p *postgresRideRepository) GetRefunds(ctx context.Context, rideID int64) ([]rides.RideRefund, error) {
+	sql := fmt.Sprintf("SELECT %v FROM ride_refunds WHERE ride_id = $1 ORDER BY created_at, id", rideRefundColumns)
+	return p.fetchRefunds(ctx, sql, rideID)
+}
+
+// GetRefundsByRideIDs implements rides.RideRepository.
+func (p *postgresRideRepository) GetRefundsByRideIDs(ctx context.Context, rideIDs []int64) ([]rides.RideRefund, error) {
+	if len(rideIDs) == 0 {
+		return []rides.RideRefund{}, nil
+	}
+	idsStr := strings.Join(lo.Map(rideIDs, func(item int64, index int) string { return strconv.FormatInt(item, 10) }), ",")
+	sql := fmt.Sprintf("SELECT %v FROM ride_refunds WHERE ride_id IN (%v) ORDER BY created_at, id", rideRefundColumns, idsStr)
+	return p.fetchRefunds(ctx, sql)
+}
+
+func (p *postgresRideRepository) fetchRefunds(ctx context.Context, query string, args ...interface{}) ([]rides.RideRefund, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	refunds := make([]rides.RideRefund, 0)
+	for rows.Next() {
+		var r rides.RideRefund
+		if err := rows.Scan(&r.ID, &r.RideID, &r.Type, &r.Amount, &r.Currency, &r.Reason, &r.Note, &r.IssuedBy,
+			&r.IssuerRole, &r.DisputeID, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, r)
+	}
+	return refunds, rows.Err()
+}
+
+const rideDisputeColumns = "id, ride_id, rider_id, reason, description, state, resolved_by, resolved_at, resolution_note, refund_id, created_at"
+
+func (p *postgresRideRepository) fetchDisputes(ctx context.Context, query string, args ...interface{}) ([]rides.FareDispute, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	disputes := make([]rides.FareDispute, 0)
+	for rows.Next() {
+		var d rides.FareDispute
+		if err := rows.Scan(
+			&d.ID,
+			&d.RideID,
+			&d.RiderID,
+			&d.Reason,
+			&d.Description,
+			&d.State,
+			&d.ResolvedBy,
+			&d.ResolvedAt,
+			&d.ResolutionNote,
+			&d.RefundID,
+			&d.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		disputes = append(disputes, d)
+	}
+	return disputes, rows.Err()
+}
+
+// CreateDispute implements rides.RideRepository.
+func (p *postgresRideRepository) CreateDispute(ctx context.Context, dispute *rides.FareDispute) (bool, error) {
+	sql := `INSERT INTO ride_disputes (ride_id, rider_id, reason, description, state, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT DO NOTHING
+			RETURNING id`
+	err := p.conn.QueryRow(ctx, sql, dispute.RideID, dispute.RiderID, dispute.Reason, dispute.Description,
+		dispute.State, dispute.CreatedAt).Scan(&dispute.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetDispute implements rides.RideRepository.
+func (p *postgresRideRepository) GetDispute(ctx context.Context, disputeID int64) (rides.FareDispute, error) {
+	sql := fmt.Sprintf("SELECT %v FROM ride_disputes WHERE id = $1", rideDisputeColumns)
+	disputes, err := p.fetchDisputes(ctx, sql, disputeID)
+	if err != nil {
+		return rides.FareDispute{}, err
+	}
+	if len(disputes) == 0 {
+		return rides.FareDispute{}, core.Errorf(core.ENOTFOUND, "dispute with id %v not found", disputeID)
+	}
+	return disputes[0], nil
+}
+
+// GetDisputesByState implements rides.RideRepository.
+func (p *postgresRideRepository) GetDisputesByState(ctx context.Context, state rides.DisputeState) ([]rides.FareDispute, error) {
+	sql := fmt.Sprintf("SELECT %v FROM ride_disputes WHERE state = $1 ORDER BY created_at, id", rideDisputeColumns)
+	return p.fetchDisputes(ctx, sql, state)
+}
+
+// ResolveDispute implements rides.RideRepository.
+func (p *postgresRideRepository) ResolveDispute(ctx context.Context, dispute *rides.FareDispute) (bool, error) {
+	sql := `UPDATE ride_disputes SET state = $2, resolved_by = $3, resolved_at = $4, resolution_note = $5, refund_id = $6
+			WHERE id = $1 AND state = $7`
+	tag, err := p.conn.Exec(ctx, sql, dispute.ID, dispute.State, dispute.ResolvedBy, dispute.ResolvedAt, dispute.ResolutionNote,
+		dispute.RefundID, rides.DisputeStateOpen)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+const rideExtraColumns = `id, ride_id, driver_id, type, amount, currency, description, state, reviewed_by, reviewed_at, review_note,
+			line_item_id, created_at`
+
+func (p *postgresRideRepository) fetchExtras(ctx context.Context, query string, args ...interface{}) ([]rides.RideExtra, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	extras := make([]rides.RideExtra, 0)
+	for rows.Next() {
+		var e rides.RideExtra
+		if err := rows.Scan(&e.ID, &e.RideID, &e.DriverID, &e.Type, &e.Amount, &e.Currency, &e.Description, &e.State,
+			&e.ReviewedBy, &e.ReviewedAt, &e.ReviewNote, &e.LineItemID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		extras = append(extras, e)
+	}
+	return extras, rows.Err()
+}
+
+// CreateExtra implements rides.RideRepository.
+func (p *postgresRideRepository) CreateExtra(ctx context.Context, extra *rides.RideExtra) error {
+	sql := `INSERT INTO ride_extras (ride_id, driver_id, type, amount, currency, description, state, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+	return p.conn.QueryRow(ctx, sql, extra.RideID, extra.DriverID, extra.Type, extra.Amount, extra.Currency, extra.Description,
+		extra.State, extra.CreatedAt).Scan(&extra.ID)
+}
+
+// GetExtra implements rides.RideRepository.
+func (p *postgresRideRepository) GetExtra(ctx context.Context, extraID int64) (rides.RideExtra, error) {
+	sql := fmt.Sprintf("SELECT %v FROM ride_extras WHERE id = $1", rideExtraColumns)
+	extras, err := p.fetchExtras(ctx, sql, extraID)
+	if err != nil {
+		return rides.RideExtra{}, err
+	}
+	if len(extras) == 0 {
+		return rides.RideExtra{}, core.Errorf(core.ENOTFOUND, "extra with id %v not found", extraID)
+	}
+	return extras[0], nil
+}
+
+// GetExtrasByRideID implements rides.RideRepository.
+func (p *postgresRideRepository) GetExtrasByRideID(ctx context.Context, rideID int64) ([]rides.RideExtra, error) {
+	sql := fmt.Sprintf("SELECT %v FROM ride_extras WHERE ride_id = $1 ORDER BY created_at, id", rideExtraColumns)
+	return p.fetchExtras(ctx, sql, rideID)
+}
+
+// GetExtrasByState implements rides.RideRepository.
+func (p *postgresRideRepository) GetExtrasByState(ctx context.Context, state rides.ExtraState) ([]rides.RideExtra, error) {
+	sql := fmt.Sprintf("SELECT %v FROM ride_extras WHERE state = $1 ORDER BY created_at, id", rideExtraColumns)
+	return p.fetchExtras(ctx, sql, state)
+}
+
+// ReviewExtra implements rides.RideRepository.
+func (p *postgresRideRepository) ReviewExtra(ctx context.Context, extra *rides.RideExtra, lineItem *rides.RideLineItem) (bool, error) {
+	// A single statement, so an approved extra is never stored without its line item.
+	// The pending extra is locked, so a concurrent review finds it reviewed and creates no line item
+	sql := `WITH pending AS (
+				SELECT id FROM ride_extras WHERE id = $1 AND state = $2 FOR UPDATE
+			), item AS (
+				INSERT INTO ride_line_items (ride_id, type, amount, currency, description, created_by, created_at)
+				SELECT $7, $8, $9, $10, $11, $12, $5 FROM pending WHERE $13
+				RETURNING id
+			)
+			UPDATE ride_extras e SET state = $3, reviewed_by = $4, reviewed_at = $5, review_note = $6,
+				line_item_id = (SELECT id FROM item)
+			FROM pending WHERE e.id = pending.id
+			RETURNING e.line_item_id`
+	var item rides.RideLineItem
+	if lineItem != nil {
+		item = *lineItem
+	}
+	err := p.conn.QueryRow(ctx, sql, extra.ID, rides.ExtraStatePending, extra.State, extra.ReviewedBy, extra.ReviewedAt,
+		extra.ReviewNote, item.RideID, item.Type, item.Amount, item.Currency, item.Description, item.CreatedBy,
+		lineItem != nil).Scan(&extra.LineItemID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if lineItem != nil && extra.LineItemID != nil {
+		lineItem.ID = *extra.LineItemID
+	}
+	return true, nil
+}
+
+// AddBreadcrumb implements rides.RideRepository.
+func (p *postgresRideRepository) AddBreadcrumb(ctx context.Context, rideID int64, breadcrumb rides.RideBreadcrumb) error {
+	sql := `INSERT INTO ride_breadcrumbs (ride_id, lat, lng, recorded_at) VALUES ($1, $2, $3, $4)`
+	_, err := p.conn.Exec(ctx, sql, rideID, breadcrumb.Lat, breadcrumb.Lng, breadcrumb.RecordedAt)
+	return err
+}
+
+// GetBreadcrumbs implements rides.RideRepository.
+func (p *postgresRideRepository) GetBreadcrumbs(ctx context.Context, rideID int64) ([]rides.RideBreadcrumb, error) {
+	sql := `SELECT lat, lng, recorded_at FROM ride_breadcrumbs WHERE ride_id = $1 ORDER BY recorded_at, id`
+	rows, err := p.conn.Query(ctx, sql, rideID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	breadcrumbs := make([]rides.RideBreadcrumb, 0)
+	for rows.Next() {
+		var b rides.RideBreadcrumb
+		if err := rows.Scan(&b.Lat, &b.Lng, &b.RecordedAt); err != nil {
+			return nil, err
+		}
+		breadcrumbs = append(breadcrumbs, b)
+	}
+	return breadcrumbs, rows.Err()
+}
+
+// CreateAlert implements rides.RideRepository.
+func (p *postgresRideRepository) CreateAlert(ctx context.Context, alert rides.RideAlert) error {
+	sql := `INSERT INTO ride_alerts (type, ride_id, driver_id, vehicle_id, lat, lng, message, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := p.conn.Exec(ctx, sql, alert.Type, alert.RideID, alert.DriverID, alert.VehicleID, alert.Lat, alert.Lng, alert.Message, alert.Timestamp)
+	return err
+}
+
+// GetRecentAlerts implements rides.RideRepository.
+func (p *postgresRideRepository) GetRecentAlerts(ctx context.Context, limit int) ([]rides.RideAlert, error) {
+	sql := `SELECT type, ride_id, driver_id, vehicle_id, lat, lng, message, created_at FROM ride_alerts ORDER BY created_at DESC, id DESC LIMIT $1`
+	rows, err := p.conn.Query(ctx, sql, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	alerts := make([]rides.RideAlert, 0)
+	for rows.Next() {
+		var a rides.RideAlert
+		if err := rows.Scan(&a.Type, &a.RideID, &a.DriverID, &a.VehicleID, &a.Lat, &a.Lng, &a.Message, &a.Timestamp); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
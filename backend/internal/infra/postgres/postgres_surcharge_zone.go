@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+)
+
+type postgresSurchargeZoneRepository struct {
+	conn Connection
+}
+
+func NewPostgresSurchargeZone(conn Connection) payments.SurchargeZoneRepository {
+	return &postgresSurchargeZoneRepository{conn: conn}
+}
+
+const surchargeZoneColumns = "id, name, type, polygon, fee, created_at, updated_at"
+
+func (p *postgresSurchargeZoneRepository) fetch(ctx context.Context, query string, args ...interface{}) ([]payments.SurchargeZone, error) {
+	rows, err := p.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	zones := make([]payments.SurchargeZone, 0)
+	for rows.Next() {
+		var z payments.SurchargeZone
+		if err := rows.Scan(&z.ID, &z.Name, &z.Type, &z.Polygon, &z.Fee, &z.CreatedAt, &z.UpdatedAt); err != nil {
+			return nil, err
+		}
+		zones = append(zones, z)
+	}
+	return zones, rows.Err()
+}
+
+// GetZones implements payments.SurchargeZoneRepository.
+func (p *postgresSurchargeZoneRepository) GetZones(ctx context.Context) ([]payments.SurchargeZone, error) {
+	sql := fmt.Sprintf("SELECT %v FROM surcharge_zones ORDER BY id", surchargeZoneColumns)
+	return p.fetch(ctx, sql)
+}
+
+// GetZone implements payments.SurchargeZoneRepository.
+func (p *postgresSurchargeZoneRepository) GetZone(ctx context.Context, zoneID int64) (payments.SurchargeZone, error) {
+	sql := fmt.Sprintf("SELECT %v FROM surcharge_zones WHERE id = $1", surchargeZoneColumns)
+	zones, err := p.fetch(ctx, sql, zoneID)
+	if err != nil {
+		return payments.SurchargeZone{}, err
+	}
+	if len(zones) == 0 {
+		return payments.SurchargeZone{}, core.Errorf(core.ENOTFOUND, "surcharge zone with id %v not found", zoneID)
+	}
+	return zones[0], nil
+}
+
+// CreateZone implements payments.SurchargeZoneRepository.
+func (p *postgresSurchargeZoneRepository) CreateZone(ctx context.Context, zone *payments.SurchargeZone) error {
+	sql := `INSERT INTO surcharge_zones (name, type, polygon, fee, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+	return p.conn.QueryRow(ctx, sql, zone.Name, zone.Type, zone.Polygon, zone.Fee, zone.CreatedAt, zone.UpdatedAt).Scan(&zone.ID)
+}
+
+// UpdateZone implements payments.SurchargeZoneRepository.
+func (p *postgresSurchargeZoneRepository) UpdateZone(ctx context.Context, zone payments.SurchargeZone) error {
+	sql := "UPDATE surcharge_zones SET name = $2, type = $3, polygon = $4, fee = $5, updated_at = $6 WHERE id = $1"
+	_, err := p.conn.Exec(ctx, sql, zone.ID, zone.Name, zone.Type, zone.Polygon, zone.Fee, zone.UpdatedAt)
+	return err
+}
+
+// DeleteZone implements payments.SurchargeZoneRepository.
+func (p *postgresSurchargeZoneRepository) DeleteZone(ctx context.Context, zoneID int64) error {
+	_, err := p.conn.Exec(ctx, "DELETE FROM surcharge_zones WHERE id = $1", zoneID)
+	return err
+}
@@ -30,6 +30,8 @@ func (p *postgresUserRepository) fetch(ctx context.Context, query string, args .
 			&u.UserID,
 			&u.Name,
 			&u.Simulated,
+			&u.Role,
+			&u.Email,
 		); err != nil {
 			return nil, err
 		}
@@ -43,10 +45,17 @@ func (p *postgresUserRepository) CreateOrUpdate(ctx context.Context, user *users
 	if err := user.Validate(); err != nil {
 		return err
 	}
-	sql := `INSERT INTO users (user_uid, name, simulated) VALUES ($1, $2, false)
+	sql := `INSERT INTO users (user_uid, name, simulated, email) VALUES ($1, $2, false, $3)
 			ON CONFLICT(user_uid) DO NOTHING
 			RETURNING id`
-	return p.conn.QueryRow(ctx, sql, user.UserID, user.Name).Scan(&user.ID)
+	return p.conn.QueryRow(ctx, sql, user.UserID, user.Name, user.Email).Scan(&user.ID)
+}
+
+// SetEmail implements users.UserRepository.
+func (p *postgresUserRepository) SetEmail(ctx context.Context, id int64, email string) error {
+	sql := "UPDATE users SET email = $2 WHERE id = $1"
+	_, err := p.conn.Exec(ctx, sql, id, email)
+	return err
 }
 
 // Delete implements users.UserRepository.
@@ -58,7 +67,7 @@ func (p *postgresUserRepository) Delete(ctx context.Context, id int64) error {
 
 // GetByID implements users.UserRepository.
 func (p *postgresUserRepository) GetByID(ctx context.Context, id int64) (users.User, error) {
-	sql := "SELECT id, user_uid, name, simulated FROM users WHERE id = $1"
+	sql := "SELECT id, user_uid, name, simulated, role, email FROM users WHERE id = $1"
 	userList, err := p.fetch(ctx, sql, id)
 	if err != nil {
 		return users.User{}, err
@@ -71,7 +80,7 @@ func (p *postgresUserRepository) GetByID(ctx context.Context, id int64) (users.U
 
 // GetByUserID implements users.UserRepository.
 func (p *postgresUserRepository) GetByUserID(ctx context.Context, userID string) (users.User, error) {
-	sql := "SELECT id, user_uid, name, simulated FROM users WHERE user_uid = $1"
+	sql := "SELECT id, user_uid, name, simulated, role, email FROM users WHERE user_uid = $1"
 	userList, err := p.fetch(ctx, sql, userID)
 	if err != nil {
 		return users.User{}, err
@@ -82,9 +91,15 @@ func (p *postgresUserRepository) GetByUserID(ctx context.Context, userID string)
 	return userList[0], nil
 }
 
+// GetByRole implements users.UserRepository.
+func (p *postgresUserRepository) GetByRole(ctx context.Context, role string) ([]users.User, error) {
+	sql := "SELECT id, user_uid, name, simulated, role, email FROM users WHERE role = $1"
+	return p.fetch(ctx, sql, role)
+}
+
 // GetSimulatedUsers implements users.UserRepository.
 func (p *postgresUserRepository) GetSimulatedUsers(ctx context.Context) ([]users.User, error) {
-	sql := "SELECT id, user_uid, name, simulated FROM users WHERE simulated = true"
+	sql := "SELECT id, user_uid, name, simulated, role, email FROM users WHERE simulated = true"
 	userList, err := p.fetch(ctx, sql)
 	if err != nil {
 		return userList, err
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/bjarke-xyz/uber-clone-backend/internal/core"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/drivers"
 	"github.com/bjarke-xyz/uber-clone-backend/internal/core/vehicles"
 	"github.com/samber/lo"
 )
@@ -20,6 +21,8 @@ func NewPostgresVehicle(conn Connection) vehicles.VehicleRepository {
 	return &postgresVehicleRepository{conn: conn}
 }
 
+const vehicleColumns = "id, registration_country, registration_number, owner_id, icon, class"
+
 func (p *postgresVehicleRepository) fetch(ctx context.Context, query string, args ...interface{}) ([]vehicles.Vehicle, error) {
 	rows, err := p.conn.Query(ctx, query, args...)
 	if err != nil {
@@ -36,6 +39,7 @@ func (p *postgresVehicleRepository) fetch(ctx context.Context, query string, arg
 			&v.RegistrationNumber,
 			&v.OwnerID,
 			&v.Icon,
+			&v.Class,
 		); err != nil {
 			return nil, err
 		}
@@ -46,7 +50,7 @@ func (p *postgresVehicleRepository) fetch(ctx context.Context, query string, arg
 
 // GetByIdAndOwnerId implements vehicles.VehicleRepository.
 func (p *postgresVehicleRepository) GetByIdAndOwnerId(ctx context.Context, vehicleId int64, userId int64) (vehicles.Vehicle, error) {
-	sql := "SELECT id, registration_country, registration_number, owner_id, icon FROM vehicles WHERE id = $1 AND owner_id = $2"
+	sql := fmt.Sprintf("SELECT %v FROM vehicles WHERE id = $1 AND owner_id = $2", vehicleColumns)
 	vehicleList, err := p.fetch(ctx, sql, vehicleId, userId)
 	if err != nil {
 		return vehicles.Vehicle{}, err
@@ -69,7 +73,7 @@ func (p *postgresVehicleRepository) Delete(ctx context.Context, id int64) error
 
 // GetByID implements vehicles.VehicleRepository.
 func (p *postgresVehicleRepository) GetByID(ctx context.Context, id int64) (vehicles.Vehicle, error) {
-	sql := "SELECT id, registration_country, registration_number, owner_id, icon FROM vehicles WHERE id = $1"
+	sql := fmt.Sprintf("SELECT %v FROM vehicles WHERE id = $1", vehicleColumns)
 	vehicleList, err := p.fetch(ctx, sql, id)
 	if err != nil {
 		return vehicles.Vehicle{}, err
@@ -82,7 +86,7 @@ func (p *postgresVehicleRepository) GetByID(ctx context.Context, id int64) (vehi
 
 // GetByOwnerId implements vehicles.VehicleRepository.
 func (p *postgresVehicleRepository) GetByOwnerId(ctx context.Context, userId int64) ([]vehicles.Vehicle, error) {
-	sql := "SELECT id, registration_country, registration_number, owner_id, icon FROM vehicles WHERE owner_id = $1"
+	sql := fmt.Sprintf("SELECT %v FROM vehicles WHERE owner_id = $1", vehicleColumns)
 	vehicleList, err := p.fetch(ctx, sql, userId)
 	if err != nil {
 		return vehicleList, err
@@ -92,9 +96,11 @@ func (p *postgresVehicleRepository) GetByOwnerId(ctx context.Context, userId int
 
 // GetSimulatedVehicles implements vehicles.VehicleRepository.
 func (p *postgresVehicleRepository) GetSimulatedVehicles(ctx context.Context) ([]vehicles.Vehicle, error) {
-	sql := `SELECT v.id, v.registration_country, v.registration_number, v.owner_id, v.icon FROM vehicles v
-			WHERE v.owner_id IN (SELECT id FROM users WHERE simulated = true)`
-	vehicleList, err := p.fetch(ctx, sql)
+	// Only the vehicles simulated drivers are online with
+	sql := fmt.Sprintf(`SELECT %v FROM vehicles
+			WHERE owner_id IN (SELECT id FROM users WHERE simulated = true)
+			AND id IN (SELECT vehicle_id FROM driver_availability WHERE state != $1)`, vehicleColumns)
+	vehicleList, err := p.fetch(ctx, sql, drivers.AvailabilityOffline)
 	if err != nil {
 		return vehicleList, err
 	}
@@ -0,0 +1,102 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/geo"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/rides"
+)
+
+// formatAmount formats an amount in minor units with the icon of the currency
+func formatAmount(amount int, currencyCode string) string {
+	currency, ok := payments.GetCurrency(currencyCode)
+	if !ok {
+		currency = payments.Currency{Symbol: currencyCode, Icon: currencyCode, Decimals: 2, IconPosition: payments.IconAfter}
+	}
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	value := fmt.Sprintf("%.*f", currency.Decimals, float64(amount)/math.Pow10(currency.Decimals))
+	if currency.IconPosition == payments.IconBefore {
+		return fmt.Sprintf("%v%v%v", sign, currency.Icon, value)
+	}
+	return fmt.Sprintf("%v%v %v", sign, value, currency.Icon)
+}
+
+func formatRate(rate float64) string {
+	return fmt.Sprintf("%v%%", math.Round(rate*10000)/100)
+}
+
+func formatDate(t time.Time) string {
+	return t.UTC().Format("2 January 2006")
+}
+
+func formatDateTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format("2 January 2006 15:04 MST")
+}
+
+func formatMonth(t time.Time) string {
+	return t.UTC().Format("January 2006")
+}
+
+func lineItemLabel(item rides.RideLineItem) string {
+	label := ""
+	switch item.Type {
+	case rides.LineItemTip:
+		label = "Tip"
+	case rides.LineItemPromotion:
+		label = "Promotion discount"
+	case rides.LineItemWaitingTime:
+		label = "Waiting time"
+	case rides.LineItemAirportFee:
+		label = "Airport fee"
+	case rides.LineItemZoneFee:
+		label = "Zone fee"
+	case "":
+		return ""
+	default:
+		label = strings.ToUpper(item.Type[:1]) + strings.ReplaceAll(item.Type[1:], "_", " ")
+	}
+	if item.Description != "" {
+		return fmt.Sprintf("%v (%v)", label, item.Description)
+	}
+	return label
+}
+
+// routePoints projects the encoded route onto a width by height box, with y pointing down.
+// Longitudes are scaled by the cosine of the latitude so the route keeps its shape
+func routePoints(encoded string, width float64, height float64, padding float64) [][2]float64 {
+	coordinates, err := geo.DecodePolyline(encoded)
+	if err != nil || len(coordinates) == 0 {
+		return [][2]float64{}
+	}
+	minLat, maxLat := coordinates[0][0], coordinates[0][0]
+	minLng, maxLng := coordinates[0][1], coordinates[0][1]
+	for _, c := range coordinates {
+		minLat, maxLat = math.Min(minLat, c[0]), math.Max(maxLat, c[0])
+		minLng, maxLng = math.Min(minLng, c[1]), math.Max(maxLng, c[1])
+	}
+	lngScale := math.Cos((minLat + maxLat) / 2 * math.Pi / 180)
+	spanX := (maxLng - minLng) * lngScale
+	spanY := maxLat - minLat
+	scale := math.Min((width-2*padding)/math.Max(spanX, 1e-9), (height-2*padding)/math.Max(spanY, 1e-9))
+	offsetX := (width - spanX*scale) / 2
+	offsetY := (height - spanY*scale) / 2
+	points := make([][2]float64, 0, len(coordinates))
+	for _, c := range coordinates {
+		points = append(points, [2]float64{
+			offsetX + (c[1]-minLng)*lngScale*scale,
+			offsetY + (maxLat-c[0])*scale,
+		})
+	}
+	return points
+}
@@ -0,0 +1,127 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/rides"
+)
+
+const (
+	mapWidth   = 480
+	mapHeight  = 240
+	mapPadding = 12
+)
+
+var funcs = template.FuncMap{
+	"amount":    formatAmount,
+	"rate":      formatRate,
+	"date":      formatDate,
+	"dateTime":  formatDateTime,
+	"month":     formatMonth,
+	"label":     lineItemLabel,
+	"routeSVG":  routeSVGPoints,
+	"mapWidth":  func() int { return mapWidth },
+	"mapHeight": func() int { return mapHeight },
+}
+
+// routeSVGPoints returns the points attribute of an SVG polyline of the route
+func routeSVGPoints(encoded string) string {
+	points := routePoints(encoded, mapWidth, mapHeight, mapPadding)
+	parts := make([]string, 0, len(points))
+	for _, p := range points {
+		parts = append(parts, fmt.Sprintf("%.1f,%.1f", p[0], p[1]))
+	}
+	return strings.Join(parts, " ")
+}
+
+const styles = `
+body { font-family: Helvetica, Arial, sans-serif; color: #222; max-width: 640px; margin: 24px auto; }
+h1 { font-size: 22px; margin-bottom: 4px; }
+h2 { font-size: 16px; margin-top: 24px; }
+table { width: 100%; border-collapse: collapse; }
+td { padding: 4px 0; }
+td.amount { text-align: right; }
+tr.total td { border-top: 1px solid #222; font-weight: bold; }
+.muted { color: #666; font-size: 13px; }
+`
+
+var receiptTemplate = template.Must(template.New("receipt.html").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Receipt {{.InvoiceNumber}}</title><style>` + styles + `</style></head>
+<body>
+<h1>Receipt {{.InvoiceNumber}}</h1>
+<div class="muted">Issued {{date .IssuedAt}}</div>
+{{if .Billing}}<p>{{.Billing.CompanyName}}<br>{{.Billing.Address}}{{if .Billing.VATNumber}}<br>VAT no. {{.Billing.VATNumber}}{{end}}</p>{{end}}
+<p>{{.RiderName}}</p>
+<h2>Ride</h2>
+<table>
+<tr><td>From</td><td class="amount">{{.FromName}}</td></tr>
+<tr><td>To</td><td class="amount">{{.ToName}}</td></tr>
+<tr><td>Finished</td><td class="amount">{{dateTime .FinishedAt}}</td></tr>
+<tr><td>Driver</td><td class="amount">{{.DriverName}}</td></tr>
+<tr><td>Vehicle</td><td class="amount">{{.VehicleRegistration}} ({{.VehicleClass}})</td></tr>
+</table>
+<svg width="{{mapWidth}}" height="{{mapHeight}}" viewBox="0 0 {{mapWidth}} {{mapHeight}}" style="background:#f2f2f2;margin-top:12px">
+<polyline points="{{routeSVG .Route}}" fill="none" stroke="#276ef1" stroke-width="3" stroke-linejoin="round"/>
+</svg>
+<h2>Charges</h2>
+<table>
+{{$currency := .Currency}}
+{{range .FareComponents}}<tr><td>{{.Name}}</td><td class="amount">{{amount .Amount $currency}}</td></tr>
+{{end}}
+{{range .LineItems}}<tr><td>{{label .}}</td><td class="amount">{{amount .Amount $currency}}</td></tr>
+{{end}}
+<tr class="total"><td>Total</td><td class="amount">{{amount .Total $currency}}</td></tr>
+{{if .Refunded}}<tr><td>Refunded</td><td class="amount">{{amount .Refunded $currency}}</td></tr>{{end}}
+</table>
+{{if .VAT}}<h2>VAT</h2>
+<table>
+{{range .VAT}}<tr><td>{{.Jurisdiction}} {{rate .Rate}} of {{amount .Net $currency}}</td><td class="amount">{{amount .VAT $currency}}</td></tr>
+{{end}}
+</table>{{end}}
+</body></html>`))
+
+var monthlyInvoiceTemplate = template.Must(template.New("invoice.html").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Invoice {{.InvoiceNumber}}</title><style>` + styles + `</style></head>
+<body>
+<h1>Invoice {{.InvoiceNumber}}</h1>
+<div class="muted">Issued {{date .IssuedAt}}, rides in {{month .PeriodStart}}</div>
+<p>{{.Billing.CompanyName}}<br>{{.Billing.Address}}{{if .Billing.VATNumber}}<br>VAT no. {{.Billing.VATNumber}}{{end}}</p>
+<p>{{.RiderName}}</p>
+<h2>Rides</h2>
+<table>
+{{range .Receipts}}<tr><td>{{.InvoiceNumber}}<br><span class="muted">{{dateTime .FinishedAt}}, {{.FromName}} to {{.ToName}}</span></td><td class="amount">{{amount .Total .Currency}}</td></tr>
+{{end}}
+</table>
+{{range .Totals}}{{$currency := .Currency}}
+<h2>Total in {{$currency}}</h2>
+<table>
+<tr class="total"><td>Total</td><td class="amount">{{amount .Total $currency}}</td></tr>
+{{if .Refunded}}<tr><td>Refunded</td><td class="amount">{{amount .Refunded $currency}}</td></tr>{{end}}
+{{range .VAT}}<tr><td>VAT {{.Jurisdiction}} {{rate .Rate}} of {{amount .Net $currency}}</td><td class="amount">{{amount .VAT $currency}}</td></tr>
+{{end}}
+</table>
+{{end}}
+</body></html>`))
+
+// ReceiptHTML renders the receipt as an HTML document
+func ReceiptHTML(receipt rides.RideReceipt) ([]byte, error) {
+	var buf bytes.Buffer
+	err := receiptTemplate.Execute(&buf, receipt)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MonthlyInvoiceHTML renders the invoice as an HTML document
+func MonthlyInvoiceHTML(invoice rides.MonthlyInvoice) ([]byte, error) {
+	var buf bytes.Buffer
+	err := monthlyInvoiceTemplate.Execute(&buf, invoice)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
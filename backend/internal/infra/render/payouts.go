@@ -0,0 +1,175 @@
+package render
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/samber/lo"
+)
+
+// SEPADebtor is the account of the platform payouts are sent from
+type SEPADebtor struct {
+	Name string
+	IBAN string
+	BIC  string
+}
+
+// decimalAmount formats an amount in minor units as a decimal number without currency icon, as banks expect it
+func decimalAmount(amount int, currencyCode string) string {
+	currency, ok := payments.GetCurrency(currencyCode)
+	if !ok {
+		currency.Decimals = 2
+	}
+	return strconv.FormatFloat(float64(amount)/math.Pow10(currency.Decimals), 'f', currency.Decimals, 64)
+}
+
+// Elements of a pain.001.001.03 customer credit transfer initiation, the SEPA credit transfer file format
+
+type sepaDocument struct {
+	XMLName    xml.Name       `xml:"urn:iso:std:iso:20022:tech:xsd:pain.001.001.03 Document"`
+	Initiation sepaInitiation `xml:"CstmrCdtTrfInitn"`
+}
+
+type sepaInitiation struct {
+	GroupHeader sepaGroupHeader `xml:"GrpHdr"`
+	Payment     sepaPayment     `xml:"PmtInf"`
+}
+
+type sepaGroupHeader struct {
+	MessageID       string    `xml:"MsgId"`
+	CreatedAt       string    `xml:"CreDtTm"`
+	Transactions    int       `xml:"NbOfTxs"`
+	ControlSum      string    `xml:"CtrlSum"`
+	InitiatingParty sepaParty `xml:"InitgPty"`
+}
+
+type sepaParty struct {
+	Name string `xml:"Nm"`
+}
+
+type sepaAccount struct {
+	IBAN string `xml:"Id>IBAN"`
+}
+
+type sepaAgent struct {
+	BIC string `xml:"FinInstnId>BIC"`
+}
+
+type sepaPayment struct {
+	PaymentID       string               `xml:"PmtInfId"`
+	Method          string               `xml:"PmtMtd"`
+	Transactions    int                  `xml:"NbOfTxs"`
+	ControlSum      string               `xml:"CtrlSum"`
+	ServiceLevel    string               `xml:"PmtTpInf>SvcLvl>Cd"`
+	ExecutionDate   string               `xml:"ReqdExctnDt"`
+	Debtor          sepaParty            `xml:"Dbtr"`
+	DebtorAccount   sepaAccount          `xml:"DbtrAcct"`
+	DebtorAgent     *sepaAgent           `xml:"DbtrAgt,omitempty"`
+	ChargeBearer    string               `xml:"ChrgBr"`
+	CreditTransfers []sepaCreditTransfer `xml:"CdtTrfTxInf"`
+}
+
+type sepaAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type sepaCreditTransfer struct {
+	EndToEndID      string      `xml:"PmtId>EndToEndId"`
+	Amount          sepaAmount  `xml:"Amt>InstdAmt"`
+	CreditorAgent   *sepaAgent  `xml:"CdtrAgt,omitempty"`
+	Creditor        sepaParty   `xml:"Cdtr"`
+	CreditorAccount sepaAccount `xml:"CdtrAcct"`
+	Remittance      string      `xml:"RmtInf>Ustrd"`
+}
+
+// PayoutsSEPA renders the pending payouts of the batch as a SEPA credit transfer file.
+// SEPA transfers are in euro only
+func PayoutsSEPA(batch payments.PayoutBatch, debtor SEPADebtor, now time.Time) ([]byte, error) {
+	if batch.Currency != "EUR" {
+		return nil, fmt.Errorf("SEPA transfers must be in EUR, batch %v is in %v", batch.ID, batch.Currency)
+	}
+	if debtor.IBAN == "" {
+		return nil, fmt.Errorf("no debtor account is configured")
+	}
+	pending := lo.Filter(batch.Payouts, func(item payments.Payout, index int) bool { return item.State == payments.PayoutStatePending })
+	controlSum := decimalAmount(lo.SumBy(pending, func(item payments.Payout) int { return item.Amount }), batch.Currency)
+	messageID := fmt.Sprintf("PAYOUT-BATCH-%v", batch.ID)
+	document := sepaDocument{
+		Initiation: sepaInitiation{
+			GroupHeader: sepaGroupHeader{
+				MessageID:       messageID,
+				CreatedAt:       now.UTC().Format("2006-01-02T15:04:05"),
+				Transactions:    len(pending),
+				ControlSum:      controlSum,
+				InitiatingParty: sepaParty{Name: debtor.Name},
+			},
+			Payment: sepaPayment{
+				PaymentID:     messageID,
+				Method:        "TRF",
+				Transactions:  len(pending),
+				ControlSum:    controlSum,
+				ServiceLevel:  "SEPA",
+				ExecutionDate: now.UTC().Format("2006-01-02"),
+				Debtor:        sepaParty{Name: debtor.Name},
+				DebtorAccount: sepaAccount{IBAN: debtor.IBAN},
+				ChargeBearer:  "SLEV",
+				CreditTransfers: lo.Map(pending, func(item payments.Payout, index int) sepaCreditTransfer {
+					transfer := sepaCreditTransfer{
+						EndToEndID:      item.Reference(),
+						Amount:          sepaAmount{Currency: item.Currency, Value: decimalAmount(item.Amount, item.Currency)},
+						Creditor:        sepaParty{Name: item.HolderName},
+						CreditorAccount: sepaAccount{IBAN: item.IBAN},
+						Remittance:      fmt.Sprintf("Earnings payout %v", item.Reference()),
+					}
+					if item.BIC != "" {
+						transfer.CreditorAgent = &sepaAgent{BIC: item.BIC}
+					}
+					return transfer
+				}),
+			},
+		},
+	}
+	if debtor.BIC != "" {
+		document.Initiation.Payment.DebtorAgent = &sepaAgent{BIC: debtor.BIC}
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// PayoutsCSV renders the payouts of the batch as CSV, one payout per row
+func PayoutsCSV(batch payments.PayoutBatch) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"payout_id", "driver_id", "holder_name", "iban", "bic", "amount", "currency", "reference", "state"})
+	for _, payout := range batch.Payouts {
+		writer.Write([]string{
+			strconv.FormatInt(payout.ID, 10),
+			strconv.FormatInt(payout.DriverID, 10),
+			payout.HolderName,
+			payout.IBAN,
+			payout.BIC,
+			decimalAmount(payout.Amount, payout.Currency),
+			payout.Currency,
+			payout.Reference(),
+			string(payout.State),
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,158 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 in points
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+	pageMargin = 50.0
+)
+
+// pdfDocument writes a PDF of text and lines using the standard Helvetica fonts, so no fonts are embedded.
+// Positions are in points from the top left corner of the page
+type pdfDocument struct {
+	pages []*bytes.Buffer
+	// Position of the next line of text on the current page
+	y float64
+}
+
+func newPDFDocument() *pdfDocument {
+	d := &pdfDocument{}
+	d.newPage()
+	return d
+}
+
+func (d *pdfDocument) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pageMargin
+}
+
+func (d *pdfDocument) page() *bytes.Buffer {
+	return d.pages[len(d.pages)-1]
+}
+
+// ensureSpace starts a new page if height does not fit below the current line
+func (d *pdfDocument) ensureSpace(height float64) {
+	if d.y+height > pageHeight-pageMargin {
+		d.newPage()
+	}
+}
+
+// winAnsi encodes s in the WinAnsiEncoding of the standard fonts and escapes it as a PDF string.
+// Characters the encoding does not have are replaced with ?
+func winAnsi(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r == '€':
+			sb.WriteString("\\200")
+		case r >= 0x20 && r < 0x7f:
+			sb.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&sb, "\\%03o", r)
+		default:
+			sb.WriteByte('?')
+		}
+	}
+	return sb.String()
+}
+
+// textWidth estimates the width of text in Helvetica, as the standard fonts carry no metrics
+func textWidth(s string, size float64) float64 {
+	return float64(len([]rune(s))) * size * 0.5
+}
+
+func (d *pdfDocument) text(x float64, y float64, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.page(), "BT /%v %.1f Tf %.2f %.2f Td (%v) Tj ET\n", font, size, x, pageHeight-y, winAnsi(s))
+}
+
+// heading writes a line of bold text and moves to the next line
+func (d *pdfDocument) heading(size float64, s string) {
+	d.ensureSpace(size * 2)
+	d.y += size * 1.6
+	d.text(pageMargin, d.y, size, true, s)
+	d.y += size * 0.4
+}
+
+// row writes label at the left margin and value aligned to the right margin, and moves to the next line
+func (d *pdfDocument) row(label string, value string, bold bool) {
+	const size = 10.0
+	d.ensureSpace(size * 1.6)
+	d.y += size * 1.6
+	d.text(pageMargin, d.y, size, bold, label)
+	d.text(pageWidth-pageMargin-textWidth(value, size), d.y, size, bold, value)
+}
+
+// rule draws a line across the page below the current line
+func (d *pdfDocument) rule() {
+	d.y += 4
+	fmt.Fprintf(d.page(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", pageMargin, pageHeight-d.y, pageWidth-pageMargin, pageHeight-d.y)
+}
+
+// route draws the encoded route in a box of the given height spanning the page
+func (d *pdfDocument) route(encoded string, height float64) {
+	width := pageWidth - 2*pageMargin
+	d.ensureSpace(height + 12)
+	top := d.y + 12
+	page := d.page()
+	fmt.Fprintf(page, "0.95 g %.2f %.2f %.2f %.2f re f 0 g\n", pageMargin, pageHeight-top-height, width, height)
+	points := routePoints(encoded, width, height, mapPadding)
+	if len(points) > 1 {
+		fmt.Fprintf(page, "0.15 0.43 0.95 RG 2 w 1 j\n")
+		for i, p := range points {
+			op := "l"
+			if i == 0 {
+				op = "m"
+			}
+			fmt.Fprintf(page, "%.2f %.2f %v\n", pageMargin+p[0], pageHeight-top-p[1], op)
+		}
+		fmt.Fprintf(page, "S 0 G\n")
+	}
+	d.y = top + height
+}
+
+// bytes returns the PDF file
+func (d *pdfDocument) bytes() []byte {
+	var buf bytes.Buffer
+	offsets := make([]int, 0)
+	object := func(content string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%v\nendobj\n", len(offsets), content)
+	}
+	buf.WriteString("%PDF-1.4\n")
+
+	// Objects 1 to 4 are the catalog, the page tree and the fonts, followed by each page and its content stream
+	kids := make([]string, 0, len(d.pages))
+	for i := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 5+2*i))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%v] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%vendstream", page.Len(), page.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
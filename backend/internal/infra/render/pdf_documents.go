@@ -0,0 +1,85 @@
+package render
+
+import (
+	"fmt"
+
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/payments"
+	"github.com/bjarke-xyz/uber-clone-backend/internal/core/rides"
+)
+
+func (d *pdfDocument) billing(billing payments.BillingProfile) {
+	d.row(billing.CompanyName, "", false)
+	d.row(billing.Address, "", false)
+	if billing.VATNumber != "" {
+		d.row("VAT no. "+billing.VATNumber, "", false)
+	}
+}
+
+// ReceiptPDF renders the receipt as a PDF document
+func ReceiptPDF(receipt rides.RideReceipt) []byte {
+	d := newPDFDocument()
+	d.heading(20, "Receipt "+receipt.InvoiceNumber)
+	d.row("Issued "+formatDate(receipt.IssuedAt), "", false)
+	if receipt.Billing != nil {
+		d.billing(*receipt.Billing)
+	}
+	d.row(receipt.RiderName, "", false)
+
+	d.heading(13, "Ride")
+	d.row("From", receipt.FromName, false)
+	d.row("To", receipt.ToName, false)
+	d.row("Finished", formatDateTime(receipt.FinishedAt), false)
+	d.row("Driver", receipt.DriverName, false)
+	d.row("Vehicle", fmt.Sprintf("%v (%v)", receipt.VehicleRegistration, receipt.VehicleClass), false)
+	d.route(receipt.Route, 220)
+
+	d.heading(13, "Charges")
+	for _, component := range receipt.FareComponents {
+		d.row(component.Name, formatAmount(component.Amount, receipt.Currency), false)
+	}
+	for _, item := range receipt.LineItems {
+		d.row(lineItemLabel(item), formatAmount(item.Amount, receipt.Currency), false)
+	}
+	d.rule()
+	d.row("Total", formatAmount(receipt.Total, receipt.Currency), true)
+	if receipt.Refunded != 0 {
+		d.row("Refunded", formatAmount(receipt.Refunded, receipt.Currency), false)
+	}
+
+	if len(receipt.VAT) > 0 {
+		d.heading(13, "VAT")
+		for _, vat := range receipt.VAT {
+			d.row(fmt.Sprintf("%v %v of %v", vat.Jurisdiction, formatRate(vat.Rate), formatAmount(vat.Net, receipt.Currency)),
+				formatAmount(vat.VAT, receipt.Currency), false)
+		}
+	}
+	return d.bytes()
+}
+
+// MonthlyInvoicePDF renders the invoice as a PDF document
+func MonthlyInvoicePDF(invoice rides.MonthlyInvoice) []byte {
+	d := newPDFDocument()
+	d.heading(20, "Invoice "+invoice.InvoiceNumber)
+	d.row(fmt.Sprintf("Issued %v, rides in %v", formatDate(invoice.IssuedAt), formatMonth(invoice.PeriodStart)), "", false)
+	d.billing(invoice.Billing)
+	d.row(invoice.RiderName, "", false)
+
+	d.heading(13, "Rides")
+	for _, receipt := range invoice.Receipts {
+		d.row(fmt.Sprintf("%v  %v, %v to %v", receipt.InvoiceNumber, formatDateTime(receipt.FinishedAt), receipt.FromName, receipt.ToName),
+			formatAmount(receipt.Total, receipt.Currency), false)
+	}
+
+	for _, total := range invoice.Totals {
+		d.heading(13, "Total in "+total.Currency)
+		d.row("Total", formatAmount(total.Total, total.Currency), true)
+		if total.Refunded != 0 {
+			d.row("Refunded", formatAmount(total.Refunded, total.Currency), false)
+		}
+		for _, vat := range total.VAT {
+			d.row(fmt.Sprintf("VAT %v %v of %v", vat.Jurisdiction, formatRate(vat.Rate), formatAmount(vat.Net, total.Currency)),
+				formatAmount(vat.VAT, total.Currency), false)
+		}
+	}
+	return d.bytes()
+}
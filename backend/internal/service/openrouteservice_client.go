@@ -28,7 +28,7 @@ func NewOpenRouteServiceClient(apiKey string) rides.RouteServiceClient {
 	}
 }
 
-func (o *OpenRouteServiceClient) GetDirections(locations [][]float64) (*rides.ORSDirections, error) {
+func (o *OpenRouteServiceClient) GetDirections(locations [][]float64) (*rides.Directions, error) {
 	reqBody := make(map[string]any, 0)
 	reqBody["coordinates"] = locations
 	reqBody["maneuvers"] = true
@@ -61,5 +61,5 @@ func (o *OpenRouteServiceClient) GetDirections(locations [][]float64) (*rides.OR
 	if err != nil {
 		return nil, err
 	}
-	return directions, nil
+	return directions.ToDirections()
 }
@@ -95,135 +95,44 @@ export interface RideRequest {
   toLng: number;
   toName: string;
   state: number;
-  directionsVersion: number | null;
-  directions: DirectionsV1 | null;
+  directions: Directions | null;
   price: number;
   currency: string;
   createdAt: string;
   updatedAt: string;
 }
 
-export interface DirectionsV1 {
-  bbox: number[];
-  routes: Route[];
-  metadata: Metadata;
-}
-
-export interface Route {
-  summary: Summary;
-  segments: Segment[];
-  bbox: number[];
-  geometry: string;
-  way_points: number[];
-}
-
-export interface Summary {
+export interface Directions {
+  provider: string;
   distance: number;
   duration: number;
+  /** [lat, lng] pairs */
+  coordinates: number[][];
+  legs: DirectionsLeg[];
 }
 
-export interface Segment {
+export interface DirectionsLeg {
   distance: number;
   duration: number;
-  steps: Step[];
+  steps: DirectionsStep[];
 }
 
-export interface Step {
+export interface DirectionsStep {
   distance: number;
   duration: number;
   type: number;
   instruction: string;
   name: string;
-  way_points: number[];
-  maneuver: Maneuver;
-}
-
-export interface Maneuver {
-  location: number[];
-  bearing_before: number;
-  bearing_after: number;
-}
-
-export interface Metadata {
-  attribution: string;
-  service: string;
-  timestamp: number;
-  query: Query;
-  engine: Engine;
+  wayPoints: number[];
+  location: number[] | null;
+  bearingBefore: number;
+  bearingAfter: number;
 }
 
-export interface Query {
-  coordinates: number[][];
-  profile: string;
-  format: string;
-}
-
-export interface Engine {
-  version: string;
-  build_date: string;
-  graph_date: string;
-}
-
-/**
- * Decode an x,y or x,y,z encoded polyline
- * @param {*} encodedPolyline
- * @param {Boolean} includeElevation - true for x,y,z polyline
- * @returns {Array} of coordinates
- */
-export const decodePolyline = (
-  encodedPolyline: string,
-  includeElevation = false
-) => {
-  // array that holds the points
-  const points = [];
-  let index = 0;
-  const len = encodedPolyline.length;
-  let lat = 0;
-  let lng = 0;
-  let ele = 0;
-  while (index < len) {
-    let b;
-    let shift = 0;
-    let result = 0;
-    do {
-      b = encodedPolyline.charAt(index++).charCodeAt(0) - 63; // finds ascii
-      // and subtract it by 63
-      result |= (b & 0x1f) << shift;
-      shift += 5;
-    } while (b >= 0x20);
-
-    lat += (result & 1) !== 0 ? ~(result >> 1) : result >> 1;
-    shift = 0;
-    result = 0;
-    do {
-      b = encodedPolyline.charAt(index++).charCodeAt(0) - 63;
-      result |= (b & 0x1f) << shift;
-      shift += 5;
-    } while (b >= 0x20);
-    lng += (result & 1) !== 0 ? ~(result >> 1) : result >> 1;
-
-    if (includeElevation) {
-      shift = 0;
-      result = 0;
-      do {
-        b = encodedPolyline.charAt(index++).charCodeAt(0) - 63;
-        result |= (b & 0x1f) << shift;
-        shift += 5;
-      } while (b >= 0x20);
-      ele += (result & 1) !== 0 ? ~(result >> 1) : result >> 1;
-    }
-    try {
-      const location = [lat / 1e5, lng / 1e5];
-      if (includeElevation) location.push(ele / 100);
-      points.push(location);
-    } catch (e) {
-      console.log(e);
-    }
-  }
-  return points;
-};
-
 export interface Currency {
   symbol: string;
   icon: string;
+  name: string;
+  decimals: number;
+  iconPosition: "before" | "after";
 }
@@ -7,7 +7,7 @@ import { format, parseISO } from "date-fns";
 import L, { Icon } from "leaflet";
 import "leaflet-rotatedmarker";
 import markerIconPng from "leaflet/dist/images/marker-icon.png";
-import { sum, takeRight } from "lodash";
+import { takeRight } from "lodash";
 import { PropsWithChildren, useEffect, useMemo, useRef, useState } from "react";
 import {
   MapContainer,
@@ -25,7 +25,6 @@ import {
   Vehicle,
   backendApi,
   baseUrl,
-  decodePolyline,
 } from "../api/backend";
 import "./OverviewPage.css";
 import { useAtomValue } from "jotai";
@@ -53,6 +52,16 @@ function SideSection(props: PropsWithChildren<SideSectionProps>) {
   );
 }
 
+function formatPrice(amount: number, currency?: Currency): string {
+  if (!currency) {
+    return `${amount / 100}`;
+  }
+  const value = (amount / 10 ** currency.decimals).toFixed(currency.decimals);
+  return currency.iconPosition === "before"
+    ? `${currency.icon}${value}`
+    : `${value} ${currency.icon}`;
+}
+
 const maxLogLines = 100;
 
 export function OverviewPage() {
@@ -236,17 +245,11 @@ export function OverviewPage() {
                     </div>
                     <div className="flex self-end">
                       <span>
-                        {ride.price / 100} {currencies[ride.currency]?.icon}
+                        {formatPrice(ride.price, currencies[ride.currency])}
                       </span>
                       <span>&nbsp; &middot; &nbsp;</span>
                       <span>
-                        {Math.ceil(
-                          sum(
-                            ride.directions?.routes?.map(
-                              (x) => x.summary.distance
-                            ) ?? []
-                          ) / 1000
-                        )}{" "}
+                        {Math.ceil((ride.directions?.distance ?? 0) / 1000)}{" "}
                         km
                       </span>
                     </div>
@@ -339,9 +342,9 @@ export function OverviewPage() {
                 </Tooltip>
               </Marker>
               <Polyline
-                positions={decodePolyline(
-                  activeRide.directions?.routes[0]?.geometry ?? ""
-                ).map(([lat, lng]) => new L.LatLng(lat, lng))}
+                positions={(activeRide.directions?.coordinates ?? []).map(
+                  ([lat, lng]) => new L.LatLng(lat, lng)
+                )}
               ></Polyline>
             </>
           )}
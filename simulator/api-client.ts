@@ -2,7 +2,7 @@ import { FirebaseOptions, initializeApp } from "firebase/app";
 import { User, getAuth, signInWithEmailAndPassword } from "firebase/auth";
 import {
   BackendUser,
-  DirectionsV1,
+  Directions,
   LatLng,
   PostLogInput,
   RideRequest,
@@ -194,6 +194,46 @@ export class BackendApiClient {
     }
   }
 
+  async goOnline(vehicleId: number): Promise<boolean> {
+    try {
+      const idtoken = await this.mustGetToken();
+      const resp = await fetch(`${this.baseUrl}/v1/me/online`, {
+        method: "PUT",
+        headers: {
+          Authorization: `Bearer ${idtoken}`,
+          "Content-Type": "application/json",
+        },
+        body: JSON.stringify({ vehicleId }),
+      });
+      if (resp.status > 299) {
+        throw new Error(`goOnline ${vehicleId} returned ${resp.status}`);
+      }
+      return true;
+    } catch (error) {
+      console.log(`goOnline ${vehicleId} failed`, error);
+      return false;
+    }
+  }
+
+  async goOffline(): Promise<boolean> {
+    try {
+      const idtoken = await this.mustGetToken();
+      const resp = await fetch(`${this.baseUrl}/v1/me/offline`, {
+        method: "PUT",
+        headers: {
+          Authorization: `Bearer ${idtoken}`,
+        },
+      });
+      if (resp.status > 299) {
+        throw new Error(`goOffline returned ${resp.status}`);
+      }
+      return true;
+    } catch (error) {
+      console.log(`goOffline failed`, error);
+      return false;
+    }
+  }
+
   async finishRideRequest(id: number): Promise<boolean> {
     try {
       const idtoken = await this.mustGetToken();
@@ -213,10 +253,10 @@ export class BackendApiClient {
     }
   }
 
-  async getDirectionsV1(
+  async getDirections(
     rideRequestId: number,
     startPoint: LatLng | null = null
-  ): Promise<DirectionsV1 | null> {
+  ): Promise<Directions | null> {
     try {
       const idToken = await this.mustGetToken();
       const resp = await fetch(
@@ -231,12 +271,12 @@ export class BackendApiClient {
         }
       );
       if (resp.status > 299) {
-        throw new Error(`getDirectionsV1 returned status ${resp.status}`);
+        throw new Error(`getDirections returned status ${resp.status}`);
       }
-      const json = (await resp.json()) as DirectionsV1;
+      const json = (await resp.json()) as Directions;
       return json;
     } catch (error) {
-      console.log(`getDirectionsV1 failed ${rideRequestId}`, error);
+      console.log(`getDirections failed ${rideRequestId}`, error);
       return null;
     }
   }
@@ -10,7 +10,7 @@ import {
   getAngleInDegrees,
   isAbortError,
 } from "./types";
-import { decodePolyline, randomIntFromInterval } from "./util";
+import { randomIntFromInterval } from "./util";
 
 export interface RouteStep {
   bearing: number;
@@ -43,6 +43,8 @@ export class SimDriver extends SimRunner {
       while (this.running) {
         const randomWait = randomIntFromInterval(5, 15);
         await this.wait(randomWait * 1000);
+        // Going online again is a no-op, but brings the driver back if it was taken offline for inactivity
+        await this.apiClient.goOnline(vehicle.ID);
         await this.drive(vehicle);
       }
     } catch (error) {
@@ -50,6 +52,7 @@ export class SimDriver extends SimRunner {
         console.error("Unexpected error in driver run", error);
       }
     } finally {
+      await this.apiClient.goOffline();
       await this.stopped();
     }
   }
@@ -59,6 +62,7 @@ export class SimDriver extends SimRunner {
       (x) =>
         x.driverId === this.apiClient.getBackendUser()?.id &&
         (x.state === RideRequestState.Accepted ||
+          x.state === RideRequestState.DriverArrived ||
           x.state === RideRequestState.InProgress)
     );
     return rides;
@@ -117,6 +121,16 @@ export class SimDriver extends SimRunner {
         await this.wait(15 * 1000);
       }
     } else {
+      if (this.currentLocation) {
+        // Keep reporting the position so the driver stays online
+        await this.apiClient.updateLocation(
+          vehicle.ID,
+          this.currentLocation.lat,
+          this.currentLocation.lng,
+          0,
+          0
+        );
+      }
       await this.log("no ride requests found, waiting 10s");
       await this.wait(10 * 1000);
     }
@@ -172,7 +186,7 @@ export class SimDriver extends SimRunner {
     rideRequestId: number,
     startPoint: LatLng | null
   ): Promise<RouteStep[]> {
-    let directions = await this.apiClient.getDirectionsV1(
+    let directions = await this.apiClient.getDirections(
       rideRequestId,
       startPoint
     );
@@ -180,45 +194,32 @@ export class SimDriver extends SimRunner {
       const sleepSeconds = randomIntFromInterval(30 * 1000, 90 * 1000);
       await this.log(`failed to get directions, sleeping ${sleepSeconds}s`);
       await this.wait(sleepSeconds);
-      directions = await this.apiClient.getDirectionsV1(
+      directions = await this.apiClient.getDirections(
         rideRequestId,
         startPoint
       );
     }
     const steps: RouteStep[] = [];
     if (directions) {
-      for (const route of directions.routes) {
-        const geometryPolyline = decodePolyline(route.geometry);
-        for (const segment of route.segments) {
-          for (const step of segment.steps) {
-            const stepInfo: RouteStep = {
-              bearing: step.maneuver.bearing_after,
-              distance: step.distance,
-              duration: step.duration,
-              locations: [],
-            };
-            // stepInfo.locations.push(
-            //   new LatLng(step.maneuver.location[1], step.maneuver.location[0])
-            // );
-            steps.push(stepInfo);
-            // const coordinates = geometryPolyline.filter((x, i) =>
-            //   step.way_points.includes(i)
-            // );
-            let coordinates: number[][] = [];
-            if (step.way_points.length === 2) {
-              const [startIndex, endIndex] = step.way_points;
-              for (let i = 0; i < geometryPolyline.length; i++) {
-                const coord = geometryPolyline[i];
-                if (i >= startIndex && i <= endIndex) {
-                  coordinates.push(coord);
-                }
-              }
-            }
-            for (const coord of coordinates) {
-              const position = new LatLng(coord[0], coord[1]);
-              if (!stepInfo.locations.some((x) => x.equals(position))) {
-                stepInfo.locations.push(position);
-              }
+      const geometry = directions.coordinates;
+      for (const leg of directions.legs) {
+        for (const step of leg.steps) {
+          const stepInfo: RouteStep = {
+            bearing: step.bearingAfter,
+            distance: step.distance,
+            duration: step.duration,
+            locations: [],
+          };
+          steps.push(stepInfo);
+          let coordinates: number[][] = [];
+          if (step.wayPoints.length === 2) {
+            const [startIndex, endIndex] = step.wayPoints;
+            coordinates = geometry.slice(startIndex, endIndex + 1);
+          }
+          for (const coord of coordinates) {
+            const position = new LatLng(coord[0], coord[1]);
+            if (!stepInfo.locations.some((x) => x.equals(position))) {
+              stepInfo.locations.push(position);
             }
           }
         }
@@ -66,7 +66,9 @@ export class SimRider extends SimRunner {
   private needsRide(): boolean {
     return (
       !this.currentRideRequest ||
-      this.currentRideRequest.state === RideRequestState.Finished
+      this.currentRideRequest.state === RideRequestState.Finished ||
+      this.currentRideRequest.state === RideRequestState.Cancelled ||
+      this.currentRideRequest.state === RideRequestState.Expired
     );
   }
 
@@ -101,6 +103,7 @@ export class SimRider extends SimRunner {
       [
         RideRequestState.Available,
         RideRequestState.Accepted,
+        RideRequestState.DriverArrived,
         RideRequestState.InProgress,
       ].includes(x.state)
     );
@@ -3,66 +3,31 @@ import { BackendApiClient } from "./api-client";
 import { setTimeout } from "timers/promises";
 import { User } from "firebase/auth";
 
-export interface DirectionsV1 {
-  bbox: number[];
-  routes: Route[];
-  metadata: Metadata;
-}
-
-export interface Route {
-  summary: Summary;
-  segments: Segment[];
-  bbox: number[];
-  geometry: string;
-  way_points: number[];
-  legs: any[];
-}
-
-export interface Summary {
+export interface Directions {
+  provider: string;
   distance: number;
   duration: number;
+  /** [lat, lng] pairs */
+  coordinates: number[][];
+  legs: DirectionsLeg[];
 }
 
-export interface Segment {
+export interface DirectionsLeg {
   distance: number;
   duration: number;
-  steps: Step[];
+  steps: DirectionsStep[];
 }
 
-export interface Step {
+export interface DirectionsStep {
   distance: number;
   duration: number;
   type: number;
   instruction: string;
   name: string;
-  way_points: number[];
-  maneuver: Maneuver;
-}
-
-export interface Maneuver {
-  location: number[];
-  bearing_before: number;
-  bearing_after: number;
-}
-
-export interface Metadata {
-  attribution: string;
-  service: string;
-  timestamp: number;
-  query: Query;
-  engine: Engine;
-}
-
-export interface Query {
-  coordinates: number[][];
-  profile: string;
-  format: string;
-}
-
-export interface Engine {
-  version: string;
-  build_date: string;
-  graph_date: string;
+  wayPoints: number[];
+  location: number[] | null;
+  bearingBefore: number;
+  bearingAfter: number;
 }
 
 export interface OSMSearchResult {
@@ -167,6 +132,10 @@ export enum RideRequestState {
   Accepted,
   InProgress,
   Finished,
+  DriverArrived,
+  Cancelled,
+  Expired,
+  Scheduled,
 }
 
 export interface BackendUser {